@@ -206,4 +206,8 @@ const (
 	TopUpStatusPending = "pending"
 	TopUpStatusSuccess = "success"
 	TopUpStatusExpired = "expired"
+	// 部分退款后订单仍视为已支付，全额退款后标记为 refunded
+	TopUpStatusPartiallyRefunded = "partially_refunded"
+	TopUpStatusRefunded          = "refunded"
+	TopUpStatusDisputed          = "disputed"
 )
@@ -18,13 +18,20 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+	RotateSecret = flag.Bool("rotate-secrets", false, "re-encrypt stored secrets with the current SECRET_ENCRYPTION_KEY and exit")
+
+	ExportConfigFile = flag.String("export-config", "", "export channels, options, vendors, models and prefill groups to the given YAML/JSON file (\"-\" for stdout) and exit")
+	ImportConfigFile = flag.String("import-config", "", "import the given YAML/JSON config document and exit")
+	ConfigDryRun     = flag.Bool("config-dry-run", false, "with --import-config, only print the changes without applying them")
+	ConfigPrune      = flag.Bool("config-prune", false, "with --import-config, delete channels, vendors, models and prefill groups missing from the document")
+	ConfigKeys       = flag.String("config-keys", "omit", "with --export-config, how to export channel keys and secret options: omit, plain or encrypted")
 )
 
 func printHelp() {
 	fmt.Println("NewAPI(Based OneAPI) " + Version + " - The next-generation LLM gateway and AI asset management system supports multiple languages.")
 	fmt.Println("Original Project: OneAPI by JustSong - https://github.com/songquanpeng/one-api")
 	fmt.Println("Maintainer: QuantumNous - https://github.com/QuantumNous/new-api")
-	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--rotate-secrets] [--export-config <file>] [--import-config <file> [--config-dry-run] [--config-prune]] [--version] [--help]")
 }
 
 func InitEnv() {
@@ -60,6 +67,7 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	InitSecretEncryption()
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 信封加密：每条记录随机生成数据密钥（DEK）加密内容，DEK 再由主密钥加密后与密文一起保存。
+// 密文格式：enc:v1:{主密钥ID}:{base64(加密后的DEK)}:{base64(密文)}
+const secretCipherPrefix = "enc:v1:"
+
+var (
+	secretMasterKey   []byte
+	secretMasterKeyId string
+	// 轮换期间仍可用于解密的旧主密钥，按主密钥ID索引
+	secretFallbackKeys = map[string][]byte{}
+)
+
+var ErrSecretKeyNotFound = errors.New("secret master key not found, check SECRET_ENCRYPTION_KEY / SECRET_ENCRYPTION_OLD_KEYS")
+
+// InitSecretEncryption 从环境变量 SECRET_ENCRYPTION_KEY 或 SECRET_ENCRYPTION_KEY_FILE 指定的文件加载主密钥，
+// SECRET_ENCRYPTION_OLD_KEYS 为逗号分隔的旧主密钥，用于密钥轮换。未配置主密钥时不加密，保持明文存储。
+func InitSecretEncryption() {
+	material := os.Getenv("SECRET_ENCRYPTION_KEY")
+	if material == "" {
+		if path := os.Getenv("SECRET_ENCRYPTION_KEY_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				FatalLog("failed to read SECRET_ENCRYPTION_KEY_FILE: " + err.Error())
+			}
+			material = strings.TrimSpace(string(data))
+		}
+	}
+	if material != "" {
+		secretMasterKey = deriveSecretKey(material)
+		secretMasterKeyId = secretKeyId(secretMasterKey)
+		secretFallbackKeys[secretMasterKeyId] = secretMasterKey
+		SysLog("secret encryption enabled, master key id: " + secretMasterKeyId)
+	}
+	for _, old := range strings.Split(os.Getenv("SECRET_ENCRYPTION_OLD_KEYS"), ",") {
+		old = strings.TrimSpace(old)
+		if old == "" {
+			continue
+		}
+		key := deriveSecretKey(old)
+		secretFallbackKeys[secretKeyId(key)] = key
+	}
+}
+
+// deriveSecretKey 接受 32 字节的 base64 / hex 密钥，其他内容按口令处理并通过 SHA-256 派生
+func deriveSecretKey(material string) []byte {
+	if key, err := base64.StdEncoding.DecodeString(material); err == nil && len(key) == 32 {
+		return key
+	}
+	if key, err := hex.DecodeString(material); err == nil && len(key) == 32 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(material))
+	return sum[:]
+}
+
+func secretKeyId(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func SecretEncryptionEnabled() bool {
+	return secretMasterKey != nil
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretCipherPrefix)
+}
+
+// SecretNeedsRotation 判断值是否需要用当前主密钥重新加密：明文或由旧主密钥加密
+func SecretNeedsRotation(value string) bool {
+	if !SecretEncryptionEnabled() || value == "" {
+		return false
+	}
+	if !IsEncryptedSecret(value) {
+		return true
+	}
+	return !strings.HasPrefix(value, secretCipherPrefix+secretMasterKeyId+":")
+}
+
+// EncryptSecret 加密敏感字段，未启用加密或值为空时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if !SecretEncryptionEnabled() || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealSecret(secretMasterKey, dataKey, []byte(secretMasterKeyId))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealSecret(dataKey, []byte(plaintext), []byte(secretMasterKeyId))
+	if err != nil {
+		return "", err
+	}
+	return secretCipherPrefix + secretMasterKeyId + ":" +
+		base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptSecret 解密敏感字段，未加密的历史数据原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, secretCipherPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted secret format")
+	}
+	masterKey, ok := secretFallbackKeys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: key id %s", ErrSecretKeyNotFound, parts[0])
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := openSecret(masterKey, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openSecret(dataKey, ciphertext, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func sealSecret(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openSecret(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted secret is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+}
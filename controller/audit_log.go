@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseAuditLogQuery(c *gin.Context) *model.AuditLogQuery {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return &model.AuditLogQuery{
+		UserId:         userId,
+		Username:       c.Query("username"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	logs, total, err := model.GetAuditLogs(parseAuditLogQuery(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ExportAuditLogs 以 CSV 格式导出审计日志，筛选参数与 GetAuditLogs 相同
+func ExportAuditLogs(c *gin.Context) {
+	query := parseAuditLogQuery(c)
+	filename := fmt.Sprintf("audit_logs_%s.csv", time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	// UTF-8 BOM，避免 Excel 打开时中文乱码
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "time", "user_id", "username", "ip", "auth_method", "credential_id",
+		"action", "target_type", "target_id", "before", "after", "diff"})
+	err := model.IterateAuditLogs(query, func(logs []*model.AuditLog) error {
+		for _, log := range logs {
+			record := []string{
+				strconv.Itoa(log.Id),
+				time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+				strconv.Itoa(log.UserId),
+				log.Username,
+				log.Ip,
+				log.AuthMethod,
+				log.CredentialId,
+				log.Action,
+				log.TargetType,
+				log.TargetId,
+				log.Before,
+				log.After,
+				log.Diff,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	writer.Flush()
+	if err != nil {
+		common.SysLog("failed to export audit logs: " + err.Error())
+	}
+}
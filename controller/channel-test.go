@@ -30,6 +30,7 @@ import (
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
 
 	"github.com/gin-gonic/gin"
 )
@@ -38,19 +39,32 @@ type testResult struct {
 	context     *gin.Context
 	localErr    error
 	newAPIError *types.NewAPIError
+	output      string // 模型输出文本，无法提取时为原始响应
+}
+
+// channelTestOptions 自定义测试请求的提示词、流式模式与最大输出 token，用于合成健康探测
+type channelTestOptions struct {
+	Stream    bool
+	Prompt    string
+	MaxTokens int
+}
+
+var unsupportedTestChannelTypes = []int{
+	constant.ChannelTypeMidjourney,
+	constant.ChannelTypeMidjourneyPlus,
+	constant.ChannelTypeSunoAPI,
+	constant.ChannelTypeKling,
+	constant.ChannelTypeJimeng,
+	constant.ChannelTypeDoubaoVideo,
+	constant.ChannelTypeVidu,
 }
 
 func testChannel(channel *model.Channel, testModel string, endpointType string) testResult {
+	return testChannelWithOptions(channel, testModel, endpointType, nil)
+}
+
+func testChannelWithOptions(channel *model.Channel, testModel string, endpointType string, options *channelTestOptions) testResult {
 	tik := time.Now()
-	var unsupportedTestChannelTypes = []int{
-		constant.ChannelTypeMidjourney,
-		constant.ChannelTypeMidjourneyPlus,
-		constant.ChannelTypeSunoAPI,
-		constant.ChannelTypeKling,
-		constant.ChannelTypeJimeng,
-		constant.ChannelTypeDoubaoVideo,
-		constant.ChannelTypeVidu,
-	}
 	if lo.Contains(unsupportedTestChannelTypes, channel.Type) {
 		channelTypeName := constant.GetChannelTypeName(channel.Type)
 		return testResult{
@@ -122,6 +136,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	group, _ := model.GetUserGroup(1, false)
 	c.Set("group", group)
 
+	common.SetContextKey(c, constant.ContextKeyChannelSkipSlot, true)
 	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, testModel)
 	if newAPIError != nil {
 		return testResult{
@@ -177,6 +192,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	}
 
 	request := buildTestRequest(testModel, endpointType)
+	applyTestOptions(request, options)
 
 	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
 
@@ -386,7 +402,103 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 		context:     c,
 		localErr:    nil,
 		newAPIError: nil,
+		output:      extractTestOutput(respBody),
+	}
+}
+
+// applyTestOptions 将自定义选项应用到对话类测试请求
+func applyTestOptions(request dto.Request, options *channelTestOptions) {
+	if options == nil {
+		return
+	}
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		r.Stream = options.Stream
+		if options.Prompt != "" {
+			r.Messages = []dto.Message{
+				{
+					Role:    "user",
+					Content: options.Prompt,
+				},
+			}
+		}
+		if options.MaxTokens > 0 {
+			if r.MaxCompletionTokens > 0 {
+				r.MaxCompletionTokens = uint(options.MaxTokens)
+			} else {
+				r.MaxTokens = uint(options.MaxTokens)
+			}
+		}
+	case *dto.OpenAIResponsesRequest:
+		r.Stream = options.Stream
+		if options.Prompt != "" {
+			input, _ := common.Marshal(options.Prompt)
+			r.Input = input
+		}
+		if options.MaxTokens > 0 {
+			r.MaxOutputTokens = uint(options.MaxTokens)
+		}
+	}
+}
+
+// testOutputPaths 各格式响应（含流式分片）中模型输出文本所在的路径
+var testOutputPaths = []string{
+	"choices.#.message.content",
+	"choices.#.delta.content",
+	"choices.#.text",
+	"content.#.text",
+	"delta.text",
+	"candidates.#.content.parts.#.text",
+	"output.#.content.#.text",
+}
+
+func collectTestOutput(sb *strings.Builder, result gjson.Result) {
+	if result.IsArray() {
+		result.ForEach(func(_, value gjson.Result) bool {
+			collectTestOutput(sb, value)
+			return true
+		})
+		return
+	}
+	if result.Type == gjson.String {
+		sb.WriteString(result.Str)
+	}
+}
+
+// extractTestOutput 从 OpenAI、Claude、Gemini 与 Responses 格式的流式或非流式响应中提取输出文本，
+// 无法提取时（如 embedding、图像）返回原始响应
+func extractTestOutput(body []byte) string {
+	var sb strings.Builder
+	appendChunk := func(data []byte) {
+		chunk := gjson.ParseBytes(data)
+		if chunk.Get("type").String() == "response.output_text.delta" {
+			sb.WriteString(chunk.Get("delta").String())
+			return
+		}
+		for _, path := range testOutputPaths {
+			collectTestOutput(&sb, chunk.Get(path))
+		}
+	}
+	isStream := false
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		isStream = true
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		appendChunk([]byte(data))
+	}
+	if !isStream && gjson.ValidBytes(body) {
+		appendChunk(body)
+	}
+	if sb.Len() == 0 {
+		return string(body)
 	}
+	return sb.String()
 }
 
 func buildTestRequest(model string, endpointType string) dto.Request {
@@ -237,7 +237,7 @@ func FetchUpstreamModels(c *gin.Context) {
 	}
 
 	// 获取用于请求的可用密钥（多密钥渠道优先使用启用状态的密钥）
-	key, _, apiErr := channel.GetNextEnabledKey()
+	key, _, apiErr := channel.GetNextEnabledKey("")
 	if apiErr != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -494,6 +494,10 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
 
+	if err := model.ValidateChannelLimits(channel.GetOtherSettings()); err != nil {
+		return fmt.Errorf("渠道用量限制设置错误：%s", err.Error())
+	}
+
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
 		if channel == nil || channel.Key == "" {
@@ -658,6 +662,9 @@ func AddChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	for i := range channels {
+		service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetChannel, channels[i].Id, nil, channels[i])
+	}
 	service.ResetProxyClientCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -668,12 +675,14 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	originChannel, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetChannel, id, originChannel, nil)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -688,6 +697,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetChannel, "disabled", gin.H{"deleted_count": rows}, nil)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -724,6 +734,7 @@ func DisableTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, "tag:"+channelTag.Tag, nil, gin.H{"status": common.ChannelStatusManuallyDisabled})
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -747,6 +758,7 @@ func EnableTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, "tag:"+channelTag.Tag, nil, gin.H{"status": common.ChannelStatusEnabled})
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -799,6 +811,7 @@ func EditTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, "tag:"+channelTag.Tag, nil, channelTag)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -827,6 +840,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetChannel, "batch", gin.H{"ids": channelBatch.Ids}, nil)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -877,6 +891,7 @@ func UpdateChannel(c *gin.Context) {
 	}
 
 	// 处理多key模式下的密钥追加/覆盖逻辑
+	keysReplaced := false
 	if channel.KeyMode != nil && channel.ChannelInfo.IsMultiKey {
 		switch *channel.KeyMode {
 		case "append":
@@ -935,7 +950,11 @@ func UpdateChannel(c *gin.Context) {
 				}
 			}
 		case "replace":
-			// 覆盖模式：直接使用新密钥（默认行为，不需要特殊处理）
+			// 覆盖模式：直接使用新密钥，原有 Key 的配置与统计不再适用
+			if channel.Key != "" {
+				channel.ChannelInfo.MultiKeySettings = nil
+				keysReplaced = true
+			}
 		}
 	}
 	err = channel.Update()
@@ -943,6 +962,14 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if keysReplaced {
+		if err := model.ResetChannelKeyStats(channel.Id, originChannel.GetKeys()); err != nil {
+			common.SysLog(fmt.Sprintf("failed to reset channel key stats: channel_id=%d, error=%v", channel.Id, err))
+		}
+	}
+	if updatedChannel, err := model.GetChannelById(channel.Id, true); err == nil {
+		service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, channel.Id, originChannel, updatedChannel)
+	}
 	model.InitChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
@@ -1051,6 +1078,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, "batch", nil, channelBatch)
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1142,23 +1170,35 @@ func CopyChannel(c *gin.Context) {
 	}
 
 	// insert
-	if err := model.BatchInsertChannels([]model.Channel{clone}); err != nil {
+	clones := []model.Channel{clone}
+	if err := model.BatchInsertChannels(clones); err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
 	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetChannel, clones[0].Id, nil, clones[0])
 	model.InitChannelCache()
 	// success
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"id": clone.Id}})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"id": clones[0].Id}})
 }
 
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
 	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
-	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
+	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status", "update_key_setting", "reset_key_stats", "import_keys"
+	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, delete_key, update_key_setting and reset_key_stats actions
 	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
 	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
 	Status    *int   `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+
+	KeySetting *model.MultiKeySetting `json:"key_setting,omitempty"` // for update_key_setting, nil clears the setting
+	Keys       []MultiKeyExportItem   `json:"keys,omitempty"`        // for import_keys
+}
+
+// MultiKeyExportItem represents a key with its status and setting for bulk import/export
+type MultiKeyExportItem struct {
+	Key    string `json:"key"`
+	Status int    `json:"status,omitempty"` // 1: enabled, 2: manual disabled, 3: auto disabled
+	model.MultiKeySetting
 }
 
 // MultiKeyStatusResponse represents the response for key status query
@@ -1180,6 +1220,9 @@ type KeyStatus struct {
 	DisabledTime int64  `json:"disabled_time,omitempty"`
 	Reason       string `json:"reason,omitempty"`
 	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+
+	Setting *model.MultiKeySetting `json:"setting,omitempty"` // weight, allowed models and endpoint overrides
+	Stats   model.ChannelKeyStats  `json:"stats"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1212,6 +1255,18 @@ func ManageMultiKeys(c *gin.Context) {
 	lock.Lock()
 	defer lock.Unlock()
 
+	if request.Action != "get_key_status" {
+		// 深拷贝变更前的渠道，操作结束后与数据库中的最新状态对比，未发生变化时不会产生审计记录
+		var originChannel model.Channel
+		if data, err := common.Marshal(channel); err == nil && common.Unmarshal(data, &originChannel) == nil {
+			defer func() {
+				if updatedChannel, err := model.GetChannelById(channel.Id, true); err == nil {
+					service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, channel.Id, originChannel, updatedChannel)
+				}
+			}()
+		}
+	}
+
 	switch request.Action {
 	case "get_key_status":
 		keys := channel.GetKeys()
@@ -1273,6 +1328,7 @@ func ManageMultiKeys(c *gin.Context) {
 				DisabledTime: disabledTime,
 				Reason:       reason,
 				KeyPreview:   keyPreview,
+				Setting:      channel.GetKeySetting(i),
 			})
 		}
 
@@ -1310,6 +1366,10 @@ func ManageMultiKeys(c *gin.Context) {
 		if start < filteredTotal {
 			pageKeyStatusList = filteredKeyStatusList[start:end]
 		}
+		// Only load stats for keys on the current page
+		for i := range pageKeyStatusList {
+			pageKeyStatusList[i].Stats = model.GetChannelKeyStats(channel.Id, keys[pageKeyStatusList[i].Index])
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -1506,6 +1566,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newKeySettings = make(map[int]*model.MultiKeySetting)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1532,6 +1593,9 @@ func ManageMultiKeys(c *gin.Context) {
 					newDisabledReason[newIndex] = r
 				}
 			}
+			if setting := channel.GetKeySetting(i); setting != nil {
+				newKeySettings[newIndex] = setting
+			}
 			newIndex++
 		}
 
@@ -1549,6 +1613,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeySettings = newKeySettings
 
 		err = channel.Update()
 		if err != nil {
@@ -1570,6 +1635,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newKeySettings = make(map[int]*model.MultiKeySetting)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1599,6 +1665,9 @@ func ManageMultiKeys(c *gin.Context) {
 						}
 					}
 				}
+				if setting := channel.GetKeySetting(i); setting != nil {
+					newKeySettings[newIndex] = setting
+				}
 				newIndex++
 			}
 		}
@@ -1617,6 +1686,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeySettings = newKeySettings
 
 		err = channel.Update()
 		if err != nil {
@@ -1632,6 +1702,158 @@ func ManageMultiKeys(c *gin.Context) {
 		})
 		return
 
+	case "update_key_setting":
+		if request.KeyIndex == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定要设置的密钥索引",
+			})
+			return
+		}
+
+		keyIndex := *request.KeyIndex
+		if keyIndex < 0 || keyIndex >= channel.ChannelInfo.MultiKeySize {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+
+		// key_setting 为空时清除该密钥的配置
+		if request.KeySetting != nil {
+			if err := request.KeySetting.Normalize(); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
+		channel.ChannelInfo.SetKeySetting(keyIndex, request.KeySetting)
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥配置已更新",
+		})
+		return
+
+	case "reset_key_stats":
+		// 未指定索引时清空所有密钥的统计
+		keys := channel.GetKeys()
+		if request.KeyIndex != nil {
+			keyIndex := *request.KeyIndex
+			if keyIndex < 0 || keyIndex >= len(keys) {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "密钥索引超出范围",
+				})
+				return
+			}
+			keys = keys[keyIndex : keyIndex+1]
+		}
+
+		if err := model.ResetChannelKeyStats(channel.Id, keys); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥统计已重置",
+		})
+		return
+
+	case "import_keys":
+		if len(request.Keys) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定要导入的密钥",
+			})
+			return
+		}
+
+		keys := channel.GetKeys()
+		existingKeys := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			existingKeys[key] = true
+		}
+		if channel.ChannelInfo.MultiKeyStatusList == nil {
+			channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
+		}
+		if channel.ChannelInfo.MultiKeyDisabledTime == nil {
+			channel.ChannelInfo.MultiKeyDisabledTime = make(map[int]int64)
+		}
+
+		var importedCount, skippedCount int
+		now := common.GetTimestamp()
+		for _, item := range request.Keys {
+			key := strings.TrimSpace(item.Key)
+			// 跳过空密钥与已存在的密钥
+			if key == "" || existingKeys[key] {
+				skippedCount++
+				continue
+			}
+			if strings.Contains(key, "\n") {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "密钥不能包含换行符",
+				})
+				return
+			}
+			if item.Status < 0 || item.Status > 3 {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无效的密钥状态",
+				})
+				return
+			}
+			setting := item.MultiKeySetting
+			if err := setting.Normalize(); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+
+			keyIndex := len(keys)
+			keys = append(keys, key)
+			existingKeys[key] = true
+			if item.Status > 1 {
+				channel.ChannelInfo.MultiKeyStatusList[keyIndex] = item.Status
+				channel.ChannelInfo.MultiKeyDisabledTime[keyIndex] = now
+			}
+			channel.ChannelInfo.SetKeySetting(keyIndex, &setting)
+			importedCount++
+		}
+
+		if importedCount == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "没有可导入的新密钥",
+			})
+			return
+		}
+
+		channel.Key = strings.Join(keys, "\n")
+		channel.ChannelInfo.MultiKeySize = len(keys)
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": fmt.Sprintf("已导入 %d 个密钥，跳过 %d 个重复或空密钥", importedCount, skippedCount),
+			"data":    importedCount,
+		})
+		return
+
 	default:
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -1640,3 +1862,50 @@ func ManageMultiKeys(c *gin.Context) {
 		return
 	}
 }
+
+// ExportMultiKeys exports all keys of a multi-key channel with their status and setting
+func ExportMultiKeys(c *gin.Context) {
+	request := MultiKeyManageRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	channel, err := model.GetChannelById(request.ChannelId, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "渠道不存在",
+		})
+		return
+	}
+
+	if !channel.ChannelInfo.IsMultiKey {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该渠道不是多密钥模式",
+		})
+		return
+	}
+
+	keys := channel.GetKeys()
+	items := make([]MultiKeyExportItem, 0, len(keys))
+	for i, key := range keys {
+		item := MultiKeyExportItem{Key: key, Status: 1}
+		if status, exists := channel.ChannelInfo.MultiKeyStatusList[i]; exists {
+			item.Status = status
+		}
+		if setting := channel.GetKeySetting(i); setting != nil {
+			item.MultiKeySetting = *setting
+		}
+		items = append(items, item)
+	}
+
+	// 导出明文密钥属于敏感操作，记录审计日志
+	service.RecordAudit(c, model.AuditActionExport, model.AuditTargetChannel, channel.Id, nil, gin.H{"key_count": len(items)})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    items,
+	})
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelUsageLimit 查询渠道当前周期的用量、上限与可调度状态
+func GetChannelUsageLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.CacheGetChannel(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.GetChannelLimitStatus(channel))
+}
+
+// ResetChannelUsageLimit 清除渠道当前周期的用量计数，立即恢复调度
+func ResetChannelUsageLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.CacheGetChannel(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	before := model.GetChannelLimitStatus(channel)
+	model.ResetChannelUsage(channel)
+	after := model.GetChannelLimitStatus(channel)
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetChannel, id, before, after)
+	common.ApiSuccess(c, after)
+}
+
+// GetChannelUpstreamRateLimit 查询渠道各 Key 最近一次上报的上游限流状态
+func GetChannelUpstreamRateLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.CacheGetChannel(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.GetChannelUpstreamRateLimits(channel))
+}
+
+// GetChannelQueue 查询本节点的渠道排队深度与在途请求数
+func GetChannelQueue(c *gin.Context) {
+	common.ApiSuccess(c, model.GetChannelQueueStats())
+}
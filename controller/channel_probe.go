@@ -0,0 +1,372 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const defaultProbeIntervalMinutes = 5
+
+var (
+	probeLock      sync.Mutex
+	probeLastRun   = make(map[string]int64) // 探测用例名称 -> 上次执行时间
+	probeRunning   = make(map[string]bool)
+	probeSloBreach = make(map[string]bool) // 探测用例|渠道|模型 -> 是否处于 SLO 违约状态
+)
+
+// checkProbeAssertion 检查探测输出与耗时是否满足断言
+func checkProbeAssertion(assertion operation_setting.HealthProbeAssertion, output string, latencyMs int64) error {
+	if assertion.MaxLatencyMs > 0 && latencyMs > assertion.MaxLatencyMs {
+		return fmt.Errorf("latency %dms exceeds %dms", latencyMs, assertion.MaxLatencyMs)
+	}
+	if assertion.MinLength > 0 && len([]rune(strings.TrimSpace(output))) < assertion.MinLength {
+		return fmt.Errorf("output length is less than %d", assertion.MinLength)
+	}
+	if assertion.Contains != "" && !strings.Contains(strings.ToLower(output), strings.ToLower(assertion.Contains)) {
+		return fmt.Errorf("output does not contain %q", assertion.Contains)
+	}
+	if assertion.Regex != "" {
+		re, err := regexp.Compile(assertion.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid assertion regex: %w", err)
+		}
+		if !re.MatchString(output) {
+			return fmt.Errorf("output does not match %q", assertion.Regex)
+		}
+	}
+	return nil
+}
+
+// getProbeChannels 返回探测用例需要探测的渠道，未指定渠道时选择所有启用且支持该模型的渠道，跳过不支持测试的任务类渠道
+func getProbeChannels(probe operation_setting.HealthProbe) ([]*model.Channel, error) {
+	var channels []*model.Channel
+	if len(probe.ChannelIds) > 0 {
+		for _, id := range probe.ChannelIds {
+			channel, err := model.GetChannelById(id, true)
+			if err != nil {
+				common.SysLog(fmt.Sprintf("health probe %s: channel #%d not found", probe.Name, id))
+				continue
+			}
+			channels = append(channels, channel)
+		}
+	} else {
+		all, err := model.GetAllChannels(0, 0, true, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range all {
+			if channel.Status == common.ChannelStatusEnabled && lo.Contains(channel.GetModels(), probe.Model) {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	return lo.Filter(channels, func(channel *model.Channel, _ int) bool {
+		return !lo.Contains(unsupportedTestChannelTypes, channel.Type)
+	}), nil
+}
+
+// runHealthProbe 对探测用例的所有渠道执行一次探测并记录结果
+func runHealthProbe(probe operation_setting.HealthProbe) ([]*model.ChannelProbeResult, error) {
+	channels, err := getProbeChannels(probe)
+	if err != nil {
+		return nil, err
+	}
+	options := &channelTestOptions{
+		Stream:    probe.Stream,
+		Prompt:    probe.Prompt,
+		MaxTokens: probe.MaxTokens,
+	}
+	results := make([]*model.ChannelProbeResult, 0, len(channels))
+	for _, channel := range channels {
+		tik := time.Now()
+		result := testChannelWithOptions(channel, probe.Model, probe.EndpointType, options)
+		latency := time.Since(tik).Milliseconds()
+
+		var probeErr error
+		if result.newAPIError != nil {
+			probeErr = result.newAPIError
+		} else if result.localErr != nil {
+			probeErr = result.localErr
+		} else {
+			probeErr = checkProbeAssertion(probe.Assertion, result.output, latency)
+		}
+		probeResult := &model.ChannelProbeResult{
+			CreatedAt:    common.GetTimestamp(),
+			ChannelId:    channel.Id,
+			ModelName:    probe.Model,
+			ProbeName:    probe.Name,
+			EndpointType: probe.EndpointType,
+			IsStream:     probe.Stream,
+			Success:      probeErr == nil,
+			LatencyMs:    latency,
+		}
+		if probeErr != nil {
+			probeResult.Message = probeErr.Error()
+		}
+		if err := model.InsertChannelProbeResult(probeResult); err != nil {
+			common.SysLog(fmt.Sprintf("failed to record health probe result: %s", err.Error()))
+		}
+		model.RecordModelProbeStatus(probe.Model, probeResult.Success)
+		results = append(results, probeResult)
+		time.Sleep(common.RequestInterval)
+	}
+	return results, nil
+}
+
+// ChannelProbeSloStatus 探测用例在某渠道与模型上的 SLO 达成情况
+type ChannelProbeSloStatus struct {
+	*model.ChannelProbeSummary
+	ProbeName          string  `json:"probe_name"`
+	ChannelName        string  `json:"channel_name"`
+	UptimeTarget       float64 `json:"uptime_target"`
+	LatencyP95TargetMs int64   `json:"latency_p95_target_ms"`
+	SloBreached        bool    `json:"slo_breached"`
+	SloReason          string  `json:"slo_reason,omitempty"`
+}
+
+// evaluateProbeSlo 判断统计窗口内的可用率与 P95 延迟是否满足 SLO，样本不足时视为满足
+func evaluateProbeSlo(probe operation_setting.HealthProbe, summary *model.ChannelProbeSummary) (bool, string) {
+	if summary.Total < operation_setting.GetHealthProbeSetting().MinSloSamples {
+		return false, ""
+	}
+	var reasons []string
+	if target := probe.GetUptimeTarget(); target > 0 && summary.Uptime < target {
+		reasons = append(reasons, fmt.Sprintf("可用率 %.2f%% 低于目标 %.2f%%", summary.Uptime, target))
+	}
+	if target := probe.GetLatencyP95TargetMs(); target > 0 && summary.Success > 0 && summary.P95LatencyMs > target {
+		reasons = append(reasons, fmt.Sprintf("P95 延迟 %dms 高于目标 %dms", summary.P95LatencyMs, target))
+	}
+	return len(reasons) > 0, strings.Join(reasons, "，")
+}
+
+// getProbeSloStatuses 统计探测用例在 SLO 窗口内各渠道的达成情况
+func getProbeSloStatuses(probe operation_setting.HealthProbe, channelId int, windowHours int) ([]*ChannelProbeSloStatus, error) {
+	summaries, err := model.GetChannelProbeSummaries(&model.ChannelProbeQuery{
+		ChannelId:      channelId,
+		ProbeName:      probe.Name,
+		StartTimestamp: common.GetTimestamp() - int64(windowHours)*3600,
+	})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*ChannelProbeSloStatus, 0, len(summaries))
+	for _, summary := range summaries {
+		status := &ChannelProbeSloStatus{
+			ChannelProbeSummary: summary,
+			ProbeName:           probe.Name,
+			UptimeTarget:        probe.GetUptimeTarget(),
+			LatencyP95TargetMs:  probe.GetLatencyP95TargetMs(),
+		}
+		status.SloBreached, status.SloReason = evaluateProbeSlo(probe, summary)
+		if channel, err := model.CacheGetChannel(summary.ChannelId); err == nil {
+			status.ChannelName = channel.Name
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func getSloWindowHours() int {
+	hours := operation_setting.GetHealthProbeSetting().SloWindowHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return hours
+}
+
+// checkProbeSlo 在 SLO 违约与恢复时通知管理员
+func checkProbeSlo(probe operation_setting.HealthProbe) {
+	windowHours := getSloWindowHours()
+	statuses, err := getProbeSloStatuses(probe, 0, windowHours)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to evaluate health probe slo: %s", err.Error()))
+		return
+	}
+	for _, status := range statuses {
+		key := fmt.Sprintf("%s|%d|%s", probe.Name, status.ChannelId, status.ModelName)
+		probeLock.Lock()
+		changed := probeSloBreach[key] != status.SloBreached
+		probeSloBreach[key] = status.SloBreached
+		probeLock.Unlock()
+		if !changed || !operation_setting.GetHealthProbeSetting().NotifyOnBreach {
+			continue
+		}
+		var subject, content string
+		if status.SloBreached {
+			subject = fmt.Sprintf("渠道「%s」（#%d）模型 %s 未达到 SLO", status.ChannelName, status.ChannelId, status.ModelName)
+			content = fmt.Sprintf("探测用例 %s 在最近 %d 小时内%s（样本 %d 个）", probe.Name, windowHours, status.SloReason, status.Total)
+		} else {
+			subject = fmt.Sprintf("渠道「%s」（#%d）模型 %s 已恢复 SLO", status.ChannelName, status.ChannelId, status.ModelName)
+			content = fmt.Sprintf("探测用例 %s 在最近 %d 小时内可用率 %.2f%%，P95 延迟 %dms", probe.Name, windowHours, status.Uptime, status.P95LatencyMs)
+		}
+		service.NotifyRootUser(dto.NotifyTypeChannelSlo, subject, content)
+	}
+}
+
+// startHealthProbe 在后台执行探测用例，同一用例不会并发执行
+func startHealthProbe(probe operation_setting.HealthProbe) bool {
+	probeLock.Lock()
+	if probeRunning[probe.Name] {
+		probeLock.Unlock()
+		return false
+	}
+	probeRunning[probe.Name] = true
+	probeLastRun[probe.Name] = common.GetTimestamp()
+	probeLock.Unlock()
+
+	gopool.Go(func() {
+		defer func() {
+			probeLock.Lock()
+			delete(probeRunning, probe.Name)
+			probeLock.Unlock()
+		}()
+		if _, err := runHealthProbe(probe); err != nil {
+			common.SysLog(fmt.Sprintf("health probe %s failed: %s", probe.Name, err.Error()))
+			return
+		}
+		checkProbeSlo(probe)
+	})
+	return true
+}
+
+func isProbeDue(probe operation_setting.HealthProbe, now int64) bool {
+	interval := probe.IntervalMinutes
+	if interval <= 0 {
+		interval = defaultProbeIntervalMinutes
+	}
+	probeLock.Lock()
+	defer probeLock.Unlock()
+	return now-probeLastRun[probe.Name] >= int64(interval)*60
+}
+
+var autoProbeChannelsOnce sync.Once
+
+// AutomaticallyProbeChannels 按探测用例各自的间隔定时探测渠道，并定期清理过期的探测结果
+func AutomaticallyProbeChannels() {
+	// 只在Master节点执行探测
+	if !common.IsMasterNode {
+		return
+	}
+	autoProbeChannelsOnce.Do(func() {
+		var lastCleanup int64
+		for {
+			time.Sleep(1 * time.Minute)
+			setting := operation_setting.GetHealthProbeSetting()
+			if !setting.Enabled {
+				continue
+			}
+			now := common.GetTimestamp()
+			for _, probe := range setting.Probes {
+				if probe.Name == "" || probe.Model == "" || !isProbeDue(probe, now) {
+					continue
+				}
+				startHealthProbe(probe)
+			}
+			if setting.RetentionDays > 0 && now-lastCleanup >= 3600 {
+				lastCleanup = now
+				deleted, err := model.DeleteChannelProbeResultsBefore(now - int64(setting.RetentionDays)*86400)
+				if err != nil {
+					common.SysLog(fmt.Sprintf("failed to clean up health probe results: %s", err.Error()))
+				} else if deleted > 0 {
+					common.SysLog(fmt.Sprintf("cleaned up %d health probe results", deleted))
+				}
+			}
+		}
+	})
+}
+
+func parseChannelProbeQuery(c *gin.Context) *model.ChannelProbeQuery {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return &model.ChannelProbeQuery{
+		ChannelId:      channelId,
+		ModelName:      c.Query("model"),
+		ProbeName:      c.Query("probe"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+// GetChannelProbeResults 分页查询探测结果时间序列
+func GetChannelProbeResults(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	results, total, err := model.GetChannelProbeResults(parseChannelProbeQuery(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(results)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetChannelProbeStats 按渠道与模型汇总探测结果的可用率与延迟分位数，未指定时间范围时使用 SLO 窗口
+func GetChannelProbeStats(c *gin.Context) {
+	query := parseChannelProbeQuery(c)
+	if query.StartTimestamp == 0 {
+		query.StartTimestamp = common.GetTimestamp() - int64(getSloWindowHours())*3600
+	}
+	summaries, err := model.GetChannelProbeSummaries(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, summaries)
+}
+
+// GetChannelProbeSlo 返回各探测用例在 SLO 窗口内的达成情况
+func GetChannelProbeSlo(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	probeName := c.Query("probe")
+	windowHours := getSloWindowHours()
+	statuses := make([]*ChannelProbeSloStatus, 0)
+	for _, probe := range operation_setting.GetHealthProbeSetting().Probes {
+		if probe.Name == "" || (probeName != "" && probe.Name != probeName) {
+			continue
+		}
+		items, err := getProbeSloStatuses(probe, channelId, windowHours)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		statuses = append(statuses, items...)
+	}
+	common.ApiSuccess(c, gin.H{
+		"window_hours": windowHours,
+		"items":        statuses,
+	})
+}
+
+// RunChannelProbe 立即执行指定的探测用例
+func RunChannelProbe(c *gin.Context) {
+	probe, ok := operation_setting.GetHealthProbe(c.Query("probe"))
+	if !ok {
+		common.ApiError(c, errors.New("探测用例不存在"))
+		return
+	}
+	if probe.Model == "" {
+		common.ApiError(c, errors.New("探测用例未配置模型"))
+		return
+	}
+	if !startHealthProbe(probe) {
+		common.ApiError(c, errors.New("探测已在运行中"))
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
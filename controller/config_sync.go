@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportConfig 导出实例配置，format 为 yaml（默认）或 json，keys 为 omit（默认）/ plain / encrypted
+func ExportConfig(c *gin.Context) {
+	format := c.DefaultQuery("format", service.ConfigFormatYAML)
+	if format != service.ConfigFormatYAML && format != service.ConfigFormatJSON {
+		common.ApiErrorMsg(c, "不支持的导出格式")
+		return
+	}
+	keyMode := c.DefaultQuery("keys", model.ConfigKeyModeOmit)
+	if !model.IsValidConfigKeyMode(keyMode) {
+		common.ApiErrorMsg(c, "无效的密钥导出方式")
+		return
+	}
+	doc, err := model.ExportConfigDocument(keyMode)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data, err := service.EncodeConfigDocument(doc, format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionExport, model.AuditTargetConfig, "export", nil, gin.H{
+		"format": format,
+		"keys":   keyMode,
+	})
+
+	contentType := "application/yaml; charset=utf-8"
+	if format == service.ConfigFormatJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	filename := fmt.Sprintf("config_%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConfig 导入配置文档（请求体为 YAML 或 JSON）。dry_run=true 时只返回变更预览，
+// 否则在一个事务中整体应用；prune=true 时删除文档中不存在的渠道、供应商、模型与预填组。
+func ImportConfig(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	prune := c.Query("prune") == "true"
+	data, err := c.GetRawData()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	doc, err := service.DecodeConfigDocument(data)
+	if err != nil {
+		common.ApiErrorMsg(c, "配置文档解析失败: "+err.Error())
+		return
+	}
+	if err := model.PrepareConfigDocument(doc); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan, err := service.PlanConfigImport(doc, prune)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !dryRun && len(plan) > 0 {
+		if err := model.ApplyConfigDocument(doc, prune, c.GetInt("id"), c.GetString("username")); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		service.RecordAudit(c, model.AuditActionImport, model.AuditTargetConfig, "import", nil, gin.H{
+			"prune":   prune,
+			"changes": plan,
+		})
+	}
+	common.ApiSuccess(c, gin.H{
+		"dry_run": dryRun,
+		"changes": plan,
+	})
+}
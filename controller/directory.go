@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+const (
+	directoryProviderLDAP = "ldap"
+	directoryProviderSAML = "saml"
+)
+
+// directoryIdentity 是 LDAP / SAML 登录后得到的外部身份，分组与角色已按映射规则计算好
+type directoryIdentity struct {
+	Provider    string `json:"p"`
+	Id          string `json:"i"`
+	Username    string `json:"u,omitempty"`
+	DisplayName string `json:"d,omitempty"`
+	Email       string `json:"e,omitempty"`
+	Group       string `json:"g,omitempty"` // 为空表示不修改分组
+	SyncRole    bool   `json:"sr,omitempty"`
+	IsAdmin     bool   `json:"a,omitempty"`
+}
+
+// provisionDirectoryUser 查找外部身份对应的用户，不存在时按需创建（JIT），
+// 已存在时在每次登录时重新同步显示名称、分组与角色。
+func provisionDirectoryUser(identity *directoryIdentity) (*model.User, error) {
+	if identity.Id == "" {
+		return nil, errors.New("外部身份标识为空")
+	}
+	user := model.User{}
+	var taken bool
+	switch identity.Provider {
+	case directoryProviderLDAP:
+		user.LdapId = identity.Id
+		taken = model.IsLdapIdAlreadyTaken(identity.Id)
+	case directoryProviderSAML:
+		user.SamlId = identity.Id
+		taken = model.IsSamlIdAlreadyTaken(identity.Id)
+	default:
+		return nil, errors.New("未知的身份来源")
+	}
+
+	if !taken {
+		if !common.RegisterEnabled {
+			return nil, errors.New("管理员关闭了新用户注册")
+		}
+		user.Username = directoryUsername(identity.Provider, identity.Username)
+		user.DisplayName = identity.DisplayName
+		if user.DisplayName == "" {
+			user.DisplayName = strings.ToUpper(identity.Provider) + " User"
+		}
+		if identity.Email != "" && !model.IsEmailAlreadyTaken(identity.Email) {
+			user.Email = identity.Email
+		}
+		if identity.Group != "" {
+			user.Group = identity.Group
+		}
+		if identity.SyncRole && identity.IsAdmin {
+			user.Role = common.RoleAdminUser
+		}
+		if err := user.Insert(0); err != nil {
+			return nil, err
+		}
+		common.SysLog(fmt.Sprintf("%s 用户 %s 首次登录，已自动创建账户 %s", identity.Provider, identity.Id, user.Username))
+		return &user, nil
+	}
+
+	var err error
+	if identity.Provider == directoryProviderLDAP {
+		err = user.FillUserByLdapId()
+	} else {
+		err = user.FillUserBySamlId()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != common.UserStatusEnabled {
+		return &user, nil
+	}
+
+	// 只更新同步的列，避免写回过期的额度
+	updates := map[string]interface{}{}
+	if identity.DisplayName != "" && identity.DisplayName != user.DisplayName {
+		user.DisplayName = identity.DisplayName
+		updates["display_name"] = user.DisplayName
+	}
+	if identity.Group != "" && identity.Group != user.Group {
+		user.Group = identity.Group
+		updates["group"] = user.Group
+	}
+	// 根用户的角色不受目录同步影响
+	if identity.SyncRole && user.Role != common.RoleRootUser {
+		role := common.RoleCommonUser
+		if identity.IsAdmin {
+			role = common.RoleAdminUser
+		}
+		if role != user.Role {
+			user.Role = role
+			updates["role"] = user.Role
+		}
+	}
+	if err := model.UpdateUserColumns(user.Id, updates); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// resolveDirectoryGroup 计算映射后的分组，映射到不存在的分组时忽略并记录日志
+func resolveDirectoryGroup(provider string, group string) string {
+	if group == "" || ratio_setting.ContainsGroupRatio(group) {
+		return group
+	}
+	common.SysLog(fmt.Sprintf("%s 分组映射的目标分组 %s 不存在，已忽略", provider, group))
+	return ""
+}
+
+// directoryUsername 优先使用外部用户名（去掉邮箱域名部分），不可用时生成 {prefix}_{id}
+func directoryUsername(prefix string, preferred string) string {
+	username := preferred
+	if at := strings.Index(username, "@"); at > 0 {
+		username = username[:at]
+	}
+	if username != "" && len(username) <= 20 {
+		if exist, err := model.CheckUserExistOrDeleted(username, ""); err == nil && !exist {
+			return username
+		}
+	}
+	return prefix + "_" + strconv.Itoa(model.GetMaxUserId()+1)
+}
@@ -28,7 +28,8 @@ func GetUserGroups(c *gin.Context) {
 	userGroup := ""
 	userId := c.GetInt("id")
 	userGroup, _ = model.GetUserGroup(userId, false)
-	userUsableGroups := service.GetUserUsableGroups(userGroup)
+	userSetting, _ := model.GetUserSetting(userId, false)
+	userUsableGroups := service.FilterAllowedTokenGroups(service.GetUserUsableGroups(userGroup), userSetting)
 	for groupName, _ := range ratio_setting.GetGroupRatioCopy() {
 		// UserUsableGroups contains the groups that the user can use
 		if desc, ok := userUsableGroups[groupName]; ok {
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetSelfBillingProfile(c *gin.Context) {
+	profile, err := model.GetBillingProfile(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, profile)
+}
+
+func UpdateSelfBillingProfile(c *gin.Context) {
+	var profile model.BillingProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	profile.UserId = c.GetInt("id")
+	if err := model.SaveBillingProfile(&profile); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, profile)
+}
+
+func parseInvoiceQuery(c *gin.Context) *model.InvoiceQuery {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return &model.InvoiceQuery{
+		UserId:         userId,
+		Type:           c.Query("type"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetSelfInvoices(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	query := parseInvoiceQuery(c)
+	query.UserId = c.GetInt("id")
+	invoices, total, err := model.GetInvoices(query, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfInvoiceHTML 下载自己的发票
+func GetSelfInvoiceHTML(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	invoice, err := model.GetInvoiceById(id)
+	if err != nil || invoice.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "发票不存在")
+		return
+	}
+	renderInvoice(c, invoice)
+}
+
+func GetAllInvoices(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(parseInvoiceQuery(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetInvoiceHTML(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	invoice, err := model.GetInvoiceById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	renderInvoice(c, invoice)
+}
+
+func renderInvoice(c *gin.Context, invoice *model.Invoice) {
+	data, err := service.RenderInvoiceHTML(invoice)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.html", invoice.InvoiceNo))
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+}
+
+type CreditNoteRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// CreateCreditNote 管理员为发票开具红字发票（部分或全额退款）
+func CreateCreditNote(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req CreditNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	creditNote, err := model.CreateCreditNote(id, req.Amount, req.Reason)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetInvoice, creditNote.Id, nil, creditNote)
+	common.ApiSuccess(c, creditNote)
+}
+
+// IssueInvoice 管理员为已完成但缺少发票的充值订单补开发票
+func IssueInvoice(c *gin.Context) {
+	invoice, err := model.CreateTopUpInvoice(c.Query("trade_no"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if invoice == nil {
+		common.ApiErrorMsg(c, "未启用发票功能")
+		return
+	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetInvoice, invoice.Id, nil, invoice)
+	common.ApiSuccess(c, invoice)
+}
+
+// ExportInvoices 以 CSV 格式导出发票与红字发票，供财务对账，筛选参数与 GetAllInvoices 相同
+func ExportInvoices(c *gin.Context) {
+	query := parseInvoiceQuery(c)
+	filename := fmt.Sprintf("invoices_%s.csv", time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	// UTF-8 BOM，避免 Excel 打开时中文乱码
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"invoice_no", "type", "date", "user_id", "trade_no", "related_invoice_id", "payment_method",
+		"currency", "subtotal", "tax_rate", "tax_amount", "total", "company_name", "tax_id", "country", "address", "email"})
+	err := model.IterateInvoices(query, func(invoices []*model.Invoice) error {
+		for _, invoice := range invoices {
+			record := []string{
+				invoice.InvoiceNo,
+				invoice.Type,
+				time.Unix(invoice.CreatedTime, 0).Format("2006-01-02"),
+				strconv.Itoa(invoice.UserId),
+				invoice.TradeNo,
+				strconv.Itoa(invoice.RelatedInvoiceId),
+				invoice.PaymentMethod,
+				invoice.Currency,
+				strconv.FormatFloat(invoice.Subtotal, 'f', 2, 64),
+				strconv.FormatFloat(invoice.TaxRate, 'f', -1, 64),
+				strconv.FormatFloat(invoice.TaxAmount, 'f', 2, 64),
+				strconv.FormatFloat(invoice.Total, 'f', 2, 64),
+				invoice.CompanyName,
+				invoice.TaxId,
+				invoice.Country,
+				invoice.Address,
+				invoice.Email,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	writer.Flush()
+	if err != nil {
+		common.SysLog("failed to export invoices: " + err.Error())
+	}
+}
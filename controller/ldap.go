@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+func ldapConnect(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+	conn, err := ldap.DialURL(settings.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+	if settings.StartTLS && strings.HasPrefix(strings.ToLower(settings.URL), "ldap://") {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func ldapAttributeValue(entry *ldap.Entry, attribute string) string {
+	if attribute == "" {
+		return ""
+	}
+	raw := entry.GetRawAttributeValue(attribute)
+	if len(raw) == 0 {
+		return ""
+	}
+	// objectGUID 等二进制属性转为十六进制
+	if !utf8.Valid(raw) {
+		return hex.EncodeToString(raw)
+	}
+	return string(raw)
+}
+
+// authenticateLdapUser 先用服务账号查找用户条目，再以用户自己的 DN 和密码绑定校验
+func authenticateLdapUser(username string, password string) (*directoryIdentity, error) {
+	settings := system_setting.GetLDAPSettings()
+	conn, err := ldapConnect(settings)
+	if err != nil {
+		common.SysLog("LDAP 连接失败：" + err.Error())
+		return nil, errors.New("无法连接至 LDAP 服务器，请稍后重试！")
+	}
+	defer conn.Close()
+
+	if settings.BindDN != "" {
+		err = conn.Bind(settings.BindDN, settings.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		common.SysLog("LDAP 服务账号绑定失败：" + err.Error())
+		return nil, errors.New("LDAP 服务账号绑定失败，请检查设置！")
+	}
+
+	attributes := []string{"dn"}
+	for _, attr := range []string{settings.IdAttribute, settings.UsernameAttribute, settings.DisplayNameAttribute, settings.EmailAttribute, settings.GroupAttribute} {
+		if attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(settings.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil {
+		common.SysLog("LDAP 查找用户失败：" + err.Error())
+		return nil, errors.New("LDAP 查找用户失败，请检查设置！")
+	}
+	if len(result.Entries) != 1 {
+		return nil, errors.New("用户名或密码错误，或用户已被封禁")
+	}
+	entry := result.Entries[0]
+
+	// 用户自身绑定校验密码
+	if err = conn.Bind(entry.DN, password); err != nil {
+		return nil, errors.New("用户名或密码错误，或用户已被封禁")
+	}
+
+	identity := &directoryIdentity{
+		Provider:    directoryProviderLDAP,
+		Id:          entry.DN,
+		Username:    ldapAttributeValue(entry, settings.UsernameAttribute),
+		DisplayName: ldapAttributeValue(entry, settings.DisplayNameAttribute),
+		Email:       ldapAttributeValue(entry, settings.EmailAttribute),
+	}
+	if id := ldapAttributeValue(entry, settings.IdAttribute); id != "" {
+		identity.Id = id
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	var groups []string
+	if settings.GroupAttribute != "" {
+		groups = entry.GetAttributeValues(settings.GroupAttribute)
+	}
+	group, isAdmin := system_setting.ResolveDirectoryGroup(settings.GroupRules, settings.AdminGroups, settings.DefaultGroup, groups)
+	identity.Group = resolveDirectoryGroup(directoryProviderLDAP, group)
+	identity.SyncRole = len(settings.AdminGroups) > 0
+	identity.IsAdmin = isAdmin
+	return identity, nil
+}
+
+func LdapLogin(c *gin.Context) {
+	if !system_setting.GetLDAPSettings().Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "管理员未开启通过 LDAP 登录",
+			"success": false,
+		})
+		return
+	}
+	var loginRequest LoginRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&loginRequest)
+	if err != nil || loginRequest.Username == "" || loginRequest.Password == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	identity, err := authenticateLdapUser(loginRequest.Username, loginRequest.Password)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := provisionDirectoryUser(identity)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+
+	// 与密码登录一致，开启 2FA 的用户需要继续验证
+	if model.IsTwoFAEnabled(user.Id) {
+		session := sessions.Default(c)
+		session.Set("pending_username", user.Username)
+		session.Set("pending_user_id", user.Id)
+		err := session.Save()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "无法保存会话信息，请重试",
+				"success": false,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "请输入两步验证码",
+			"success": true,
+			"data": map[string]interface{}{
+				"require_2fa": true,
+			},
+		})
+		return
+	}
+	setupLogin(user, c)
+}
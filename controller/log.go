@@ -167,3 +167,25 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetMarginReport 按渠道、模型、分组或天汇总收入、上游成本与毛利，group_by 默认为 channel
+func GetMarginReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	tzOffset, _ := strconv.Atoi(c.Query("tz_offset"))
+	items, err := model.GetMarginReport(&model.MarginReportQuery{
+		GroupBy:        c.DefaultQuery("group_by", model.MarginReportByChannel),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ChannelId:      channel,
+		ModelName:      c.Query("model_name"),
+		Group:          c.Query("group"),
+		TzOffset:       tzOffset,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, items)
+}
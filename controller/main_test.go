@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// setupTestDB 为每个测试初始化独立的 SQLite 数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	common.SQLitePath = filepath.Join(t.TempDir(), "controller.db")
+	common.UsingSQLite = true
+	common.IsMasterNode = true
+	common.RedisEnabled = false
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	model.LOG_DB = model.DB
+}
+
+func createTestUser(t *testing.T, quota int) *model.User {
+	t.Helper()
+	user := &model.User{Username: "test_user", Password: "password", Quota: quota, Status: common.UserStatusEnabled, Group: "default"}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
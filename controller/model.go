@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/moonshot"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/gin-gonic/gin"
@@ -140,6 +141,7 @@ func ListModels(c *gin.Context, modelType int) {
 			}
 			if oaiModel, ok := openAIModelsMap[allowModel]; ok {
 				oaiModel.SupportedEndpointTypes = model.GetModelSupportEndpointTypes(allowModel)
+				oaiModel.ModelCapabilities = model.GetModelCapabilities(allowModel)
 				userOpenAiModels = append(userOpenAiModels, oaiModel)
 			} else {
 				userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
@@ -148,6 +150,7 @@ func ListModels(c *gin.Context, modelType int) {
 					Created:                1626777600,
 					OwnedBy:                "custom",
 					SupportedEndpointTypes: model.GetModelSupportEndpointTypes(allowModel),
+					ModelCapabilities:      model.GetModelCapabilities(allowModel),
 				})
 			}
 		}
@@ -179,6 +182,17 @@ func ListModels(c *gin.Context, modelType int) {
 		} else {
 			models = model.GetGroupEnabledModels(group)
 		}
+		// 管理员定义的虚拟模型，请求时按能力解析为实际模型
+		if model_setting.GetAutoRoutingSettings().Enabled {
+			for name := range model_setting.GetAutoRoutingSettings().VirtualModels {
+				userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
+					Id:      name,
+					Object:  "model",
+					Created: 1626777600,
+					OwnedBy: "virtual",
+				})
+			}
+		}
 		for _, modelName := range models {
 			if !acceptUnsetRatioModel {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(modelName)
@@ -188,6 +202,7 @@ func ListModels(c *gin.Context, modelType int) {
 			}
 			if oaiModel, ok := openAIModelsMap[modelName]; ok {
 				oaiModel.SupportedEndpointTypes = model.GetModelSupportEndpointTypes(modelName)
+				oaiModel.ModelCapabilities = model.GetModelCapabilities(modelName)
 				userOpenAiModels = append(userOpenAiModels, oaiModel)
 			} else {
 				userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
@@ -196,6 +211,7 @@ func ListModels(c *gin.Context, modelType int) {
 					Created:                1626777600,
 					OwnedBy:                "custom",
 					SupportedEndpointTypes: model.GetModelSupportEndpointTypes(modelName),
+					ModelCapabilities:      model.GetModelCapabilities(modelName),
 				})
 			}
 		}
@@ -272,6 +288,7 @@ func RetrieveModel(c *gin.Context, modelType int) {
 				Type:        "model",
 			})
 		default:
+			aiModel.ModelCapabilities = model.GetModelCapabilities(modelId)
 			c.JSON(200, aiModel)
 		}
 	} else {
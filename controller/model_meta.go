@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -88,6 +89,10 @@ func CreateModelMeta(c *gin.Context) {
 		common.ApiErrorMsg(c, "模型名称不能为空")
 		return
 	}
+	if err := m.ModelCapabilities.Normalize(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	// 名称冲突检查
 	if dup, err := model.IsModelNameDuplicated(0, m.ModelName); err != nil {
 		common.ApiError(c, err)
@@ -101,6 +106,7 @@ func CreateModelMeta(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetModel, m.Id, nil, m)
 	model.RefreshPricing()
 	common.ApiSuccess(c, &m)
 }
@@ -119,6 +125,8 @@ func UpdateModelMeta(c *gin.Context) {
 		return
 	}
 
+	var origin model.Model
+	model.DB.First(&origin, m.Id)
 	if statusOnly {
 		// 只更新状态，防止误清空其他字段
 		if err := model.DB.Model(&model.Model{}).Where("id = ?", m.Id).Update("status", m.Status).Error; err != nil {
@@ -126,6 +134,10 @@ func UpdateModelMeta(c *gin.Context) {
 			return
 		}
 	} else {
+		if err := m.ModelCapabilities.Normalize(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 		// 名称冲突检查
 		if dup, err := model.IsModelNameDuplicated(m.Id, m.ModelName); err != nil {
 			common.ApiError(c, err)
@@ -140,6 +152,10 @@ func UpdateModelMeta(c *gin.Context) {
 			return
 		}
 	}
+	var updated model.Model
+	if err := model.DB.First(&updated, m.Id).Error; err == nil {
+		service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetModel, m.Id, origin, updated)
+	}
 	model.RefreshPricing()
 	common.ApiSuccess(c, &m)
 }
@@ -152,10 +168,13 @@ func DeleteModelMeta(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	var origin model.Model
+	model.DB.First(&origin, id)
 	if err := model.DB.Delete(&model.Model{}, id).Error; err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetModel, id, origin, nil)
 	model.RefreshPricing()
 	common.ApiSuccess(c, nil)
 }
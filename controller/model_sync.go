@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
 
 	"github.com/gin-gonic/gin"
@@ -64,6 +65,16 @@ type upstreamModel struct {
 	Status      int             `json:"status"`
 	Tags        string          `json:"tags"`
 	VendorName  string          `json:"vendor_name"`
+	dto.ModelCapabilities
+}
+
+// capabilities 返回规范化后的上游能力元数据，格式不合法时忽略
+func (m upstreamModel) capabilities() dto.ModelCapabilities {
+	capabilities := m.ModelCapabilities
+	if err := capabilities.Normalize(); err != nil {
+		return dto.ModelCapabilities{}
+	}
+	return capabilities
 }
 
 type upstreamVendor struct {
@@ -350,6 +361,8 @@ func SyncUpstreamModels(c *gin.Context) {
 			VendorID:    vendorID,
 			Status:      chooseStatus(up.Status, 1),
 			NameRule:    up.NameRule,
+
+			ModelCapabilities: up.capabilities(),
 		}
 		if err := mi.Insert(); err == nil {
 			createdModels++
@@ -407,6 +420,10 @@ func SyncUpstreamModels(c *gin.Context) {
 					local.Status = chooseStatus(up.Status, local.Status)
 					needUpdate = true
 				}
+				if containsField(ow.Fields, "capabilities") {
+					local.ModelCapabilities = up.capabilities()
+					needUpdate = true
+				}
 				if !needUpdate {
 					return nil
 				}
@@ -563,7 +580,7 @@ func SyncUpstreamPreview(c *gin.Context) {
 		if !ok {
 			continue
 		}
-		fields := make([]conflictField, 0, 6)
+		fields := make([]conflictField, 0, 7)
 		if strings.TrimSpace(local.Description) != strings.TrimSpace(up.Description) {
 			fields = append(fields, conflictField{Field: "description", Local: local.Description, Upstream: up.Description})
 		}
@@ -584,6 +601,9 @@ func SyncUpstreamPreview(c *gin.Context) {
 		if local.Status != chooseStatus(up.Status, local.Status) {
 			fields = append(fields, conflictField{Field: "status", Local: local.Status, Upstream: up.Status})
 		}
+		if upCapabilities := up.capabilities(); !upCapabilities.IsEmpty() && local.ModelCapabilities != upCapabilities {
+			fields = append(fields, conflictField{Field: "capabilities", Local: local.ModelCapabilities, Upstream: upCapabilities})
+		}
 		if len(fields) > 0 {
 			conflicts = append(conflicts, conflictItem{ModelName: local.ModelName, Fields: fields})
 		}
@@ -0,0 +1,526 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcDiscoveryTTL    = time.Hour
+	oidcJwksMinInterval = time.Minute
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type oidcJWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type oidcIssuerCache struct {
+	discovery     *oidcDiscovery
+	expireAt      time.Time
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+var (
+	oidcIssuerCaches = make(map[string]*oidcIssuerCache)
+	oidcIssuerMutex  sync.Mutex
+	oidcHttpClient   = &http.Client{Timeout: 10 * time.Second}
+)
+
+func oidcGetJSON(endpoint string, bearer string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	res, err := oidcHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回状态码 %d", endpoint, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func getOidcIssuerCache(issuer string) (*oidcIssuerCache, error) {
+	oidcIssuerMutex.Lock()
+	defer oidcIssuerMutex.Unlock()
+	cache, ok := oidcIssuerCaches[issuer]
+	if ok && time.Now().Before(cache.expireAt) {
+		return cache, nil
+	}
+	var discovery oidcDiscovery
+	err := oidcGetJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "", &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("OIDC 发现文档缺少必要的端点")
+	}
+	cache = &oidcIssuerCache{discovery: &discovery, expireAt: time.Now().Add(oidcDiscoveryTTL)}
+	oidcIssuerCaches[issuer] = cache
+	return cache, nil
+}
+
+func parseOidcJWK(key oidcJWK) (any, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线 %s", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型 %s", key.Kty)
+}
+
+// getOidcSigningKey 查找 ID Token 的验签公钥，遇到未知 kid 时重新拉取 JWKS（有最小间隔）
+func getOidcSigningKey(cache *oidcIssuerCache, kid string) (any, error) {
+	oidcIssuerMutex.Lock()
+	defer oidcIssuerMutex.Unlock()
+	lookup := func() (any, bool) {
+		if kid == "" && len(cache.keys) == 1 {
+			for _, k := range cache.keys {
+				return k, true
+			}
+		}
+		k, ok := cache.keys[kid]
+		return k, ok
+	}
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	if time.Since(cache.keysFetchedAt) < oidcJwksMinInterval {
+		return nil, errors.New("未找到 ID Token 的签名密钥")
+	}
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	cache.keysFetchedAt = time.Now()
+	if err := oidcGetJSON(cache.discovery.JwksURI, "", &jwks); err != nil {
+		return nil, err
+	}
+	cache.keys = make(map[string]any)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		parsed, err := parseOidcJWK(k)
+		if err != nil {
+			continue
+		}
+		cache.keys[k.Kid] = parsed
+	}
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	return nil, errors.New("未找到 ID Token 的签名密钥")
+}
+
+func oidcProviderRedirectURI(provider *system_setting.OIDCProvider) string {
+	return fmt.Sprintf("%s/oauth/oidc/%s", strings.TrimSuffix(system_setting.ServerAddress, "/"), provider.Name)
+}
+
+// exchangeOidcProviderCode 用授权码换取并校验 ID Token，返回合并了 UserInfo 的声明
+func exchangeOidcProviderCode(provider *system_setting.OIDCProvider, code string, codeVerifier string, nonce string) (map[string]any, error) {
+	cache, err := getOidcIssuerCache(provider.Issuer)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("OIDC 提供方 %s 发现失败：%s", provider.Name, err.Error()))
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", oidcProviderRedirectURI(provider))
+	values.Set("client_id", provider.ClientId)
+	values.Set("client_secret", provider.ClientSecret)
+	values.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest(http.MethodPost, cache.discovery.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := oidcHttpClient.Do(req)
+	if err != nil {
+		common.SysLog(err.Error())
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		common.SysLog(fmt.Sprintf("OIDC 提供方 %s 获取 Token 失败，状态码 %d：%s", provider.Name, res.StatusCode, string(body)))
+		return nil, errors.New("OIDC 获取 Token 失败，请检查设置！")
+	}
+	var tokenResponse OidcResponse
+	if err = json.NewDecoder(res.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		common.SysLog(fmt.Sprintf("OIDC 提供方 %s 未返回 ID Token，请检查设置！", provider.Name))
+		return nil, errors.New("OIDC 获取 Token 失败，请检查设置！")
+	}
+
+	issuer := cache.discovery.Issuer
+	if issuer == "" {
+		issuer = provider.Issuer
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenResponse.IDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return getOidcSigningKey(cache, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(provider.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("OIDC 提供方 %s 的 ID Token 校验失败：%s", provider.Name, err.Error()))
+		return nil, errors.New("OIDC ID Token 校验失败")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("OIDC ID Token 校验失败")
+	}
+
+	// UserInfo 中的声明只补充 ID Token 中没有的字段
+	if cache.discovery.UserInfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		userInfo := make(map[string]any)
+		if err := oidcGetJSON(cache.discovery.UserInfoEndpoint, tokenResponse.AccessToken, &userInfo); err != nil {
+			common.SysLog(fmt.Sprintf("OIDC 提供方 %s 获取用户信息失败：%s", provider.Name, err.Error()))
+		} else if userInfo["sub"] == claims["sub"] {
+			for k, v := range userInfo {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return claims, nil
+}
+
+func oidcClaimString(claims map[string]any, name string, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+	v, _ := claims[name].(string)
+	return v
+}
+
+// provisionOidcProviderUser 查找或创建提供方账户对应的用户，并在每次登录时按规则同步分组、角色与令牌分组
+func provisionOidcProviderUser(provider *system_setting.OIDCProvider, subject string, claims map[string]any) (*model.User, error) {
+	result := provider.EvaluateClaims(claims)
+	group := resolveDirectoryGroup(provider.Name, result.Group)
+	displayName := oidcClaimString(claims, provider.DisplayNameClaim, "name")
+
+	userId, err := model.GetUserIdByOAuthBinding(provider.Name, subject)
+	if err != nil {
+		return nil, err
+	}
+	if userId == 0 {
+		if !common.RegisterEnabled {
+			return nil, errors.New("管理员关闭了新用户注册")
+		}
+		user := model.User{
+			Username:    directoryUsername("oidc", oidcClaimString(claims, provider.UsernameClaim, "preferred_username")),
+			DisplayName: displayName,
+			Group:       group,
+		}
+		if user.DisplayName == "" {
+			user.DisplayName = provider.DisplayName + " User"
+		}
+		if email := oidcClaimString(claims, provider.EmailClaim, "email"); email != "" && !model.IsEmailAlreadyTaken(email) {
+			user.Email = email
+		}
+		if result.RoleSet {
+			user.Role = result.Role
+		}
+		if result.AllowedTokenGroupsSet {
+			user.SetSetting(dto.UserSetting{AllowedTokenGroups: result.AllowedTokenGroups})
+		}
+		if err := user.Insert(0); err != nil {
+			return nil, err
+		}
+		if err := model.CreateOAuthBinding(user.Id, provider.Name, subject); err != nil {
+			return nil, err
+		}
+		if result.Quota > 0 {
+			if err := model.IncreaseUserQuota(user.Id, result.Quota, true); err == nil {
+				model.RecordLog(user.Id, model.LogTypeSystem, fmt.Sprintf("%s 登录规则赠送 %s", provider.DisplayName, logger.LogQuota(result.Quota)))
+			}
+		}
+		return &user, nil
+	}
+
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != common.UserStatusEnabled {
+		return user, nil
+	}
+	// 只更新同步的列，避免写回过期的额度
+	updates := map[string]interface{}{}
+	if displayName != "" && displayName != user.DisplayName {
+		user.DisplayName = displayName
+		updates["display_name"] = user.DisplayName
+	}
+	if group != "" && group != user.Group {
+		user.Group = group
+		updates["group"] = user.Group
+	}
+	// 根用户的角色不受规则影响
+	if result.RoleSet && user.Role != common.RoleRootUser && user.Role != result.Role {
+		user.Role = result.Role
+		updates["role"] = user.Role
+	}
+	if result.AllowedTokenGroupsSet {
+		setting := user.GetSetting()
+		if strings.Join(setting.AllowedTokenGroups, ",") != strings.Join(result.AllowedTokenGroups, ",") {
+			setting.AllowedTokenGroups = result.AllowedTokenGroups
+			user.SetSetting(setting)
+			updates["setting"] = user.Setting
+		}
+	}
+	if err := model.UpdateUserColumns(user.Id, updates); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func getOidcProviderFromParam(c *gin.Context) (*system_setting.OIDCProvider, bool) {
+	provider, ok := system_setting.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "OIDC 提供方不存在或未启用",
+		})
+	}
+	return provider, ok
+}
+
+// OidcProviderLogin 校验 state 后生成 nonce 与 PKCE 参数并跳转到提供方授权页
+func OidcProviderLogin(c *gin.Context) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	provider, ok := getOidcProviderFromParam(c)
+	if !ok {
+		return
+	}
+	cache, err := getOidcIssuerCache(provider.Issuer)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("OIDC 提供方 %s 发现失败：%s", provider.Name, err.Error()))
+		common.ApiErrorMsg(c, "无法连接至 OIDC 服务器，请稍后重试！")
+		return
+	}
+	nonce := common.GetRandomString(32)
+	codeVerifier := common.GetRandomString(64)
+	session.Set("oidc_provider", provider.Name)
+	session.Set("oidc_nonce", nonce)
+	session.Set("oidc_code_verifier", codeVerifier)
+	if err = session.Save(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientId)
+	query.Set("redirect_uri", oidcProviderRedirectURI(provider))
+	query.Set("scope", provider.GetScopes())
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL := cache.discovery.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OidcProviderAuth 处理具名提供方的回调，已登录时绑定账户，否则登录或注册
+func OidcProviderAuth(c *gin.Context) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	provider, ok := getOidcProviderFromParam(c)
+	if !ok {
+		return
+	}
+	sessionProvider, _ := session.Get("oidc_provider").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	codeVerifier, _ := session.Get("oidc_code_verifier").(string)
+	if sessionProvider != provider.Name || nonce == "" {
+		common.ApiErrorMsg(c, "登录会话已失效，请重新登录")
+		return
+	}
+	session.Delete("oidc_nonce")
+	session.Delete("oidc_code_verifier")
+	_ = session.Save()
+
+	claims, err := exchangeOidcProviderCode(provider, c.Query("code"), codeVerifier, nonce)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		common.ApiErrorMsg(c, "OIDC 获取用户信息为空！请检查设置！")
+		return
+	}
+
+	if session.Get("username") != nil {
+		oidcProviderBind(c, provider, subject)
+		return
+	}
+	user, err := provisionOidcProviderUser(provider, subject, claims)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	setupLogin(user, c)
+}
+
+func oidcProviderBind(c *gin.Context, provider *system_setting.OIDCProvider, subject string) {
+	userId, err := model.GetUserIdByOAuthBinding(provider.Name, subject)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if userId != 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该 OIDC 账户已被绑定",
+		})
+		return
+	}
+	id, _ := sessions.Default(c).Get("id").(int)
+	if err = model.CreateOAuthBinding(id, provider.Name, subject); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+}
+
+type oidcProviderStatus struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// getEnabledOidcProviders 返回前端登录页展示用的提供方列表，不包含任何密钥
+func getEnabledOidcProviders() []oidcProviderStatus {
+	providers := make([]oidcProviderStatus, 0)
+	for _, p := range system_setting.GetOIDCProvidersSettings().Providers {
+		if !p.Enabled {
+			continue
+		}
+		displayName := p.DisplayName
+		if displayName == "" {
+			displayName = p.Name
+		}
+		providers = append(providers, oidcProviderStatus{Name: p.Name, DisplayName: displayName})
+	}
+	return providers
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -38,8 +39,9 @@ func GetOptions(c *gin.Context) {
 }
 
 type OptionUpdateRequest struct {
-	Key   string `json:"key"`
-	Value any    `json:"value"`
+	Key        string `json:"key"`
+	Value      any    `json:"value"`
+	ActivateAt int64  `json:"activate_at"` // 定时生效时间（秒级时间戳），为空时立即生效
 }
 
 func UpdateOption(c *gin.Context) {
@@ -87,6 +89,35 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "oidc_providers.providers":
+		var providers []system_setting.OIDCProvider
+		err = common.UnmarshalJsonStr(option.Value.(string), &providers)
+		if err == nil {
+			err = system_setting.CheckOIDCProviders(providers)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ldap.enabled":
+		if option.Value == "true" && (system_setting.GetLDAPSettings().URL == "" || system_setting.GetLDAPSettings().BaseDN == "") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 LDAP 登录，请先填入 LDAP 地址以及 Base DN！",
+			})
+			return
+		}
+	case "saml.enabled":
+		if option.Value == "true" && system_setting.GetSAMLSettings().IdPMetadataURL == "" && system_setting.GetSAMLSettings().IdPMetadataXML == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 SAML 登录，请先填入 IdP 元数据！",
+			})
+			return
+		}
 	case "LinuxDOOAuthEnabled":
 		if option.Value == "true" && common.LinuxDOClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -164,6 +195,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "PricingTiers":
+		err = ratio_setting.CheckPricingTiersJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分段计费规则设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "PricingWindows":
+		err = ratio_setting.CheckPricingWindowsJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "定时计费规则设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value.(string))
 		if err != nil {
@@ -210,14 +259,51 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
-	err = model.UpdateOption(option.Key, option.Value.(string))
+	if option.ActivateAt > common.GetTimestamp() {
+		revision, err := model.ScheduleOptionUpdate(option.Key, option.Value.(string), option.ActivateAt, c.GetInt("id"), c.GetString("username"))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetOptionRevision, revision.Id, nil, gin.H{
+			option.Key:    option.Value,
+			"activate_at": option.ActivateAt,
+		})
+		common.ApiSuccess(c, revision.Id)
+		return
+	}
+	originValue := getOptionValue(option.Key)
+	err = model.UpdateOptionByUser(option.Key, option.Value.(string), c.GetInt("id"), c.GetString("username"))
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetOption, option.Key,
+		gin.H{option.Key: originValue}, gin.H{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+// RotateSecrets 使用当前主密钥重新加密渠道密钥、敏感配置与用户 Webhook 密钥
+func RotateSecrets(c *gin.Context) {
+	result, err := model.RotateSecrets()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetOption, "rotate_secrets", nil, result)
+	common.ApiSuccess(c, result)
+}
+
+func getOptionValue(key string) string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	value, ok := common.OptionMap[key]
+	if !ok {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const optionRevisionMaskedValue = "******"
+
+// maskOptionRevision 敏感配置项不返回具体值，与 GetOptions 的处理保持一致
+func maskOptionRevision(revision *model.OptionRevision) {
+	if !revision.IsSecret() {
+		return
+	}
+	if revision.Value != "" {
+		revision.Value = optionRevisionMaskedValue
+	}
+	if revision.PreviousValue != "" {
+		revision.PreviousValue = optionRevisionMaskedValue
+	}
+}
+
+func GetOptionRevisions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	status, _ := strconv.Atoi(c.Query("status"))
+	revisions, total, err := model.GetOptionRevisions(c.Query("key"), status, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, revision := range revisions {
+		maskOptionRevision(revision)
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(revisions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetOptionRevisionDiff 对比版本差异。compare_to 为空时与该版本生效前的值对比，
+// 为 current 时与当前生效的值对比，为版本 ID 时与该版本对比（须为同一配置项）
+func GetOptionRevisionDiff(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	revision, err := model.GetOptionRevisionById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	before := revision.PreviousValue
+	switch compareTo := c.Query("compare_to"); compareTo {
+	case "":
+	case "current":
+		before = getOptionValue(revision.OptionKey)
+	default:
+		compareId, _ := strconv.Atoi(compareTo)
+		other, err := model.GetOptionRevisionById(compareId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if other.OptionKey != revision.OptionKey {
+			common.ApiErrorMsg(c, "只能对比同一配置项的版本")
+			return
+		}
+		before = other.Value
+	}
+	common.ApiSuccess(c, gin.H{
+		"key":     revision.OptionKey,
+		"changes": service.DiffOptionValues(revision.OptionKey, before, revision.Value),
+	})
+}
+
+// RollbackOptionRevision 将配置项恢复为指定版本的值
+func RollbackOptionRevision(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	target, err := model.GetOptionRevisionById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	originValue := getOptionValue(target.OptionKey)
+	revision, err := model.RollbackOptionRevision(id, c.GetInt("id"), c.GetString("username"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetOption, revision.OptionKey,
+		gin.H{revision.OptionKey: originValue}, gin.H{revision.OptionKey: revision.Value, "rollback_of": id})
+	maskOptionRevision(revision)
+	common.ApiSuccess(c, revision)
+}
+
+// CancelOptionRevision 取消尚未生效的定时修改
+func CancelOptionRevision(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.CancelOptionRevision(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetOptionRevision, id, gin.H{"id": id}, nil)
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,524 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// requireOrganizationRole 校验当前用户在组织中的角色，roles 为空时只要求是组织成员
+func requireOrganizationRole(c *gin.Context, roles ...string) (*model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 ID")
+		return nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiErrorMsg(c, "你不是该组织的成员")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	if len(roles) == 0 {
+		return member, true
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return member, true
+		}
+	}
+	common.ApiErrorMsg(c, "无权进行此操作")
+	return nil, false
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var org model.Organization
+	if err := common.DecodeJson(c.Request.Body, &org); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" || len(org.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 64 个字符")
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:        org.Name,
+		Description: org.Description,
+		Status:      common.UserStatusEnabled,
+	}
+	if err := model.CreateOrganization(&cleanOrg, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanOrg)
+}
+
+func GetOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.UserOrganization{
+		Organization:    *org,
+		Role:            member.Role,
+		QuotaLimit:      member.QuotaLimit,
+		MemberUsedQuota: member.UsedQuota,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req model.Organization
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 64 个字符")
+		return
+	}
+	// 组织状态只能由系统管理员修改
+	org.Name = req.Name
+	org.Description = req.Description
+	if err := org.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	if err := model.DeleteOrganization(member.OrganizationId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+type organizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if !model.IsValidOrganizationRole(req.Role) {
+		common.ApiErrorMsg(c, "无效的角色")
+		return
+	}
+	if req.Role == model.OrganizationRoleOwner && operator.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有拥有者可以添加拥有者")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员限额不能为负数")
+		return
+	}
+	user := model.User{Id: req.UserId, Username: strings.TrimSpace(req.Username)}
+	if user.Id == 0 && user.Username == "" {
+		common.ApiErrorMsg(c, "请指定用户")
+		return
+	}
+	if user.Id == 0 {
+		if err := user.FillUserByUsername(); err != nil || user.Id == 0 {
+			common.ApiErrorMsg(c, "用户不存在")
+			return
+		}
+	} else if _, err := model.GetUserById(user.Id, false); err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	if _, err := model.GetOrganizationMember(operator.OrganizationId, user.Id); err == nil {
+		common.ApiErrorMsg(c, "该用户已是组织成员")
+		return
+	}
+	member := model.OrganizationMember{
+		OrganizationId: operator.OrganizationId,
+		UserId:         user.Id,
+		Role:           req.Role,
+		QuotaLimit:     req.QuotaLimit,
+	}
+	if err := model.AddOrganizationMember(&member); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if !model.IsValidOrganizationRole(req.Role) {
+		common.ApiErrorMsg(c, "无效的角色")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员限额不能为负数")
+		return
+	}
+	member, err := model.GetOrganizationMember(operator.OrganizationId, req.UserId)
+	if err != nil {
+		common.ApiErrorMsg(c, "成员不存在")
+		return
+	}
+	// 拥有者角色的授予与收回只能由拥有者操作
+	if (req.Role == model.OrganizationRoleOwner || member.Role == model.OrganizationRoleOwner) && operator.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有拥有者可以修改拥有者角色")
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner && req.Role != model.OrganizationRoleOwner {
+		members, err := model.GetOrganizationMembers(operator.OrganizationId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		owners := 0
+		for _, m := range members {
+			if m.Role == model.OrganizationRoleOwner {
+				owners++
+			}
+		}
+		if owners <= 1 {
+			common.ApiErrorMsg(c, "组织至少需要保留一名拥有者")
+			return
+		}
+	}
+	member.Role = req.Role
+	member.QuotaLimit = req.QuotaLimit
+	if err := member.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// RemoveOrganizationMember 移除成员，成员也可以通过此接口主动退出组织
+func RemoveOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	if userId != operator.UserId {
+		if operator.Role != model.OrganizationRoleOwner && operator.Role != model.OrganizationRoleAdmin {
+			common.ApiErrorMsg(c, "无权进行此操作")
+			return
+		}
+		target, err := model.GetOrganizationMember(operator.OrganizationId, userId)
+		if err != nil {
+			common.ApiErrorMsg(c, "成员不存在")
+			return
+		}
+		if target.Role == model.OrganizationRoleOwner && operator.Role != model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "只有拥有者可以移除拥有者")
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(operator.OrganizationId, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	tokens, err := model.GetOrganizationTokens(member.OrganizationId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 财务角色只负责额度，不需要看到令牌密钥
+	if member.Role == model.OrganizationRoleBilling {
+		for _, token := range tokens {
+			token.Key = ""
+		}
+	}
+	total, _ := model.CountOrganizationTokens(member.OrganizationId)
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(tokens)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddOrganizationToken(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	token := model.Token{}
+	if err := c.ShouldBindJSON(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(token.Name) > 50 {
+		common.ApiErrorMsg(c, "令牌名称过长")
+		return
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		common.ApiErrorMsg(c, "生成令牌失败")
+		common.SysLog("failed to generate token key: " + err.Error())
+		return
+	}
+	cleanToken := model.Token{
+		UserId:             member.UserId,
+		OrganizationId:     member.OrganizationId,
+		Name:               token.Name,
+		Key:                key,
+		CreatedTime:        common.GetTimestamp(),
+		AccessedTime:       common.GetTimestamp(),
+		ExpiredTime:        token.ExpiredTime,
+		RemainQuota:        token.RemainQuota,
+		UnlimitedQuota:     token.UnlimitedQuota,
+		ModelLimitsEnabled: token.ModelLimitsEnabled,
+		ModelLimits:        token.ModelLimits,
+		AllowIps:           token.AllowIps,
+		Group:              token.Group,
+	}
+	if err := cleanToken.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanToken)
+}
+
+func UpdateOrganizationToken(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	token := model.Token{}
+	if err := c.ShouldBindJSON(&token); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(token.Name) > 50 {
+		common.ApiErrorMsg(c, "令牌名称过长")
+		return
+	}
+	cleanToken, err := model.GetOrganizationTokenById(token.Id, member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("status_only") != "" {
+		cleanToken.Status = token.Status
+	} else {
+		cleanToken.Name = token.Name
+		cleanToken.ExpiredTime = token.ExpiredTime
+		cleanToken.RemainQuota = token.RemainQuota
+		cleanToken.UnlimitedQuota = token.UnlimitedQuota
+		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
+		cleanToken.ModelLimits = token.ModelLimits
+		cleanToken.AllowIps = token.AllowIps
+		cleanToken.Group = token.Group
+	}
+	if err := cleanToken.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanToken)
+}
+
+func DeleteOrganizationToken(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	tokenId, _ := strconv.Atoi(c.Param("token_id"))
+	token, err := model.GetOrganizationTokenById(tokenId, member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// TransferOrganizationQuota 将个人额度转入组织额度池
+func TransferOrganizationQuota(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := model.TransferUserQuotaToOrganization(member.UserId, member.OrganizationId, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationLogs(c *gin.Context) {
+	member, ok := requireOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleAdmin, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tokenIds, err := model.GetOrganizationTokenIds(member.OrganizationId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	logs, total, err := model.GetOrganizationLogs(tokenIds, startTimestamp, endTimestamp, c.Query("model_name"), c.Query("username"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminUpdateOrganization 管理员修改组织状态或调整组织额度
+func AdminUpdateOrganization(c *gin.Context) {
+	var req struct {
+		Id         int `json:"id"`
+		Status     int `json:"status"`
+		QuotaDelta int `json:"quota_delta"`
+	}
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	org, err := model.GetOrganizationById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status != 0 && req.Status != org.Status {
+		if req.Status != common.UserStatusEnabled && req.Status != common.UserStatusDisabled {
+			common.ApiErrorMsg(c, "无效的状态")
+			return
+		}
+		org.Status = req.Status
+		if err := org.Update(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if req.QuotaDelta != 0 {
+		if err := model.AdjustOrganizationQuota(org.Id, req.QuotaDelta); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("管理员将组织 %s（%d）的额度调整 %s", org.Name, org.Id, logger.LogQuota(req.QuotaDelta)))
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminDeleteOrganization(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 ID")
+		return
+	}
+	if err := model.DeleteOrganization(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
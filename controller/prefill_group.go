@@ -5,6 +5,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -44,6 +45,7 @@ func CreatePrefillGroup(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetPrefillGroup, g.Id, nil, g)
 	common.ApiSuccess(c, &g)
 }
 
@@ -67,10 +69,13 @@ func UpdatePrefillGroup(c *gin.Context) {
 		return
 	}
 
+	var origin model.PrefillGroup
+	model.DB.First(&origin, g.Id)
 	if err := g.Update(); err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetPrefillGroup, g.Id, origin, g)
 	common.ApiSuccess(c, &g)
 }
 
@@ -82,9 +87,12 @@ func DeletePrefillGroup(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	var origin model.PrefillGroup
+	model.DB.First(&origin, id)
 	if err := model.DeletePrefillGroupByID(id); err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetPrefillGroup, id, origin, nil)
 	common.ApiSuccess(c, nil)
 }
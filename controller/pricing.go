@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -46,12 +48,57 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		"pricing_windows":    getActivePricingWindows(usableGroup),
 	})
 }
 
+type activePricingWindow struct {
+	Name        string   `json:"name"`
+	Models      []string `json:"models,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	Multiplier  *float64 `json:"multiplier,omitempty"`
+	ModelRatio  *float64 `json:"model_ratio,omitempty"`
+	ModelPrice  *float64 `json:"model_price,omitempty"`
+	ActiveUntil int64    `json:"active_until,omitempty"` // 本次生效时段的结束时间，0 表示长期有效
+}
+
+// getActivePricingWindows 返回当前生效且对用户可用分组有效的定时计费规则，便于用户了解实际计费价格
+func getActivePricingWindows(usableGroup map[string]string) []activePricingWindow {
+	now := time.Now()
+	windows := make([]activePricingWindow, 0)
+	for _, window := range ratio_setting.GetActivePricingWindows(now) {
+		if len(window.Groups) > 0 {
+			usable := false
+			for _, g := range window.Groups {
+				if _, ok := usableGroup[g]; ok {
+					usable = true
+					break
+				}
+			}
+			if !usable {
+				continue
+			}
+		}
+		item := activePricingWindow{
+			Name:       window.Name,
+			Models:     window.Models,
+			Groups:     window.Groups,
+			Multiplier: window.Multiplier,
+			ModelRatio: window.ModelRatio,
+			ModelPrice: window.ModelPrice,
+		}
+		if until, ok := window.ActiveUntil(now); ok && !until.IsZero() {
+			item.ActiveUntil = until.Unix()
+		}
+		windows = append(windows, item)
+	}
+	return windows
+}
+
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := ratio_setting.DefaultModelRatio2JSONString()
-	err := model.UpdateOption("ModelRatio", defaultStr)
+	originValue := getOptionValue("ModelRatio")
+	err := model.UpdateOptionByUser("ModelRatio", defaultStr, c.GetInt("id"), c.GetString("username"))
 	if err != nil {
 		c.JSON(200, gin.H{
 			"success": false,
@@ -67,6 +114,8 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetOption, "ModelRatio",
+		gin.H{"ModelRatio": originValue}, gin.H{"ModelRatio": defaultStr})
 	c.JSON(200, gin.H{
 		"success": true,
 		"message": "重置模型倍率成功",
@@ -2,11 +2,13 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -20,6 +22,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -84,6 +87,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	defer func() {
 		if newAPIError != nil {
+			if middleware.ChannelQueueErrorWritten(c) {
+				// 排队超时的错误已以 SSE 事件返回
+				return
+			}
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
 			switch relayFormat {
@@ -133,6 +140,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	// 超出上下文长度或包含模型不支持的模态时，在预扣费前直接拒绝
+	if err = service.CheckModelCapabilities(relayInfo.OriginModelName, tokens, meta); err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -181,6 +194,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 
 		if newAPIError == nil {
+			model.RecordModelStatus(originalModel, true, relayLatencyMs(relayInfo))
+			if channel.ChannelInfo.IsMultiKey {
+				model.RecordChannelKeySuccess(channel.Id, common.GetContextKeyString(c, constant.ContextKeyChannelKey))
+			}
 			return
 		}
 
@@ -191,6 +208,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	// 只有上游或渠道不可用导致的失败计入模型可用率，请求本身的错误不计入
+	if newAPIError != nil && (newAPIError.StatusCode >= http.StatusInternalServerError || newAPIError.StatusCode == http.StatusTooManyRequests) {
+		model.RecordModelStatus(originalModel, false, 0)
+	}
+
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
@@ -198,6 +220,14 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// relayLatencyMs 返回首字延迟，未向客户端发送过响应时返回总耗时
+func relayLatencyMs(info *relaycommon.RelayInfo) int64 {
+	if info.HasSendResponse() {
+		return info.FirstResponseTime.Sub(info.StartTime).Milliseconds()
+	}
+	return time.Since(info.StartTime).Milliseconds()
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -225,14 +255,19 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, group, originalModel, retryCount)
-	if err != nil {
-		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, originalModel, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
-	}
-	if channel == nil {
-		return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在（retry）", selectGroup, originalModel), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
-	}
-	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+	channel, newAPIError := middleware.SelectChannelWithQueue(c, group, originalModel, func() (*model.Channel, *types.NewAPIError) {
+		channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, group, originalModel, retryCount)
+		if errors.Is(err, model.ErrAllChannelsBusy) {
+			return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeChannelBusy, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+		}
+		if err != nil {
+			return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, originalModel, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		}
+		if channel == nil {
+			return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在（retry）", selectGroup, originalModel), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		}
+		return channel, nil
+	})
 	if newAPIError != nil {
 		return nil, newAPIError
 	}
@@ -285,6 +320,9 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
+	if channelError.IsMultiKey {
+		model.RecordChannelKeyError(channelError.ChannelId, channelError.UsingKey, err.Error())
+	}
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.Error())
@@ -390,7 +428,7 @@ func RelayNotFound(c *gin.Context) {
 }
 
 func RelayTask(c *gin.Context) {
-	retryTimes := common.RetryTimes
+	retryTimes := operation_setting.GetTaskSetting().GetSubmitRetryTimes()
 	channelId := c.GetInt("channel_id")
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
@@ -0,0 +1,485 @@
+package controller
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	samlRelayStateTTL     = 10 * time.Minute
+	samlTicketTTL         = 2 * time.Minute
+	samlIdPMetadataTTL    = time.Hour
+	samlSignatureSHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	samlMaxMetadataLength = 4 << 20
+)
+
+var samlProvider struct {
+	sync.Mutex
+	fingerprint string
+	expireAt    time.Time
+	sp          *saml.ServiceProvider
+}
+
+// samlTicket 是 ACS 校验断言后交给前端回调页的一次性登录凭证。
+// ACS 由 IdP 跨站 POST，拿不到 SameSite=Strict 的会话，因此把结果签名后转交给
+// /oauth/saml 回调页，由它携带会话调用 /api/oauth/saml 完成登录。
+// 凭证绑定发起登录的会话的 state，兑换后即作废。
+type samlTicket struct {
+	Id       string            `json:"t"`
+	Identity directoryIdentity `json:"id"`
+	State    string            `json:"s"`
+	ExpireAt int64             `json:"x"`
+}
+
+// 已使用的凭证与断言 ID，启用 Redis 时多节点共享
+var samlUsedIds = struct {
+	sync.Mutex
+	expireAt map[string]time.Time
+}{expireAt: make(map[string]time.Time)}
+
+// consumeSAMLId 将凭证或断言 ID 标记为已使用，ID 在有效期内已被使用过时返回 false
+func consumeSAMLId(kind string, id string, expireAt time.Time) bool {
+	if id == "" {
+		return false
+	}
+	key := "saml_used:" + kind + ":" + id
+	ttl := time.Until(expireAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(context.Background(), key, 1, ttl).Result()
+		if err != nil {
+			common.SysLog("SAML 记录已使用的 ID 失败：" + err.Error())
+			return false
+		}
+		return ok
+	}
+	samlUsedIds.Lock()
+	defer samlUsedIds.Unlock()
+	now := time.Now()
+	for k, t := range samlUsedIds.expireAt {
+		if now.After(t) {
+			delete(samlUsedIds.expireAt, k)
+		}
+	}
+	if _, used := samlUsedIds.expireAt[key]; used {
+		return false
+	}
+	samlUsedIds.expireAt[key] = now.Add(ttl)
+	return true
+}
+
+func parseSAMLKeyPair(certPEM string, keyPEM string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if strings.TrimSpace(certPEM) == "" || strings.TrimSpace(keyPEM) == "" {
+		return nil, nil, nil
+	}
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, nil, fmt.Errorf("SP 证书或私钥无效: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("SP 私钥必须为 RSA 私钥")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func parseSAMLIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	entity := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, entity)
+	if err == nil {
+		return entity, nil
+	}
+	// 部分 IdP 的元数据外层为 EntitiesDescriptor
+	entities := &saml.EntitiesDescriptor{}
+	if xml.Unmarshal(data, entities) != nil {
+		return nil, err
+	}
+	for i, e := range entities.EntityDescriptors {
+		if len(e.IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("IdP 元数据中没有 IDPSSODescriptor")
+}
+
+func fetchSAMLIdPMetadata(metadataURL string) (*saml.EntityDescriptor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 IdP 元数据失败，状态码 %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, samlMaxMetadataLength))
+	if err != nil {
+		return nil, err
+	}
+	return parseSAMLIdPMetadata(data)
+}
+
+// getSAMLServiceProvider 根据当前设置构建 SP，设置不变时复用，URL 方式获取的 IdP 元数据定期刷新
+func getSAMLServiceProvider() (*saml.ServiceProvider, error) {
+	settings := system_setting.GetSAMLSettings()
+	fingerprint := strings.Join([]string{
+		system_setting.ServerAddress, settings.EntityId, settings.IdPMetadataURL, settings.IdPMetadataXML,
+		settings.SPCertificate, settings.SPPrivateKey, settings.NameIdFormat, strconv.FormatBool(settings.AllowIdPInitiated),
+	}, "\x00")
+
+	samlProvider.Lock()
+	defer samlProvider.Unlock()
+	if samlProvider.sp != nil && samlProvider.fingerprint == fingerprint && time.Now().Before(samlProvider.expireAt) {
+		return samlProvider.sp, nil
+	}
+
+	var idpMetadata *saml.EntityDescriptor
+	var err error
+	if strings.TrimSpace(settings.IdPMetadataXML) != "" {
+		idpMetadata, err = parseSAMLIdPMetadata([]byte(settings.IdPMetadataXML))
+	} else if settings.IdPMetadataURL != "" {
+		idpMetadata, err = fetchSAMLIdPMetadata(settings.IdPMetadataURL)
+	} else {
+		err = errors.New("未配置 IdP 元数据")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cert, key, err := parseSAMLKeyPair(settings.SPCertificate, settings.SPPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serverAddress := strings.TrimSuffix(system_setting.ServerAddress, "/")
+	metadataURL, err := url.Parse(serverAddress + "/api/saml/metadata")
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(serverAddress + "/api/saml/acs")
+	if err != nil {
+		return nil, err
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:          settings.EntityId,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.NameIDFormat(settings.NameIdFormat),
+		AllowIDPInitiated: settings.AllowIdPInitiated,
+	}
+	if sp.EntityID == "" {
+		sp.EntityID = metadataURL.String()
+	}
+	if key != nil {
+		sp.SignatureMethod = samlSignatureSHA256
+	}
+
+	samlProvider.sp = sp
+	samlProvider.fingerprint = fingerprint
+	samlProvider.expireAt = time.Now().Add(samlIdPMetadataTTL)
+	return sp, nil
+}
+
+func signSAMLPayload(payload string) string {
+	return payload + "." + common.GenerateHMAC(payload)
+}
+
+func verifySAMLPayload(signed string) (string, bool) {
+	idx := strings.LastIndex(signed, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	payload, signature := signed[:idx], signed[idx+1:]
+	expected := common.GenerateHMAC(payload)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) != 1 {
+		return "", false
+	}
+	return payload, true
+}
+
+// RelayState 形如 state.requestId.expireAt.signature，ACS 据此还原 AuthnRequest 的 ID
+func makeSAMLRelayState(state string, requestId string) string {
+	return signSAMLPayload(fmt.Sprintf("%s.%s.%d", state, requestId, time.Now().Add(samlRelayStateTTL).Unix()))
+}
+
+func parseSAMLRelayState(relayState string) (state string, requestId string, ok bool) {
+	payload, ok := verifySAMLPayload(relayState)
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	expireAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expireAt {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				if v.Value != "" {
+					values = append(values, v.Value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func samlAttributeValue(assertion *saml.Assertion, name string) string {
+	values := samlAttributeValues(assertion, name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func samlIdentityFromAssertion(assertion *saml.Assertion) (*directoryIdentity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("SAML 断言中缺少 NameID")
+	}
+	settings := system_setting.GetSAMLSettings()
+	identity := &directoryIdentity{
+		Provider:    directoryProviderSAML,
+		Id:          assertion.Subject.NameID.Value,
+		Username:    samlAttributeValue(assertion, settings.UsernameAttribute),
+		DisplayName: samlAttributeValue(assertion, settings.DisplayNameAttribute),
+		Email:       samlAttributeValue(assertion, settings.EmailAttribute),
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Id
+	}
+	groups := samlAttributeValues(assertion, settings.GroupAttribute)
+	group, isAdmin := system_setting.ResolveDirectoryGroup(settings.GroupRules, settings.AdminGroups, settings.DefaultGroup, groups)
+	identity.Group = resolveDirectoryGroup(directoryProviderSAML, group)
+	identity.SyncRole = len(settings.AdminGroups) > 0
+	identity.IsAdmin = isAdmin
+	return identity, nil
+}
+
+func SamlMetadata(c *gin.Context) {
+	if !system_setting.GetSAMLSettings().Enabled {
+		c.String(http.StatusNotFound, "SAML is not enabled")
+		return
+	}
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		common.SysLog("SAML 初始化失败：" + err.Error())
+		c.String(http.StatusInternalServerError, "SAML is not configured properly")
+		return
+	}
+	data, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", data)
+}
+
+// SamlLogin 校验 /api/oauth/state 生成的 state 后跳转到 IdP
+func SamlLogin(c *gin.Context) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	if !system_setting.GetSAMLSettings().Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过 SAML 登录以及注册",
+		})
+		return
+	}
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		common.SysLog("SAML 初始化失败：" + err.Error())
+		common.ApiErrorMsg(c, "SAML 配置有误，请联系管理员")
+		return
+	}
+	authnRequest, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	redirectURL, err := authnRequest.Redirect(makeSAMLRelayState(state, authnRequest.ID), sp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL.String())
+}
+
+// SamlACS 接收 IdP POST 回来的断言，校验签名、受众与有效期
+func SamlACS(c *gin.Context) {
+	settings := system_setting.GetSAMLSettings()
+	if !settings.Enabled {
+		c.String(http.StatusNotFound, "SAML is not enabled")
+		return
+	}
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		common.SysLog("SAML 初始化失败：" + err.Error())
+		c.String(http.StatusInternalServerError, "SAML is not configured properly")
+		return
+	}
+	if err = c.Request.ParseForm(); err != nil {
+		c.String(http.StatusBadRequest, "invalid request")
+		return
+	}
+	state, requestId, ok := parseSAMLRelayState(c.Request.PostForm.Get("RelayState"))
+	if !ok {
+		// IdP 发起的登录没有可绑定的会话，改为由回调页重新发起 SP 登录
+		if settings.AllowIdPInitiated {
+			c.Redirect(http.StatusSeeOther, strings.TrimSuffix(system_setting.ServerAddress, "/")+"/oauth/saml?restart=1")
+			return
+		}
+		c.String(http.StatusForbidden, "invalid RelayState")
+		return
+	}
+	assertion, err := sp.ParseResponse(c.Request, []string{requestId})
+	if err != nil {
+		var invalidErr *saml.InvalidResponseError
+		if errors.As(err, &invalidErr) {
+			common.SysLog("SAML 断言校验失败：" + invalidErr.PrivateErr.Error())
+		} else {
+			common.SysLog("SAML 断言校验失败：" + err.Error())
+		}
+		c.String(http.StatusForbidden, "invalid SAML response")
+		return
+	}
+	// 同一断言只能使用一次，防止重放
+	assertionExpireAt := time.Now().Add(samlRelayStateTTL)
+	if assertion.Conditions != nil && !assertion.Conditions.NotOnOrAfter.IsZero() {
+		assertionExpireAt = assertion.Conditions.NotOnOrAfter
+	}
+	if !consumeSAMLId("assertion", assertion.ID, assertionExpireAt) {
+		c.String(http.StatusForbidden, "SAML assertion has already been used")
+		return
+	}
+	identity, err := samlIdentityFromAssertion(assertion)
+	if err != nil {
+		c.String(http.StatusForbidden, err.Error())
+		return
+	}
+	payload, err := common.Marshal(samlTicket{
+		Id:       common.GetRandomString(32),
+		Identity: *identity,
+		State:    state,
+		ExpireAt: time.Now().Add(samlTicketTTL).Unix(),
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ticket := signSAMLPayload(base64.RawURLEncoding.EncodeToString(payload))
+	query := url.Values{}
+	query.Set("code", ticket)
+	query.Set("state", state)
+	c.Redirect(http.StatusSeeOther, strings.TrimSuffix(system_setting.ServerAddress, "/")+"/oauth/saml?"+query.Encode())
+}
+
+// SamlAuth 由前端回调页调用，兑换 ACS 签发的凭证并完成登录
+func SamlAuth(c *gin.Context) {
+	if !system_setting.GetSAMLSettings().Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过 SAML 登录以及注册",
+		})
+		return
+	}
+	payload, ok := verifySAMLPayload(c.Query("code"))
+	if !ok {
+		common.ApiErrorMsg(c, "无效的登录凭证")
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的登录凭证")
+		return
+	}
+	var ticket samlTicket
+	if err = common.Unmarshal(data, &ticket); err != nil || time.Now().Unix() > ticket.ExpireAt {
+		common.ApiErrorMsg(c, "登录凭证已过期，请重新登录")
+		return
+	}
+	// 凭证需要与发起登录时的会话一致
+	session := sessions.Default(c)
+	if ticket.State == "" || session.Get("oauth_state") == nil || ticket.State != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	if ticket.Identity.Provider != directoryProviderSAML {
+		common.ApiErrorMsg(c, "无效的登录凭证")
+		return
+	}
+	if !consumeSAMLId("ticket", ticket.Id, time.Unix(ticket.ExpireAt, 0)) {
+		common.ApiErrorMsg(c, "登录凭证已被使用，请重新登录")
+		return
+	}
+	user, err := provisionDirectoryUser(&ticket.Identity)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	setupLogin(user, c)
+}
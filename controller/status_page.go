@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStatusPage 公开状态页数据，按供应商分组展示模型可用率、延迟与故障记录
+func GetStatusPage(c *gin.Context) {
+	if !console_setting.GetConsoleSetting().StatusPageEnabled {
+		common.ApiErrorMsg(c, "状态页未启用")
+		return
+	}
+	page, err := service.GetStatusPage()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, page)
+}
+
+type statusIncidentRequest struct {
+	model.StatusIncident
+	Content string `json:"content"` // 本次追加的处理进展
+}
+
+// normalizeStatusIncident 校验故障字段并补全默认值
+func normalizeStatusIncident(incident *model.StatusIncident) string {
+	incident.Title = strings.TrimSpace(incident.Title)
+	if incident.Title == "" {
+		return "标题不能为空"
+	}
+	if incident.Type == "" {
+		incident.Type = model.StatusIncidentTypeIncident
+	}
+	if !model.IsValidStatusIncidentType(incident.Type) {
+		return "无效的类型"
+	}
+	if incident.Status == "" {
+		incident.Status = model.StatusIncidentInvestigating
+		if incident.Type != model.StatusIncidentTypeIncident {
+			incident.Status = model.StatusIncidentScheduled
+		}
+	}
+	if !model.IsValidStatusIncidentStatus(incident.Status) {
+		return "无效的状态"
+	}
+	if incident.Impact == "" {
+		incident.Impact = model.StatusImpactMinor
+		if incident.Type == model.StatusIncidentTypeAnnouncement {
+			incident.Impact = model.StatusImpactNone
+		}
+	}
+	if !model.IsValidStatusImpact(incident.Impact) {
+		return "无效的影响程度"
+	}
+	if incident.StartsAt > 0 && incident.EndsAt > 0 && incident.EndsAt <= incident.StartsAt {
+		return "结束时间必须晚于开始时间"
+	}
+	incident.Models = strings.Join(incident.GetModelList(), ",")
+	incident.Updates = nil
+	return ""
+}
+
+// GetStatusIncidents 分页查询故障、维护与公告，可通过 ?type= 与 ?status= 筛选
+func GetStatusIncidents(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	incidents, total, err := model.GetStatusIncidents(c.Query("type"), c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(incidents)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetStatusIncident(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	incident, err := model.GetStatusIncidentById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, incident)
+}
+
+func CreateStatusIncident(c *gin.Context) {
+	var req statusIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	incident := req.StatusIncident
+	incident.Id = 0
+	if msg := normalizeStatusIncident(&incident); msg != "" {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	if err := model.InsertStatusIncident(&incident, req.Content); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateStatusPageCache()
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetStatusIncident, incident.Id, nil, incident)
+	common.ApiSuccess(c, &incident)
+}
+
+// UpdateStatusIncident 更新故障信息，content 不为空时追加一条处理进展
+func UpdateStatusIncident(c *gin.Context) {
+	var req statusIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetStatusIncidentById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	incident := req.StatusIncident
+	incident.CreatedAt = origin.CreatedAt
+	incident.ResolvedAt = origin.ResolvedAt
+	if msg := normalizeStatusIncident(&incident); msg != "" {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	if err := model.UpdateStatusIncident(&incident, req.Content); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateStatusPageCache()
+	origin.Updates = nil
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetStatusIncident, incident.Id, origin, incident)
+	updated, err := model.GetStatusIncidentById(incident.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, updated)
+}
+
+func DeleteStatusIncident(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetStatusIncidentById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteStatusIncidentById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateStatusPageCache()
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetStatusIncident, id, origin, nil)
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,563 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/thanhpk/randstr"
+)
+
+type SubscriptionPayRequest struct {
+	PlanId        int    `json:"plan_id"`
+	PaymentMethod string `json:"payment_method"`
+}
+
+// GetSubscriptionPlans 用户可订阅的套餐列表
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+// GetSelfSubscription 当前用户的订阅与套餐信息，未订阅时返回空
+func GetSelfSubscription(c *gin.Context) {
+	sub, err := model.GetUserActiveSubscription(c.GetInt("id"))
+	if err != nil {
+		common.ApiSuccess(c, nil)
+		return
+	}
+	plan, _ := model.GetSubscriptionPlanById(sub.PlanId)
+	common.ApiSuccess(c, gin.H{
+		"subscription": sub,
+		"plan":         plan,
+	})
+}
+
+func RequestSubscriptionPay(c *gin.Context) {
+	if !operation_setting.GetSubscriptionSetting().Enabled {
+		common.ApiErrorMsg(c, "订阅套餐未开放")
+		return
+	}
+	var req SubscriptionPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || !plan.Enabled {
+		common.ApiErrorMsg(c, "套餐不存在")
+		return
+	}
+	id := c.GetInt("id")
+	if _, err := model.GetUserActiveSubscription(id); err == nil {
+		common.ApiErrorMsg(c, "已有生效中的订阅，请使用升级功能更换套餐")
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	reference := fmt.Sprintf("new-api-sub-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	tradeNo := "sub_" + common.Sha1([]byte(reference))
+
+	var payLink string
+	switch req.PaymentMethod {
+	case PaymentMethodStripe:
+		if plan.StripePriceId == "" {
+			common.ApiErrorMsg(c, "该套餐不支持 Stripe 支付")
+			return
+		}
+		payLink, err = genStripeSubscriptionLink(tradeNo, user.StripeCustomer, user.Email, plan)
+	case PaymentMethodCreem:
+		if plan.CreemProductId == "" {
+			common.ApiErrorMsg(c, "该套餐不支持 Creem 支付")
+			return
+		}
+		payLink, err = genCreemLink(tradeNo, &CreemProduct{
+			ProductId: plan.CreemProductId,
+			Name:      plan.Name,
+			Price:     plan.Price,
+			Currency:  plan.Currency,
+			Quota:     int64(plan.Quota),
+		}, user.Email, user.Username)
+	default:
+		common.ApiErrorMsg(c, "不支持的支付渠道")
+		return
+	}
+	if err != nil {
+		log.Printf("获取订阅支付链接失败: %v", err)
+		common.ApiErrorMsg(c, "拉起支付失败")
+		return
+	}
+
+	sub := &model.Subscription{
+		UserId:        id,
+		PlanId:        plan.Id,
+		Status:        model.SubscriptionStatusPending,
+		PaymentMethod: req.PaymentMethod,
+		TradeNo:       tradeNo,
+	}
+	if err := sub.Insert(); err != nil {
+		common.ApiErrorMsg(c, "创建订单失败")
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"pay_link": payLink,
+		"order_id": tradeNo,
+	})
+}
+
+// UpgradeSelfSubscription 升级到同一计费周期的更高价套餐，差价与额度按本周期剩余时间折算
+func UpgradeSelfSubscription(c *gin.Context) {
+	var req SubscriptionPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	sub, err := model.GetUserActiveSubscription(c.GetInt("id"))
+	if err != nil || sub.Status != model.SubscriptionStatusActive {
+		common.ApiErrorMsg(c, "没有可升级的订阅")
+		return
+	}
+	oldPlan, err := model.GetSubscriptionPlanById(sub.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	newPlan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || !newPlan.Enabled {
+		common.ApiErrorMsg(c, "套餐不存在")
+		return
+	}
+	if newPlan.Interval != oldPlan.Interval || newPlan.Price <= oldPlan.Price {
+		common.ApiErrorMsg(c, "只能升级到相同计费周期的更高价套餐")
+		return
+	}
+	quota, money := model.ProrateSubscriptionUpgrade(sub, oldPlan, newPlan, common.GetTimestamp())
+
+	// 先记录待升级套餐，差价支付成功的回调可能早于接口返回
+	if err := model.SetSubscriptionPendingUpgrade(sub.Id, newPlan.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	switch sub.PaymentMethod {
+	case PaymentMethodStripe:
+		err = upgradeStripeSubscription(sub.ExternalId, newPlan)
+	case PaymentMethodCreem:
+		err = requestCreemSubscriptionApi(sub.ExternalId, "upgrade", map[string]string{
+			"product_id":      newPlan.CreemProductId,
+			"update_behavior": "proration-charge-immediately",
+		})
+	default:
+		err = errors.New("不支持的支付渠道")
+	}
+	if err != nil {
+		_ = model.SetSubscriptionPendingUpgrade(sub.Id, 0)
+		log.Printf("订阅升级失败 - 订阅ID: %d, err: %v", sub.Id, err)
+		common.ApiErrorMsg(c, "订阅升级失败")
+		return
+	}
+
+	// 套餐与补发额度在差价支付成功后由支付平台回调生效，此处返回的是预估值
+	common.ApiSuccess(c, gin.H{
+		"quota":   quota,
+		"money":   money,
+		"pending": true,
+	})
+}
+
+// CancelSelfSubscription 取消自动续费，当前周期结束后套餐失效
+func CancelSelfSubscription(c *gin.Context) {
+	sub, err := model.GetUserActiveSubscription(c.GetInt("id"))
+	if err != nil || sub.Status == model.SubscriptionStatusCanceled {
+		common.ApiErrorMsg(c, "没有可取消的订阅")
+		return
+	}
+	switch sub.PaymentMethod {
+	case PaymentMethodStripe:
+		err = cancelStripeSubscription(sub.ExternalId)
+	case PaymentMethodCreem:
+		err = requestCreemSubscriptionApi(sub.ExternalId, "cancel", nil)
+	}
+	if err != nil {
+		log.Printf("取消订阅失败 - 订阅ID: %d, err: %v", sub.Id, err)
+		common.ApiErrorMsg(c, "取消订阅失败")
+		return
+	}
+	if err := model.CancelSubscriptionAtPeriodEnd(sub.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetAllSubscriptionPlans 管理员获取全部套餐
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func CreateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetSubscriptionPlan, plan.Id, nil, plan)
+	common.ApiSuccess(c, &plan)
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetSubscriptionPlanById(plan.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.CreatedTime = origin.CreatedTime
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetSubscriptionPlan, plan.Id, origin, plan)
+	common.ApiSuccess(c, &plan)
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	origin, err := model.GetSubscriptionPlanById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteSubscriptionPlanById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetSubscriptionPlan, id, origin, nil)
+	common.ApiSuccess(c, nil)
+}
+
+// GetAllSubscriptions 管理员查询订阅记录，支持按用户与状态筛选
+func GetAllSubscriptions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	subs, total, err := model.GetSubscriptions(userId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func genStripeSubscriptionLink(tradeNo string, customerId string, email string, plan *model.SubscriptionPlan) (string, error) {
+	if setting.StripeApiSecret == "" {
+		return "", fmt.Errorf("未配置Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(tradeNo),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/topup"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{"trade_no": tradeNo},
+		},
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+	}
+	if customerId == "" {
+		if email != "" {
+			params.CustomerEmail = stripe.String(email)
+		}
+	} else {
+		params.Customer = stripe.String(customerId)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+func upgradeStripeSubscription(subscriptionId string, plan *model.SubscriptionPlan) error {
+	if plan.StripePriceId == "" {
+		return errors.New("该套餐不支持 Stripe 支付")
+	}
+	stripe.Key = setting.StripeApiSecret
+	current, err := subscription.Get(subscriptionId, nil)
+	if err != nil {
+		return err
+	}
+	if current.Items == nil || len(current.Items.Data) == 0 {
+		return errors.New("Stripe 订阅缺少订阅项")
+	}
+	_, err = subscription.Update(subscriptionId, &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(current.Items.Data[0].ID),
+				Price: stripe.String(plan.StripePriceId),
+			},
+		},
+		ProrationBehavior: stripe.String("always_invoice"),
+		// 差价账单支付成功后才切换套餐
+		PaymentBehavior: stripe.String("pending_if_incomplete"),
+	})
+	return err
+}
+
+func cancelStripeSubscription(subscriptionId string) error {
+	stripe.Key = setting.StripeApiSecret
+	_, err := subscription.Update(subscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	return err
+}
+
+func stripeSubscriptionCheckoutCompleted(event stripe.Event) {
+	tradeNo := event.GetObjectValue("client_reference_id")
+	subscriptionId := event.GetObjectValue("subscription")
+	customerId := event.GetObjectValue("customer")
+	if err := model.ActivateSubscription(tradeNo, subscriptionId, customerId, 0, 0); err != nil {
+		log.Println("开通Stripe订阅失败", tradeNo, err.Error())
+		return
+	}
+	log.Printf("Stripe订阅开通成功：%s, %s", tradeNo, subscriptionId)
+}
+
+func stripeInvoicePaid(event stripe.Event) {
+	var invoice stripe.Invoice
+	if err := common.Unmarshal(event.Data.Raw, &invoice); err != nil || invoice.Subscription == nil {
+		return
+	}
+	// 升级产生的差价账单支付成功后完成升级，不影响计费周期
+	if invoice.BillingReason == stripe.InvoiceBillingReasonSubscriptionUpdate {
+		if _, err := model.UpgradeSubscriptionByExternalId(invoice.Subscription.ID); err != nil {
+			log.Println("Stripe订阅升级失败", invoice.Subscription.ID, err.Error())
+		}
+		return
+	}
+	// 首期账单由 checkout.session.completed 处理
+	if invoice.BillingReason != stripe.InvoiceBillingReasonSubscriptionCycle {
+		return
+	}
+	var periodStart, periodEnd int64
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && line.Period.End > periodEnd {
+				periodStart, periodEnd = line.Period.Start, line.Period.End
+			}
+		}
+	}
+	if err := model.RenewSubscription(invoice.Subscription.ID, periodStart, periodEnd); err != nil {
+		log.Println("Stripe订阅续费失败", invoice.Subscription.ID, err.Error())
+	}
+}
+
+func stripeInvoicePaymentFailed(event stripe.Event) {
+	var invoice stripe.Invoice
+	if err := common.Unmarshal(event.Data.Raw, &invoice); err != nil || invoice.Subscription == nil {
+		return
+	}
+	if err := model.MarkSubscriptionPastDue(invoice.Subscription.ID); err != nil {
+		log.Println("处理Stripe订阅扣款失败通知失败", invoice.Subscription.ID, err.Error())
+	}
+}
+
+func stripeSubscriptionUpdated(event stripe.Event) {
+	var stripeSub stripe.Subscription
+	if err := common.Unmarshal(event.Data.Raw, &stripeSub); err != nil {
+		return
+	}
+	sub, err := model.GetSubscriptionByExternalId(stripeSub.ID)
+	if err != nil {
+		return
+	}
+	if stripeSub.CancelAtPeriodEnd {
+		err = model.CancelSubscriptionAtPeriodEnd(sub.Id)
+	} else if sub.Status == model.SubscriptionStatusCanceled {
+		err = model.ResumeSubscription(sub.Id)
+	}
+	if err != nil {
+		log.Println("同步Stripe订阅状态失败", stripeSub.ID, err.Error())
+	}
+}
+
+func stripeSubscriptionDeleted(event stripe.Event) {
+	sub, err := model.GetSubscriptionByExternalId(event.GetObjectValue("id"))
+	if err != nil {
+		return
+	}
+	if err := model.LapseSubscription(sub.Id); err != nil {
+		log.Println("Stripe订阅失效处理失败", sub.ExternalId, err.Error())
+	}
+}
+
+// creemSubscriptionId 兼容 checkout 事件中 subscription 字段为 ID 字符串或对象两种格式
+func creemSubscriptionId(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var id string
+	if err := common.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	var obj struct {
+		Id string `json:"id"`
+	}
+	_ = common.Unmarshal(raw, &obj)
+	return obj.Id
+}
+
+func parseCreemTime(value string) int64 {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+func handleCreemSubscriptionCheckout(c *gin.Context, event *CreemWebhookEvent) {
+	referenceId := event.Object.RequestId
+	subscriptionId := creemSubscriptionId(event.Object.Subscription)
+	if err := model.ActivateSubscription(referenceId, subscriptionId, "", 0, 0); err != nil {
+		log.Printf("Creem订阅开通失败: %s, 订单号: %s", err.Error(), referenceId)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Creem订阅开通成功 - 订单号: %s, 订阅ID: %s", referenceId, subscriptionId)
+	c.Status(http.StatusOK)
+}
+
+func handleCreemSubscriptionEvent(c *gin.Context, event *CreemWebhookEvent) {
+	subscriptionId := event.Object.Id
+	var err error
+	switch event.EventType {
+	case "subscription.paid":
+		// 立即扣款的升级差价同样通过 subscription.paid 通知，商品与待升级套餐一致时完成升级
+		upgradeCreemSubscription(subscriptionId, event.Object.Product.Id)
+		err = model.RenewSubscription(subscriptionId,
+			parseCreemTime(event.Object.CurrentPeriodStartDate), parseCreemTime(event.Object.CurrentPeriodEndDate))
+	case "subscription.canceled":
+		var sub *model.Subscription
+		if sub, err = model.GetSubscriptionByExternalId(subscriptionId); err == nil {
+			err = model.CancelSubscriptionAtPeriodEnd(sub.Id)
+		}
+	case "subscription.expired":
+		// 周期结束仍未收到款项，Creem 会继续重试扣款
+		err = model.MarkSubscriptionPastDue(subscriptionId)
+	}
+	if err != nil {
+		// 首次 subscription.paid 可能早于 checkout.completed 到达，此时订阅尚未开通，忽略即可
+		log.Printf("处理Creem订阅事件失败 - %s, 订阅ID: %s, err: %v", event.EventType, subscriptionId, err)
+	}
+	c.Status(http.StatusOK)
+}
+
+func upgradeCreemSubscription(subscriptionId string, productId string) {
+	sub, err := model.GetSubscriptionByExternalId(subscriptionId)
+	if err != nil || sub.PendingPlanId == 0 {
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(sub.PendingPlanId)
+	if err != nil || plan.CreemProductId == "" || plan.CreemProductId != productId {
+		return
+	}
+	if _, err := model.UpgradeSubscription(sub.Id, plan); err != nil {
+		log.Printf("Creem订阅升级失败 - 订阅ID: %s, err: %v", subscriptionId, err)
+	}
+}
+
+// requestCreemSubscriptionApi 调用 Creem 订阅管理接口，action 为 upgrade 或 cancel
+func requestCreemSubscriptionApi(subscriptionId string, action string, body any) error {
+	if setting.CreemApiKey == "" {
+		return fmt.Errorf("未配置Creem API密钥")
+	}
+	if subscriptionId == "" {
+		return errors.New("未提供订阅 ID")
+	}
+	apiUrl := "https://api.creem.io/v1/subscriptions/"
+	if setting.CreemTestMode {
+		apiUrl = "https://test-api.creem.io/v1/subscriptions/"
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest("POST", apiUrl+subscriptionId+"/"+action, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Creem API http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
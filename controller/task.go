@@ -17,6 +17,8 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
@@ -30,6 +32,7 @@ func UpdateTaskBulk() {
 		common.SysLog("任务进度轮询开始")
 		ctx := context.TODO()
 		allTasks := model.GetAllUnFinishSyncTasks(constant.TaskQueryLimit)
+		allTasks = failTimeoutTasks(ctx, allTasks)
 		platformTask := make(map[constant.TaskPlatform][]*model.Task)
 		for _, t := range allTasks {
 			platformTask[t.Platform] = append(platformTask[t.Platform], t)
@@ -71,6 +74,49 @@ func UpdateTaskBulk() {
 	}
 }
 
+// failTimeoutTasks 将超过最长执行时间的任务标记为失败并退还额度，返回仍需轮询的任务
+func failTimeoutTasks(ctx context.Context, tasks []*model.Task) []*model.Task {
+	taskSetting := operation_setting.GetTaskSetting()
+	if !taskSetting.TimeoutEnabled {
+		return tasks
+	}
+	now := time.Now().Unix()
+	remaining := make([]*model.Task, 0, len(tasks))
+	for _, task := range tasks {
+		timeout := taskSetting.GetTimeoutSeconds(string(task.Platform))
+		if timeout <= 0 || task.SubmitTime == 0 || now-task.SubmitTime < timeout {
+			remaining = append(remaining, task)
+			continue
+		}
+		reason := fmt.Sprintf("task timed out after %d minutes", timeout/60)
+		if failAndRefundTask(ctx, task, reason) {
+			logger.LogInfo(ctx, fmt.Sprintf("Task %s (#%d) %s", task.TaskID, task.ID, reason))
+		}
+	}
+	return remaining
+}
+
+// failAndRefundTask 将未结束的任务标记为失败并退还预扣额度，任务已结束时返回 false
+func failAndRefundTask(ctx context.Context, task *model.Task, reason string) bool {
+	updated, err := model.TaskMarkFailureIfUnfinished(task.ID, reason)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Failed to mark task %s as failure: %s", task.TaskID, err.Error()))
+		return false
+	}
+	if !updated {
+		return false
+	}
+	if task.Quota != 0 {
+		if err := model.ConsumeBillingQuota(task.UserId, task.OrganizationId, -task.Quota); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to refund task %s: %s", task.TaskID, err.Error()))
+			return true
+		}
+		logContent := fmt.Sprintf("异步任务 %s 失败（%s），退还 %s", task.TaskID, reason, logger.LogQuota(task.Quota))
+		model.RecordLog(task.UserId, model.LogTypeRefund, logContent)
+	}
+	return true
+}
+
 func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
 	switch platform {
 	case constant.TaskPlatformMidjourney:
@@ -88,7 +134,7 @@ func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM
 	for channelId, taskIds := range taskChannelM {
 		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
 		if err != nil {
-			logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %d", channelId, err.Error()))
+			logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
 		}
 	}
 	return nil
@@ -141,7 +187,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		return err
 	}
 	if !responseItems.IsSuccess() {
-		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %d", channelId, len(taskIds), string(responseBody)))
+		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 响应: %s", channelId, len(taskIds), string(responseBody)))
 		return err
 	}
 
@@ -165,7 +211,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			} else {
 				quota := task.Quota
 				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
+					err = model.ConsumeBillingQuota(task.UserId, task.OrganizationId, -quota)
 					if err != nil {
 						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
@@ -274,3 +320,85 @@ func GetUserTask(c *gin.Context) {
 	pageInfo.SetItems(items)
 	common.ApiSuccess(c, pageInfo)
 }
+
+func CancelUserTask(c *gin.Context) {
+	if !operation_setting.GetTaskSetting().UserCancelEnabled {
+		common.ApiErrorMsg(c, "任务取消功能未启用")
+		return
+	}
+	userId := c.GetInt("id")
+	task, exist, err := model.GetByTaskId(userId, c.Param("task_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !exist {
+		common.ApiErrorMsg(c, "任务不存在")
+		return
+	}
+	if task.Status == model.TaskStatusFailure || task.Status == model.TaskStatusSuccess {
+		common.ApiErrorMsg(c, "任务已结束，无法取消")
+		return
+	}
+	if err := cancelUpstreamTask(task); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !failAndRefundTask(c, task, "cancelled by user") {
+		common.ApiErrorMsg(c, "任务已结束，无法取消")
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// cancelUpstreamTask 调用上游取消接口，上游无法取消的任务不允许取消，避免退款后上游仍在运行并计费
+func cancelUpstreamTask(task *model.Task) error {
+	if task.TaskID == "" {
+		// 尚未提交到上游
+		return nil
+	}
+	adaptor := relay.GetTaskAdaptor(task.Platform)
+	if adaptor == nil {
+		return errors.New("该平台的任务不支持取消")
+	}
+	canceler, ok := adaptor.(channel.TaskCancelAdaptor)
+	if !ok {
+		return errors.New("该平台的任务不支持取消")
+	}
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return fmt.Errorf("获取任务渠道失败: %w", err)
+	}
+	key, err := taskUpstreamKey(task, ch)
+	if err != nil {
+		return err
+	}
+	baseURL := constant.ChannelBaseURLs[ch.Type]
+	if ch.GetBaseURL() != "" {
+		baseURL = ch.GetBaseURL()
+	}
+	resp, err := canceler.CancelTask(baseURL, key, map[string]any{
+		"task_id": task.TaskID,
+		"action":  task.Action,
+	}, ch.GetSetting().Proxy)
+	if err != nil {
+		return fmt.Errorf("上游取消任务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("上游取消任务失败，状态码 %d: %s", resp.StatusCode, string(responseBody))
+	}
+	return nil
+}
+
+// taskUpstreamKey 返回提交任务时使用的 Key，多 Key 渠道必须使用任务记录的 Key
+func taskUpstreamKey(task *model.Task, ch *model.Channel) (string, error) {
+	if task.PrivateData.Key != "" {
+		return task.PrivateData.Key, nil
+	}
+	if ch.ChannelInfo.IsMultiKey {
+		return "", errors.New("无法确定任务提交时使用的密钥，不支持取消")
+	}
+	return ch.Key, nil
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+)
+
+func createTestTask(t *testing.T, userId int, status model.TaskStatus, quota int) *model.Task {
+	t.Helper()
+	task := &model.Task{
+		TaskID:   "task_" + strconv.Itoa(userId) + "_" + string(status),
+		Platform: constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeKling)),
+		UserId:   userId,
+		Quota:    quota,
+		Status:   status,
+	}
+	if err := model.DB.Create(task).Error; err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	return task
+}
+
+func TestFailAndRefundTaskRefundsOnce(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, 1000)
+	task := createTestTask(t, user.Id, model.TaskStatusInProgress, 300)
+
+	if !failAndRefundTask(context.Background(), task, "cancelled by user") {
+		t.Fatal("expected unfinished task to be failed")
+	}
+	if quota, err := model.GetUserQuota(user.Id, true); err != nil || quota != 1300 {
+		t.Fatalf("expected quota 1300 after refund, got %d, %v", quota, err)
+	}
+	if failAndRefundTask(context.Background(), task, "cancelled by user") {
+		t.Fatal("expected finished task not to be refunded again")
+	}
+	if quota, err := model.GetUserQuota(user.Id, true); err != nil || quota != 1300 {
+		t.Fatalf("expected quota to stay 1300, got %d, %v", quota, err)
+	}
+}
+
+func TestFailAndRefundTaskSkipsFinishedTask(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, 1000)
+	task := createTestTask(t, user.Id, model.TaskStatusSuccess, 300)
+
+	if failAndRefundTask(context.Background(), task, "timeout") {
+		t.Fatal("expected successful task not to be failed")
+	}
+	if quota, err := model.GetUserQuota(user.Id, true); err != nil || quota != 1000 {
+		t.Fatalf("expected quota 1000, got %d, %v", quota, err)
+	}
+}
+
+func TestPolledTaskDoesNotOverwriteCancelledTask(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, 1000)
+	task := createTestTask(t, user.Id, model.TaskStatusInProgress, 300)
+
+	// 轮询读取任务后，用户取消并退款
+	polled := *task
+	if !failAndRefundTask(context.Background(), task, "cancelled by user") {
+		t.Fatal("expected task to be cancelled")
+	}
+	polled.Status = model.TaskStatusSuccess
+	updated, err := polled.UpdateWithStatus(model.TaskStatusInProgress)
+	if err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	if updated {
+		t.Fatal("expected stale poll result not to overwrite cancelled task")
+	}
+	var saved model.Task
+	if err := model.DB.First(&saved, task.ID).Error; err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if saved.Status != model.TaskStatusFailure {
+		t.Fatalf("expected task to stay FAILURE, got %s", saved.Status)
+	}
+}
+
+func TestCancelUpstreamTaskRejectsUnsupportedPlatform(t *testing.T) {
+	task := &model.Task{TaskID: "upstream_id", Platform: constant.TaskPlatformSuno}
+	if err := cancelUpstreamTask(task); err == nil {
+		t.Fatal("expected cancel to be rejected for platform without upstream cancel")
+	}
+	task.Platform = constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeKling))
+	if err := cancelUpstreamTask(task); err == nil {
+		t.Fatal("expected cancel to be rejected for platform without upstream cancel")
+	}
+	// 尚未提交到上游的任务可以直接在本地取消
+	task.TaskID = ""
+	if err := cancelUpstreamTask(task); err != nil {
+		t.Fatalf("expected unsubmitted task to be cancellable, got %v", err)
+	}
+}
+
+func TestTaskUpstreamKey(t *testing.T) {
+	single := &model.Channel{Key: "sk-single"}
+	multi := &model.Channel{Key: "sk-a\nsk-b"}
+	multi.ChannelInfo.IsMultiKey = true
+
+	key, err := taskUpstreamKey(&model.Task{}, single)
+	if err != nil || key != "sk-single" {
+		t.Fatalf("expected channel key for single-key channel, got %q, %v", key, err)
+	}
+	key, err = taskUpstreamKey(&model.Task{PrivateData: model.TaskPrivateData{Key: "sk-b"}}, multi)
+	if err != nil || key != "sk-b" {
+		t.Fatalf("expected submitted key for multi-key channel, got %q, %v", key, err)
+	}
+	if _, err = taskUpstreamKey(&model.Task{}, multi); err == nil {
+		t.Fatal("expected error when multi-key task has no submitted key")
+	}
+}
@@ -120,6 +120,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 
 	// 记录原本的状态，防止重复退款
 	shouldRefund := false
+	var settle func()
 	quota := task.Quota
 	preStatus := task.Status
 
@@ -144,88 +145,91 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		}
 
 		// 如果返回了 total_tokens 并且配置了模型倍率(非固定价格),则重新计费
-		if taskResult.TotalTokens > 0 {
-			// 获取模型名称
-			var taskData map[string]interface{}
-			if err := json.Unmarshal(task.Data, &taskData); err == nil {
-				if modelName, ok := taskData["model"].(string); ok && modelName != "" {
-					// 获取模型价格和倍率
-					modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
-					// 只有配置了倍率(非固定价格)时才按 token 重新计费
-					if hasRatioSetting && modelRatio > 0 {
-						// 获取用户和组的倍率信息
-						group := task.Group
-						if group == "" {
-							user, err := model.GetUserById(task.UserId, false)
-							if err == nil {
-								group = user.Group
+		// 按 token 重新计费在任务状态保存成功后执行，任务已被取消时不再补扣或退还
+		settle = func() {
+			if taskResult.TotalTokens > 0 {
+				// 获取模型名称
+				var taskData map[string]interface{}
+				if err := json.Unmarshal(task.Data, &taskData); err == nil {
+					if modelName, ok := taskData["model"].(string); ok && modelName != "" {
+						// 获取模型价格和倍率
+						modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
+						// 只有配置了倍率(非固定价格)时才按 token 重新计费
+						if hasRatioSetting && modelRatio > 0 {
+							// 获取用户和组的倍率信息
+							group := task.Group
+							if group == "" {
+								user, err := model.GetUserById(task.UserId, false)
+								if err == nil {
+									group = user.Group
+								}
 							}
-						}
-						if group != "" {
-							groupRatio := ratio_setting.GetGroupRatio(group)
-							userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(group, group)
+							if group != "" {
+								groupRatio := ratio_setting.GetGroupRatio(group)
+								userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(group, group)
 
-							var finalGroupRatio float64
-							if hasUserGroupRatio {
-								finalGroupRatio = userGroupRatio
-							} else {
-								finalGroupRatio = groupRatio
-							}
+								var finalGroupRatio float64
+								if hasUserGroupRatio {
+									finalGroupRatio = userGroupRatio
+								} else {
+									finalGroupRatio = groupRatio
+								}
 
-							// 计算实际应扣费额度: totalTokens * modelRatio * groupRatio
-							actualQuota := int(float64(taskResult.TotalTokens) * modelRatio * finalGroupRatio)
+								// 计算实际应扣费额度: totalTokens * modelRatio * groupRatio
+								actualQuota := int(float64(taskResult.TotalTokens) * modelRatio * finalGroupRatio)
 
-							// 计算差额
-							preConsumedQuota := task.Quota
-							quotaDelta := actualQuota - preConsumedQuota
+								// 计算差额
+								preConsumedQuota := task.Quota
+								quotaDelta := actualQuota - preConsumedQuota
 
-							if quotaDelta > 0 {
-								// 需要补扣费
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
-									task.TaskID,
-									logger.LogQuota(quotaDelta),
-									logger.LogQuota(actualQuota),
-									logger.LogQuota(preConsumedQuota),
-									taskResult.TotalTokens,
-								))
-								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
-								} else {
-									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
-									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
+								if quotaDelta > 0 {
+									// 需要补扣费
+									logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+										task.TaskID,
+										logger.LogQuota(quotaDelta),
+										logger.LogQuota(actualQuota),
+										logger.LogQuota(preConsumedQuota),
+										taskResult.TotalTokens,
+									))
+									if err := model.ConsumeBillingQuota(task.UserId, task.OrganizationId, quotaDelta); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
+									} else {
+										model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
+										model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
+										task.Quota = actualQuota // 更新任务记录的实际扣费额度
 
-									// 记录消费日志
-									logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-								}
-							} else if quotaDelta < 0 {
-								// 需要退还多扣的费用
-								refundQuota := -quotaDelta
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
-									task.TaskID,
-									logger.LogQuota(refundQuota),
-									logger.LogQuota(actualQuota),
-									logger.LogQuota(preConsumedQuota),
-									taskResult.TotalTokens,
-								))
-								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
-								} else {
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
+										// 记录消费日志
+										logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
+											modelRatio, finalGroupRatio, taskResult.TotalTokens,
+											logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
+										model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+									}
+								} else if quotaDelta < 0 {
+									// 需要退还多扣的费用
+									refundQuota := -quotaDelta
+									logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+										task.TaskID,
+										logger.LogQuota(refundQuota),
+										logger.LogQuota(actualQuota),
+										logger.LogQuota(preConsumedQuota),
+										taskResult.TotalTokens,
+									))
+									if err := model.ConsumeBillingQuota(task.UserId, task.OrganizationId, -refundQuota); err != nil {
+										logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
+									} else {
+										task.Quota = actualQuota // 更新任务记录的实际扣费额度
 
-									// 记录退款日志
-									logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+										// 记录退款日志
+										logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
+											modelRatio, finalGroupRatio, taskResult.TotalTokens,
+											logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
+										model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+									}
+								} else {
+									// quotaDelta == 0, 预扣费刚好准确
+									logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费准确（%s，tokens：%d）",
+										task.TaskID, logger.LogQuota(actualQuota), taskResult.TotalTokens))
 								}
-							} else {
-								// quotaDelta == 0, 预扣费刚好准确
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费准确（%s，tokens：%d）",
-									task.TaskID, logger.LogQuota(actualQuota), taskResult.TotalTokens))
 							}
 						}
 					}
@@ -255,14 +259,29 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if taskResult.Progress != "" {
 		task.Progress = taskResult.Progress
 	}
-	if err := task.Update(); err != nil {
+	// 仅在状态未被其他流程（如用户取消、超时退款）修改时保存，防止覆盖已退款的任务
+	updated, err := task.UpdateWithStatus(preStatus)
+	if err != nil {
 		common.SysLog("UpdateVideoTask task error: " + err.Error())
-		shouldRefund = false
+		return nil
+	}
+	if !updated {
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s status changed concurrently or unchanged, skip update", task.TaskID))
+		return nil
+	}
+	if settle != nil {
+		settledQuota := task.Quota
+		settle()
+		if task.Quota != settledQuota {
+			if err := model.TaskUpdateQuota(task.ID, task.Quota); err != nil {
+				common.SysLog("UpdateVideoTask task quota error: " + err.Error())
+			}
+		}
 	}
 
 	if shouldRefund {
 		// 任务失败且之前状态不是失败才退还额度，防止重复退还
-		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
+		if err := model.ConsumeBillingQuota(task.UserId, task.OrganizationId, -quota); err != nil {
 			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
 		}
 		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota))
@@ -224,6 +224,18 @@ type CreemWebhookEvent struct {
 		Status   string            `json:"status"`
 		Metadata map[string]string `json:"metadata"`
 		Mode     string            `json:"mode"`
+		// 订阅相关字段：checkout 事件中的 subscription，以及订阅事件中的当前周期
+		Subscription           json.RawMessage `json:"subscription"`
+		CurrentPeriodStartDate string          `json:"current_period_start_date"`
+		CurrentPeriodEndDate   string          `json:"current_period_end_date"`
+		// 退款与拒付事件字段
+		RefundAmount int    `json:"refund_amount"`
+		Amount       int    `json:"amount"`
+		Reason       string `json:"reason"`
+		Checkout     struct {
+			Id        string `json:"id"`
+			RequestId string `json:"request_id"`
+		} `json:"checkout"`
 	} `json:"object"`
 }
 
@@ -285,6 +297,12 @@ func CreemWebhook(c *gin.Context) {
 	switch webhookEvent.EventType {
 	case "checkout.completed":
 		handleCheckoutCompleted(c, &webhookEvent)
+	case "subscription.paid", "subscription.canceled", "subscription.expired":
+		handleCreemSubscriptionEvent(c, &webhookEvent)
+	case "refund.created":
+		handleCreemRefund(c, &webhookEvent)
+	case "dispute.created":
+		handleCreemDispute(c, &webhookEvent)
 	default:
 		log.Printf("忽略Creem Webhook事件类型: %s", webhookEvent.EventType)
 		c.Status(http.StatusOK)
@@ -308,7 +326,13 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 		return
 	}
 
-	// 验证订单类型，目前只处理一次性付款
+	// 订阅产品的首次付款用于开通订阅
+	if event.Object.Order.Type == "recurring" {
+		handleCreemSubscriptionCheckout(c, event)
+		return
+	}
+
+	// 验证订单类型，一次性付款用于充值
 	if event.Object.Order.Type != "onetime" {
 		log.Printf("暂不支持的订单类型: %s, 跳过处理", event.Object.Order.Type)
 		c.Status(http.StatusOK)
@@ -355,6 +379,9 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	if err := model.SetTopUpExternalId(referenceId, event.Object.Order.Id); err != nil {
+		log.Printf("保存Creem订单ID失败: %s, 订单号: %s", err.Error(), referenceId)
+	}
 
 	log.Printf("Creem充值成功 - 订单号: %s, 充值额度: %d, 支付金额: %.2f",
 		referenceId, topUp.Amount, topUp.Money)
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/stripe/stripe-go/v81/refund"
+)
+
+type AdminRefundTopUpRequest struct {
+	TradeNo string  `json:"trade_no"`
+	Money   float64 `json:"money"` // 退款的支付金额，<=0 表示退还剩余全部
+	Reason  string  `json:"reason"`
+	// 是否同时通过支付平台原路退款，否则仅扣回本地额度
+	// Stripe 与 Creem 后台发起的退款会通过回调自动扣回额度，无需再调用本接口
+	RefundProvider bool `json:"refund_provider"`
+}
+
+// AdminRefundTopUp 管理员发起退款
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	// 订单级互斥，避免与支付平台的退款回调重复扣减
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	before := model.GetTopUpByTradeNo(req.TradeNo)
+	if before == nil {
+		common.ApiErrorMsg(c, "充值订单不存在")
+		return
+	}
+	money := req.Money
+	if money <= 0 {
+		money = before.RefundableMoney()
+	}
+	if money <= 0 || money > before.RefundableMoney() {
+		common.ApiErrorMsg(c, fmt.Sprintf("退款金额无效，订单剩余可退金额 %.2f", before.RefundableMoney()))
+		return
+	}
+
+	if req.RefundProvider {
+		if err := refundTopUpProvider(before, money); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+
+	after, quota, err := model.RefundTopUp(req.TradeNo, money, req.Reason)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetTopUp, after.Id, before, after)
+	common.ApiSuccess(c, gin.H{
+		"topup": after,
+		"quota": quota,
+	})
+}
+
+// refundTopUpProvider 通过支付平台原路退款
+func refundTopUpProvider(topUp *model.TopUp, money float64) error {
+	switch topUp.PaymentMethod {
+	case PaymentMethodStripe:
+		if topUp.ExternalId == "" {
+			return errors.New("订单缺少 Stripe 支付标识，请在 Stripe 后台退款")
+		}
+		stripe.Key = setting.StripeApiSecret
+		intent, err := paymentintent.Get(topUp.ExternalId, nil)
+		if err != nil {
+			return err
+		}
+		// Money 与 Stripe 实际扣款币种可能不同，按比例换算退款金额
+		amount := int64(float64(intent.AmountReceived) * money / topUp.Money)
+		if amount <= 0 {
+			return errors.New("退款金额过小")
+		}
+		_, err = refund.New(&stripe.RefundParams{
+			PaymentIntent: stripe.String(topUp.ExternalId),
+			Amount:        stripe.Int64(amount),
+		})
+		return err
+	case PaymentMethodCreem:
+		return errors.New("Creem 暂不支持通过 API 退款，请在 Creem 后台退款，退款回调会自动同步")
+	default:
+		return fmt.Errorf("支付方式 %s 不支持原路退款", topUp.PaymentMethod)
+	}
+}
+
+// stripeTopUpTradeNo 根据 PaymentIntent 查找充值订单号，兼容未保存支付标识的历史订单
+func stripeTopUpTradeNo(paymentIntentId string) string {
+	if paymentIntentId == "" {
+		return ""
+	}
+	if topUp := model.GetTopUpByExternalId(paymentIntentId); topUp != nil {
+		return topUp.TradeNo
+	}
+	stripe.Key = setting.StripeApiSecret
+	params := &stripe.CheckoutSessionListParams{PaymentIntent: stripe.String(paymentIntentId)}
+	params.Limit = stripe.Int64(1)
+	iter := session.List(params)
+	if iter.Next() && iter.CheckoutSession().ClientReferenceID != "" {
+		tradeNo := iter.CheckoutSession().ClientReferenceID
+		_ = model.SetTopUpExternalId(tradeNo, paymentIntentId)
+		return tradeNo
+	}
+	return ""
+}
+
+func stripeChargeRefunded(event stripe.Event) {
+	var charge stripe.Charge
+	if err := common.Unmarshal(event.Data.Raw, &charge); err != nil || charge.PaymentIntent == nil || charge.Amount <= 0 {
+		return
+	}
+	tradeNo := stripeTopUpTradeNo(charge.PaymentIntent.ID)
+	if tradeNo == "" {
+		log.Println("Stripe退款未匹配到充值订单", charge.PaymentIntent.ID)
+		return
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+	ratio := float64(charge.AmountRefunded) / float64(charge.Amount)
+	if err := model.SyncTopUpRefund(tradeNo, ratio, "Stripe refund"); err != nil {
+		log.Println("处理Stripe退款失败", tradeNo, err.Error())
+	}
+}
+
+func stripeDisputeCreated(event stripe.Event) {
+	var dispute stripe.Dispute
+	if err := common.Unmarshal(event.Data.Raw, &dispute); err != nil || dispute.PaymentIntent == nil {
+		return
+	}
+	tradeNo := stripeTopUpTradeNo(dispute.PaymentIntent.ID)
+	if tradeNo == "" {
+		log.Println("Stripe拒付未匹配到充值订单", dispute.PaymentIntent.ID)
+		return
+	}
+	ratio := 1.0
+	stripe.Key = setting.StripeApiSecret
+	if intent, err := paymentintent.Get(dispute.PaymentIntent.ID, nil); err == nil && intent.AmountReceived > 0 {
+		ratio = float64(dispute.Amount) / float64(intent.AmountReceived)
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+	if err := model.DisputeTopUp(tradeNo, ratio, string(dispute.Reason)); err != nil {
+		log.Println("处理Stripe拒付失败", tradeNo, err.Error())
+	}
+}
+
+func stripeDisputeClosed(event stripe.Event) {
+	var dispute stripe.Dispute
+	if err := common.Unmarshal(event.Data.Raw, &dispute); err != nil || dispute.PaymentIntent == nil {
+		return
+	}
+	tradeNo := stripeTopUpTradeNo(dispute.PaymentIntent.ID)
+	if tradeNo == "" {
+		return
+	}
+	// warning_closed 表示询问未升级为正式拒付，视同胜诉
+	won := dispute.Status == stripe.DisputeStatusWon || dispute.Status == stripe.DisputeStatusWarningClosed
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+	if err := model.ResolveTopUpDispute(tradeNo, won); err != nil {
+		log.Println("处理Stripe拒付结果失败", tradeNo, err.Error())
+	}
+}
+
+// creemTopUpTradeNo 优先使用 checkout 的 request_id，其次按 Creem 订单 ID 匹配
+func creemTopUpTradeNo(event *CreemWebhookEvent) string {
+	if event.Object.Checkout.RequestId != "" {
+		return event.Object.Checkout.RequestId
+	}
+	if topUp := model.GetTopUpByExternalId(event.Object.Order.Id); topUp != nil {
+		return topUp.TradeNo
+	}
+	return ""
+}
+
+func handleCreemRefund(c *gin.Context, event *CreemWebhookEvent) {
+	tradeNo := creemTopUpTradeNo(event)
+	if tradeNo == "" || event.Object.Order.Amount <= 0 {
+		log.Printf("Creem退款未匹配到充值订单: %s", event.Object.Order.Id)
+		c.Status(http.StatusOK)
+		return
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+	// refund.created 按笔通知退款，按退款 ID 去重
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		c.Status(http.StatusOK)
+		return
+	}
+	money := min(topUp.Money*float64(event.Object.RefundAmount)/float64(event.Object.Order.Amount), topUp.RefundableMoney())
+	if money > 0 {
+		if err := model.ApplyProviderRefund(tradeNo, event.Object.Id, money, event.Object.Reason); err != nil {
+			log.Printf("处理Creem退款失败: %s, 订单号: %s", err.Error(), tradeNo)
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+func handleCreemDispute(c *gin.Context, event *CreemWebhookEvent) {
+	tradeNo := creemTopUpTradeNo(event)
+	if tradeNo == "" {
+		log.Printf("Creem拒付未匹配到充值订单: %s", event.Object.Order.Id)
+		c.Status(http.StatusOK)
+		return
+	}
+	ratio := 1.0
+	if event.Object.Order.Amount > 0 && event.Object.Amount > 0 {
+		ratio = float64(event.Object.Amount) / float64(event.Object.Order.Amount)
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+	if err := model.DisputeTopUp(tradeNo, ratio, event.Object.Reason); err != nil {
+		log.Printf("处理Creem拒付失败: %s, 订单号: %s", err.Error(), tradeNo)
+	}
+	c.Status(http.StatusOK)
+}
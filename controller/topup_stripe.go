@@ -150,6 +150,20 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeInvoicePaid:
+		stripeInvoicePaid(event)
+	case stripe.EventTypeInvoicePaymentFailed:
+		stripeInvoicePaymentFailed(event)
+	case stripe.EventTypeCustomerSubscriptionUpdated:
+		stripeSubscriptionUpdated(event)
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		stripeSubscriptionDeleted(event)
+	case stripe.EventTypeChargeRefunded:
+		stripeChargeRefunded(event)
+	case stripe.EventTypeChargeDisputeCreated:
+		stripeDisputeCreated(event)
+	case stripe.EventTypeChargeDisputeClosed:
+		stripeDisputeClosed(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -166,11 +180,19 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
+	if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+		stripeSubscriptionCheckoutCompleted(event)
+		return
+	}
+
 	err := model.Recharge(referenceId, customerId)
 	if err != nil {
 		log.Println(err.Error(), referenceId)
 		return
 	}
+	if err := model.SetTopUpExternalId(referenceId, event.GetObjectValue("payment_intent")); err != nil {
+		log.Println("保存Stripe支付标识失败", referenceId, err.Error())
+	}
 
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
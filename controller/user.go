@@ -102,6 +102,7 @@ func setupLogin(user *model.User, c *gin.Context) {
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
+	session.Set("session_id", common.GetRandomString(16))
 	err := session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -457,6 +458,8 @@ func GetSelf(c *gin.Context) {
 		"oidc_id":           user.OidcId,
 		"wechat_id":         user.WeChatId,
 		"telegram_id":       user.TelegramId,
+		"ldap_id":           user.LdapId,
+		"saml_id":           user.SamlId,
 		"group":             user.Group,
 		"quota":             user.Quota,
 		"used_quota":        user.UsedQuota,
@@ -649,6 +652,13 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		if updatePassword {
+			// 密码不会出现在快照中，这里只标记其发生了变化
+			user.Password = updatedUser.Password
+		}
+		service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetUser, updatedUser.Id, originUser, user)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -795,6 +805,9 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 	err = model.HardDeleteUserById(id)
+	if err == nil {
+		service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetUser, id, originUser, nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -868,6 +881,7 @@ func CreateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetUser, cleanUser.Id, nil, cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -913,6 +927,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -940,6 +955,7 @@ func ManageUser(c *gin.Context) {
 			})
 			return
 		}
+		service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetUser, user.Id, originUser, nil)
 	case "promote":
 		if myRole != common.RoleRootUser {
 			c.JSON(http.StatusOK, gin.H{
@@ -978,6 +994,9 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if req.Action != "delete" {
+		service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetUser, user.Id, originUser, user)
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1245,6 +1264,8 @@ func UpdateUserSetting(c *gin.Context) {
 		QuotaWarningThreshold: req.QuotaWarningThreshold,
 		AcceptUnsetRatioModel: req.AcceptUnsetModelRatioModel,
 		RecordIpLog:           req.RecordIpLog,
+		// 令牌分组限制由管理员规则维护，用户不可修改
+		AllowedTokenGroups: user.GetSetting().AllowedTokenGroups,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
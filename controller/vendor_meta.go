@@ -5,6 +5,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -78,6 +79,7 @@ func CreateVendorMeta(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionCreate, model.AuditTargetVendor, v.Id, nil, v)
 	common.ApiSuccess(c, &v)
 }
 
@@ -101,10 +103,14 @@ func UpdateVendorMeta(c *gin.Context) {
 		return
 	}
 
+	origin, _ := model.GetVendorByID(v.Id)
 	if err := v.Update(); err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if updated, err := model.GetVendorByID(v.Id); err == nil {
+		service.RecordAudit(c, model.AuditActionUpdate, model.AuditTargetVendor, v.Id, origin, updated)
+	}
 	common.ApiSuccess(c, &v)
 }
 
@@ -116,9 +122,11 @@ func DeleteVendorMeta(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	origin, _ := model.GetVendorByID(id)
 	if err := model.DB.Delete(&model.Vendor{}, id).Error; err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, model.AuditActionDelete, model.AuditTargetVendor, id, origin, nil)
 	common.ApiSuccess(c, nil)
 }
@@ -23,6 +23,15 @@ const (
 	AwsKeyTypeApiKey AwsKeyType = "api_key"
 )
 
+type AwsApiMode string
+
+const (
+	AwsApiModeAuto     AwsApiMode = ""         // 默认：Claude 模型使用 InvokeModel，其余模型使用 Converse
+	AwsApiModeConverse AwsApiMode = "converse" // 全部模型使用 Converse
+)
+
+const AwsCrossRegionNone = "none"
+
 type ChannelOtherSettings struct {
 	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
 	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
@@ -31,6 +40,42 @@ type ChannelOtherSettings struct {
 	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
 	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	// AWS Bedrock：请求模型到 Bedrock 模型 ID 或推理配置文件 ARN 的映射，优先于内置映射
+	AwsModelIdMap map[string]string `json:"aws_model_id_map,omitempty"`
+	// AWS Bedrock 跨区域推理前缀：空为按内置表自动选择，"none" 为禁用，也可指定 us、eu、apac、global 等
+	AwsCrossRegion string     `json:"aws_cross_region,omitempty"`
+	AwsApiMode     AwsApiMode `json:"aws_api_mode,omitempty"`
+	// 上游成本：CostPrices 按模型配置成本价，未配置的模型按 CostRatio 乘以基础计费（不含分组倍率）估算
+	CostRatio  float64                     `json:"cost_ratio,omitempty"`
+	CostPrices map[string]ChannelCostPrice `json:"cost_prices,omitempty"`
+	// 用量上限：按自然日、自然月统计渠道消耗的额度与请求数，达到上限后暂停调度至下个周期，0 表示不限
+	DailyQuotaLimit     int64 `json:"daily_quota_limit,omitempty"`
+	MonthlyQuotaLimit   int64 `json:"monthly_quota_limit,omitempty"`
+	DailyRequestLimit   int64 `json:"daily_request_limit,omitempty"`
+	MonthlyRequestLimit int64 `json:"monthly_request_limit,omitempty"`
+	// 可用时段：配置后仅在任一时段内参与调度
+	AvailabilityWindows []ChannelAvailabilityWindow `json:"availability_windows,omitempty"`
+	// 用量周期与可用时段使用的时区，为空时使用服务器时区
+	LimitTimezone string `json:"limit_timezone,omitempty"`
+	// 并发上限：渠道与单个 Key 同时处理的最大请求数（按节点统计），0 表示不限
+	MaxConcurrency    int `json:"max_concurrency,omitempty"`
+	MaxKeyConcurrency int `json:"max_key_concurrency,omitempty"`
+}
+
+// ChannelAvailabilityWindow 渠道可用时段，StartClock 晚于 EndClock 时表示跨天
+type ChannelAvailabilityWindow struct {
+	Weekdays   []int  `json:"weekdays,omitempty"` // 0 表示周日，为空表示每天
+	StartClock string `json:"start_clock"`        // HH:MM
+	EndClock   string `json:"end_clock"`
+}
+
+// ChannelCostPrice 渠道的上游成本价，单位为美元，token 价格按每百万 tokens 计
+type ChannelCostPrice struct {
+	InputPrice      float64 `json:"input_price,omitempty"`
+	OutputPrice     float64 `json:"output_price,omitempty"`
+	CacheReadPrice  float64 `json:"cache_read_price,omitempty"`  // 为 0 时按 InputPrice 计
+	CacheWritePrice float64 `json:"cache_write_price,omitempty"` // 为 0 时按 InputPrice 计
+	CallPrice       float64 `json:"call_price,omitempty"`        // 按次成本
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
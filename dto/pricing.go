@@ -1,6 +1,12 @@
 package dto
 
-import "github.com/QuantumNous/new-api/constant"
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+)
 
 // 这里不好动就不动了，本来想独立出来的（
 type OpenAIModels struct {
@@ -9,6 +15,82 @@ type OpenAIModels struct {
 	Created                int                     `json:"created"`
 	OwnedBy                string                  `json:"owned_by"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
+	*ModelCapabilities
+}
+
+// 模型支持的输入输出模态
+const (
+	ModalityText  = "text"
+	ModalityImage = "image"
+	ModalityAudio = "audio"
+	ModalityVideo = "video"
+	ModalityFile  = "file"
+)
+
+// ModelCapabilities 模型能力元数据，字段为空表示未知
+type ModelCapabilities struct {
+	ContextWindow     int    `json:"context_window,omitempty"`
+	MaxOutputTokens   int    `json:"max_output_tokens,omitempty"`
+	InputModalities   string `json:"input_modalities,omitempty" gorm:"type:varchar(64)"`  // 逗号分隔，如 text,image
+	OutputModalities  string `json:"output_modalities,omitempty" gorm:"type:varchar(64)"` // 逗号分隔，如 text
+	SupportsTools     bool   `json:"supports_tools,omitempty"`
+	SupportsReasoning bool   `json:"supports_reasoning,omitempty"`
+	KnowledgeCutoff   string `json:"knowledge_cutoff,omitempty" gorm:"type:varchar(32)"` // 如 2024-06
+}
+
+func (m *ModelCapabilities) IsEmpty() bool {
+	return *m == ModelCapabilities{}
+}
+
+// SupportsInputModality 未配置输入模态时视为支持
+func (m *ModelCapabilities) SupportsInputModality(modality string) bool {
+	if strings.TrimSpace(m.InputModalities) == "" {
+		return true
+	}
+	for _, item := range strings.Split(m.InputModalities, ",") {
+		if strings.TrimSpace(item) == modality {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeModalities(modalities string) (string, error) {
+	items := make([]string, 0)
+	for _, item := range strings.Split(modalities, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		switch item {
+		case ModalityText, ModalityImage, ModalityAudio, ModalityVideo, ModalityFile:
+		default:
+			return "", errors.New("unsupported modality: " + item)
+		}
+		if !slices.Contains(items, item) {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ","), nil
+}
+
+// Normalize 校验数值并规范化模态列表
+func (m *ModelCapabilities) Normalize() error {
+	if m.ContextWindow < 0 || m.MaxOutputTokens < 0 {
+		return errors.New("context_window and max_output_tokens must not be negative")
+	}
+	if m.ContextWindow > 0 && m.MaxOutputTokens > m.ContextWindow {
+		return errors.New("max_output_tokens must not exceed context_window")
+	}
+	var err error
+	if m.InputModalities, err = normalizeModalities(m.InputModalities); err != nil {
+		return err
+	}
+	if m.OutputModalities, err = normalizeModalities(m.OutputModalities); err != nil {
+		return err
+	}
+	m.KnowledgeCutoff = strings.TrimSpace(m.KnowledgeCutoff)
+	return nil
 }
 
 type AnthropicModel struct {
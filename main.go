@@ -45,6 +45,22 @@ func main() {
 		return
 	}
 
+	if *common.RotateSecret {
+		result, err := model.RotateSecrets()
+		if err != nil {
+			common.FatalLog("failed to rotate secrets: " + err.Error())
+		}
+		common.SysLog(fmt.Sprintf("secrets rotated: %d channels, %d options, %d users", result.Channels, result.Options, result.Users))
+		return
+	}
+
+	if *common.ExportConfigFile != "" || *common.ImportConfigFile != "" {
+		if err := runConfigSync(); err != nil {
+			common.FatalLog("config sync failed: " + err.Error())
+		}
+		return
+	}
+
 	common.SysLog("New API " + common.Version + " started")
 	if os.Getenv("GIN_MODE") != "debug" {
 		gin.SetMode(gin.ReleaseMode)
@@ -89,9 +105,21 @@ func main() {
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
+	// 定时生效的配置修改
+	if common.IsMasterNode {
+		go model.ActivateScheduledOptions(10)
+	}
+
+	// 订阅套餐
+	model.RefreshSubscriptionPlanCache()
+	go model.SyncSubscriptions(60)
+
 	// 数据看板
 	go model.UpdateQuotaData()
 
+	// 状态页模型可用性统计
+	go model.UpdateModelStatusStats(60)
+
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
@@ -102,6 +130,8 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	go controller.AutomaticallyProbeChannels()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -258,3 +288,55 @@ func InitResources() error {
 	}
 	return nil
 }
+
+// runConfigSync 处理 --export-config / --import-config 命令行模式，用于将版本库中的配置应用到实例
+func runConfigSync() error {
+	if *common.ExportConfigFile != "" {
+		doc, err := model.ExportConfigDocument(*common.ConfigKeys)
+		if err != nil {
+			return err
+		}
+		format := service.ConfigFormatYAML
+		if strings.HasSuffix(*common.ExportConfigFile, ".json") {
+			format = service.ConfigFormatJSON
+		}
+		data, err := service.EncodeConfigDocument(doc, format)
+		if err != nil {
+			return err
+		}
+		if *common.ExportConfigFile == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(*common.ExportConfigFile, data, 0600); err != nil {
+			return err
+		}
+		common.SysLog("config exported to " + *common.ExportConfigFile)
+		return nil
+	}
+
+	data, err := os.ReadFile(*common.ImportConfigFile)
+	if err != nil {
+		return err
+	}
+	doc, err := service.DecodeConfigDocument(data)
+	if err != nil {
+		return err
+	}
+	if err := model.PrepareConfigDocument(doc); err != nil {
+		return err
+	}
+	plan, err := service.PlanConfigImport(doc, *common.ConfigPrune)
+	if err != nil {
+		return err
+	}
+	fmt.Print(service.FormatConfigPlan(plan))
+	if *common.ConfigDryRun || len(plan) == 0 {
+		return nil
+	}
+	if err := model.ApplyConfigDocument(doc, *common.ConfigPrune, 0, ""); err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("config imported from %s: %d changes applied", *common.ImportConfigFile, len(plan)))
+	return nil
+}
@@ -128,6 +128,9 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Set("group", session.Get("group"))
 	c.Set("user_group", session.Get("group"))
 	c.Set("use_access_token", useAccessToken)
+	if sessionId, ok := session.Get("session_id").(string); ok {
+		c.Set("session_id", sessionId)
+	}
 
 	//userCache, err := model.GetUserCache(id.(int))
 	//if err != nil {
@@ -266,7 +269,8 @@ func TokenAuth() func(c *gin.Context) {
 		tokenGroup := token.Group
 		if tokenGroup != "" {
 			// check common.UserUsableGroups[userGroup]
-			if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+			usableGroups := service.FilterAllowedTokenGroups(service.GetUserUsableGroups(userGroup), userCache.GetSetting())
+			if _, ok := usableGroups[tokenGroup]; !ok {
 				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
 				return
 			}
@@ -279,6 +283,18 @@ func TokenAuth() func(c *gin.Context) {
 			}
 			userGroup = tokenGroup
 		}
+		// 令牌分组限制作用于实际使用的分组，包括未指定分组时的用户分组与 auto 解析出的分组
+		if userSetting := userCache.GetSetting(); len(userSetting.AllowedTokenGroups) > 0 {
+			if userGroup == "auto" {
+				if len(service.GetContextUserAutoGroup(c)) == 0 {
+					abortWithOpenAiMessage(c, http.StatusForbidden, "无权访问 auto 分组")
+					return
+				}
+			} else if !service.IsTokenGroupAllowed(userGroup, userSetting) {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", userGroup))
+				return
+			}
+		}
 		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
 
 		err = SetupContextForToken(c, token, parts...)
@@ -308,6 +324,7 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 		c.Set("token_model_limit_enabled", false)
 	}
 	c.Set("token_group", token.Group)
+	common.SetContextKey(c, constant.ContextKeyTokenOrganizationId, token.OrganizationId)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const routedModelHeader = "X-New-Api-Routed-Model"
+
+// autoRouteRelayFormat 虚拟模型仅支持可解析出消息内容的对话类接口
+func autoRouteRelayFormat(path string) (types.RelayFormat, bool) {
+	switch {
+	case strings.HasPrefix(path, "/v1/chat/completions"), strings.HasPrefix(path, "/pg/chat/completions"), strings.HasPrefix(path, "/v1/completions"):
+		return types.RelayFormatOpenAI, true
+	case strings.HasPrefix(path, "/v1/messages"):
+		return types.RelayFormatClaude, true
+	case strings.HasPrefix(path, "/v1/responses"):
+		return types.RelayFormatOpenAIResponses, true
+	}
+	return "", false
+}
+
+func isReasoningEffortSet(effort string) bool {
+	return effort != "" && effort != "none" && effort != "minimal"
+}
+
+func isJsonNonEmpty(raw []byte) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	return trimmed != "" && trimmed != "null" && trimmed != "[]" && trimmed != "{}"
+}
+
+// routeRequirements 解析请求中的图片、工具、结构化输出与推理强度，并估算输入 token 数
+func routeRequirements(c *gin.Context) (service.RouteRequirements, error) {
+	format, ok := autoRouteRelayFormat(c.Request.URL.Path)
+	if !ok {
+		return service.RouteRequirements{}, errors.New("virtual models are not supported on this endpoint")
+	}
+	request, err := helper.GetAndValidateRequest(c, format)
+	if err != nil {
+		return service.RouteRequirements{}, err
+	}
+	meta := request.GetTokenCountMeta()
+	info := &relaycommon.RelayInfo{
+		RelayFormat: format,
+		RelayMode:   relayconstant.Path2RelayMode(c.Request.URL.Path),
+		IsStream:    request.IsStream(c),
+	}
+	tokens, err := service.EstimateRequestToken(c, meta, info)
+	if err != nil {
+		return service.RouteRequirements{}, err
+	}
+	req := service.NewRouteRequirements(meta, tokens)
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		req.Tools = req.Tools || len(r.Tools) > 0
+		req.JsonSchema = r.ResponseFormat != nil && r.ResponseFormat.Type == "json_schema"
+		req.Reasoning = isReasoningEffortSet(r.ReasoningEffort)
+	case *dto.ClaudeRequest:
+		req.Reasoning = r.Thinking != nil && r.Thinking.Type != "disabled"
+	case *dto.OpenAIResponsesRequest:
+		req.Tools = isJsonNonEmpty(r.Tools)
+		req.Reasoning = r.Reasoning != nil && isReasoningEffortSet(r.Reasoning.Effort)
+		if isJsonNonEmpty(r.Text) {
+			var text struct {
+				Format struct {
+					Type string `json:"type"`
+				} `json:"format"`
+			}
+			if common.Unmarshal(r.Text, &text) == nil {
+				req.JsonSchema = text.Format.Type == "json_schema"
+			}
+		}
+	}
+	return req, nil
+}
+
+// resolveVirtualModel 将虚拟模型解析为满足请求能力且费用最低的实际模型与分组
+func resolveVirtualModel(c *gin.Context, virtualModel string, group string, allowed func(string) bool) (string, string, error) {
+	req, err := routeRequirements(c)
+	if err != nil {
+		return "", "", err
+	}
+	return service.ResolveVirtualModel(c, virtualModel, group, req, allowed)
+}
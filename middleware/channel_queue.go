@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const channelSlotContextKey = "channel_slot"
+
+// 排队超时等错误已以 SSE 事件写入响应时设置，调用方不再写入 JSON 错误
+const channelQueueErrorWrittenContextKey = "channel_queue_error_written"
+
+// 排队期间即使未被唤醒也定期重新尝试，覆盖唤醒丢失或渠道配置变更的情况
+const channelQueueRetryInterval = time.Second
+
+type channelSlot struct {
+	channelId int
+	keyIndex  int
+}
+
+func newChannelBusyError(err error) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeChannelBusy, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+}
+
+// acquireChannelSlot 释放上一次占用的槽位，并占用当前渠道与 Key 的并发槽位
+func acquireChannelSlot(c *gin.Context, channel *model.Channel, keyIndex int) *types.NewAPIError {
+	ReleaseChannelSlot(c)
+	if !model.TryAcquireChannelSlot(channel, keyIndex) {
+		return newChannelBusyError(fmt.Errorf("channel #%d has reached its concurrency limit", channel.Id))
+	}
+	c.Set(channelSlotContextKey, channelSlot{channelId: channel.Id, keyIndex: keyIndex})
+	return nil
+}
+
+// releaseChannelSlot 释放当前请求占用的并发槽位
+func ReleaseChannelSlot(c *gin.Context) {
+	v, ok := c.Get(channelSlotContextKey)
+	if !ok {
+		return
+	}
+	if slot, ok := v.(channelSlot); ok {
+		model.ReleaseChannelSlot(slot.channelId, slot.keyIndex)
+	}
+	delete(c.Keys, channelSlotContextKey)
+}
+
+func isStreamRequest(c *gin.Context) bool {
+	if strings.Contains(c.Request.URL.Path, ":streamGenerateContent") {
+		return true
+	}
+	if !strings.Contains(c.ContentType(), "json") {
+		return false
+	}
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return false
+	}
+	return req.Stream
+}
+
+// ChannelQueueErrorWritten 判断排队错误是否已经以 SSE 事件写入响应
+func ChannelQueueErrorWritten(c *gin.Context) bool {
+	return c.GetBool(channelQueueErrorWrittenContextKey)
+}
+
+// writeChannelQueueStreamError 流式请求排队期间已发送 keepalive，响应头已写出，错误只能以 SSE 事件返回
+func writeChannelQueueStreamError(c *gin.Context, apiErr *types.NewAPIError) {
+	apiErr.SetMessage(common.MessageWithRequestId(apiErr.Error(), c.GetString(common.RequestIdKey)))
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		c.Render(-1, common.CustomEvent{Data: "event: error\n"})
+		_ = helper.ObjectData(c, gin.H{"type": "error", "error": apiErr.ToClaudeError()})
+	} else {
+		_ = helper.ObjectData(c, gin.H{"error": apiErr.ToOpenAIError()})
+	}
+	c.Set(channelQueueErrorWrittenContextKey, true)
+	logger.LogError(c, fmt.Sprintf("user %d | %s", c.GetInt("id"), apiErr.Error()))
+}
+
+func channelQueueCandidates(c *gin.Context, group string, modelName string) []int {
+	if channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId); ok {
+		if id, err := strconv.Atoi(channelId.(string)); err == nil {
+			return []int{id}
+		}
+	}
+	return service.GetCandidateChannelIds(c, group, modelName)
+}
+
+// SelectChannelWithQueue 调用 selectChannel 选择渠道并设置渠道上下文。
+// 所有候选渠道并发均已满时，请求进入等待队列，直到有槽位释放或超时；流式请求排队期间发送 keepalive。
+// 选择成功但设置上下文失败时同时返回渠道与错误，由调用方决定是否继续。
+// 已发送 keepalive 后选择失败时，错误以 SSE 事件写入响应，调用方可通过 ChannelQueueErrorWritten 判断。
+func SelectChannelWithQueue(c *gin.Context, group string, modelName string, selectChannel func() (*model.Channel, *types.NewAPIError)) (channel *model.Channel, apiErr *types.NewAPIError) {
+	setting := operation_setting.GetChannelQueueSetting()
+	var (
+		waiter   *model.ChannelWaiter
+		deadline time.Time
+		lastPing time.Time
+		stream   bool
+		pinged   bool
+		woken    bool
+	)
+	defer func() {
+		if waiter != nil {
+			waiter.Leave()
+		}
+		if pinged && channel == nil && apiErr != nil {
+			writeChannelQueueStreamError(c, apiErr)
+		}
+	}()
+	// 重试时先释放上一个渠道的槽位，避免请求与自身竞争
+	ReleaseChannelSlot(c)
+	for {
+		channel, apiErr = selectChannel()
+		if apiErr == nil {
+			apiErr = SetupContextForSelectedChannel(c, channel, modelName)
+		}
+		if apiErr == nil || apiErr.GetErrorCode() != types.ErrorCodeChannelBusy {
+			return channel, apiErr
+		}
+		if !setting.Enabled || setting.TimeoutSeconds <= 0 {
+			return nil, apiErr
+		}
+
+		if waiter == nil {
+			deadline = time.Now().Add(time.Duration(setting.TimeoutSeconds) * time.Second)
+			lastPing = time.Now()
+			stream = isStreamRequest(c)
+			logger.LogInfo(c, fmt.Sprintf("all channels for model %s are busy, waiting in queue", modelName))
+		}
+		// 首次排队进入队尾；被唤醒后仍未抢到槽位则回到队首，保持先来先服务
+		if waiter == nil || woken {
+			var err error
+			waiter, err = model.EnqueueChannelWaiter(channelQueueCandidates(c, group, modelName), c.GetInt("id"), waiter != nil)
+			if err != nil {
+				waiter = nil
+				return nil, newChannelBusyError(err)
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, newChannelBusyError(errors.New("timed out waiting for an available channel"))
+		}
+		timer := time.NewTimer(min(remaining, channelQueueRetryInterval))
+		woken = false
+		select {
+		case <-waiter.Ready():
+			woken = true
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			return nil, newChannelBusyError(c.Request.Context().Err())
+		}
+		timer.Stop()
+
+		if stream {
+			pingInterval := helper.DefaultPingInterval
+			if generalSetting := operation_setting.GetGeneralSetting(); generalSetting.PingIntervalEnabled && generalSetting.PingIntervalSeconds > 0 {
+				pingInterval = time.Duration(generalSetting.PingIntervalSeconds) * time.Second
+			}
+			if time.Since(lastPing) >= pingInterval {
+				helper.SetEventStreamHeaders(c)
+				_ = helper.PingData(c)
+				lastPing = time.Now()
+				pinged = true
+			}
+		}
+	}
+}
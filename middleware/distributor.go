@@ -12,9 +12,11 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -29,6 +31,7 @@ type ModelRequest struct {
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		var channel *model.Channel
+		selected := false
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
@@ -54,6 +57,7 @@ func Distribute() func(c *gin.Context) {
 			// Select a channel for the user
 			// check token model mapping
 			modelLimitEnable := common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled)
+			var tokenModelLimit map[string]bool
 			if modelLimitEnable {
 				s, ok := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
 				if !ok {
@@ -61,7 +65,6 @@ func Distribute() func(c *gin.Context) {
 					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
 					return
 				}
-				var tokenModelLimit map[string]bool
 				tokenModelLimit, ok = s.(map[string]bool)
 				if !ok {
 					tokenModelLimit = map[string]bool{}
@@ -78,7 +81,6 @@ func Distribute() func(c *gin.Context) {
 					abortWithOpenAiMessage(c, http.StatusBadRequest, "未指定模型名称，模型名称不能为空")
 					return
 				}
-				var selectGroup string
 				usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 				// check path is /pg/chat/completions
 				if strings.HasPrefix(c.Request.URL.Path, "/pg/chat/completions") {
@@ -97,29 +99,82 @@ func Distribute() func(c *gin.Context) {
 						common.SetContextKey(c, constant.ContextKeyUsingGroup, usingGroup)
 					}
 				}
-				channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
-				if err != nil {
-					showGroup := usingGroup
+				routeGroup := usingGroup
+				// 虚拟模型：按请求能力解析为实际模型后再选择渠道
+				if _, isVirtual := model_setting.GetVirtualModel(modelRequest.Model); isVirtual {
+					var allowed func(string) bool
+					if modelLimitEnable {
+						allowed = func(name string) bool {
+							return tokenModelLimit[ratio_setting.FormatMatchingModelName(name)]
+						}
+					}
+					routedModel, routedGroup, err := resolveVirtualModel(c, modelRequest.Model, usingGroup, allowed)
+					if err != nil {
+						abortWithOpenAiMessage(c, http.StatusBadRequest, fmt.Sprintf("虚拟模型 %s 解析失败: %s", modelRequest.Model, err.Error()), string(types.ErrorCodeModelNotFound))
+						return
+					}
+					logger.LogInfo(c, fmt.Sprintf("virtual model %s routed to %s (group %s)", modelRequest.Model, routedModel, routedGroup))
+					common.SetContextKey(c, constant.ContextKeyVirtualModel, modelRequest.Model)
+					c.Header(routedModelHeader, routedModel)
+					modelRequest.Model = routedModel
 					if usingGroup == "auto" {
-						showGroup = fmt.Sprintf("auto(%s)", selectGroup)
+						routeGroup = routedGroup
+						c.Set("auto_group", routedGroup)
 					}
-					message := fmt.Sprintf("获取分组 %s 下模型 %s 的可用渠道失败（distributor）: %s", showGroup, modelRequest.Model, err.Error())
-					// 如果错误，但是渠道不为空，说明是数据库一致性问题
-					//if channel != nil {
-					//	common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
-					//	message = "数据库一致性已被破坏，请联系管理员"
-					//}
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message, string(types.ErrorCodeModelNotFound))
-					return
 				}
+				var apiErr *types.NewAPIError
+				channel, apiErr = SelectChannelWithQueue(c, routeGroup, modelRequest.Model, func() (*model.Channel, *types.NewAPIError) {
+					ch, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, routeGroup, modelRequest.Model, 0)
+					if errors.Is(err, model.ErrAllChannelsBusy) {
+						return nil, newChannelBusyError(err)
+					}
+					if err != nil {
+						showGroup := usingGroup
+						if usingGroup == "auto" {
+							showGroup = fmt.Sprintf("auto(%s)", selectGroup)
+						}
+						message := fmt.Sprintf("获取分组 %s 下模型 %s 的可用渠道失败（distributor）: %s", showGroup, modelRequest.Model, err.Error())
+						// 如果错误，但是渠道不为空，说明是数据库一致性问题
+						//if channel != nil {
+						//	common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
+						//	message = "数据库一致性已被破坏，请联系管理员"
+						//}
+						return nil, types.NewErrorWithStatusCode(errors.New(message), types.ErrorCodeModelNotFound, http.StatusServiceUnavailable)
+					}
+					if ch == nil {
+						return nil, types.NewErrorWithStatusCode(fmt.Errorf("分组 %s 下模型 %s 无可用渠道（distributor）", usingGroup, modelRequest.Model), types.ErrorCodeModelNotFound, http.StatusServiceUnavailable)
+					}
+					return ch, nil
+				})
 				if channel == nil {
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("分组 %s 下模型 %s 无可用渠道（distributor）", usingGroup, modelRequest.Model), string(types.ErrorCodeModelNotFound))
+					if ChannelQueueErrorWritten(c) {
+						c.Abort()
+						return
+					}
+					abortWithOpenAiMessage(c, apiErr.StatusCode, apiErr.Error(), string(apiErr.GetErrorCode()))
+					return
+				}
+				selected = true
+			}
+		}
+		if channel != nil && !selected {
+			// 指定渠道时同样受并发限制，已满时排队等待
+			specificChannel := channel
+			if channel, apiErr := SelectChannelWithQueue(c, "", modelRequest.Model, func() (*model.Channel, *types.NewAPIError) {
+				return specificChannel, nil
+			}); channel == nil {
+				if ChannelQueueErrorWritten(c) {
+					c.Abort()
 					return
 				}
+				abortWithOpenAiMessage(c, apiErr.StatusCode, apiErr.Error(), string(apiErr.GetErrorCode()))
+				return
 			}
+		} else if !selected {
+			SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 		}
+		defer ReleaseChannelSlot(c)
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 		c.Next()
 	}
 }
@@ -307,17 +362,19 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, channel.GetOtherSettings())
 	common.SetContextKey(c, constant.ContextKeyChannelParamOverride, channel.GetParamOverride())
 	common.SetContextKey(c, constant.ContextKeyChannelHeaderOverride, channel.GetHeaderOverride())
-	if nil != channel.OpenAIOrganization && *channel.OpenAIOrganization != "" {
-		common.SetContextKey(c, constant.ContextKeyChannelOrganization, *channel.OpenAIOrganization)
-	}
 	common.SetContextKey(c, constant.ContextKeyChannelAutoBan, channel.GetAutoBan())
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	key, index, newAPIError := channel.GetNextEnabledKey(modelName)
 	if newAPIError != nil {
 		return newAPIError
 	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyChannelSkipSlot) {
+		if newAPIError = acquireChannelSlot(c, channel, index); newAPIError != nil {
+			return newAPIError
+		}
+	}
 	if channel.ChannelInfo.IsMultiKey {
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
 		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
@@ -327,7 +384,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	// c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
-	common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, channel.GetBaseURL())
+	// 多 Key 模式下 Key 可以覆盖渠道的 BaseURL 与 Organization
+	common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, channel.GetKeyBaseURL(index))
+	common.SetContextKey(c, constant.ContextKeyChannelOrganization, channel.GetKeyOrganization(index))
 
 	common.SetContextKey(c, constant.ContextKeySystemPromptOverride, false)
 
@@ -353,6 +412,21 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	return nil
 }
 
+// NewSubRequestContext 为同一请求内向其他渠道发起的子请求创建上下文，继承用户、令牌与分组信息
+// 子请求使用自己的请求体，不继承父请求缓存的请求体与已占用的渠道并发槽位，响应写入 w
+func NewSubRequestContext(c *gin.Context, w http.ResponseWriter, req *http.Request, body []byte) *gin.Context {
+	sub, _ := gin.CreateTestContext(w)
+	sub.Request = req
+	for k, v := range c.Keys {
+		sub.Set(k, v)
+	}
+	delete(sub.Keys, channelSlotContextKey)
+	delete(sub.Keys, channelQueueErrorWrittenContextKey)
+	delete(sub.Keys, common.KeyMultipartForm)
+	sub.Set(common.KeyRequestBody, body)
+	return sub
+}
+
 // extractModelNameFromGeminiPath 从 Gemini API URL 路径中提取模型名
 // 输入格式: /v1beta/models/gemini-2.0-flash:generateContent
 // 输出: gemini-2.0-flash
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/common/limiter"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
 
 	"github.com/gin-gonic/gin"
@@ -189,6 +190,12 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 			totalMaxCount = groupTotalCount
 			successMaxCount = groupSuccessCount
 		}
+		// 订阅套餐分组的限流配置优先
+		planTotalCount, planSuccessCount, found := model.GetSubscriptionGroupRateLimit(group)
+		if found {
+			totalMaxCount = planTotalCount
+			successMaxCount = planSuccessCount
+		}
 
 		// 根据存储类型选择并执行限流处理器
 		if common.RedisEnabled {
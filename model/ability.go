@@ -3,10 +3,13 @@ package model
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -58,91 +61,125 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
-
-	var priorities []int
-	err := DB.Model(&Ability{}).
-		Select("DISTINCT(priority)").
-		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
-		Order("priority DESC").              // 按优先级降序排序
-		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
-
-	if err != nil {
-		// 处理错误
-		return 0, err
+// filterAbilitiesByPriority 按重试次数选择优先级，只保留该优先级的渠道
+func filterAbilitiesByPriority(abilities []Ability, retry int) []Ability {
+	uniquePriorities := make(map[int64]bool)
+	for _, ability := range abilities {
+		uniquePriorities[lo.FromPtr(ability.Priority)] = true
 	}
-
-	if len(priorities) == 0 {
-		// 如果没有查询到优先级，则返回错误
-		return 0, errors.New("数据库一致性被破坏")
+	priorities := make([]int64, 0, len(uniquePriorities))
+	for priority := range uniquePriorities {
+		priorities = append(priorities, priority)
 	}
-
-	// 确定要使用的优先级
-	var priorityToUse int
+	// 按优先级降序排序
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	// 如果重试次数大于优先级数，则使用最小的优先级
 	if retry >= len(priorities) {
-		// 如果重试次数大于优先级数，则使用最小的优先级
-		priorityToUse = priorities[len(priorities)-1]
-	} else {
-		priorityToUse = priorities[retry]
+		retry = len(priorities) - 1
 	}
-	return priorityToUse, nil
-}
-
-func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
-	channelQuery := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = (?)", group, model, true, maxPrioritySubQuery)
-	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
-		if err != nil {
-			return nil, err
-		} else {
-			channelQuery = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ?", group, model, true, priority)
+	targetPriority := priorities[retry]
+	filtered := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if lo.FromPtr(ability.Priority) == targetPriority {
+			filtered = append(filtered, ability)
 		}
 	}
-
-	return channelQuery, nil
+	return filtered
 }
 
 func GetChannel(group string, model string, retry int) (*Channel, error) {
 	var abilities []Ability
 
-	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
+	err := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).Order("weight DESC").Find(&abilities).Error
 	if err != nil {
 		return nil, err
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	} else {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	}
-	if err != nil {
+	// 先排除不可调度与并发已满的渠道，再按优先级选择，避免高优先级渠道全部不可用时直接失败
+	if abilities, err = filterAvailableAbilities(abilities, model); err != nil {
 		return nil, err
 	}
+	if len(abilities) == 0 {
+		return nil, nil
+	}
+	abilities = filterAbilitiesByPriority(abilities, retry)
 	channel := Channel{}
-	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
-		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
-				break
-			}
+	// Randomly choose one
+	weightSum := uint(0)
+	for _, ability_ := range abilities {
+		weightSum += ability_.Weight + 10
+	}
+	// Randomly choose one
+	weight := common.GetRandomInt(int(weightSum))
+	for _, ability_ := range abilities {
+		weight -= int(ability_.Weight) + 10
+		//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
+		if weight <= 0 {
+			channel.Id = ability_.ChannelId
+			break
 		}
-	} else {
-		return nil, nil
 	}
 	err = DB.First(&channel, "id = ?", channel.Id).Error
 	return &channel, err
 }
 
+// filterAvailableAbilities 未启用内存缓存时，一次性从数据库读取候选渠道的设置，
+// 排除没有 Key 允许使用该模型、不在可用时段或已达到用量上限的渠道，尽量避开上游限流即将耗尽的渠道，
+// 最后排除并发已满的渠道，全部繁忙时返回 ErrAllChannelsBusy
+func filterAvailableAbilities(abilities []Ability, modelName string) ([]Ability, error) {
+	if len(abilities) == 0 {
+		return abilities, nil
+	}
+	ids := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		ids = append(ids, ability.ChannelId)
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "settings", "channel_info").Where("id IN ?", ids).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rateLimitEnabled := operation_setting.GetUpstreamRateLimitSetting().Enabled
+	unavailable := make(map[int]bool)
+	rateLimited := make(map[int]bool)
+	saturated := make(map[int]bool)
+	for _, channel := range channels {
+		if !channelKeysAllowModel(channel, modelName) || !IsChannelSchedulable(channel, now) {
+			unavailable[channel.Id] = true
+			continue
+		}
+		if rateLimitEnabled && isChannelUpstreamRateLimited(channel) {
+			rateLimited[channel.Id] = true
+		}
+		if isChannelSaturated(channel) {
+			saturated[channel.Id] = true
+		}
+	}
+	abilities = excludeAbilities(abilities, unavailable)
+	// 全部渠道受限时仍按原逻辑选择
+	if filtered := excludeAbilities(abilities, rateLimited); len(filtered) > 0 {
+		abilities = filtered
+	}
+	if len(abilities) > 0 {
+		if abilities = excludeAbilities(abilities, saturated); len(abilities) == 0 {
+			return nil, ErrAllChannelsBusy
+		}
+	}
+	return abilities, nil
+}
+
+func excludeAbilities(abilities []Ability, excluded map[int]bool) []Ability {
+	if len(excluded) == 0 {
+		return abilities
+	}
+	filtered := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if !excluded[ability.ChannelId] {
+			filtered = append(filtered, ability)
+		}
+	}
+	return filtered
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
@@ -0,0 +1,101 @@
+package model
+
+import "gorm.io/gorm"
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionImport = "import"
+	AuditActionExport = "export"
+)
+
+const (
+	AuditTargetChannel          = "channel"
+	AuditTargetOption           = "option"
+	AuditTargetUser             = "user"
+	AuditTargetToken            = "token"
+	AuditTargetRedemption       = "redemption"
+	AuditTargetVendor           = "vendor"
+	AuditTargetModel            = "model"
+	AuditTargetPrefillGroup     = "prefill_group"
+	AuditTargetConfig           = "config"
+	AuditTargetOptionRevision   = "option_revision"
+	AuditTargetSubscriptionPlan = "subscription_plan"
+	AuditTargetInvoice          = "invoice"
+	AuditTargetTopUp            = "topup"
+	AuditTargetStatusIncident   = "status_incident"
+)
+
+// AuditLog 管理操作审计日志，只追加不修改，不受历史日志清理影响
+type AuditLog struct {
+	Id           int    `json:"id"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Username     string `json:"username" gorm:"type:varchar(64);index"`
+	Ip           string `json:"ip" gorm:"type:varchar(64)"`
+	AuthMethod   string `json:"auth_method" gorm:"type:varchar(16)"`   // session / access_token
+	CredentialId string `json:"credential_id" gorm:"type:varchar(64)"` // 会话 ID 或 access token 指纹
+	Action       string `json:"action" gorm:"type:varchar(32);index"`
+	TargetType   string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target"`
+	TargetId     string `json:"target_id" gorm:"type:varchar(128);index:idx_audit_target"`
+	Before       string `json:"before" gorm:"type:text"`
+	After        string `json:"after" gorm:"type:text"`
+	Diff         string `json:"diff" gorm:"type:text"`
+}
+
+type AuditLogQuery struct {
+	UserId         int
+	Username       string
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func InsertAuditLog(log *AuditLog) error {
+	return DB.Create(log).Error
+}
+
+func (q *AuditLogQuery) apply() *gorm.DB {
+	tx := DB.Model(&AuditLog{})
+	if q.UserId != 0 {
+		tx = tx.Where("user_id = ?", q.UserId)
+	}
+	if q.Username != "" {
+		tx = tx.Where("username = ?", q.Username)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		tx = tx.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetId != "" {
+		tx = tx.Where("target_id = ?", q.TargetId)
+	}
+	if q.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", q.StartTimestamp)
+	}
+	if q.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", q.EndTimestamp)
+	}
+	return tx
+}
+
+func GetAuditLogs(q *AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	if err = q.apply().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = q.apply().Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// IterateAuditLogs 按批次遍历满足条件的审计日志，用于导出
+func IterateAuditLogs(q *AuditLogQuery, fn func(logs []*AuditLog) error) error {
+	var batch []*AuditLog
+	return q.apply().Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
@@ -111,6 +111,18 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
+	// 排除多 Key 模式下没有 Key 允许使用该模型的渠道
+	channels = filterKeyModelChannels(channels, model)
+	// 排除不在可用时段或已达到用量上限的渠道，周期结束后自动恢复
+	channels = filterSchedulableChannels(channels, time.Now())
+	// 尽量避开上游限流即将耗尽的渠道
+	channels = filterUpstreamRateLimitedChannels(channels)
+	// 排除并发已满的渠道，全部已满时由调用方排队等待
+	channels, err := filterSaturatedChannels(channels)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(channels) == 0 {
 		return nil, nil
 	}
@@ -190,6 +202,43 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	return nil, errors.New("channel not found")
 }
 
+func filterSchedulableChannels(channels []int, now time.Time) []int {
+	var filtered []int
+	for i, channelId := range channels {
+		channel, ok := channelsIDM[channelId]
+		if !ok || IsChannelSchedulable(channel, now) {
+			if filtered != nil {
+				filtered = append(filtered, channelId)
+			}
+			continue
+		}
+		if filtered == nil {
+			filtered = make([]int, i, len(channels))
+			copy(filtered, channels[:i])
+		}
+	}
+	if filtered == nil {
+		return channels
+	}
+	return filtered
+}
+
+// CacheGetGroupEnabledModels 返回分组下有启用渠道的模型
+func CacheGetGroupEnabledModels(group string) []string {
+	if !common.MemoryCacheEnabled {
+		return GetGroupEnabledModels(group)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	models := make([]string, 0, len(group2model2channels[group]))
+	for modelName, channels := range group2model2channels[group] {
+		if len(channels) > 0 {
+			models = append(models, modelName)
+		}
+	}
+	return models
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
@@ -0,0 +1,309 @@
+package model
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// 渠道并发控制。
+// 每个节点独立统计渠道与 Key 的在途请求数，达到 max_concurrency / max_key_concurrency 后不再调度到该渠道或 Key；
+// 所有候选渠道都繁忙时，请求进入先进先出的等待队列，渠道释放槽位时按顺序唤醒等待该渠道的请求。
+
+var ErrAllChannelsBusy = errors.New("all channels are busy")
+var ErrChannelQueueFull = errors.New("channel queue is full")
+
+type channelInflight struct {
+	total int
+	keys  map[int]int
+}
+
+var channelInflights = make(map[int]*channelInflight)
+var channelInflightLock sync.Mutex
+
+func channelConcurrencyLimits(channel *Channel) (int, int) {
+	if channel.OtherSettings == "" {
+		return 0, 0
+	}
+	settings := getChannelLimit(channel).settings
+	return settings.MaxConcurrency, settings.MaxKeyConcurrency
+}
+
+// channelKeyIndexes 返回渠道中启用的 Key 序号，非多 Key 渠道固定为 0
+// Key 数量取自 MultiKeySize，无需读取和解析 Key 本身
+func channelKeyIndexes(channel *Channel) []int {
+	if !channel.ChannelInfo.IsMultiKey {
+		return []int{0}
+	}
+	indexes := make([]int, 0, channel.ChannelInfo.MultiKeySize)
+	for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok && status != common.ChannelStatusEnabled {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// isChannelSaturated 渠道在途请求达到上限，或全部可用 Key 都达到上限
+func isChannelSaturated(channel *Channel) bool {
+	maxConcurrency, maxKeyConcurrency := channelConcurrencyLimits(channel)
+	if maxConcurrency <= 0 && maxKeyConcurrency <= 0 {
+		return false
+	}
+	var keyIndexes []int
+	if maxKeyConcurrency > 0 {
+		keyIndexes = channelKeyIndexes(channel)
+	}
+	channelInflightLock.Lock()
+	defer channelInflightLock.Unlock()
+	inflight, ok := channelInflights[channel.Id]
+	if !ok {
+		return false
+	}
+	if maxConcurrency > 0 && inflight.total >= maxConcurrency {
+		return true
+	}
+	if maxKeyConcurrency <= 0 {
+		return false
+	}
+	for _, idx := range keyIndexes {
+		if inflight.keys[idx] < maxKeyConcurrency {
+			return false
+		}
+	}
+	return true
+}
+
+// filterSaturatedKeys 排除在途请求达到上限的 Key，全部已满时返回原列表
+func filterSaturatedKeys(channel *Channel, keyIndexes []int) []int {
+	_, maxKeyConcurrency := channelConcurrencyLimits(channel)
+	if maxKeyConcurrency <= 0 || len(keyIndexes) <= 1 {
+		return keyIndexes
+	}
+	channelInflightLock.Lock()
+	defer channelInflightLock.Unlock()
+	inflight, ok := channelInflights[channel.Id]
+	if !ok {
+		return keyIndexes
+	}
+	filtered := make([]int, 0, len(keyIndexes))
+	for _, idx := range keyIndexes {
+		if inflight.keys[idx] < maxKeyConcurrency {
+			filtered = append(filtered, idx)
+		}
+	}
+	if len(filtered) == 0 {
+		return keyIndexes
+	}
+	return filtered
+}
+
+// filterSaturatedChannels 排除繁忙的渠道，全部繁忙时返回 ErrAllChannelsBusy
+func filterSaturatedChannels(channels []int) ([]int, error) {
+	var filtered []int
+	for i, channelId := range channels {
+		channel, ok := channelsIDM[channelId]
+		if !ok || !isChannelSaturated(channel) {
+			if filtered != nil {
+				filtered = append(filtered, channelId)
+			}
+			continue
+		}
+		if filtered == nil {
+			filtered = make([]int, i, len(channels))
+			copy(filtered, channels[:i])
+		}
+	}
+	if filtered == nil {
+		return channels, nil
+	}
+	if len(filtered) == 0 {
+		return nil, ErrAllChannelsBusy
+	}
+	return filtered, nil
+}
+
+// TryAcquireChannelSlot 占用渠道与 Key 的并发槽位，达到上限时返回 false
+func TryAcquireChannelSlot(channel *Channel, keyIndex int) bool {
+	maxConcurrency, maxKeyConcurrency := channelConcurrencyLimits(channel)
+	channelInflightLock.Lock()
+	defer channelInflightLock.Unlock()
+	inflight, ok := channelInflights[channel.Id]
+	if !ok {
+		inflight = &channelInflight{keys: make(map[int]int)}
+		channelInflights[channel.Id] = inflight
+	}
+	if (maxConcurrency > 0 && inflight.total >= maxConcurrency) ||
+		(maxKeyConcurrency > 0 && inflight.keys[keyIndex] >= maxKeyConcurrency) {
+		return false
+	}
+	inflight.total++
+	inflight.keys[keyIndex]++
+	return true
+}
+
+// ReleaseChannelSlot 释放并发槽位，并唤醒等待该渠道的请求
+func ReleaseChannelSlot(channelId int, keyIndex int) {
+	channelInflightLock.Lock()
+	if inflight, ok := channelInflights[channelId]; ok {
+		inflight.total--
+		if inflight.keys[keyIndex]--; inflight.keys[keyIndex] <= 0 {
+			delete(inflight.keys, keyIndex)
+		}
+		if inflight.total <= 0 {
+			delete(channelInflights, channelId)
+		}
+	}
+	channelInflightLock.Unlock()
+	notifyChannelWaiter(channelId)
+}
+
+// GetChannelInflight 返回渠道当前的在途请求数
+func GetChannelInflight(channelId int) int {
+	channelInflightLock.Lock()
+	defer channelInflightLock.Unlock()
+	if inflight, ok := channelInflights[channelId]; ok {
+		return inflight.total
+	}
+	return 0
+}
+
+type ChannelWaiter struct {
+	channelIds map[int]bool
+	userId     int
+	enqueuedAt time.Time
+	ready      chan struct{}
+	elem       *list.Element
+}
+
+var channelQueue = list.New()
+var channelQueueUsers = make(map[int]int)
+var channelQueueLock sync.Mutex
+
+// EnqueueChannelWaiter 加入等待队列；front 为 true 时插入队首，用于被唤醒后仍未抢到槽位的请求保持原有顺序
+func EnqueueChannelWaiter(channelIds []int, userId int, front bool) (*ChannelWaiter, error) {
+	setting := operation_setting.GetChannelQueueSetting()
+	channelQueueLock.Lock()
+	defer channelQueueLock.Unlock()
+	if !front {
+		if channelQueue.Len() >= setting.MaxQueueSize {
+			return nil, ErrChannelQueueFull
+		}
+		if setting.MaxQueuePerUser > 0 && channelQueueUsers[userId] >= setting.MaxQueuePerUser {
+			return nil, ErrChannelQueueFull
+		}
+	}
+	waiter := &ChannelWaiter{
+		channelIds: make(map[int]bool, len(channelIds)),
+		userId:     userId,
+		enqueuedAt: time.Now(),
+		ready:      make(chan struct{}),
+	}
+	for _, id := range channelIds {
+		waiter.channelIds[id] = true
+	}
+	if front {
+		waiter.elem = channelQueue.PushFront(waiter)
+	} else {
+		waiter.elem = channelQueue.PushBack(waiter)
+	}
+	channelQueueUsers[userId]++
+	return waiter, nil
+}
+
+// Ready 被唤醒时关闭
+func (w *ChannelWaiter) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// Leave 超时或请求结束时离开队列
+func (w *ChannelWaiter) Leave() {
+	channelQueueLock.Lock()
+	defer channelQueueLock.Unlock()
+	w.removeLocked()
+}
+
+func (w *ChannelWaiter) removeLocked() {
+	if w.elem == nil {
+		return
+	}
+	channelQueue.Remove(w.elem)
+	w.elem = nil
+	if channelQueueUsers[w.userId]--; channelQueueUsers[w.userId] <= 0 {
+		delete(channelQueueUsers, w.userId)
+	}
+}
+
+// notifyChannelWaiter 唤醒队列中最早等待该渠道的请求
+func notifyChannelWaiter(channelId int) {
+	channelQueueLock.Lock()
+	defer channelQueueLock.Unlock()
+	for e := channelQueue.Front(); e != nil; e = e.Next() {
+		waiter := e.Value.(*ChannelWaiter)
+		if waiter.channelIds[channelId] {
+			waiter.removeLocked()
+			close(waiter.ready)
+			return
+		}
+	}
+}
+
+type ChannelQueueStats struct {
+	Depth         int         `json:"depth"`
+	OldestWaitMs  int64       `json:"oldest_wait_ms"`
+	ChannelDepth  map[int]int `json:"channel_depth"`
+	Inflight      map[int]int `json:"inflight"`
+	QueuedByUsers map[int]int `json:"queued_by_users"`
+}
+
+// GetChannelQueueStats 返回本节点的排队与在途请求统计
+func GetChannelQueueStats() ChannelQueueStats {
+	stats := ChannelQueueStats{
+		ChannelDepth:  make(map[int]int),
+		Inflight:      make(map[int]int),
+		QueuedByUsers: make(map[int]int),
+	}
+	channelQueueLock.Lock()
+	stats.Depth = channelQueue.Len()
+	if front := channelQueue.Front(); front != nil {
+		stats.OldestWaitMs = time.Since(front.Value.(*ChannelWaiter).enqueuedAt).Milliseconds()
+	}
+	for e := channelQueue.Front(); e != nil; e = e.Next() {
+		for id := range e.Value.(*ChannelWaiter).channelIds {
+			stats.ChannelDepth[id]++
+		}
+	}
+	for userId, count := range channelQueueUsers {
+		stats.QueuedByUsers[userId] = count
+	}
+	channelQueueLock.Unlock()
+
+	channelInflightLock.Lock()
+	for id, inflight := range channelInflights {
+		stats.Inflight[id] = inflight.total
+	}
+	channelInflightLock.Unlock()
+	return stats
+}
+
+// GetGroupModelChannelIds 返回分组下可提供该模型的启用渠道
+func GetGroupModelChannelIds(group string, model string) []int {
+	if !common.MemoryCacheEnabled {
+		var ids []int
+		DB.Model(&Ability{}).Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).Pluck("channel_id", &ids)
+		return ids
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	channels := group2model2channels[group][model]
+	if len(channels) == 0 {
+		channels = group2model2channels[group][ratio_setting.FormatMatchingModelName(model)]
+	}
+	return append([]int(nil), channels...)
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// calculateUpstreamCost 根据渠道的成本配置计算一次消费的上游成本（额度单位），未配置成本时返回 0。
+// 优先使用按模型配置的成本价，否则按成本比例乘以不含分组倍率的计费额度估算。
+func calculateUpstreamCost(params RecordConsumeLogParams) int {
+	if params.ChannelId == 0 {
+		return 0
+	}
+	channel, err := CacheGetChannel(params.ChannelId)
+	if err != nil {
+		return 0
+	}
+	settings := channel.GetOtherSettings()
+	if len(settings.CostPrices) > 0 {
+		price, ok := settings.CostPrices[params.ModelName]
+		if !ok {
+			if upstreamModel, _ := params.Other["upstream_model_name"].(string); upstreamModel != "" {
+				price, ok = settings.CostPrices[upstreamModel]
+			}
+		}
+		if ok {
+			cacheTokens := int(logOtherNumber(params.Other, "cache_tokens"))
+			cacheCreationTokens := int(logOtherNumber(params.Other, "cache_creation_tokens"))
+			inputTokens := params.PromptTokens
+			// Claude 格式的 input_tokens 不包含缓存读写部分，其余格式的 prompt_tokens 已包含
+			if claude, _ := params.Other["claude"].(bool); !claude {
+				inputTokens -= cacheTokens + cacheCreationTokens
+			}
+			if inputTokens < 0 {
+				inputTokens = 0
+			}
+			cacheReadPrice := price.CacheReadPrice
+			if cacheReadPrice == 0 {
+				cacheReadPrice = price.InputPrice
+			}
+			cacheWritePrice := price.CacheWritePrice
+			if cacheWritePrice == 0 {
+				cacheWritePrice = price.InputPrice
+			}
+			usd := (float64(inputTokens)*price.InputPrice +
+				float64(cacheTokens)*cacheReadPrice +
+				float64(cacheCreationTokens)*cacheWritePrice +
+				float64(params.CompletionTokens)*price.OutputPrice) / 1000000
+			usd += price.CallPrice
+			return int(usd * common.QuotaPerUnit)
+		}
+	}
+	if settings.CostRatio <= 0 {
+		return 0
+	}
+	baseQuota := float64(params.Quota)
+	if _, ok := params.Other["group_ratio"]; ok {
+		groupRatio := logOtherNumber(params.Other, "group_ratio")
+		if groupRatio <= 0 {
+			// 免费分组无法从计费额度反推基础价格
+			return 0
+		}
+		baseQuota = baseQuota / groupRatio
+	}
+	return int(baseQuota * settings.CostRatio)
+}
+
+func logOtherNumber(other map[string]interface{}, key string) float64 {
+	switch v := other[key].(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+const (
+	MarginReportByChannel = "channel"
+	MarginReportByModel   = "model"
+	MarginReportByGroup   = "group"
+	MarginReportByDay     = "day"
+)
+
+// MarginReportItem 收入、成本与毛利汇总，金额均为额度单位。
+// 未配置成本的请求只计入 Revenue，Margin 只基于已配置成本的部分（CostedRevenue）计算。
+type MarginReportItem struct {
+	Key           string  `json:"key"`
+	Name          string  `json:"name,omitempty"`
+	Requests      int64   `json:"requests"`
+	Revenue       int64   `json:"revenue"`
+	CostedRevenue int64   `json:"costed_revenue"`
+	Cost          int64   `json:"cost"`
+	Margin        int64   `json:"margin"`
+	MarginRate    float64 `json:"margin_rate"`
+}
+
+type MarginReportQuery struct {
+	GroupBy        string
+	StartTimestamp int64
+	EndTimestamp   int64
+	ChannelId      int
+	ModelName      string
+	Group          string
+	TzOffset       int // 按天汇总时的时区偏移（秒）
+}
+
+// GetMarginReport 按渠道、模型、分组或天汇总消费日志中的收入与上游成本
+func GetMarginReport(q *MarginReportQuery) ([]*MarginReportItem, error) {
+	var keyExpr string
+	numericKey := false
+	switch q.GroupBy {
+	case MarginReportByChannel:
+		keyExpr = "channel_id"
+		numericKey = true
+	case MarginReportByModel:
+		keyExpr = "model_name"
+	case MarginReportByGroup:
+		keyExpr = logGroupCol
+	case MarginReportByDay:
+		offset := strconv.Itoa(q.TzOffset)
+		keyExpr = fmt.Sprintf("(created_at + %s) - (created_at + %s) %% 86400 - %s", offset, offset, offset)
+		numericKey = true
+	default:
+		return nil, fmt.Errorf("invalid group_by: %s", q.GroupBy)
+	}
+
+	tx := LOG_DB.Table("logs").Where("type = ?", LogTypeConsume)
+	if q.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", q.StartTimestamp)
+	}
+	if q.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", q.EndTimestamp)
+	}
+	if q.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", q.ChannelId)
+	}
+	if q.ModelName != "" {
+		tx = tx.Where("model_name = ?", q.ModelName)
+	}
+	if q.Group != "" {
+		tx = tx.Where(logGroupCol+" = ?", q.Group)
+	}
+
+	var rows []struct {
+		KeyInt        int64
+		KeyStr        string
+		Requests      int64
+		Revenue       int64
+		CostedRevenue int64
+		Cost          int64
+	}
+	keyColumn := "key_str"
+	if numericKey {
+		keyColumn = "key_int"
+	}
+	err := tx.Select(keyExpr + " AS " + keyColumn + ", count(*) AS requests, sum(quota) AS revenue, " +
+		"sum(CASE WHEN upstream_cost > 0 THEN quota ELSE 0 END) AS costed_revenue, sum(upstream_cost) AS cost").
+		Group(keyColumn).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*MarginReportItem, 0, len(rows))
+	for _, row := range rows {
+		item := &MarginReportItem{
+			Key:           row.KeyStr,
+			Requests:      row.Requests,
+			Revenue:       row.Revenue,
+			CostedRevenue: row.CostedRevenue,
+			Cost:          row.Cost,
+			Margin:        row.CostedRevenue - row.Cost,
+		}
+		if numericKey {
+			item.Key = strconv.FormatInt(row.KeyInt, 10)
+		}
+		if q.GroupBy == MarginReportByDay {
+			item.Name = time.Unix(row.KeyInt, 0).UTC().Add(time.Duration(q.TzOffset) * time.Second).Format("2006-01-02")
+		}
+		if item.CostedRevenue > 0 {
+			item.MarginRate = float64(item.Margin) / float64(item.CostedRevenue)
+		}
+		items = append(items, item)
+	}
+
+	if q.GroupBy == MarginReportByChannel && len(items) > 0 {
+		ids := make([]int, 0, len(items))
+		for _, item := range items {
+			id, _ := strconv.Atoi(item.Key)
+			ids = append(ids, id)
+		}
+		var channels []struct {
+			Id   int
+			Name string
+		}
+		DB.Table("channels").Select("id", "name").Where("id IN ?", ids).Scan(&channels)
+		names := make(map[string]string, len(channels))
+		for _, channel := range channels {
+			names[strconv.Itoa(channel.Id)] = channel.Name
+		}
+		for _, item := range items {
+			item.Name = names[item.Key]
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if q.GroupBy == MarginReportByDay {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].Revenue > items[j].Revenue
+	})
+	return items, nil
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// 多 Key 渠道的单 Key 配置。
+// 配置按 Key 序号保存在 ChannelInfo.MultiKeySettings 中，与 MultiKeyStatusList 一样在删除 Key 时重新编号。
+// 选择 Key 时先排除不允许当前模型的 Key，再按权重随机或按平滑加权轮询选择。
+
+// MultiKeySetting 多Key模式下单个Key的配置
+type MultiKeySetting struct {
+	Weight       int      `json:"weight,omitempty"`       // 选择权重，未设置时为 1
+	Models       []string `json:"models,omitempty"`       // 允许使用的模型，为空表示不限制
+	BaseURL      string   `json:"base_url,omitempty"`     // 覆盖渠道的 BaseURL
+	Organization string   `json:"organization,omitempty"` // 覆盖渠道的 OpenAI Organization
+}
+
+// Normalize 去除空白与重复的模型并校验权重
+func (s *MultiKeySetting) Normalize() error {
+	if s.Weight < 0 {
+		return errors.New("weight must not be negative")
+	}
+	models := make([]string, 0, len(s.Models))
+	for _, name := range s.Models {
+		if name = strings.TrimSpace(name); name != "" && !common.StringsContains(models, name) {
+			models = append(models, name)
+		}
+	}
+	s.Models = models
+	s.BaseURL = strings.TrimRight(strings.TrimSpace(s.BaseURL), "/")
+	s.Organization = strings.TrimSpace(s.Organization)
+	return nil
+}
+
+func (s *MultiKeySetting) IsEmpty() bool {
+	return s == nil || (s.Weight == 0 && len(s.Models) == 0 && s.BaseURL == "" && s.Organization == "")
+}
+
+func (s *MultiKeySetting) GetWeight() int {
+	if s == nil || s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+// AllowsModel 判断 Key 是否允许使用指定模型，modelName 为空时不限制
+func (s *MultiKeySetting) AllowsModel(modelName string) bool {
+	if s == nil || len(s.Models) == 0 || modelName == "" {
+		return true
+	}
+	return common.StringsContains(s.Models, modelName) ||
+		common.StringsContains(s.Models, ratio_setting.FormatMatchingModelName(modelName))
+}
+
+// GetKeySetting 返回 Key 的配置，未配置时返回 nil
+func (channel *Channel) GetKeySetting(keyIndex int) *MultiKeySetting {
+	if !channel.ChannelInfo.IsMultiKey || channel.ChannelInfo.MultiKeySettings == nil {
+		return nil
+	}
+	return channel.ChannelInfo.MultiKeySettings[keyIndex]
+}
+
+// GetKeyBaseURL 返回 Key 使用的 BaseURL，未覆盖时使用渠道的 BaseURL
+func (channel *Channel) GetKeyBaseURL(keyIndex int) string {
+	if setting := channel.GetKeySetting(keyIndex); setting != nil && setting.BaseURL != "" {
+		return setting.BaseURL
+	}
+	return channel.GetBaseURL()
+}
+
+// GetKeyOrganization 返回 Key 使用的 OpenAI Organization，未覆盖时使用渠道的配置
+func (channel *Channel) GetKeyOrganization(keyIndex int) string {
+	if setting := channel.GetKeySetting(keyIndex); setting != nil && setting.Organization != "" {
+		return setting.Organization
+	}
+	if channel.OpenAIOrganization != nil {
+		return *channel.OpenAIOrganization
+	}
+	return ""
+}
+
+// SetKeySetting 设置 Key 的配置，配置为空时删除
+func (info *ChannelInfo) SetKeySetting(keyIndex int, setting *MultiKeySetting) {
+	if setting.IsEmpty() {
+		delete(info.MultiKeySettings, keyIndex)
+		return
+	}
+	if info.MultiKeySettings == nil {
+		info.MultiKeySettings = make(map[int]*MultiKeySetting)
+	}
+	info.MultiKeySettings[keyIndex] = setting
+}
+
+// pruneMultiKeySettings 清理超出 Key 数量的配置
+func (info *ChannelInfo) pruneMultiKeySettings() {
+	for idx := range info.MultiKeySettings {
+		if idx >= info.MultiKeySize {
+			delete(info.MultiKeySettings, idx)
+		}
+	}
+}
+
+// filterKeysByModel 排除不允许使用该模型的 Key
+func filterKeysByModel(channel *Channel, keyIndexes []int, modelName string) []int {
+	if modelName == "" || len(channel.ChannelInfo.MultiKeySettings) == 0 {
+		return keyIndexes
+	}
+	filtered := make([]int, 0, len(keyIndexes))
+	for _, idx := range keyIndexes {
+		if channel.GetKeySetting(idx).AllowsModel(modelName) {
+			filtered = append(filtered, idx)
+		}
+	}
+	return filtered
+}
+
+// channelKeysAllowModel 判断多 Key 渠道是否有启用的 Key 允许使用该模型
+func channelKeysAllowModel(channel *Channel, modelName string) bool {
+	if !channel.ChannelInfo.IsMultiKey || len(channel.ChannelInfo.MultiKeySettings) == 0 {
+		return true
+	}
+	for _, idx := range channelKeyIndexes(channel) {
+		if channel.GetKeySetting(idx).AllowsModel(modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterKeyModelChannels 排除没有 Key 允许使用该模型的渠道
+func filterKeyModelChannels(channels []int, modelName string) []int {
+	filtered := make([]int, 0, len(channels))
+	for _, channelId := range channels {
+		if channel, ok := channelsIDM[channelId]; !ok || channelKeysAllowModel(channel, modelName) {
+			filtered = append(filtered, channelId)
+		}
+	}
+	return filtered
+}
+
+func hasCustomKeyWeights(channel *Channel, keyIndexes []int) bool {
+	for _, idx := range keyIndexes {
+		if channel.GetKeySetting(idx).GetWeight() != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// pickWeightedRandomKey 按权重随机选择 Key
+func pickWeightedRandomKey(channel *Channel, keyIndexes []int) int {
+	totalWeight := 0
+	for _, idx := range keyIndexes {
+		totalWeight += channel.GetKeySetting(idx).GetWeight()
+	}
+	r := rand.Intn(totalWeight)
+	for _, idx := range keyIndexes {
+		r -= channel.GetKeySetting(idx).GetWeight()
+		if r < 0 {
+			return idx
+		}
+	}
+	return keyIndexes[len(keyIndexes)-1]
+}
+
+// 平滑加权轮询的当前权重，channel id -> key index -> current weight
+var (
+	keyPollingWeights     = make(map[int]map[int]int)
+	keyPollingWeightsLock sync.Mutex
+)
+
+// pickWeightedPollingKey 按平滑加权轮询选择 Key，各 Key 被选中的次数与权重成正比且分布均匀
+func pickWeightedPollingKey(channel *Channel, keyIndexes []int) int {
+	keyPollingWeightsLock.Lock()
+	defer keyPollingWeightsLock.Unlock()
+	current, ok := keyPollingWeights[channel.Id]
+	if !ok {
+		current = make(map[int]int)
+		keyPollingWeights[channel.Id] = current
+	}
+	totalWeight := 0
+	selected := keyIndexes[0]
+	for _, idx := range keyIndexes {
+		weight := channel.GetKeySetting(idx).GetWeight()
+		totalWeight += weight
+		current[idx] += weight
+		if current[idx] > current[selected] {
+			selected = idx
+		}
+	}
+	current[selected] -= totalWeight
+	return selected
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 多 Key 渠道的单 Key 调用统计。
+// 统计按 Key 内容的指纹保存，删除或导入 Key 导致序号变化时统计不会错位；
+// 启用 Redis 时写入 Redis 供多节点共享，否则保存在本节点内存中。
+
+// channelKeyStatsTTL Key 长时间未被使用时统计自动过期
+const channelKeyStatsTTL = 30 * 24 * time.Hour
+
+const channelKeyStatsMaxErrorLength = 512
+
+// ChannelKeyStats 单个 Key 的调用统计，时间为秒级时间戳
+type ChannelKeyStats struct {
+	Requests    int64   `json:"requests"`
+	Successes   int64   `json:"successes"`
+	Errors      int64   `json:"errors"`
+	ErrorRate   float64 `json:"error_rate"` // 错误率（百分比）
+	LastUsedAt  int64   `json:"last_used_at,omitempty"`
+	LastErrorAt int64   `json:"last_error_at,omitempty"`
+	LastError   string  `json:"last_error,omitempty"`
+}
+
+func (s *ChannelKeyStats) fillRates() ChannelKeyStats {
+	s.Requests = s.Successes + s.Errors
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests) * 100
+	}
+	return *s
+}
+
+var channelKeyStats = make(map[string]*ChannelKeyStats)
+var channelKeyStatsLock sync.Mutex
+
+// channelKeyFingerprint 使用 Key 的哈希前缀标识 Key，避免在 Redis 中保存明文
+func channelKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func channelKeyStatsKey(channelId int, key string) string {
+	return fmt.Sprintf("channel_key_stats:%d:%s", channelId, channelKeyFingerprint(key))
+}
+
+func recordChannelKeyStats(channelId int, key string, success bool, errMsg string) {
+	if key == "" {
+		return
+	}
+	statsKey := channelKeyStatsKey(channelId, key)
+	now := common.GetTimestamp()
+	if len(errMsg) > channelKeyStatsMaxErrorLength {
+		errMsg = errMsg[:channelKeyStatsMaxErrorLength]
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		if success {
+			pipe.HIncrBy(ctx, statsKey, "successes", 1)
+			pipe.HSet(ctx, statsKey, "last_used_at", now)
+		} else {
+			pipe.HIncrBy(ctx, statsKey, "errors", 1)
+			pipe.HSet(ctx, statsKey, "last_used_at", now, "last_error_at", now, "last_error", errMsg)
+		}
+		pipe.Expire(ctx, statsKey, channelKeyStatsTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysLog(fmt.Sprintf("failed to record channel key stats: channel_id=%d, error=%v", channelId, err))
+		}
+		return
+	}
+
+	channelKeyStatsLock.Lock()
+	defer channelKeyStatsLock.Unlock()
+	stats, ok := channelKeyStats[statsKey]
+	if !ok {
+		stats = &ChannelKeyStats{}
+		channelKeyStats[statsKey] = stats
+	}
+	stats.LastUsedAt = now
+	if success {
+		stats.Successes++
+	} else {
+		stats.Errors++
+		stats.LastErrorAt = now
+		stats.LastError = errMsg
+	}
+}
+
+// RecordChannelKeySuccess 记录 Key 的一次成功请求
+func RecordChannelKeySuccess(channelId int, key string) {
+	recordChannelKeyStats(channelId, key, true, "")
+}
+
+// RecordChannelKeyError 记录 Key 的一次失败请求
+func RecordChannelKeyError(channelId int, key string, errMsg string) {
+	recordChannelKeyStats(channelId, key, false, errMsg)
+}
+
+// GetChannelKeyStats 获取 Key 的调用统计
+func GetChannelKeyStats(channelId int, key string) ChannelKeyStats {
+	statsKey := channelKeyStatsKey(channelId, key)
+	if common.RedisEnabled {
+		values, err := common.RDB.HGetAll(context.Background(), statsKey).Result()
+		if err != nil {
+			return ChannelKeyStats{}
+		}
+		stats := ChannelKeyStats{LastError: values["last_error"]}
+		stats.Successes, _ = strconv.ParseInt(values["successes"], 10, 64)
+		stats.Errors, _ = strconv.ParseInt(values["errors"], 10, 64)
+		stats.LastUsedAt, _ = strconv.ParseInt(values["last_used_at"], 10, 64)
+		stats.LastErrorAt, _ = strconv.ParseInt(values["last_error_at"], 10, 64)
+		return stats.fillRates()
+	}
+	channelKeyStatsLock.Lock()
+	defer channelKeyStatsLock.Unlock()
+	if stats, ok := channelKeyStats[statsKey]; ok {
+		result := *stats
+		return result.fillRates()
+	}
+	return ChannelKeyStats{}
+}
+
+// ResetChannelKeyStats 清空渠道指定 Key 的调用统计
+func ResetChannelKeyStats(channelId int, keys []string) error {
+	statsKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		statsKeys = append(statsKeys, channelKeyStatsKey(channelId, key))
+	}
+	if common.RedisEnabled {
+		if len(statsKeys) == 0 {
+			return nil
+		}
+		return common.RDB.Del(context.Background(), statsKeys...).Err()
+	}
+	channelKeyStatsLock.Lock()
+	defer channelKeyStatsLock.Unlock()
+	for _, statsKey := range statsKeys {
+		delete(channelKeyStats, statsKey)
+	}
+	return nil
+}
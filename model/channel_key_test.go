@@ -0,0 +1,145 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+func newTestMultiKeyChannel(t *testing.T, id int, mode constant.MultiKeyMode, settings map[int]*MultiKeySetting) *Channel {
+	t.Helper()
+	keyPollingWeightsLock.Lock()
+	delete(keyPollingWeights, id)
+	keyPollingWeightsLock.Unlock()
+	t.Cleanup(func() {
+		keyPollingWeightsLock.Lock()
+		delete(keyPollingWeights, id)
+		keyPollingWeightsLock.Unlock()
+	})
+	return &Channel{
+		Id:  id,
+		Key: "key-0\nkey-1\nkey-2",
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:       true,
+			MultiKeySize:     3,
+			MultiKeyMode:     mode,
+			MultiKeySettings: settings,
+		},
+	}
+}
+
+func TestMultiKeySettingGetWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting *MultiKeySetting
+		want    int
+	}{
+		{name: "nil setting", setting: nil, want: 1},
+		{name: "unset weight", setting: &MultiKeySetting{}, want: 1},
+		{name: "custom weight", setting: &MultiKeySetting{Weight: 5}, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.setting.GetWeight(); got != tt.want {
+				t.Fatalf("expected weight %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMultiKeySettingAllowsModel(t *testing.T) {
+	setting := &MultiKeySetting{Models: []string{"gpt-4o", "claude-3-5-sonnet"}}
+	tests := []struct {
+		name    string
+		setting *MultiKeySetting
+		model   string
+		want    bool
+	}{
+		{name: "nil setting allows all", setting: nil, model: "gpt-4o", want: true},
+		{name: "empty models allow all", setting: &MultiKeySetting{Weight: 2}, model: "gpt-4o", want: true},
+		{name: "empty model name", setting: setting, model: "", want: true},
+		{name: "listed model", setting: setting, model: "gpt-4o", want: true},
+		{name: "unlisted model", setting: setting, model: "gpt-4o-mini", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.setting.AllowsModel(tt.model); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterKeysByModel(t *testing.T) {
+	channel := newTestMultiKeyChannel(t, -1, constant.MultiKeyModeRandom, map[int]*MultiKeySetting{
+		0: {Models: []string{"gpt-4o"}},
+		1: {Models: []string{"gpt-4o-mini"}},
+	})
+	keys := []int{0, 1, 2}
+	if got := filterKeysByModel(channel, keys, "gpt-4o"); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Fatalf("expected keys [0 2], got %v", got)
+	}
+	if got := filterKeysByModel(channel, keys, ""); !reflect.DeepEqual(got, keys) {
+		t.Fatalf("expected all keys without a model, got %v", got)
+	}
+}
+
+func TestPickWeightedPollingKey(t *testing.T) {
+	channel := newTestMultiKeyChannel(t, -2, constant.MultiKeyModePolling, map[int]*MultiKeySetting{
+		0: {Weight: 5},
+		1: {Weight: 1},
+		2: {Weight: 1},
+	})
+	// 平滑加权轮询不会连续集中选择权重最高的 Key
+	want := []int{0, 0, 1, 0, 2, 0, 0}
+	got := make([]int, 0, len(want))
+	for range want {
+		got = append(got, pickWeightedPollingKey(channel, []int{0, 1, 2}))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected sequence %v, got %v", want, got)
+	}
+}
+
+func TestPickWeightedRandomKey(t *testing.T) {
+	channel := newTestMultiKeyChannel(t, -3, constant.MultiKeyModeRandom, map[int]*MultiKeySetting{
+		0: {Weight: 8},
+		2: {Weight: 0}, // 未设置权重按 1 计算
+	})
+	counts := make(map[int]int)
+	const rounds = 10000
+	for i := 0; i < rounds; i++ {
+		counts[pickWeightedRandomKey(channel, []int{0, 1, 2})]++
+	}
+	// 期望比例 8:1:1，留出足够的随机误差
+	if counts[0] < rounds*7/10 || counts[0] > rounds*9/10 {
+		t.Fatalf("expected key 0 to be picked about 80%% of the time, got %d/%d", counts[0], rounds)
+	}
+	if counts[1] == 0 || counts[2] == 0 {
+		t.Fatalf("expected every key to be picked, got %v", counts)
+	}
+}
+
+func TestGetNextEnabledKeyWithKeySettings(t *testing.T) {
+	channel := newTestMultiKeyChannel(t, -4, constant.MultiKeyModePolling, map[int]*MultiKeySetting{
+		0: {Weight: 2, Models: []string{"gpt-4o"}},
+		1: {Weight: 1, Models: []string{"gpt-4o-mini"}},
+		2: {Weight: 1},
+	})
+	channel.ChannelInfo.MultiKeyStatusList = map[int]int{2: common.ChannelStatusManuallyDisabled}
+
+	for i := 0; i < 3; i++ {
+		key, idx, err := channel.GetNextEnabledKey("gpt-4o")
+		if err != nil {
+			t.Fatalf("get next enabled key: %v", err)
+		}
+		if idx != 0 || key != "key-0" {
+			t.Fatalf("expected key-0 for gpt-4o, got %s at %d", key, idx)
+		}
+	}
+	if _, _, err := channel.GetNextEnabledKey("claude-3-5-sonnet"); err == nil {
+		t.Fatal("expected an error when no enabled key allows the model")
+	}
+}
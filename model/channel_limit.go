@@ -0,0 +1,432 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道用量上限与可用时段。
+// 用量按渠道时区的自然日、自然月统计，启用 Redis 时计数保存在 Redis 中供多节点共享，否则保存在内存中；
+// 达到上限的渠道直到周期结束前不再参与 GetRandomSatisfiedChannel 的调度，启用 Redis 时该状态同样写入 Redis，
+// 各节点在本地缓存 1 秒并在后台刷新，渠道选择时不访问 Redis。
+
+const (
+	ChannelUsagePeriodDaily   = "daily"
+	ChannelUsagePeriodMonthly = "monthly"
+)
+
+const channelExhaustionLocalTTL = time.Second
+
+type ChannelUsage struct {
+	Quota    int64 `json:"quota"`
+	Requests int64 `json:"requests"`
+}
+
+type ChannelPeriodUsage struct {
+	Period       string `json:"period"`
+	QuotaLimit   int64  `json:"quota_limit"`
+	RequestLimit int64  `json:"request_limit"`
+	ResetAt      int64  `json:"reset_at"`
+	ChannelUsage
+}
+
+type ChannelLimitStatus struct {
+	ChannelId      int                  `json:"channel_id"`
+	Available      bool                 `json:"available"`
+	InWindow       bool                 `json:"in_window"`
+	Exhausted      bool                 `json:"exhausted"`
+	ExhaustedUntil int64                `json:"exhausted_until,omitempty"`
+	Usage          []ChannelPeriodUsage `json:"usage"`
+}
+
+type channelLimit struct {
+	raw      string
+	hash     string
+	settings dto.ChannelOtherSettings
+	loc      *time.Location
+	windows  []channelWindow
+}
+
+type channelWindow struct {
+	start    int
+	end      int
+	weekdays []int
+}
+
+type channelExhaustion struct {
+	hash  string
+	until time.Time
+}
+
+var channelLimits sync.Map    // channelId -> *channelLimit
+var channelExhausted sync.Map // channelId -> channelExhaustion
+var channelExhaustionSyncedAt = make(map[int]time.Time)
+var channelExhaustionSyncLock sync.Mutex
+var channelUsageCounters = make(map[string]*ChannelUsage)
+var channelUsageLock sync.Mutex
+
+// ValidateChannelLimits 校验渠道用量上限与可用时段配置
+func ValidateChannelLimits(settings dto.ChannelOtherSettings) error {
+	for _, v := range []int64{settings.DailyQuotaLimit, settings.MonthlyQuotaLimit, settings.DailyRequestLimit, settings.MonthlyRequestLimit} {
+		if v < 0 {
+			return errors.New("用量上限不能为负数")
+		}
+	}
+	if settings.LimitTimezone != "" {
+		if _, err := time.LoadLocation(settings.LimitTimezone); err != nil {
+			return fmt.Errorf("时区无效: %s", settings.LimitTimezone)
+		}
+	}
+	for _, w := range settings.AvailabilityWindows {
+		start, err := ratio_setting.ParseClock(w.StartClock)
+		if err != nil {
+			return fmt.Errorf("可用时段的开始时刻无效: %s", w.StartClock)
+		}
+		end, err := ratio_setting.ParseClock(w.EndClock)
+		if err != nil {
+			return fmt.Errorf("可用时段的结束时刻无效: %s", w.EndClock)
+		}
+		if start == end {
+			return errors.New("可用时段的开始时刻与结束时刻相同")
+		}
+		for _, day := range w.Weekdays {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("可用时段的星期无效: %d", day)
+			}
+		}
+	}
+	return nil
+}
+
+func getChannelLimit(channel *Channel) *channelLimit {
+	if v, ok := channelLimits.Load(channel.Id); ok && v.(*channelLimit).raw == channel.OtherSettings {
+		return v.(*channelLimit)
+	}
+	limit := &channelLimit{
+		raw:  channel.OtherSettings,
+		hash: strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(channel.OtherSettings))), 16),
+		loc:  time.Local,
+	}
+	if channel.OtherSettings != "" {
+		_ = common.UnmarshalJsonStr(channel.OtherSettings, &limit.settings)
+	}
+	if limit.settings.LimitTimezone != "" {
+		if loc, err := time.LoadLocation(limit.settings.LimitTimezone); err == nil {
+			limit.loc = loc
+		}
+	}
+	for _, w := range limit.settings.AvailabilityWindows {
+		start, err1 := ratio_setting.ParseClock(w.StartClock)
+		end, err2 := ratio_setting.ParseClock(w.EndClock)
+		if err1 != nil || err2 != nil || start == end {
+			continue
+		}
+		limit.windows = append(limit.windows, channelWindow{start: start, end: end, weekdays: w.Weekdays})
+	}
+	channelLimits.Store(channel.Id, limit)
+	return limit
+}
+
+func (l *channelLimit) hasUsageLimit() bool {
+	s := l.settings
+	return s.DailyQuotaLimit > 0 || s.MonthlyQuotaLimit > 0 || s.DailyRequestLimit > 0 || s.MonthlyRequestLimit > 0
+}
+
+// inWindow 判断 now 是否处于任一可用时段，未配置时段时始终可用
+func (l *channelLimit) inWindow(now time.Time) bool {
+	if len(l.settings.AvailabilityWindows) == 0 {
+		return true
+	}
+	local := now.In(l.loc)
+	minute := local.Hour()*60 + local.Minute()
+	weekday := int(local.Weekday())
+	for _, w := range l.windows {
+		start, end := w.start, w.end
+		// 跨天时段在次日凌晨的部分属于前一天
+		day := -1
+		switch {
+		case start < end && minute >= start && minute < end:
+			day = weekday
+		case start > end && minute >= start:
+			day = weekday
+		case start > end && minute < end:
+			day = (weekday + 6) % 7
+		}
+		if day < 0 {
+			continue
+		}
+		if len(w.weekdays) == 0 || containsInt(w.weekdays, day) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// periods 返回 now 所在的日、月周期标识与结束时间
+func (l *channelLimit) periods(now time.Time) []ChannelPeriodUsage {
+	local := now.In(l.loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, l.loc)
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, l.loc)
+	return []ChannelPeriodUsage{
+		{
+			Period:       ChannelUsagePeriodDaily + ":" + day.Format("20060102"),
+			QuotaLimit:   l.settings.DailyQuotaLimit,
+			RequestLimit: l.settings.DailyRequestLimit,
+			ResetAt:      day.AddDate(0, 0, 1).Unix(),
+		},
+		{
+			Period:       ChannelUsagePeriodMonthly + ":" + month.Format("200601"),
+			QuotaLimit:   l.settings.MonthlyQuotaLimit,
+			RequestLimit: l.settings.MonthlyRequestLimit,
+			ResetAt:      month.AddDate(0, 1, 0).Unix(),
+		},
+	}
+}
+
+func (p *ChannelPeriodUsage) exceeded() bool {
+	return (p.QuotaLimit > 0 && p.Quota >= p.QuotaLimit) || (p.RequestLimit > 0 && p.Requests >= p.RequestLimit)
+}
+
+func channelUsageKey(channelId int, period string) string {
+	return fmt.Sprintf("channel_usage:%d:%s", channelId, period)
+}
+
+// incrChannelUsage 累加周期用量并返回累加后的值
+func incrChannelUsage(channelId int, period *ChannelPeriodUsage, quota int64, requests int64) (ChannelUsage, error) {
+	key := channelUsageKey(channelId, period.Period)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		quotaCmd := pipe.HIncrBy(ctx, key, "quota", quota)
+		requestsCmd := pipe.HIncrBy(ctx, key, "requests", requests)
+		// 多保留一天，便于周期结束后查询
+		pipe.ExpireAt(ctx, key, time.Unix(period.ResetAt, 0).Add(24*time.Hour))
+		if _, err := pipe.Exec(ctx); err != nil {
+			return ChannelUsage{}, err
+		}
+		return ChannelUsage{Quota: quotaCmd.Val(), Requests: requestsCmd.Val()}, nil
+	}
+
+	channelUsageLock.Lock()
+	defer channelUsageLock.Unlock()
+	usage, ok := channelUsageCounters[key]
+	if !ok {
+		usage = &ChannelUsage{}
+		channelUsageCounters[key] = usage
+		cleanupChannelUsageCounters(channelId, period.Period)
+	}
+	usage.Quota += quota
+	usage.Requests += requests
+	return *usage, nil
+}
+
+// cleanupChannelUsageCounters 进入新周期时清理该渠道同类型的旧周期计数
+func cleanupChannelUsageCounters(channelId int, period string) {
+	periodType, _, _ := strings.Cut(period, ":")
+	prefix := channelUsageKey(channelId, periodType+":")
+	current := channelUsageKey(channelId, period)
+	for key := range channelUsageCounters {
+		if key != current && strings.HasPrefix(key, prefix) {
+			delete(channelUsageCounters, key)
+		}
+	}
+}
+
+func getChannelUsage(channelId int, period string) ChannelUsage {
+	key := channelUsageKey(channelId, period)
+	if common.RedisEnabled {
+		values, err := common.RDB.HGetAll(context.Background(), key).Result()
+		if err != nil {
+			return ChannelUsage{}
+		}
+		quota, _ := strconv.ParseInt(values["quota"], 10, 64)
+		requests, _ := strconv.ParseInt(values["requests"], 10, 64)
+		return ChannelUsage{Quota: quota, Requests: requests}
+	}
+	channelUsageLock.Lock()
+	defer channelUsageLock.Unlock()
+	if usage, ok := channelUsageCounters[key]; ok {
+		return *usage
+	}
+	return ChannelUsage{}
+}
+
+// recordChannelUsage 记录渠道的一次请求消耗，仅对配置了用量上限的渠道计数
+func recordChannelUsage(channelId int, quota int) {
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || channel == nil {
+		return
+	}
+	limit := getChannelLimit(channel)
+	if !limit.hasUsageLimit() {
+		return
+	}
+	var until time.Time
+	periods := limit.periods(time.Now())
+	for i := range periods {
+		if periods[i].QuotaLimit <= 0 && periods[i].RequestLimit <= 0 {
+			continue
+		}
+		usage, err := incrChannelUsage(channelId, &periods[i], int64(quota), 1)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to record channel usage: channel_id=%d, error=%v", channelId, err))
+			continue
+		}
+		periods[i].ChannelUsage = usage
+		if periods[i].exceeded() {
+			if resetAt := time.Unix(periods[i].ResetAt, 0); resetAt.After(until) {
+				until = resetAt
+			}
+		}
+	}
+	if !until.IsZero() {
+		exhaustion := channelExhaustion{hash: limit.hash, until: until}
+		if common.RedisEnabled {
+			if err := saveChannelExhaustion(channelId, exhaustion); err != nil {
+				common.SysLog(fmt.Sprintf("failed to save channel exhaustion: channel_id=%d, error=%v", channelId, err))
+			}
+		}
+		if _, loaded := channelExhausted.Swap(channelId, exhaustion); !loaded {
+			common.SysLog(fmt.Sprintf("channel #%d reached its usage limit, paused until %s", channelId, until.Format(time.RFC3339)))
+		}
+	}
+}
+
+func channelExhaustionKey(channelId int) string {
+	return fmt.Sprintf("channel_exhausted:%d", channelId)
+}
+
+// saveChannelExhaustion 将用量耗尽状态写入 Redis，周期结束时自动过期
+func saveChannelExhaustion(channelId int, exhaustion channelExhaustion) error {
+	ttl := time.Until(exhaustion.until)
+	if ttl <= 0 {
+		return nil
+	}
+	value := fmt.Sprintf("%d:%s", exhaustion.until.Unix(), exhaustion.hash)
+	return common.RedisSet(channelExhaustionKey(channelId), value, ttl)
+}
+
+// loadChannelExhaustion 从 Redis 读取渠道的用量耗尽状态并覆盖本地缓存
+func loadChannelExhaustion(channelId int) {
+	data, err := common.RedisGet(channelExhaustionKey(channelId))
+	if err != nil || data == "" {
+		if err == nil || errors.Is(err, redis.Nil) {
+			channelExhausted.Delete(channelId)
+		}
+		return
+	}
+	untilStr, hash, _ := strings.Cut(data, ":")
+	until, err := strconv.ParseInt(untilStr, 10, 64)
+	if err != nil {
+		return
+	}
+	channelExhausted.Store(channelId, channelExhaustion{hash: hash, until: time.Unix(until, 0)})
+}
+
+// refreshChannelExhaustion 本地缓存超过 1 秒时在后台从 Redis 刷新，不阻塞渠道选择
+func refreshChannelExhaustion(channelId int, now time.Time) {
+	channelExhaustionSyncLock.Lock()
+	if now.Sub(channelExhaustionSyncedAt[channelId]) < channelExhaustionLocalTTL {
+		channelExhaustionSyncLock.Unlock()
+		return
+	}
+	channelExhaustionSyncedAt[channelId] = now
+	channelExhaustionSyncLock.Unlock()
+	gopool.Go(func() {
+		loadChannelExhaustion(channelId)
+	})
+}
+
+// isChannelExhausted 判断渠道是否已达到当前周期的用量上限，修改配置后重新判断
+func isChannelExhausted(channelId int, limit *channelLimit, now time.Time) (time.Time, bool) {
+	if common.RedisEnabled && limit.hasUsageLimit() {
+		refreshChannelExhaustion(channelId, now)
+	}
+	v, ok := channelExhausted.Load(channelId)
+	if !ok {
+		return time.Time{}, false
+	}
+	exhaustion := v.(channelExhaustion)
+	if exhaustion.hash != limit.hash || !now.Before(exhaustion.until) {
+		channelExhausted.CompareAndDelete(channelId, exhaustion)
+		return time.Time{}, false
+	}
+	return exhaustion.until, true
+}
+
+// IsChannelSchedulable 判断渠道当前是否处于可用时段且未达到用量上限
+func IsChannelSchedulable(channel *Channel, now time.Time) bool {
+	if channel.OtherSettings == "" {
+		return true
+	}
+	limit := getChannelLimit(channel)
+	if !limit.inWindow(now) {
+		return false
+	}
+	_, exhausted := isChannelExhausted(channel.Id, limit, now)
+	return !exhausted
+}
+
+// GetChannelLimitStatus 返回渠道的可用时段、用量与上限状态
+func GetChannelLimitStatus(channel *Channel) *ChannelLimitStatus {
+	now := time.Now()
+	limit := getChannelLimit(channel)
+	status := &ChannelLimitStatus{
+		ChannelId: channel.Id,
+		InWindow:  limit.inWindow(now),
+		Usage:     limit.periods(now),
+	}
+	for i := range status.Usage {
+		status.Usage[i].ChannelUsage = getChannelUsage(channel.Id, status.Usage[i].Period)
+	}
+	if common.RedisEnabled && limit.hasUsageLimit() {
+		loadChannelExhaustion(channel.Id)
+	}
+	if until, ok := isChannelExhausted(channel.Id, limit, now); ok {
+		status.Exhausted = true
+		status.ExhaustedUntil = until.Unix()
+	}
+	status.Available = status.InWindow && !status.Exhausted
+	return status
+}
+
+// ResetChannelUsage 清除渠道当前周期的用量计数并恢复调度
+func ResetChannelUsage(channel *Channel) {
+	limit := getChannelLimit(channel)
+	for _, period := range limit.periods(time.Now()) {
+		key := channelUsageKey(channel.Id, period.Period)
+		if common.RedisEnabled {
+			_ = common.RedisDel(key)
+			continue
+		}
+		channelUsageLock.Lock()
+		delete(channelUsageCounters, key)
+		channelUsageLock.Unlock()
+	}
+	if common.RedisEnabled {
+		_ = common.RedisDel(channelExhaustionKey(channel.Id))
+	}
+	channelExhausted.Delete(channel.Id)
+}
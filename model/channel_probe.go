@@ -0,0 +1,155 @@
+package model
+
+import (
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ChannelProbeResult 渠道合成健康探测的单次结果，按渠道与模型组成时间序列
+type ChannelProbeResult struct {
+	Id           int    `json:"id"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index:idx_probe_series,priority:3;index"`
+	ChannelId    int    `json:"channel_id" gorm:"index:idx_probe_series,priority:1"`
+	ModelName    string `json:"model_name" gorm:"type:varchar(128);index:idx_probe_series,priority:2"`
+	ProbeName    string `json:"probe_name" gorm:"type:varchar(64);index"`
+	EndpointType string `json:"endpoint_type" gorm:"type:varchar(32)"`
+	IsStream     bool   `json:"is_stream"`
+	Success      bool   `json:"success"`
+	LatencyMs    int64  `json:"latency_ms"`
+	Message      string `json:"message" gorm:"type:text"`
+}
+
+type ChannelProbeQuery struct {
+	ChannelId      int
+	ModelName      string
+	ProbeName      string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func (q *ChannelProbeQuery) apply() *gorm.DB {
+	tx := DB.Model(&ChannelProbeResult{})
+	if q.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", q.ChannelId)
+	}
+	if q.ModelName != "" {
+		tx = tx.Where("model_name = ?", q.ModelName)
+	}
+	if q.ProbeName != "" {
+		tx = tx.Where("probe_name = ?", q.ProbeName)
+	}
+	if q.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", q.StartTimestamp)
+	}
+	if q.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", q.EndTimestamp)
+	}
+	return tx
+}
+
+func InsertChannelProbeResult(result *ChannelProbeResult) error {
+	return DB.Create(result).Error
+}
+
+// GetChannelProbeResults 按时间倒序分页查询探测结果
+func GetChannelProbeResults(q *ChannelProbeQuery, startIdx int, num int) (results []*ChannelProbeResult, total int64, err error) {
+	if err = q.apply().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = q.apply().Order("id desc").Limit(num).Offset(startIdx).Find(&results).Error
+	return results, total, err
+}
+
+// DeleteChannelProbeResultsBefore 清理指定时间之前的探测结果
+func DeleteChannelProbeResultsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&ChannelProbeResult{})
+	return result.RowsAffected, result.Error
+}
+
+// ChannelProbeSummary 一个渠道与模型在统计窗口内的可用率与延迟分位数，延迟只统计成功的探测
+type ChannelProbeSummary struct {
+	ChannelId    int     `json:"channel_id"`
+	ModelName    string  `json:"model_name"`
+	Total        int     `json:"total"`
+	Success      int     `json:"success"`
+	Uptime       float64 `json:"uptime"` // 百分比
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	P50LatencyMs int64   `json:"p50_latency_ms"`
+	P95LatencyMs int64   `json:"p95_latency_ms"`
+	P99LatencyMs int64   `json:"p99_latency_ms"`
+	LastSuccess  bool    `json:"last_success"`
+	LastTestTime int64   `json:"last_test_time"`
+	LastMessage  string  `json:"last_message,omitempty"`
+}
+
+// latencyPercentile 使用最近秩法计算分位数，sorted 需已升序排列
+func latencyPercentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// GetChannelProbeSummaries 按渠道与模型汇总统计窗口内的探测结果
+func GetChannelProbeSummaries(q *ChannelProbeQuery) ([]*ChannelProbeSummary, error) {
+	var rows []*ChannelProbeResult
+	err := q.apply().Select("channel_id, model_name, success, latency_ms, created_at, message").
+		Order("created_at asc, id asc").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct {
+		channelId int
+		modelName string
+	}
+	summaries := make(map[seriesKey]*ChannelProbeSummary)
+	latencies := make(map[seriesKey][]int64)
+	for _, row := range rows {
+		key := seriesKey{row.ChannelId, row.ModelName}
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &ChannelProbeSummary{ChannelId: row.ChannelId, ModelName: row.ModelName}
+			summaries[key] = summary
+		}
+		summary.Total++
+		if row.Success {
+			summary.Success++
+			latencies[key] = append(latencies[key], row.LatencyMs)
+		}
+		summary.LastSuccess = row.Success
+		summary.LastTestTime = row.CreatedAt
+		summary.LastMessage = row.Message
+	}
+
+	items := make([]*ChannelProbeSummary, 0, len(summaries))
+	for key, summary := range summaries {
+		summary.Uptime = float64(summary.Success) / float64(summary.Total) * 100
+		values := latencies[key]
+		if len(values) > 0 {
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+			var sum int64
+			for _, v := range values {
+				sum += v
+			}
+			summary.AvgLatencyMs = sum / int64(len(values))
+			summary.P50LatencyMs = latencyPercentile(values, 50)
+			summary.P95LatencyMs = latencyPercentile(values, 95)
+			summary.P99LatencyMs = latencyPercentile(values, 99)
+		}
+		items = append(items, summary)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ChannelId != items[j].ChannelId {
+			return items[i].ChannelId < items[j].ChannelId
+		}
+		return items[i].ModelName < items[j].ModelName
+	})
+	return items, nil
+}
@@ -0,0 +1,284 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+// 上游限流状态。
+// 适配器从上游响应头解析剩余请求数、剩余 token 数与 retry-after，按渠道和 Key 序号上报；
+// 启用 Redis 时状态写入 Redis 供多节点共享，各节点本地缓存 1 秒。
+// 渠道选择与多 Key 轮询会跳过即将耗尽或仍处于 retry-after 窗口内的 Key，全部受限时仍按原逻辑选择；
+// 选择时只读取本地缓存，缓存过期后在后台从 Redis 刷新，不在渠道缓存锁内访问 Redis。
+
+const upstreamRateLimitLocalTTL = time.Second
+
+// UpstreamRateLimit 上游限流状态，时间均为毫秒时间戳，数量为 -1 表示上游未返回
+type UpstreamRateLimit struct {
+	LimitRequests     int64 `json:"limit_requests"`
+	RemainingRequests int64 `json:"remaining_requests"`
+	RequestsResetAt   int64 `json:"requests_reset_at,omitempty"`
+	LimitTokens       int64 `json:"limit_tokens"`
+	RemainingTokens   int64 `json:"remaining_tokens"`
+	TokensResetAt     int64 `json:"tokens_reset_at,omitempty"`
+	RetryAfterUntil   int64 `json:"retry_after_until,omitempty"`
+	UpdatedAt         int64 `json:"updated_at"`
+}
+
+type upstreamRateLimitEntry struct {
+	state     *UpstreamRateLimit
+	fetchedAt time.Time
+}
+
+var upstreamRateLimits = make(map[string]*upstreamRateLimitEntry)
+var upstreamRateLimitsLock sync.RWMutex
+
+func NewUpstreamRateLimit() *UpstreamRateLimit {
+	return &UpstreamRateLimit{
+		LimitRequests:     -1,
+		RemainingRequests: -1,
+		LimitTokens:       -1,
+		RemainingTokens:   -1,
+		UpdatedAt:         time.Now().UnixMilli(),
+	}
+}
+
+// IsEmpty 上游未返回任何限流信息
+func (s *UpstreamRateLimit) IsEmpty() bool {
+	return s.RemainingRequests < 0 && s.RemainingTokens < 0 && s.RetryAfterUntil == 0
+}
+
+// expireAt 状态失效时间，上游未返回重置时间时按配置的最长保留时间计算
+func (s *UpstreamRateLimit) expireAt() int64 {
+	expireAt := max(s.RequestsResetAt, s.TokensResetAt, s.RetryAfterUntil)
+	if expireAt == 0 {
+		expireAt = s.UpdatedAt + int64(operation_setting.GetUpstreamRateLimitSetting().MaxStateSeconds)*1000
+	}
+	return expireAt
+}
+
+func nearExhausted(limit, remaining, resetAt, minRemaining int64, ratio float64, now int64) bool {
+	if remaining < 0 || (resetAt != 0 && now >= resetAt) {
+		return false
+	}
+	if remaining <= minRemaining {
+		return true
+	}
+	return ratio > 0 && limit > 0 && float64(remaining) <= float64(limit)*ratio
+}
+
+// Limited 判断在 now（毫秒）时刻是否应跳过该 Key
+func (s *UpstreamRateLimit) Limited(now int64) bool {
+	if s == nil || now >= s.expireAt() {
+		return false
+	}
+	if now < s.RetryAfterUntil {
+		return true
+	}
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	return nearExhausted(s.LimitRequests, s.RemainingRequests, s.RequestsResetAt, setting.MinRemainingRequests, setting.MinRemainingRatio, now) ||
+		nearExhausted(s.LimitTokens, s.RemainingTokens, s.TokensResetAt, setting.MinRemainingTokens, setting.MinRemainingRatio, now)
+}
+
+func upstreamRateLimitKey(channelId int, keyIndex int) string {
+	return fmt.Sprintf("upstream_rate_limit:%d:%d", channelId, keyIndex)
+}
+
+// ReportUpstreamRateLimit 上报渠道 Key 的最新限流状态
+func ReportUpstreamRateLimit(channelId int, keyIndex int, state *UpstreamRateLimit) {
+	if state == nil || state.IsEmpty() || !operation_setting.GetUpstreamRateLimitSetting().Enabled {
+		return
+	}
+	key := upstreamRateLimitKey(channelId, keyIndex)
+	upstreamRateLimitsLock.Lock()
+	// 未过期的 retry-after 窗口不被后续的普通响应覆盖
+	if entry, ok := upstreamRateLimits[key]; ok && entry.state != nil && entry.state.RetryAfterUntil > state.RetryAfterUntil {
+		state.RetryAfterUntil = entry.state.RetryAfterUntil
+	}
+	upstreamRateLimits[key] = &upstreamRateLimitEntry{state: state, fetchedAt: time.Now()}
+	upstreamRateLimitsLock.Unlock()
+
+	if common.RedisEnabled {
+		ttl := time.Duration(state.expireAt()-time.Now().UnixMilli()) * time.Millisecond
+		if ttl <= 0 {
+			return
+		}
+		data, err := common.Marshal(state)
+		if err != nil {
+			return
+		}
+		if err = common.RedisSet(key, string(data), ttl); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save upstream rate limit: channel_id=%d, key_index=%d, error=%v", channelId, keyIndex, err))
+		}
+	}
+}
+
+// loadUpstreamRateLimit 从 Redis 读取限流状态并覆盖本地缓存，读取失败时保留原状态
+func loadUpstreamRateLimit(key string) *upstreamRateLimitEntry {
+	entry := &upstreamRateLimitEntry{fetchedAt: time.Now()}
+	data, err := common.RedisGet(key)
+	switch {
+	case err == nil && data != "":
+		state := &UpstreamRateLimit{}
+		if common.UnmarshalJsonStr(data, state) == nil {
+			entry.state = state
+		}
+	case err != nil && !errors.Is(err, redis.Nil):
+		upstreamRateLimitsLock.RLock()
+		if old, ok := upstreamRateLimits[key]; ok {
+			entry.state = old.state
+		}
+		upstreamRateLimitsLock.RUnlock()
+	}
+	upstreamRateLimitsLock.Lock()
+	upstreamRateLimits[key] = entry
+	upstreamRateLimitsLock.Unlock()
+	return entry
+}
+
+// refreshUpstreamRateLimit 在后台刷新过期的本地缓存，刷新完成前继续使用旧状态
+func refreshUpstreamRateLimit(key string, now time.Time) {
+	upstreamRateLimitsLock.Lock()
+	entry, ok := upstreamRateLimits[key]
+	if ok && now.Sub(entry.fetchedAt) <= upstreamRateLimitLocalTTL {
+		upstreamRateLimitsLock.Unlock()
+		return
+	}
+	// 先更新获取时间，避免并发请求重复刷新
+	stale := &upstreamRateLimitEntry{fetchedAt: now}
+	if ok {
+		stale.state = entry.state
+	}
+	upstreamRateLimits[key] = stale
+	upstreamRateLimitsLock.Unlock()
+	gopool.Go(func() {
+		loadUpstreamRateLimit(key)
+	})
+}
+
+// validUpstreamRateLimit 返回未失效的限流状态
+func validUpstreamRateLimit(key string, entry *upstreamRateLimitEntry, now time.Time) *UpstreamRateLimit {
+	if entry == nil || entry.state == nil {
+		return nil
+	}
+	if now.UnixMilli() >= entry.state.expireAt() {
+		if !common.RedisEnabled {
+			upstreamRateLimitsLock.Lock()
+			delete(upstreamRateLimits, key)
+			upstreamRateLimitsLock.Unlock()
+		}
+		return nil
+	}
+	return entry.state
+}
+
+// GetUpstreamRateLimit 获取渠道 Key 的限流状态，本地缓存过期时同步读取 Redis，不存在或已失效时返回 nil
+func GetUpstreamRateLimit(channelId int, keyIndex int) *UpstreamRateLimit {
+	key := upstreamRateLimitKey(channelId, keyIndex)
+	now := time.Now()
+	upstreamRateLimitsLock.RLock()
+	entry, ok := upstreamRateLimits[key]
+	upstreamRateLimitsLock.RUnlock()
+	if common.RedisEnabled && (!ok || now.Sub(entry.fetchedAt) > upstreamRateLimitLocalTTL) {
+		entry = loadUpstreamRateLimit(key)
+	}
+	return validUpstreamRateLimit(key, entry, now)
+}
+
+// getCachedUpstreamRateLimit 只读取本地缓存，供渠道选择使用
+func getCachedUpstreamRateLimit(channelId int, keyIndex int, now time.Time) *UpstreamRateLimit {
+	key := upstreamRateLimitKey(channelId, keyIndex)
+	upstreamRateLimitsLock.RLock()
+	entry, ok := upstreamRateLimits[key]
+	upstreamRateLimitsLock.RUnlock()
+	if common.RedisEnabled && (!ok || now.Sub(entry.fetchedAt) > upstreamRateLimitLocalTTL) {
+		refreshUpstreamRateLimit(key, now)
+	}
+	return validUpstreamRateLimit(key, entry, now)
+}
+
+// IsUpstreamRateLimited 判断渠道 Key 当前是否即将耗尽或处于 retry-after 窗口内
+func IsUpstreamRateLimited(channelId int, keyIndex int) bool {
+	if !operation_setting.GetUpstreamRateLimitSetting().Enabled {
+		return false
+	}
+	now := time.Now()
+	return getCachedUpstreamRateLimit(channelId, keyIndex, now).Limited(now.UnixMilli())
+}
+
+// isChannelUpstreamRateLimited 渠道的全部可用 Key 均受限时返回 true
+func isChannelUpstreamRateLimited(channel *Channel) bool {
+	for _, idx := range channelKeyIndexes(channel) {
+		if !IsUpstreamRateLimited(channel.Id, idx) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterUpstreamRateLimitedChannels 排除全部 Key 均受限的渠道，全部渠道受限时返回原列表
+func filterUpstreamRateLimitedChannels(channels []int) []int {
+	if !operation_setting.GetUpstreamRateLimitSetting().Enabled || len(channels) <= 1 {
+		return channels
+	}
+	filtered := make([]int, 0, len(channels))
+	for _, channelId := range channels {
+		if channel, ok := channelsIDM[channelId]; !ok || !isChannelUpstreamRateLimited(channel) {
+			filtered = append(filtered, channelId)
+		}
+	}
+	if len(filtered) == 0 {
+		return channels
+	}
+	return filtered
+}
+
+// filterUpstreamRateLimitedKeys 排除受限的 Key，全部受限时返回原列表
+func filterUpstreamRateLimitedKeys(channelId int, keyIndexes []int) []int {
+	if !operation_setting.GetUpstreamRateLimitSetting().Enabled || len(keyIndexes) <= 1 {
+		return keyIndexes
+	}
+	filtered := make([]int, 0, len(keyIndexes))
+	for _, idx := range keyIndexes {
+		if !IsUpstreamRateLimited(channelId, idx) {
+			filtered = append(filtered, idx)
+		}
+	}
+	if len(filtered) == 0 {
+		return keyIndexes
+	}
+	return filtered
+}
+
+type ChannelKeyRateLimit struct {
+	KeyIndex int                `json:"key_index"`
+	Limited  bool               `json:"limited"`
+	State    *UpstreamRateLimit `json:"state"`
+}
+
+// GetChannelUpstreamRateLimits 返回渠道各 Key 的上游限流状态
+func GetChannelUpstreamRateLimits(channel *Channel) []ChannelKeyRateLimit {
+	keyCount := 1
+	if channel.ChannelInfo.IsMultiKey {
+		keyCount = channel.ChannelInfo.MultiKeySize
+	}
+	now := time.Now().UnixMilli()
+	result := make([]ChannelKeyRateLimit, 0, keyCount)
+	for i := 0; i < keyCount; i++ {
+		state := GetUpstreamRateLimit(channel.Id, i)
+		result = append(result, ChannelKeyRateLimit{
+			KeyIndex: i,
+			Limited:  state.Limited(now),
+			State:    state,
+		})
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+func createTestChannel(t *testing.T, name string) *Channel {
+	t.Helper()
+	channel := &Channel{Name: name, Key: "sk-" + name, Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	if err := channel.Insert(); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	return channel
+}
+
+func reportTestRetryAfter(t *testing.T, channelId int) {
+	t.Helper()
+	key := upstreamRateLimitKey(channelId, 0)
+	t.Cleanup(func() {
+		upstreamRateLimitsLock.Lock()
+		delete(upstreamRateLimits, key)
+		upstreamRateLimitsLock.Unlock()
+	})
+	state := NewUpstreamRateLimit()
+	state.RetryAfterUntil = time.Now().Add(time.Minute).UnixMilli()
+	ReportUpstreamRateLimit(channelId, 0, state)
+}
+
+func TestGetChannelSkipsUpstreamRateLimitedChannels(t *testing.T) {
+	setupModelTestDB(t)
+	previous := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = previous
+	})
+	limited := createTestChannel(t, "limited")
+	available := createTestChannel(t, "available")
+	reportTestRetryAfter(t, limited.Id)
+
+	for i := 0; i < 20; i++ {
+		channel, err := GetRandomSatisfiedChannel("default", "gpt-4o", 0)
+		if err != nil {
+			t.Fatalf("get channel: %v", err)
+		}
+		if channel == nil || channel.Id != available.Id {
+			t.Fatalf("expected channel #%d, got %+v", available.Id, channel)
+		}
+	}
+
+	// 全部渠道受限时仍按原逻辑选择
+	reportTestRetryAfter(t, available.Id)
+	channel, err := GetRandomSatisfiedChannel("default", "gpt-4o", 0)
+	if err != nil || channel == nil {
+		t.Fatalf("expected a channel when every channel is rate limited, got %v, %v", channel, err)
+	}
+}
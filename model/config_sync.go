@@ -0,0 +1,626 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"gorm.io/gorm"
+)
+
+// ConfigDocumentVersion 配置文档格式版本，结构发生不兼容变化时递增
+const ConfigDocumentVersion = 1
+
+// 导出时渠道密钥与敏感配置项的处理方式
+const (
+	ConfigKeyModeOmit      = "omit"      // 不导出，导入时保留目标实例现有的值
+	ConfigKeyModePlain     = "plain"     // 明文导出
+	ConfigKeyModeEncrypted = "encrypted" // 使用 SECRET_ENCRYPTION_KEY 加密导出，只能导入到使用相同主密钥的实例
+)
+
+// ConfigDocument 是实例配置的完整快照，可导出为 YAML / JSON 纳入版本管理后再导入到其他实例。
+// 渠道按名称、供应商按名称、模型按模型名、预填组按名称匹配，不依赖各实例的自增 ID。
+type ConfigDocument struct {
+	Version       int                  `json:"version"`
+	ExportedAt    int64                `json:"exported_at,omitempty"`
+	Channels      []ConfigChannel      `json:"channels"`
+	Abilities     []ConfigAbility      `json:"abilities,omitempty"` // 仅供查看，导入时根据渠道重新生成
+	Options       map[string]string    `json:"options"`
+	PrefillGroups []ConfigPrefillGroup `json:"prefill_groups"`
+	Vendors       []ConfigVendor       `json:"vendors"`
+	Models        []ConfigModel        `json:"models"`
+}
+
+type ConfigChannel struct {
+	Name               string                `json:"name"`
+	Type               int                   `json:"type"`
+	Key                string                `json:"key,omitempty"` // 为空时导入不修改已有渠道的密钥
+	Status             int                   `json:"status"`
+	Models             string                `json:"models"`
+	Group              string                `json:"group"`
+	Tag                *string               `json:"tag,omitempty"`
+	Priority           *int64                `json:"priority,omitempty"`
+	Weight             *uint                 `json:"weight,omitempty"`
+	AutoBan            *int                  `json:"auto_ban,omitempty"`
+	BaseURL            *string               `json:"base_url,omitempty"`
+	Other              string                `json:"other,omitempty"`
+	OpenAIOrganization *string               `json:"openai_organization,omitempty"`
+	TestModel          *string               `json:"test_model,omitempty"`
+	ModelMapping       *string               `json:"model_mapping,omitempty"`
+	StatusCodeMapping  *string               `json:"status_code_mapping,omitempty"`
+	Setting            *string               `json:"setting,omitempty"`
+	Settings           string                `json:"settings,omitempty"`
+	ParamOverride      *string               `json:"param_override,omitempty"`
+	HeaderOverride     *string               `json:"header_override,omitempty"`
+	Remark             *string               `json:"remark,omitempty"`
+	IsMultiKey         bool                  `json:"is_multi_key,omitempty"`
+	MultiKeyMode       constant.MultiKeyMode `json:"multi_key_mode,omitempty"`
+}
+
+type ConfigAbility struct {
+	Group    string  `json:"group"`
+	Model    string  `json:"model"`
+	Channel  string  `json:"channel"`
+	Enabled  bool    `json:"enabled"`
+	Priority *int64  `json:"priority,omitempty"`
+	Weight   uint    `json:"weight"`
+	Tag      *string `json:"tag,omitempty"`
+}
+
+type ConfigPrefillGroup struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Items       JSONValue `json:"items"`
+	Description string    `json:"description,omitempty"`
+}
+
+type ConfigVendor struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Status      int    `json:"status"`
+}
+
+type ConfigModel struct {
+	ModelName    string `json:"model_name"`
+	Description  string `json:"description,omitempty"`
+	Icon         string `json:"icon,omitempty"`
+	Tags         string `json:"tags,omitempty"`
+	Vendor       string `json:"vendor,omitempty"` // 供应商名称
+	Endpoints    string `json:"endpoints,omitempty"`
+	Status       int    `json:"status"`
+	SyncOfficial int    `json:"sync_official"`
+	NameRule     int    `json:"name_rule"`
+}
+
+func IsValidConfigKeyMode(mode string) bool {
+	return mode == ConfigKeyModeOmit || mode == ConfigKeyModePlain || mode == ConfigKeyModeEncrypted
+}
+
+func exportConfigSecret(value string, keyMode string) (string, error) {
+	switch keyMode {
+	case ConfigKeyModePlain:
+		return value, nil
+	case ConfigKeyModeEncrypted:
+		return common.EncryptSecret(value)
+	}
+	return "", nil
+}
+
+// ExportConfigDocument 导出当前实例的配置，keyMode 决定渠道密钥与敏感配置项的导出方式
+func ExportConfigDocument(keyMode string) (*ConfigDocument, error) {
+	if !IsValidConfigKeyMode(keyMode) {
+		return nil, fmt.Errorf("invalid key mode: %s", keyMode)
+	}
+	if keyMode == ConfigKeyModeEncrypted && !common.SecretEncryptionEnabled() {
+		return nil, errors.New("secret encryption is not enabled, set SECRET_ENCRYPTION_KEY first")
+	}
+	doc := &ConfigDocument{
+		Version:    ConfigDocumentVersion,
+		ExportedAt: common.GetTimestamp(),
+		Options:    map[string]string{},
+	}
+
+	var channels []*Channel
+	if err := DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	channelNames := make(map[int]string, len(channels))
+	for _, channel := range channels {
+		channelNames[channel.Id] = channel.Name
+		key, err := exportConfigSecret(channel.Key, keyMode)
+		if err != nil {
+			return nil, err
+		}
+		doc.Channels = append(doc.Channels, ConfigChannel{
+			Name:               channel.Name,
+			Type:               channel.Type,
+			Key:                key,
+			Status:             channel.Status,
+			Models:             channel.Models,
+			Group:              channel.Group,
+			Tag:                channel.Tag,
+			Priority:           channel.Priority,
+			Weight:             channel.Weight,
+			AutoBan:            channel.AutoBan,
+			BaseURL:            channel.BaseURL,
+			Other:              channel.Other,
+			OpenAIOrganization: channel.OpenAIOrganization,
+			TestModel:          channel.TestModel,
+			ModelMapping:       channel.ModelMapping,
+			StatusCodeMapping:  channel.StatusCodeMapping,
+			Setting:            channel.Setting,
+			Settings:           channel.OtherSettings,
+			ParamOverride:      channel.ParamOverride,
+			HeaderOverride:     channel.HeaderOverride,
+			Remark:             channel.Remark,
+			IsMultiKey:         channel.ChannelInfo.IsMultiKey,
+			MultiKeyMode:       channel.ChannelInfo.MultiKeyMode,
+		})
+	}
+
+	var abilities []Ability
+	if err := DB.Order("channel_id asc, " + commonGroupCol + " asc, model asc").Find(&abilities).Error; err != nil {
+		return nil, err
+	}
+	for _, ability := range abilities {
+		doc.Abilities = append(doc.Abilities, ConfigAbility{
+			Group:    ability.Group,
+			Model:    ability.Model,
+			Channel:  channelNames[ability.ChannelId],
+			Enabled:  ability.Enabled,
+			Priority: ability.Priority,
+			Weight:   ability.Weight,
+			Tag:      ability.Tag,
+		})
+	}
+
+	// 导出生效中的全部配置（含默认值），倍率、分组倍率等均以配置项形式保存
+	common.OptionMapRWMutex.RLock()
+	for key, value := range common.OptionMap {
+		doc.Options[key] = value
+	}
+	common.OptionMapRWMutex.RUnlock()
+	for key, value := range doc.Options {
+		if !isSecretOptionKey(key) {
+			continue
+		}
+		if value == "" || keyMode == ConfigKeyModeOmit {
+			delete(doc.Options, key)
+			continue
+		}
+		exported, err := exportConfigSecret(value, keyMode)
+		if err != nil {
+			return nil, err
+		}
+		doc.Options[key] = exported
+	}
+
+	var groups []PrefillGroup
+	if err := DB.Order("name asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		doc.PrefillGroups = append(doc.PrefillGroups, ConfigPrefillGroup{
+			Name:        group.Name,
+			Type:        group.Type,
+			Items:       group.Items,
+			Description: group.Description,
+		})
+	}
+
+	var vendors []Vendor
+	if err := DB.Order("name asc").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+		doc.Vendors = append(doc.Vendors, ConfigVendor{
+			Name:        vendor.Name,
+			Description: vendor.Description,
+			Icon:        vendor.Icon,
+			Status:      vendor.Status,
+		})
+	}
+
+	var models []Model
+	if err := DB.Order("model_name asc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		doc.Models = append(doc.Models, ConfigModel{
+			ModelName:    m.ModelName,
+			Description:  m.Description,
+			Icon:         m.Icon,
+			Tags:         m.Tags,
+			Vendor:       vendorNames[m.VendorID],
+			Endpoints:    m.Endpoints,
+			Status:       m.Status,
+			SyncOfficial: m.SyncOfficial,
+			NameRule:     m.NameRule,
+		})
+	}
+	return doc, nil
+}
+
+// PrepareConfigDocument 校验待导入的文档并解密其中加密导出的密钥，预览与导入前都需要调用
+func PrepareConfigDocument(doc *ConfigDocument) error {
+	if doc.Version == 0 || doc.Version > ConfigDocumentVersion {
+		return fmt.Errorf("unsupported config document version: %d", doc.Version)
+	}
+	channelNames := make(map[string]bool, len(doc.Channels))
+	for i := range doc.Channels {
+		channel := &doc.Channels[i]
+		if channel.Name == "" {
+			return fmt.Errorf("channels[%d]: name is required", i)
+		}
+		if channelNames[channel.Name] {
+			return fmt.Errorf("duplicated channel name: %s", channel.Name)
+		}
+		channelNames[channel.Name] = true
+		key, err := common.DecryptSecret(channel.Key)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", channel.Name, err)
+		}
+		channel.Key = key
+	}
+	for key, value := range doc.Options {
+		plaintext, err := common.DecryptSecret(value)
+		if err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+		doc.Options[key] = plaintext
+	}
+	vendorNames := make(map[string]bool, len(doc.Vendors))
+	for i, vendor := range doc.Vendors {
+		if vendor.Name == "" {
+			return fmt.Errorf("vendors[%d]: name is required", i)
+		}
+		if vendorNames[vendor.Name] {
+			return fmt.Errorf("duplicated vendor name: %s", vendor.Name)
+		}
+		vendorNames[vendor.Name] = true
+	}
+	modelNames := make(map[string]bool, len(doc.Models))
+	for i, m := range doc.Models {
+		if m.ModelName == "" {
+			return fmt.Errorf("models[%d]: model_name is required", i)
+		}
+		if modelNames[m.ModelName] {
+			return fmt.Errorf("duplicated model name: %s", m.ModelName)
+		}
+		modelNames[m.ModelName] = true
+	}
+	groupNames := make(map[string]bool, len(doc.PrefillGroups))
+	for i, group := range doc.PrefillGroups {
+		if group.Name == "" || group.Type == "" {
+			return fmt.Errorf("prefill_groups[%d]: name and type are required", i)
+		}
+		if groupNames[group.Name] {
+			return fmt.Errorf("duplicated prefill group name: %s", group.Name)
+		}
+		groupNames[group.Name] = true
+	}
+	// 原本为 JSON 的配置项（倍率等）必须仍是合法 JSON，避免提交后才在加载时失败
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	for key, value := range doc.Options {
+		current := strings.TrimSpace(common.OptionMap[key])
+		if (strings.HasPrefix(current, "{") || strings.HasPrefix(current, "[")) && !json.Valid([]byte(value)) {
+			return fmt.Errorf("option %s: invalid JSON value", key)
+		}
+	}
+	return nil
+}
+
+// ApplyConfigDocument 在一个事务中导入配置，任一步失败则整体回滚；prune 为 true 时删除文档中不存在的渠道、供应商、模型与预填组。
+// 配置项只更新文档中出现且值有变化的项，不会删除，修改记录的操作人为 userId / username。调用前需先执行 PrepareConfigDocument。
+func ApplyConfigDocument(doc *ConfigDocument, prune bool, userId int, username string) error {
+	changedOptions := map[string]string{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyConfigChannels(tx, doc.Channels, prune); err != nil {
+			return err
+		}
+		if err := applyConfigVendors(tx, doc.Vendors, prune); err != nil {
+			return err
+		}
+		if err := applyConfigModels(tx, doc.Models, prune); err != nil {
+			return err
+		}
+		if err := applyConfigPrefillGroups(tx, doc.PrefillGroups, prune); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(doc.Options))
+		for key := range doc.Options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		common.OptionMapRWMutex.RLock()
+		for _, key := range keys {
+			if current, ok := common.OptionMap[key]; !ok || current != doc.Options[key] {
+				changedOptions[key] = doc.Options[key]
+			}
+		}
+		common.OptionMapRWMutex.RUnlock()
+		for _, key := range keys {
+			value, ok := changedOptions[key]
+			if !ok {
+				continue
+			}
+			storedValue, err := encryptOptionValue(key, value)
+			if err != nil {
+				return err
+			}
+			revision := &OptionRevision{OptionKey: key, Value: value, UserId: userId, Username: username}
+			if err := writeOptionRevision(tx, revision, storedValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, value := range changedOptions {
+		if err := updateOptionMap(key, value); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update option %s after config import: %s", key, err.Error()))
+		}
+	}
+	InitChannelCache()
+	RefreshPricing()
+	return nil
+}
+
+func applyConfigChannels(tx *gorm.DB, items []ConfigChannel, prune bool) error {
+	var existing []*Channel
+	if err := tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*Channel, len(existing))
+	duplicated := map[string]bool{}
+	for _, channel := range existing {
+		if _, ok := byName[channel.Name]; ok {
+			duplicated[channel.Name] = true
+		}
+		byName[channel.Name] = channel
+	}
+
+	keep := make(map[int]bool, len(items))
+	for _, item := range items {
+		if duplicated[item.Name] {
+			return fmt.Errorf("channel name %s is not unique in this instance, rename it before importing", item.Name)
+		}
+		channel := &Channel{}
+		current, exists := byName[item.Name]
+		if exists {
+			// 保留运行时数据（余额、用量、测速、多 Key 状态等），只覆盖配置字段
+			*channel = *current
+		} else {
+			if item.Key == "" {
+				return fmt.Errorf("channel %s: key is required for new channel", item.Name)
+			}
+			channel.CreatedTime = common.GetTimestamp()
+		}
+		channel.Name = item.Name
+		channel.Type = item.Type
+		if item.Key != "" {
+			channel.Key = item.Key
+		}
+		channel.Status = item.Status
+		channel.Models = item.Models
+		channel.Group = item.Group
+		channel.Tag = item.Tag
+		channel.Priority = item.Priority
+		channel.Weight = item.Weight
+		channel.AutoBan = item.AutoBan
+		channel.BaseURL = item.BaseURL
+		channel.Other = item.Other
+		channel.OpenAIOrganization = item.OpenAIOrganization
+		channel.TestModel = item.TestModel
+		channel.ModelMapping = item.ModelMapping
+		channel.StatusCodeMapping = item.StatusCodeMapping
+		channel.Setting = item.Setting
+		channel.OtherSettings = item.Settings
+		channel.ParamOverride = item.ParamOverride
+		channel.HeaderOverride = item.HeaderOverride
+		channel.Remark = item.Remark
+		channel.ChannelInfo.IsMultiKey = item.IsMultiKey
+		channel.ChannelInfo.MultiKeyMode = item.MultiKeyMode
+		if channel.ChannelInfo.IsMultiKey {
+			channel.Keys = nil
+			channel.ChannelInfo.MultiKeySize = len(channel.GetKeys())
+			for idx := range channel.ChannelInfo.MultiKeyStatusList {
+				if idx >= channel.ChannelInfo.MultiKeySize {
+					delete(channel.ChannelInfo.MultiKeyStatusList, idx)
+				}
+			}
+			channel.ChannelInfo.pruneMultiKeySettings()
+		}
+
+		if exists {
+			if err := tx.Save(channel).Error; err != nil {
+				return fmt.Errorf("channel %s: %w", item.Name, err)
+			}
+			if err := channel.UpdateAbilities(tx); err != nil {
+				return fmt.Errorf("channel %s: %w", item.Name, err)
+			}
+		} else {
+			if err := tx.Create(channel).Error; err != nil {
+				return fmt.Errorf("channel %s: %w", item.Name, err)
+			}
+			if err := channel.AddAbilities(tx); err != nil {
+				return fmt.Errorf("channel %s: %w", item.Name, err)
+			}
+		}
+		keep[channel.Id] = true
+	}
+
+	if !prune {
+		return nil
+	}
+	var removed []int
+	for _, channel := range existing {
+		if !keep[channel.Id] {
+			removed = append(removed, channel.Id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := tx.Where("id IN ?", removed).Delete(&Channel{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("channel_id IN ?", removed).Delete(&Ability{}).Error
+}
+
+func applyConfigVendors(tx *gorm.DB, items []ConfigVendor, prune bool) error {
+	var existing []Vendor
+	if err := tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]Vendor, len(existing))
+	for _, vendor := range existing {
+		byName[vendor.Name] = vendor
+	}
+	now := common.GetTimestamp()
+	for _, item := range items {
+		vendor, exists := byName[item.Name]
+		vendor.Name = item.Name
+		vendor.Description = item.Description
+		vendor.Icon = item.Icon
+		vendor.Status = item.Status
+		vendor.UpdatedTime = now
+		if exists {
+			err := tx.Model(&vendor).Select("description", "icon", "status", "updated_time").Updates(&vendor).Error
+			if err != nil {
+				return fmt.Errorf("vendor %s: %w", item.Name, err)
+			}
+			delete(byName, item.Name)
+			continue
+		}
+		vendor.CreatedTime = now
+		if err := tx.Create(&vendor).Error; err != nil {
+			return fmt.Errorf("vendor %s: %w", item.Name, err)
+		}
+	}
+	if !prune {
+		return nil
+	}
+	for _, vendor := range byName {
+		if err := tx.Delete(&Vendor{}, vendor.Id).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyConfigModels(tx *gorm.DB, items []ConfigModel, prune bool) error {
+	var vendors []Vendor
+	if err := tx.Find(&vendors).Error; err != nil {
+		return err
+	}
+	vendorIds := make(map[string]int, len(vendors))
+	for _, vendor := range vendors {
+		vendorIds[vendor.Name] = vendor.Id
+	}
+	var existing []Model
+	if err := tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]Model, len(existing))
+	for _, m := range existing {
+		byName[m.ModelName] = m
+	}
+	now := common.GetTimestamp()
+	for _, item := range items {
+		vendorId := 0
+		if item.Vendor != "" {
+			id, ok := vendorIds[item.Vendor]
+			if !ok {
+				return fmt.Errorf("model %s: vendor %s not found", item.ModelName, item.Vendor)
+			}
+			vendorId = id
+		}
+		m, exists := byName[item.ModelName]
+		m.ModelName = item.ModelName
+		m.Description = item.Description
+		m.Icon = item.Icon
+		m.Tags = item.Tags
+		m.VendorID = vendorId
+		m.Endpoints = item.Endpoints
+		m.Status = item.Status
+		m.SyncOfficial = item.SyncOfficial
+		m.NameRule = item.NameRule
+		m.UpdatedTime = now
+		if exists {
+			err := tx.Model(&m).Select("description", "icon", "tags", "vendor_id", "endpoints", "status",
+				"sync_official", "name_rule", "updated_time").Updates(&m).Error
+			if err != nil {
+				return fmt.Errorf("model %s: %w", item.ModelName, err)
+			}
+			delete(byName, item.ModelName)
+			continue
+		}
+		m.CreatedTime = now
+		if err := tx.Create(&m).Error; err != nil {
+			return fmt.Errorf("model %s: %w", item.ModelName, err)
+		}
+	}
+	if !prune {
+		return nil
+	}
+	for _, m := range byName {
+		if err := tx.Delete(&Model{}, m.Id).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyConfigPrefillGroups(tx *gorm.DB, items []ConfigPrefillGroup, prune bool) error {
+	var existing []PrefillGroup
+	if err := tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]PrefillGroup, len(existing))
+	for _, group := range existing {
+		byName[group.Name] = group
+	}
+	now := common.GetTimestamp()
+	for _, item := range items {
+		group, exists := byName[item.Name]
+		group.Name = item.Name
+		group.Type = item.Type
+		group.Items = item.Items
+		group.Description = item.Description
+		group.UpdatedTime = now
+		if exists {
+			err := tx.Model(&group).Select("type", "items", "description", "updated_time").Updates(&group).Error
+			if err != nil {
+				return fmt.Errorf("prefill group %s: %w", item.Name, err)
+			}
+			delete(byName, item.Name)
+			continue
+		}
+		group.CreatedTime = now
+		if err := tx.Create(&group).Error; err != nil {
+			return fmt.Errorf("prefill group %s: %w", item.Name, err)
+		}
+	}
+	if !prune {
+		return nil
+	}
+	for _, group := range byName {
+		if err := tx.Delete(&PrefillGroup{}, group.Id).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
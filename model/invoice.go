@@ -0,0 +1,314 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	InvoiceTypeInvoice    = "invoice"
+	InvoiceTypeCreditNote = "credit_note" // 退款时开具的红字发票，金额为负数
+)
+
+// BillingProfile 用户的开票信息，开具发票时复制到发票中，之后修改不影响已开具的发票
+type BillingProfile struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"`
+	CompanyName string `json:"company_name" gorm:"type:varchar(255)"`
+	TaxId       string `json:"tax_id" gorm:"type:varchar(64)"`
+	Address     string `json:"address" gorm:"type:text"`
+	Country     string `json:"country" gorm:"type:varchar(8)"` // ISO 3166-1 alpha-2
+	Email       string `json:"email" gorm:"type:varchar(255)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+type Invoice struct {
+	Id               int     `json:"id"`
+	InvoiceNo        string  `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	Type             string  `json:"type" gorm:"type:varchar(16);index"`
+	UserId           int     `json:"user_id" gorm:"index"`
+	TopUpId          int     `json:"top_up_id" gorm:"index"`
+	TradeNo          string  `json:"trade_no" gorm:"type:varchar(255)"`
+	RelatedInvoiceId int     `json:"related_invoice_id,omitempty" gorm:"index"` // 红字发票对应的原发票
+	PaymentMethod    string  `json:"payment_method" gorm:"type:varchar(50)"`
+	Currency         string  `json:"currency" gorm:"type:varchar(16)"`
+	Subtotal         float64 `json:"subtotal"`
+	TaxRate          float64 `json:"tax_rate"`
+	TaxAmount        float64 `json:"tax_amount"`
+	Total            float64 `json:"total"` // 含税金额
+	Quota            int64   `json:"quota"`
+	Description      string  `json:"description" gorm:"type:text"`
+	CompanyName      string  `json:"company_name" gorm:"type:varchar(255)"`
+	TaxId            string  `json:"tax_id" gorm:"type:varchar(64)"`
+	Address          string  `json:"address" gorm:"type:text"`
+	Country          string  `json:"country" gorm:"type:varchar(8)"`
+	Email            string  `json:"email" gorm:"type:varchar(255)"`
+	CreatedTime      int64   `json:"created_time" gorm:"bigint;index"`
+}
+
+// InvoiceSequence 发票编号计数器，按前缀与年份分别连续编号
+type InvoiceSequence struct {
+	Name  string `gorm:"primaryKey;type:varchar(64)"`
+	Value int
+}
+
+func GetBillingProfile(userId int) (*BillingProfile, error) {
+	profile := &BillingProfile{}
+	err := DB.Where("user_id = ?", userId).First(profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &BillingProfile{UserId: userId}, nil
+	}
+	return profile, err
+}
+
+func SaveBillingProfile(profile *BillingProfile) error {
+	profile.CompanyName = strings.TrimSpace(profile.CompanyName)
+	profile.TaxId = strings.TrimSpace(profile.TaxId)
+	profile.Country = strings.ToUpper(strings.TrimSpace(profile.Country))
+	if len(profile.Country) > 2 {
+		return errors.New("国家代码应为两位字母")
+	}
+	existing, err := GetBillingProfile(profile.UserId)
+	if err != nil {
+		return err
+	}
+	profile.Id = existing.Id
+	profile.CreatedTime = existing.CreatedTime
+	profile.UpdatedTime = common.GetTimestamp()
+	if profile.CreatedTime == 0 {
+		profile.CreatedTime = profile.UpdatedTime
+	}
+	return DB.Save(profile).Error
+}
+
+// nextInvoiceNo 在事务中生成连续的发票编号，例如 INV-2026-000001
+func nextInvoiceNo(tx *gorm.DB, prefix string, now time.Time) (string, error) {
+	name := fmt.Sprintf("%s-%d", prefix, now.Year())
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&InvoiceSequence{Name: name}).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Model(&InvoiceSequence{}).Where("name = ?", name).Update("value", gorm.Expr("value + 1")).Error; err != nil {
+		return "", err
+	}
+	seq := &InvoiceSequence{}
+	if err := tx.Where("name = ?", name).First(seq).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%06d", name, seq.Value), nil
+}
+
+// splitTax 将含税金额拆分为不含税金额与税额
+func splitTax(total float64, rate float64) (subtotal float64, tax float64) {
+	dTotal := decimal.NewFromFloat(total)
+	dSubtotal := dTotal.Div(decimal.NewFromFloat(1 + rate)).Round(2)
+	return dSubtotal.InexactFloat64(), dTotal.Sub(dSubtotal).Round(2).InexactFloat64()
+}
+
+// CreateTopUpInvoice 为已完成的充值订单开具发票，已开具时直接返回原发票。
+// 订单支付金额视为含税金额，税率按用户开票信息中的国家确定。
+func CreateTopUpInvoice(tradeNo string) (*Invoice, error) {
+	setting := operation_setting.GetInvoiceSetting()
+	if !setting.Enabled {
+		return nil, nil
+	}
+	topUp := GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return nil, errors.New("充值订单不存在")
+	}
+	if topUp.Status != common.TopUpStatusSuccess {
+		return nil, errors.New("充值订单未完成")
+	}
+	profile, err := GetBillingProfile(topUp.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定充值订单，避免并发的完成回调重复开具发票
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", topUp.Id).First(topUp).Error; err != nil {
+			return err
+		}
+		err := tx.Where("top_up_id = ? AND type = ?", topUp.Id, InvoiceTypeInvoice).First(invoice).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		now := time.Now()
+		invoiceNo, err := nextInvoiceNo(tx, setting.InvoicePrefix, now)
+		if err != nil {
+			return err
+		}
+		taxRate := setting.GetTaxRate(profile.Country)
+		subtotal, tax := splitTax(topUp.Money, taxRate)
+		*invoice = Invoice{
+			InvoiceNo:     invoiceNo,
+			Type:          InvoiceTypeInvoice,
+			UserId:        topUp.UserId,
+			TopUpId:       topUp.Id,
+			TradeNo:       topUp.TradeNo,
+			PaymentMethod: topUp.PaymentMethod,
+			Currency:      setting.GetPaymentCurrency(topUp.PaymentMethod),
+			Subtotal:      subtotal,
+			TaxRate:       taxRate,
+			TaxAmount:     tax,
+			Total:         topUp.Money,
+			Quota:         topUp.Amount,
+			Description:   fmt.Sprintf("Account top-up %s", topUp.TradeNo),
+			CompanyName:   profile.CompanyName,
+			TaxId:         profile.TaxId,
+			Address:       profile.Address,
+			Country:       profile.Country,
+			Email:         profile.Email,
+			CreatedTime:   now.Unix(),
+		}
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// IssueTopUpInvoice 充值完成后开具发票，失败只记录日志，不影响充值流程
+func IssueTopUpInvoice(tradeNo string) {
+	if _, err := CreateTopUpInvoice(tradeNo); err != nil {
+		common.SysLog(fmt.Sprintf("failed to create invoice for top-up %s: %s", tradeNo, err.Error()))
+	}
+}
+
+// CreateCreditNote 为发票开具红字发票，amount 为退款的含税金额，累计不能超过原发票金额
+func CreateCreditNote(invoiceId int, amount float64, reason string) (*Invoice, error) {
+	if amount <= 0 {
+		return nil, errors.New("退款金额必须大于 0")
+	}
+	setting := operation_setting.GetInvoiceSetting()
+	creditNote := &Invoice{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		origin := &Invoice{}
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(origin, invoiceId).Error; err != nil {
+			return errors.New("发票不存在")
+		}
+		if origin.Type != InvoiceTypeInvoice {
+			return errors.New("只能为发票开具红字发票")
+		}
+		var credited float64
+		if err := tx.Model(&Invoice{}).Where("related_invoice_id = ? AND type = ?", origin.Id, InvoiceTypeCreditNote).
+			Select("COALESCE(SUM(total), 0)").Scan(&credited).Error; err != nil {
+			return err
+		}
+		remaining := decimal.NewFromFloat(origin.Total).Add(decimal.NewFromFloat(credited))
+		if decimal.NewFromFloat(amount).GreaterThan(remaining) {
+			return fmt.Errorf("退款金额超过发票剩余可退金额 %s", remaining.StringFixed(2))
+		}
+		now := time.Now()
+		invoiceNo, err := nextInvoiceNo(tx, setting.CreditNotePrefix, now)
+		if err != nil {
+			return err
+		}
+		subtotal, tax := splitTax(amount, origin.TaxRate)
+		quota := int64(0)
+		if origin.Total > 0 {
+			quota = int64(float64(origin.Quota) * amount / origin.Total)
+		}
+		description := fmt.Sprintf("Credit note for %s", origin.InvoiceNo)
+		if reason != "" {
+			description += ": " + reason
+		}
+		*creditNote = Invoice{
+			InvoiceNo:        invoiceNo,
+			Type:             InvoiceTypeCreditNote,
+			UserId:           origin.UserId,
+			TopUpId:          origin.TopUpId,
+			TradeNo:          origin.TradeNo,
+			RelatedInvoiceId: origin.Id,
+			PaymentMethod:    origin.PaymentMethod,
+			Currency:         origin.Currency,
+			Subtotal:         -subtotal,
+			TaxRate:          origin.TaxRate,
+			TaxAmount:        -tax,
+			Total:            -amount,
+			Quota:            -quota,
+			Description:      description,
+			CompanyName:      origin.CompanyName,
+			TaxId:            origin.TaxId,
+			Address:          origin.Address,
+			Country:          origin.Country,
+			Email:            origin.Email,
+			CreatedTime:      now.Unix(),
+		}
+		return tx.Create(creditNote).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return creditNote, nil
+}
+
+func GetInvoiceById(id int) (*Invoice, error) {
+	invoice := &Invoice{}
+	if err := DB.First(invoice, id).Error; err != nil {
+		return nil, errors.New("发票不存在")
+	}
+	return invoice, nil
+}
+
+func GetInvoiceByTopUpId(topUpId int) (*Invoice, error) {
+	invoice := &Invoice{}
+	if err := DB.Where("top_up_id = ? AND type = ?", topUpId, InvoiceTypeInvoice).First(invoice).Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+type InvoiceQuery struct {
+	UserId         int
+	Type           string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func (q *InvoiceQuery) apply(tx *gorm.DB) *gorm.DB {
+	if q.UserId != 0 {
+		tx = tx.Where("user_id = ?", q.UserId)
+	}
+	if q.Type != "" {
+		tx = tx.Where("type = ?", q.Type)
+	}
+	if q.StartTimestamp != 0 {
+		tx = tx.Where("created_time >= ?", q.StartTimestamp)
+	}
+	if q.EndTimestamp != 0 {
+		tx = tx.Where("created_time <= ?", q.EndTimestamp)
+	}
+	return tx
+}
+
+func GetInvoices(q *InvoiceQuery, startIdx int, num int) (invoices []*Invoice, total int64, err error) {
+	tx := q.apply(DB.Model(&Invoice{}))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&invoices).Error
+	return invoices, total, err
+}
+
+// IterateInvoices 按编号顺序分批遍历发票，用于导出
+func IterateInvoices(q *InvoiceQuery, fn func([]*Invoice) error) error {
+	var batch []*Invoice
+	return q.apply(DB.Model(&Invoice{})).Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
@@ -37,6 +37,7 @@ type Log struct {
 	Group            string `json:"group" gorm:"index"`
 	Ip               string `json:"ip" gorm:"index;default:''"`
 	Other            string `json:"other"`
+	UpstreamCost     int    `json:"upstream_cost,omitempty" gorm:"default:0"` // 上游成本（额度单位），仅管理员可见
 }
 
 // don't use iota, avoid change log type value
@@ -53,6 +54,7 @@ const (
 func formatUserLogs(logs []*Log) {
 	for i := range logs {
 		logs[i].ChannelName = ""
+		logs[i].UpstreamCost = 0
 		var otherMap map[string]interface{}
 		otherMap, _ = common.StrToMap(logs[i].Other)
 		if otherMap != nil {
@@ -189,7 +191,8 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			}
 			return ""
 		}(),
-		Other: otherStr,
+		Other:        otherStr,
+		UpstreamCost: calculateUpstreamCost(params),
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
@@ -303,6 +306,36 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	return logs, total, err
 }
 
+// GetOrganizationLogs 查询组织令牌产生的日志，组织令牌被删除后历史用量仍然可查
+func GetOrganizationLogs(tokenIds []int, startTimestamp int64, endTimestamp int64, modelName string, username string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	if len(tokenIds) == 0 {
+		return []*Log{}, 0, nil
+	}
+	tx := LOG_DB.Where("logs.token_id IN ? and logs.type = ?", tokenIds, LogTypeConsume)
+	if modelName != "" {
+		tx = tx.Where("logs.model_name like ?", modelName)
+	}
+	if username != "" {
+		tx = tx.Where("logs.username = ?", username)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", endTimestamp)
+	}
+	err = tx.Model(&Log{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("logs.id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	formatUserLogs(logs)
+	return logs, total, err
+}
+
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
 	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	return logs, err
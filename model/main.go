@@ -267,6 +267,20 @@ func migrateDB() error {
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
+		&UserOAuthBinding{},
+		&Organization{},
+		&OrganizationMember{},
+		&AuditLog{},
+		&OptionRevision{},
+		&SubscriptionPlan{},
+		&Subscription{},
+		&BillingProfile{},
+		&Invoice{},
+		&InvoiceSequence{},
+		&ChannelProbeResult{},
+		&ModelStatusStat{},
+		&StatusIncident{},
+		&StatusIncidentUpdate{},
 	)
 	if err != nil {
 		return err
@@ -300,6 +314,20 @@ func migrateDBFast() error {
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
+		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&AuditLog{}, "AuditLog"},
+		{&OptionRevision{}, "OptionRevision"},
+		{&SubscriptionPlan{}, "SubscriptionPlan"},
+		{&Subscription{}, "Subscription"},
+		{&BillingProfile{}, "BillingProfile"},
+		{&Invoice{}, "Invoice"},
+		{&InvoiceSequence{}, "InvoiceSequence"},
+		{&ChannelProbeResult{}, "ChannelProbeResult"},
+		{&ModelStatusStat{}, "ModelStatusStat"},
+		{&StatusIncident{}, "StatusIncident"},
+		{&StatusIncidentUpdate{}, "StatusIncidentUpdate"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
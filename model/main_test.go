@@ -0,0 +1,39 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// setupModelTestDB 为每个测试初始化独立的 SQLite 数据库
+func setupModelTestDB(t *testing.T) {
+	t.Helper()
+	common.SQLitePath = filepath.Join(t.TempDir(), "model.db")
+	common.UsingSQLite = true
+	common.IsMasterNode = true
+	common.RedisEnabled = false
+	if err := InitDB(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	LOG_DB = DB
+}
+
+func createTestUser(t *testing.T, quota int) *User {
+	t.Helper()
+	user := &User{Username: "test_user", Password: "password", Quota: quota, Status: common.UserStatusEnabled, Group: "default"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func getTestUserQuota(t *testing.T, userId int) int {
+	t.Helper()
+	quota, err := GetUserQuota(userId, true)
+	if err != nil {
+		t.Fatalf("get user quota: %v", err)
+	}
+	return quota
+}
@@ -1,28 +1,29 @@
 package model
 
 type Midjourney struct {
-	Id          int    `json:"id"`
-	Code        int    `json:"code"`
-	UserId      int    `json:"user_id" gorm:"index"`
-	Action      string `json:"action" gorm:"type:varchar(40);index"`
-	MjId        string `json:"mj_id" gorm:"index"`
-	Prompt      string `json:"prompt"`
-	PromptEn    string `json:"prompt_en"`
-	Description string `json:"description"`
-	State       string `json:"state"`
-	SubmitTime  int64  `json:"submit_time" gorm:"index"`
-	StartTime   int64  `json:"start_time" gorm:"index"`
-	FinishTime  int64  `json:"finish_time" gorm:"index"`
-	ImageUrl    string `json:"image_url"`
-	VideoUrl    string `json:"video_url"`
-	VideoUrls   string `json:"video_urls"`
-	Status      string `json:"status" gorm:"type:varchar(20);index"`
-	Progress    string `json:"progress" gorm:"type:varchar(30);index"`
-	FailReason  string `json:"fail_reason"`
-	ChannelId   int    `json:"channel_id"`
-	Quota       int    `json:"quota"`
-	Buttons     string `json:"buttons"`
-	Properties  string `json:"properties"`
+	Id             int    `json:"id"`
+	Code           int    `json:"code"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	Action         string `json:"action" gorm:"type:varchar(40);index"`
+	MjId           string `json:"mj_id" gorm:"index"`
+	Prompt         string `json:"prompt"`
+	PromptEn       string `json:"prompt_en"`
+	Description    string `json:"description"`
+	State          string `json:"state"`
+	SubmitTime     int64  `json:"submit_time" gorm:"index"`
+	StartTime      int64  `json:"start_time" gorm:"index"`
+	FinishTime     int64  `json:"finish_time" gorm:"index"`
+	ImageUrl       string `json:"image_url"`
+	VideoUrl       string `json:"video_url"`
+	VideoUrls      string `json:"video_urls"`
+	Status         string `json:"status" gorm:"type:varchar(20);index"`
+	Progress       string `json:"progress" gorm:"type:varchar(30);index"`
+	FailReason     string `json:"fail_reason"`
+	ChannelId      int    `json:"channel_id"`
+	Quota          int    `json:"quota"`
+	Buttons        string `json:"buttons"`
+	Properties     string `json:"properties"`
+	OrganizationId int    `json:"organization_id" gorm:"default:0"` // 组织令牌提交的任务，退款时退回组织额度池
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -1,5 +1,7 @@
 package model
 
+import "github.com/QuantumNous/new-api/dto"
+
 func GetModelEnableGroups(modelName string) []string {
 	// 确保缓存最新
 	GetPricing()
@@ -29,3 +31,16 @@ func GetModelQuotaTypes(modelName string) []int {
 	}
 	return []int{quota}
 }
+
+// GetModelCapabilities 返回指定模型的能力元数据（来自缓存），未配置时返回 nil
+func GetModelCapabilities(modelName string) *dto.ModelCapabilities {
+	GetPricing()
+
+	modelEnableGroupsLock.RLock()
+	capabilities, ok := modelCapabilitiesMap[modelName]
+	modelEnableGroupsLock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return &capabilities
+}
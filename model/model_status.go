@@ -0,0 +1,163 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+// ModelStatusStat 按小时汇总的模型可用性统计，来源于真实转发结果与健康探测，不区分渠道
+type ModelStatusStat struct {
+	Id                int    `json:"id"`
+	ModelName         string `json:"model_name" gorm:"type:varchar(128);uniqueIndex:idx_model_status_hour,priority:1"`
+	Hour              int64  `json:"hour" gorm:"bigint;uniqueIndex:idx_model_status_hour,priority:2;index"`
+	SuccessCount      int64  `json:"success_count" gorm:"default:0"`
+	FailureCount      int64  `json:"failure_count" gorm:"default:0"`
+	LatencyMsSum      int64  `json:"latency_ms_sum" gorm:"default:0"` // 成功转发请求的首字延迟总和
+	ProbeSuccessCount int64  `json:"probe_success_count" gorm:"default:0"`
+	ProbeFailureCount int64  `json:"probe_failure_count" gorm:"default:0"`
+}
+
+var (
+	cacheModelStatusStats     = make(map[string]*ModelStatusStat)
+	cacheModelStatusStatsLock = sync.Mutex{}
+)
+
+func getModelStatusStatCache(modelName string) *ModelStatusStat {
+	now := time.Now().Unix()
+	// 只精确到小时
+	hour := now - now%3600
+	key := fmt.Sprintf("%s-%d", modelName, hour)
+	stat, ok := cacheModelStatusStats[key]
+	if !ok {
+		stat = &ModelStatusStat{ModelName: modelName, Hour: hour}
+		cacheModelStatusStats[key] = stat
+	}
+	return stat
+}
+
+// RecordModelStatus 记录一次转发的最终结果
+func RecordModelStatus(modelName string, success bool, latencyMs int64) {
+	if modelName == "" {
+		return
+	}
+	cacheModelStatusStatsLock.Lock()
+	defer cacheModelStatusStatsLock.Unlock()
+	stat := getModelStatusStatCache(modelName)
+	if success {
+		stat.SuccessCount++
+		stat.LatencyMsSum += latencyMs
+	} else {
+		stat.FailureCount++
+	}
+}
+
+// RecordModelProbeStatus 记录一次健康探测的结果
+func RecordModelProbeStatus(modelName string, success bool) {
+	if modelName == "" {
+		return
+	}
+	cacheModelStatusStatsLock.Lock()
+	defer cacheModelStatusStatsLock.Unlock()
+	stat := getModelStatusStatCache(modelName)
+	if success {
+		stat.ProbeSuccessCount++
+	} else {
+		stat.ProbeFailureCount++
+	}
+}
+
+// ModelStatusRetentionDays 模型可用性统计保留天数，与状态页展示的最长区间一致
+const ModelStatusRetentionDays = 90
+
+// UpdateModelStatusStats 定时将内存中的统计累加到数据库，每个节点各自累加本节点的请求；主节点每天清理过期统计
+func UpdateModelStatusStats(frequency int) {
+	var lastCleanup int64
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		SaveModelStatusStatsCache()
+		now := time.Now().Unix()
+		if common.IsMasterNode && now-lastCleanup >= 86400 {
+			lastCleanup = now
+			// 多保留一天，保证按天汇总时最早一天的数据完整
+			if err := DeleteModelStatusStatsBefore(now - (ModelStatusRetentionDays+1)*86400); err != nil {
+				common.SysLog(fmt.Sprintf("failed to clean up model status stats: %s", err.Error()))
+			}
+		}
+	}
+}
+
+func SaveModelStatusStatsCache() {
+	cacheModelStatusStatsLock.Lock()
+	stats := cacheModelStatusStats
+	cacheModelStatusStats = make(map[string]*ModelStatusStat)
+	cacheModelStatusStatsLock.Unlock()
+
+	for _, stat := range stats {
+		if err := saveModelStatusStat(stat); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save model status stat: %s", err.Error()))
+		}
+	}
+}
+
+func increaseModelStatusStat(stat *ModelStatusStat) (int64, error) {
+	result := DB.Model(&ModelStatusStat{}).Where("model_name = ? AND hour = ?", stat.ModelName, stat.Hour).
+		Updates(map[string]interface{}{
+			"success_count":       gorm.Expr("success_count + ?", stat.SuccessCount),
+			"failure_count":       gorm.Expr("failure_count + ?", stat.FailureCount),
+			"latency_ms_sum":      gorm.Expr("latency_ms_sum + ?", stat.LatencyMsSum),
+			"probe_success_count": gorm.Expr("probe_success_count + ?", stat.ProbeSuccessCount),
+			"probe_failure_count": gorm.Expr("probe_failure_count + ?", stat.ProbeFailureCount),
+		})
+	return result.RowsAffected, result.Error
+}
+
+func saveModelStatusStat(stat *ModelStatusStat) error {
+	affected, err := increaseModelStatusStat(stat)
+	if err != nil || affected > 0 {
+		return err
+	}
+	if err = DB.Create(stat).Error; err != nil {
+		// 其他节点可能已插入同一小时的记录
+		_, err = increaseModelStatusStat(stat)
+	}
+	return err
+}
+
+// ModelStatusAggregate 一段时间内某模型的可用性汇总，Bucket 为按天汇总时当天零点（UTC）的时间戳
+type ModelStatusAggregate struct {
+	ModelName         string `json:"model_name"`
+	Bucket            int64  `json:"bucket"`
+	SuccessCount      int64  `json:"success_count"`
+	FailureCount      int64  `json:"failure_count"`
+	LatencyMsSum      int64  `json:"latency_ms_sum"`
+	ProbeSuccessCount int64  `json:"probe_success_count"`
+	ProbeFailureCount int64  `json:"probe_failure_count"`
+}
+
+const modelStatusSumColumns = "sum(success_count) AS success_count, sum(failure_count) AS failure_count, sum(latency_ms_sum) AS latency_ms_sum, " +
+	"sum(probe_success_count) AS probe_success_count, sum(probe_failure_count) AS probe_failure_count"
+
+// GetModelStatusSince 按模型汇总指定时间之后的统计
+func GetModelStatusSince(since int64) ([]*ModelStatusAggregate, error) {
+	var rows []*ModelStatusAggregate
+	err := DB.Model(&ModelStatusStat{}).Select("model_name, "+modelStatusSumColumns).
+		Where("hour >= ?", since).Group("model_name").Scan(&rows).Error
+	return rows, err
+}
+
+// GetModelStatusDaily 按模型与天汇总指定时间之后的统计
+func GetModelStatusDaily(since int64) ([]*ModelStatusAggregate, error) {
+	var rows []*ModelStatusAggregate
+	err := DB.Model(&ModelStatusStat{}).Select("model_name, hour - hour % 86400 AS bucket, "+modelStatusSumColumns).
+		Where("hour >= ?", since).Group("model_name, bucket").Scan(&rows).Error
+	return rows, err
+}
+
+// DeleteModelStatusStatsBefore 清理指定时间之前的统计
+func DeleteModelStatusStatsBefore(timestamp int64) error {
+	return DB.Where("hour < ?", timestamp).Delete(&ModelStatusStat{}).Error
+}
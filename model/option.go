@@ -22,7 +22,21 @@ func AllOption() ([]*Option, error) {
 	var options []*Option
 	var err error
 	err = DB.Find(&options).Error
-	return options, err
+	if err != nil {
+		return nil, err
+	}
+	// 敏感配置加密存储，解密失败的配置项跳过，避免把密文当作配置值加载
+	result := make([]*Option, 0, len(options))
+	for _, option := range options {
+		value, err := common.DecryptSecret(option.Value)
+		if err != nil {
+			common.SysLog("failed to decrypt option " + option.Key + ": " + err.Error())
+			continue
+		}
+		option.Value = value
+		result = append(result, option)
+	}
+	return result, nil
 }
 
 func InitOptionMap() {
@@ -114,6 +128,8 @@ func InitOptionMap() {
 	common.OptionMap["ModelRatio"] = ratio_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
+	common.OptionMap["PricingTiers"] = ratio_setting.PricingTiers2JSONString()
+	common.OptionMap["PricingWindows"] = ratio_setting.PricingWindows2JSONString()
 	common.OptionMap["GroupRatio"] = ratio_setting.GroupRatio2JSONString()
 	common.OptionMap["GroupGroupRatio"] = ratio_setting.GroupGroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
@@ -173,20 +189,9 @@ func SyncOptions(frequency int) {
 	}
 }
 
+// UpdateOption 修改配置，修改记录中不含修改人，管理员操作应使用 UpdateOptionByUser
 func UpdateOption(key string, value string) error {
-	// Save to database first
-	option := Option{
-		Key: key,
-	}
-	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
-	option.Value = value
-	// Save is a combination function.
-	// If save value does not contain primary key, it will execute Create,
-	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+	return UpdateOptionByUser(key, value, 0, "")
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -424,6 +429,10 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = ratio_setting.UpdateCacheRatioByJSONString(value)
+	case "PricingTiers":
+		err = ratio_setting.UpdatePricingTiersByJSONString(value)
+	case "PricingWindows":
+		err = ratio_setting.UpdatePricingWindowsByJSONString(value)
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(value)
 	case "AudioRatio":
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OptionRevisionStatusApplied   = 1 // 已生效
+	OptionRevisionStatusPending   = 2 // 等待定时生效
+	OptionRevisionStatusCancelled = 3 // 定时修改已取消
+)
+
+// OptionRevision 配置项的修改记录，每次写入配置都会生成一条，用于查看历史、对比差异与回滚。
+// 敏感配置项（见 isSecretOptionKey）的值与 Option 表一样加密保存。
+type OptionRevision struct {
+	Id            int    `json:"id"`
+	OptionKey     string `json:"key" gorm:"type:varchar(128);index"`
+	Value         string `json:"value" gorm:"type:text"`
+	PreviousValue string `json:"previous_value" gorm:"type:text"` // 生效前的值，定时修改在生效时填写
+	UserId        int    `json:"user_id" gorm:"index"`            // 0 表示系统内部修改
+	Username      string `json:"username" gorm:"type:varchar(64)"`
+	Status        int    `json:"status" gorm:"default:1;index"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+	ActivateAt    int64  `json:"activate_at" gorm:"bigint;index"` // 定时生效时间，0 表示立即生效
+	AppliedAt     int64  `json:"applied_at" gorm:"bigint"`
+	RollbackOf    int    `json:"rollback_of"` // 回滚操作恢复的目标版本
+}
+
+// decryptValues 将敏感配置项的值解密为明文，解密失败时置空，避免把密文当作配置值使用
+func (r *OptionRevision) decryptValues() {
+	if !isSecretOptionKey(r.OptionKey) {
+		return
+	}
+	var err error
+	if r.Value, err = common.DecryptSecret(r.Value); err != nil {
+		common.SysLog(fmt.Sprintf("failed to decrypt option revision %d: %s", r.Id, err.Error()))
+		r.Value = ""
+	}
+	if r.PreviousValue, err = common.DecryptSecret(r.PreviousValue); err != nil {
+		r.PreviousValue = ""
+	}
+}
+
+func (r *OptionRevision) IsSecret() bool {
+	return isSecretOptionKey(r.OptionKey)
+}
+
+// UpdateOptionByUser 修改配置并记录修改人
+func UpdateOptionByUser(key string, value string, userId int, username string) error {
+	return applyOptionRevision(&OptionRevision{
+		OptionKey: key,
+		Value:     value,
+		UserId:    userId,
+		Username:  username,
+	})
+}
+
+// ScheduleOptionUpdate 创建一条定时生效的配置修改，到达 activateAt 后由 ActivateScheduledOptions 应用
+func ScheduleOptionUpdate(key string, value string, activateAt int64, userId int, username string) (*OptionRevision, error) {
+	storedValue, err := encryptOptionValue(key, value)
+	if err != nil {
+		return nil, err
+	}
+	revision := &OptionRevision{
+		OptionKey:  key,
+		Value:      storedValue,
+		UserId:     userId,
+		Username:   username,
+		Status:     OptionRevisionStatusPending,
+		CreatedAt:  common.GetTimestamp(),
+		ActivateAt: activateAt,
+	}
+	if err := DB.Create(revision).Error; err != nil {
+		return nil, err
+	}
+	revision.decryptValues()
+	return revision, nil
+}
+
+// RollbackOptionRevision 将配置项恢复为指定版本的值，回滚本身也会生成一条新版本
+func RollbackOptionRevision(id int, userId int, username string) (*OptionRevision, error) {
+	target, err := GetOptionRevisionById(id)
+	if err != nil {
+		return nil, err
+	}
+	if target.Status != OptionRevisionStatusApplied {
+		return nil, errors.New("只能回滚到已生效的版本")
+	}
+	revision := &OptionRevision{
+		OptionKey:  target.OptionKey,
+		Value:      target.Value,
+		UserId:     userId,
+		Username:   username,
+		RollbackOf: target.Id,
+	}
+	if err := applyOptionRevision(revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// applyOptionRevision 在一个事务中写入配置与修改记录，再通过 updateOptionMap 使配置生效
+func applyOptionRevision(revision *OptionRevision) error {
+	storedValue, err := encryptOptionValue(revision.OptionKey, revision.Value)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		return writeOptionRevision(tx, revision, storedValue)
+	})
+	if err != nil {
+		return err
+	}
+	if isSecretOptionKey(revision.OptionKey) {
+		revision.PreviousValue, _ = common.DecryptSecret(revision.PreviousValue)
+	}
+	return updateOptionMap(revision.OptionKey, revision.Value)
+}
+
+// writeOptionRevision 在事务中保存配置值（storedValue 为加密后的值）并记录修改，不更新内存中的配置
+func writeOptionRevision(tx *gorm.DB, revision *OptionRevision, storedValue string) error {
+	now := common.GetTimestamp()
+	option := Option{Key: revision.OptionKey}
+	// https://gorm.io/docs/update.html#Save-All-Fields
+	if err := tx.FirstOrCreate(&option, Option{Key: revision.OptionKey}).Error; err != nil {
+		return err
+	}
+	record := *revision
+	record.Value = storedValue
+	record.PreviousValue = option.Value
+	record.Status = OptionRevisionStatusApplied
+	record.AppliedAt = now
+	if record.CreatedAt == 0 {
+		record.CreatedAt = now
+	}
+	if record.Id == 0 {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+	} else {
+		// 定时修改：只有仍处于等待状态时才生效，避免多次应用或应用已取消的修改
+		result := tx.Model(&OptionRevision{}).Where("id = ? AND status = ?", record.Id, OptionRevisionStatusPending).
+			Updates(map[string]any{
+				"status":         OptionRevisionStatusApplied,
+				"applied_at":     now,
+				"previous_value": record.PreviousValue,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOptionRevisionNotPending
+		}
+	}
+	option.Value = storedValue
+	if err := tx.Save(&option).Error; err != nil {
+		return err
+	}
+	revision.Id = record.Id
+	revision.PreviousValue = record.PreviousValue
+	revision.Status = record.Status
+	revision.CreatedAt = record.CreatedAt
+	revision.AppliedAt = record.AppliedAt
+	return nil
+}
+
+var errOptionRevisionNotPending = errors.New("option revision is not pending")
+
+// CancelOptionRevision 取消尚未生效的定时修改
+func CancelOptionRevision(id int) error {
+	result := DB.Model(&OptionRevision{}).Where("id = ? AND status = ?", id, OptionRevisionStatusPending).
+		Update("status", OptionRevisionStatusCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该修改不存在或已生效")
+	}
+	return nil
+}
+
+func GetOptionRevisionById(id int) (*OptionRevision, error) {
+	revision := &OptionRevision{}
+	if err := DB.First(revision, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	revision.decryptValues()
+	return revision, nil
+}
+
+// GetOptionRevisions 分页查询修改记录，key 为空时返回全部配置项的记录
+func GetOptionRevisions(key string, status int, startIdx int, num int) (revisions []*OptionRevision, total int64, err error) {
+	tx := DB.Model(&OptionRevision{})
+	if key != "" {
+		tx = tx.Where("option_key = ?", key)
+	}
+	if status != 0 {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&revisions).Error
+	for _, revision := range revisions {
+		revision.decryptValues()
+	}
+	return revisions, total, err
+}
+
+// ActivateScheduledOptions 定期应用到期的定时配置修改，仅在主节点运行，其他节点通过 SyncOptions 同步
+func ActivateScheduledOptions(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		activateDueOptionRevisions()
+	}
+}
+
+func activateDueOptionRevisions() {
+	var revisions []*OptionRevision
+	err := DB.Where("status = ? AND activate_at <= ?", OptionRevisionStatusPending, common.GetTimestamp()).
+		Order("activate_at asc, id asc").Find(&revisions).Error
+	if err != nil {
+		common.SysLog("failed to load scheduled options: " + err.Error())
+		return
+	}
+	for _, revision := range revisions {
+		revision.decryptValues()
+		err := applyOptionRevision(revision)
+		if errors.Is(err, errOptionRevisionNotPending) {
+			continue
+		}
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to activate scheduled option %s (revision %d): %s", revision.OptionKey, revision.Id, err.Error()))
+			continue
+		}
+		common.SysLog(fmt.Sprintf("scheduled option %s activated (revision %d)", revision.OptionKey, revision.Id))
+	}
+}
@@ -0,0 +1,343 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationRoleOwner   = "owner"   // 拥有者，可管理一切，包括删除组织
+	OrganizationRoleAdmin   = "admin"   // 管理员，可管理成员与组织令牌
+	OrganizationRoleMember  = "member"  // 成员，可查看组织令牌并使用
+	OrganizationRoleBilling = "billing" // 财务，可查看用量并为组织充值
+)
+
+var ErrOrganizationQuotaNotEnough = errors.New("组织额度不足")
+var ErrOrganizationMemberQuotaNotEnough = errors.New("成员在组织内的额度已达上限")
+
+// Organization 组织拥有共享额度池，组织令牌的消费从这里扣除
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(64);index"`
+	Description string         `json:"description" gorm:"type:varchar(255)"`
+	Status      int            `json:"status" gorm:"type:int;default:1"`
+	Quota       int            `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int            `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member_user;not null"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user;index;not null"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"type:int;default:0"` // 成员在组织内的消费上限，0 表示不限制
+	UsedQuota      int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	Username       string `json:"username" gorm:"-:all"`
+	DisplayName    string `json:"display_name" gorm:"-:all"`
+}
+
+// UserOrganization 是用户视角的组织信息，附带自己的角色与限额
+type UserOrganization struct {
+	Organization
+	Role            string `json:"role"`
+	QuotaLimit      int    `json:"quota_limit"`
+	MemberUsedQuota int    `json:"member_used_quota"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember, OrganizationRoleBilling:
+		return true
+	}
+	return false
+}
+
+// CreateOrganization 创建组织并将创建者设为拥有者
+func CreateOrganization(org *Organization, ownerId int) error {
+	org.CreatedTime = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    org.CreatedTime,
+		}).Error
+	})
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	err = DB.Model(&Organization{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func (org *Organization) Update() error {
+	if err := DB.Model(org).Select("name", "description", "status").Updates(org).Error; err != nil {
+		return err
+	}
+	return invalidateOrganizationCache(org.Id)
+}
+
+// DeleteOrganization 删除组织与成员关系，并禁用组织令牌
+func DeleteOrganization(id int) error {
+	var tokens []Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Find(&tokens).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+	if err == nil && common.RedisEnabled {
+		for _, t := range tokens {
+			_ = cacheDeleteToken(t.Key)
+		}
+		_ = invalidateOrganizationCache(id)
+	}
+	return err
+}
+
+func GetUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var members []OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*UserOrganization, 0, len(members))
+	for _, m := range members {
+		org, err := GetOrganizationById(m.OrganizationId)
+		if err != nil {
+			continue
+		}
+		result = append(result, &UserOrganization{
+			Organization:    *org,
+			Role:            m.Role,
+			QuotaLimit:      m.QuotaLimit,
+			MemberUsedQuota: m.UsedQuota,
+		})
+	}
+	return result, nil
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.First(&member, "organization_id = ? AND user_id = ?", orgId, userId).Error
+	return &member, err
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", orgId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		var user User
+		if err := DB.Select("username", "display_name").First(&user, "id = ?", m.UserId).Error; err == nil {
+			m.Username = user.Username
+			m.DisplayName = user.DisplayName
+		}
+	}
+	return members, nil
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	member.CreatedTime = common.GetTimestamp()
+	return DB.Create(member).Error
+}
+
+func (member *OrganizationMember) Update() error {
+	if err := DB.Model(member).Select("role", "quota_limit").Updates(member).Error; err != nil {
+		return err
+	}
+	return invalidateOrganizationMemberCache(member.OrganizationId, member.UserId)
+}
+
+// RemoveOrganizationMember 移除成员，其创建的组织令牌转交给组织拥有者，避免员工离职导致线上令牌失效
+func RemoveOrganizationMember(orgId int, userId int) error {
+	var owner OrganizationMember
+	err := DB.Where("organization_id = ? AND role = ? AND user_id <> ?", orgId, OrganizationRoleOwner, userId).
+		Order("id asc").First(&owner).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("组织至少需要保留一名其他拥有者")
+		}
+		return err
+	}
+	var tokens []Token
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgId, userId).Find(&tokens).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Token{}).Where("organization_id = ? AND user_id = ?", orgId, userId).
+			Update("user_id", owner.UserId).Error; err != nil {
+			return err
+		}
+		return tx.Where("organization_id = ? AND user_id = ?", orgId, userId).Delete(&OrganizationMember{}).Error
+	})
+	if err == nil && common.RedisEnabled {
+		for _, t := range tokens {
+			_ = cacheDeleteToken(t.Key)
+		}
+		_ = invalidateOrganizationMemberCache(orgId, userId)
+	}
+	return err
+}
+
+// GetOrganizationBillingQuota 返回成员通过组织可用的额度，即组织剩余额度与成员剩余限额中的较小值
+// 组织与成员信息优先读取缓存，与用户额度一样由扣费时同步更新
+func GetOrganizationBillingQuota(orgId int, userId int) (int, error) {
+	org, err := GetOrganizationCache(orgId)
+	if err != nil {
+		return 0, err
+	}
+	if org.Status != common.UserStatusEnabled {
+		return 0, errors.New("组织已被禁用")
+	}
+	member, err := GetOrganizationMemberCache(orgId, userId)
+	if err != nil {
+		return 0, errors.New("令牌所属用户已不是组织成员")
+	}
+	quota := org.Quota
+	if member.QuotaLimit > 0 && member.QuotaLimit-member.UsedQuota < quota {
+		quota = member.QuotaLimit - member.UsedQuota
+	}
+	return quota, nil
+}
+
+// ConsumeOrganizationQuota 从组织额度池扣除消费并累计成员用量，quota 为负数表示退还
+// 用于请求完成后的结算，与 DecreaseUserQuota 一样不做余额校验，额度不足时允许扣成负数
+func ConsumeOrganizationQuota(orgId int, userId int, quota int) error {
+	return consumeOrganizationQuota(orgId, userId, quota, false)
+}
+
+// PreConsumeOrganizationQuota 预扣组织额度，组织额度池或成员限额不足时拒绝扣减
+func PreConsumeOrganizationQuota(orgId int, userId int, quota int) error {
+	return consumeOrganizationQuota(orgId, userId, quota, true)
+}
+
+func consumeOrganizationQuota(orgId int, userId int, quota int, guarded bool) error {
+	if quota == 0 {
+		return nil
+	}
+	guarded = guarded && quota > 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		orgQuery := tx.Model(&Organization{}).Where("id = ?", orgId)
+		memberQuery := tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", orgId, userId)
+		// 预扣时以条件更新保证额度不被并发请求扣成负数
+		if guarded {
+			orgQuery = orgQuery.Where("quota >= ?", quota)
+			memberQuery = memberQuery.Where("quota_limit = 0 OR quota_limit - used_quota >= ?", quota)
+		}
+		result := orgQuery.Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if guarded && result.RowsAffected == 0 {
+			return ErrOrganizationQuotaNotEnough
+		}
+		result = memberQuery.Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if guarded && result.RowsAffected == 0 {
+			return ErrOrganizationMemberQuotaNotEnough
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := cacheConsumeOrganizationQuota(orgId, userId, quota); err != nil {
+		common.SysLog("failed to update organization quota cache: " + err.Error())
+	}
+	return nil
+}
+
+// TransferUserQuotaToOrganization 将个人额度转入组织额度池
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("个人额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		_ = cacheDecrUserQuota(userId, int64(quota))
+		_ = invalidateOrganizationCache(orgId)
+	}
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("向组织 %d 转入额度 %s", orgId, logger.LogQuota(quota)))
+	return nil
+}
+
+// AdjustOrganizationQuota 管理员直接调整组织额度，delta 可为负数
+func AdjustOrganizationQuota(orgId int, delta int) error {
+	if err := DB.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", delta)).Error; err != nil {
+		return err
+	}
+	return invalidateOrganizationCache(orgId)
+}
+
+// ConsumeBillingQuota 按计费主体扣减额度，organizationId 为 0 时扣减用户额度，quota 为负数表示退还
+func ConsumeBillingQuota(userId int, organizationId int, quota int) error {
+	if organizationId != 0 {
+		return ConsumeOrganizationQuota(organizationId, userId, quota)
+	}
+	if quota >= 0 {
+		return DecreaseUserQuota(userId, quota)
+	}
+	return IncreaseUserQuota(userId, -quota, false)
+}
+
+// PreConsumeBillingQuota 按计费主体预扣额度，组织额度不足时拒绝扣减
+func PreConsumeBillingQuota(userId int, organizationId int, quota int) error {
+	if organizationId != 0 {
+		return PreConsumeOrganizationQuota(organizationId, userId, quota)
+	}
+	return DecreaseUserQuota(userId, quota)
+}
+
+func GetOrganizationTokenIds(orgId int) ([]int, error) {
+	var ids []int
+	err := DB.Unscoped().Model(&Token{}).Where("organization_id = ?", orgId).Pluck("id", &ids).Error
+	return ids, err
+}
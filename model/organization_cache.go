@@ -0,0 +1,123 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// OrganizationCache 组织计费所需字段的缓存
+type OrganizationCache struct {
+	Status int `json:"status"`
+	Quota  int `json:"quota"`
+}
+
+// OrganizationMemberCache 成员限额与已用额度的缓存
+type OrganizationMemberCache struct {
+	QuotaLimit int `json:"quota_limit"`
+	UsedQuota  int `json:"used_quota"`
+}
+
+func getOrganizationCacheKey(orgId int) string {
+	return fmt.Sprintf("organization:%d", orgId)
+}
+
+func getOrganizationMemberCacheKey(orgId int, userId int) string {
+	return fmt.Sprintf("organization_member:%d:%d", orgId, userId)
+}
+
+// GetOrganizationCache 优先从 Redis 读取组织的状态与额度，未命中时读数据库并异步回填
+func GetOrganizationCache(orgId int) (orgCache *OrganizationCache, err error) {
+	var fromDB bool
+	defer func() {
+		if shouldUpdateRedis(fromDB, err) {
+			cache := *orgCache
+			gopool.Go(func() {
+				if err := updateOrganizationCache(orgId, cache); err != nil {
+					common.SysLog("failed to update organization cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	if common.RedisEnabled {
+		var cache OrganizationCache
+		if err := common.RedisHGetObj(getOrganizationCacheKey(orgId), &cache); err == nil {
+			return &cache, nil
+		}
+	}
+	fromDB = true
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationCache{Status: org.Status, Quota: org.Quota}, nil
+}
+
+// GetOrganizationMemberCache 优先从 Redis 读取成员的限额与已用额度，未命中时读数据库并异步回填
+func GetOrganizationMemberCache(orgId int, userId int) (memberCache *OrganizationMemberCache, err error) {
+	var fromDB bool
+	defer func() {
+		if shouldUpdateRedis(fromDB, err) {
+			cache := *memberCache
+			gopool.Go(func() {
+				if err := updateOrganizationMemberCache(orgId, userId, cache); err != nil {
+					common.SysLog("failed to update organization member cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	if common.RedisEnabled {
+		var cache OrganizationMemberCache
+		if err := common.RedisHGetObj(getOrganizationMemberCacheKey(orgId, userId), &cache); err == nil {
+			return &cache, nil
+		}
+	}
+	fromDB = true
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationMemberCache{QuotaLimit: member.QuotaLimit, UsedQuota: member.UsedQuota}, nil
+}
+
+func updateOrganizationCache(orgId int, cache OrganizationCache) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHSetObj(getOrganizationCacheKey(orgId), &cache, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+}
+
+func updateOrganizationMemberCache(orgId int, userId int, cache OrganizationMemberCache) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHSetObj(getOrganizationMemberCacheKey(orgId, userId), &cache, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+}
+
+// cacheConsumeOrganizationQuota 同步扣减缓存中的组织额度并累计成员用量，缓存不存在时不做处理
+func cacheConsumeOrganizationQuota(orgId int, userId int, quota int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	if err := common.RedisHIncrBy(getOrganizationCacheKey(orgId), "Quota", int64(-quota)); err != nil {
+		return err
+	}
+	return common.RedisHIncrBy(getOrganizationMemberCacheKey(orgId, userId), "UsedQuota", int64(quota))
+}
+
+func invalidateOrganizationCache(orgId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisDelKey(getOrganizationCacheKey(orgId))
+}
+
+func invalidateOrganizationMemberCache(orgId int, userId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisDelKey(getOrganizationMemberCacheKey(orgId, userId))
+}
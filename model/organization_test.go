@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func createTestOrganization(t *testing.T, quota int, memberLimit int) (*Organization, *OrganizationMember) {
+	t.Helper()
+	org := &Organization{Name: "test_org", Status: 1, Quota: quota}
+	if err := DB.Create(org).Error; err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	member := &OrganizationMember{OrganizationId: org.Id, UserId: 1, Role: OrganizationRoleMember, QuotaLimit: memberLimit}
+	if err := DB.Create(member).Error; err != nil {
+		t.Fatalf("create organization member: %v", err)
+	}
+	return org, member
+}
+
+func getTestOrganizationQuota(t *testing.T, orgId int, userId int) (quota int, memberUsed int) {
+	t.Helper()
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		t.Fatalf("get organization: %v", err)
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		t.Fatalf("get organization member: %v", err)
+	}
+	return org.Quota, member.UsedQuota
+}
+
+func TestPreConsumeOrganizationQuota(t *testing.T) {
+	tests := []struct {
+		name        string
+		orgQuota    int
+		memberLimit int
+		wantErr     error
+		wantQuota   int
+		wantUsed    int
+	}{
+		{name: "enough quota", orgQuota: 1000, wantQuota: 400, wantUsed: 600},
+		{name: "pool exhausted", orgQuota: 500, wantErr: ErrOrganizationQuotaNotEnough, wantQuota: 500},
+		{name: "member limit exhausted", orgQuota: 1000, memberLimit: 500, wantErr: ErrOrganizationMemberQuotaNotEnough, wantQuota: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupModelTestDB(t)
+			org, member := createTestOrganization(t, tt.orgQuota, tt.memberLimit)
+
+			err := PreConsumeOrganizationQuota(org.Id, member.UserId, 600)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			quota, used := getTestOrganizationQuota(t, org.Id, member.UserId)
+			if quota != tt.wantQuota || used != tt.wantUsed {
+				t.Fatalf("expected quota %d and member used %d, got %d and %d", tt.wantQuota, tt.wantUsed, quota, used)
+			}
+		})
+	}
+}
+
+func TestConsumeOrganizationQuotaSettlesWhenPoolIsShort(t *testing.T) {
+	setupModelTestDB(t)
+	org, member := createTestOrganization(t, 1000, 1200)
+
+	if err := PreConsumeOrganizationQuota(org.Id, member.UserId, 800); err != nil {
+		t.Fatalf("pre-consume: %v", err)
+	}
+	// 请求已完成，结算时即使组织额度池与成员限额不足也必须扣费
+	if err := ConsumeOrganizationQuota(org.Id, member.UserId, 500); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	quota, used := getTestOrganizationQuota(t, org.Id, member.UserId)
+	if quota != -300 || used != 1300 {
+		t.Fatalf("expected quota -300 and member used 1300, got %d and %d", quota, used)
+	}
+
+	if err := ConsumeBillingQuota(member.UserId, org.Id, -300); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	quota, used = getTestOrganizationQuota(t, org.Id, member.UserId)
+	if quota != 0 || used != 1000 {
+		t.Fatalf("expected quota 0 and member used 1000 after refund, got %d and %d", quota, used)
+	}
+}
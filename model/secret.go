@@ -0,0 +1,195 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// SecretSerializer 在写库时加密、读库时解密字符串字段，结构体中始终是明文，
+// 使用方式：`gorm:"serializer:secret"`。注意按该字段做等值查询将无法命中已加密的数据。
+type SecretSerializer struct{}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("failed to scan secret field %s: unsupported type %T", field.Name, dbValue)
+	}
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt secret field %s: %w", field.Name, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return common.EncryptSecret(value)
+}
+
+// isSecretOptionKey 判断配置项是否需要加密存储，如支付密钥、OAuth Client Secret、SMTP 令牌等
+func isSecretOptionKey(key string) bool {
+	if key == "oidc_providers.providers" {
+		// 提供方列表中包含 client_secret
+		return true
+	}
+	name := strings.ToLower(key)
+	for _, suffix := range []string{"secret", "key", "token", "password"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func encryptOptionValue(key string, value string) (string, error) {
+	if !isSecretOptionKey(key) {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
+}
+
+func encryptUserSettingSecret(secret string) string {
+	encrypted, err := common.EncryptSecret(secret)
+	if err != nil {
+		common.SysLog("failed to encrypt user setting secret: " + err.Error())
+		return ""
+	}
+	return encrypted
+}
+
+func decryptUserSettingSecret(secret string) string {
+	plaintext, err := common.DecryptSecret(secret)
+	if err != nil {
+		common.SysLog("failed to decrypt user setting secret: " + err.Error())
+		return ""
+	}
+	return plaintext
+}
+
+// SecretRotationResult 记录各类数据重新加密的条数
+type SecretRotationResult struct {
+	Channels int `json:"channels"`
+	Options  int `json:"options"`
+	Users    int `json:"users"`
+}
+
+// RotateSecrets 使用当前主密钥重新加密所有敏感字段，明文的历史数据也会被加密。
+// 可在服务运行时执行：旧主密钥通过 SECRET_ENCRYPTION_OLD_KEYS 保留解密能力，
+// 每条记录以原密文为条件更新，不会覆盖期间被修改过的数据。
+func RotateSecrets() (*SecretRotationResult, error) {
+	if !common.SecretEncryptionEnabled() {
+		return nil, fmt.Errorf("secret encryption is not enabled, set SECRET_ENCRYPTION_KEY first")
+	}
+	result := &SecretRotationResult{}
+
+	var channels []struct {
+		Id  int
+		Key string
+	}
+	if err := DB.Table("channels").Select("id", commonKeyCol).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, ch := range channels {
+		rotated, changed, err := rotateSecretValue(ch.Key)
+		if err != nil {
+			return result, fmt.Errorf("channel %d: %w", ch.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		tx := DB.Table("channels").Where("id = ? AND "+commonKeyCol+" = ?", ch.Id, ch.Key).Update("key", rotated)
+		if tx.Error != nil {
+			return result, tx.Error
+		}
+		result.Channels += int(tx.RowsAffected)
+	}
+
+	var options []Option
+	if err := DB.Table("options").Find(&options).Error; err != nil {
+		return result, err
+	}
+	for _, option := range options {
+		if !isSecretOptionKey(option.Key) {
+			continue
+		}
+		rotated, changed, err := rotateSecretValue(option.Value)
+		if err != nil {
+			return result, fmt.Errorf("option %s: %w", option.Key, err)
+		}
+		if !changed {
+			continue
+		}
+		tx := DB.Table("options").Where(commonKeyCol+" = ? AND value = ?", option.Key, option.Value).Update("value", rotated)
+		if tx.Error != nil {
+			return result, tx.Error
+		}
+		result.Options += int(tx.RowsAffected)
+	}
+
+	var users []struct {
+		Id      int
+		Setting string
+	}
+	if err := DB.Table("users").Select("id", "setting").Where("setting LIKE ?", "%webhook_secret%").Find(&users).Error; err != nil {
+		return result, err
+	}
+	for _, user := range users {
+		var setting map[string]any
+		if err := common.UnmarshalJsonStr(user.Setting, &setting); err != nil {
+			continue
+		}
+		secret, _ := setting["webhook_secret"].(string)
+		rotated, changed, err := rotateSecretValue(secret)
+		if err != nil {
+			return result, fmt.Errorf("user %d: %w", user.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		setting["webhook_secret"] = rotated
+		data, err := common.Marshal(setting)
+		if err != nil {
+			return result, err
+		}
+		tx := DB.Table("users").Where("id = ? AND setting = ?", user.Id, user.Setting).Update("setting", string(data))
+		if tx.Error != nil {
+			return result, tx.Error
+		}
+		if tx.RowsAffected > 0 {
+			result.Users++
+			_ = invalidateUserCache(user.Id)
+		}
+	}
+	return result, nil
+}
+
+func rotateSecretValue(value string) (string, bool, error) {
+	if !common.SecretNeedsRotation(value) {
+		return value, false, nil
+	}
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		return "", false, err
+	}
+	rotated, err := common.EncryptSecret(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return rotated, true, nil
+}
@@ -0,0 +1,243 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusIncidentTypeIncident     = "incident"
+	StatusIncidentTypeMaintenance  = "maintenance"
+	StatusIncidentTypeAnnouncement = "announcement"
+)
+
+const (
+	StatusIncidentInvestigating = "investigating"
+	StatusIncidentIdentified    = "identified"
+	StatusIncidentMonitoring    = "monitoring"
+	StatusIncidentScheduled     = "scheduled"
+	StatusIncidentResolved      = "resolved"
+)
+
+const (
+	StatusImpactNone     = "none"
+	StatusImpactMinor    = "minor"
+	StatusImpactMajor    = "major"
+	StatusImpactCritical = "critical"
+)
+
+// StatusIncident 状态页展示的故障、维护与公告
+type StatusIncident struct {
+	Id         int    `json:"id"`
+	Type       string `json:"type" gorm:"type:varchar(16);index"`
+	Title      string `json:"title" gorm:"type:varchar(255)"`
+	Status     string `json:"status" gorm:"type:varchar(16);index"`
+	Impact     string `json:"impact" gorm:"type:varchar(16)"`
+	Models     string `json:"models" gorm:"type:text"` // 受影响的模型，逗号分隔，为空表示影响全部模型
+	StartsAt   int64  `json:"starts_at" gorm:"bigint"` // 计划维护或公告的开始时间，0 表示立即生效
+	EndsAt     int64  `json:"ends_at" gorm:"bigint"`   // 计划结束时间，0 表示直到标记为已解决
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+	ResolvedAt int64  `json:"resolved_at" gorm:"bigint"`
+
+	Updates []*StatusIncidentUpdate `json:"updates,omitempty" gorm:"-"`
+}
+
+// StatusIncidentUpdate 故障处理进展
+type StatusIncidentUpdate struct {
+	Id         int    `json:"id"`
+	IncidentId int    `json:"incident_id" gorm:"index"`
+	Status     string `json:"status" gorm:"type:varchar(16)"`
+	Content    string `json:"content" gorm:"type:text"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+}
+
+func IsValidStatusIncidentType(t string) bool {
+	switch t {
+	case StatusIncidentTypeIncident, StatusIncidentTypeMaintenance, StatusIncidentTypeAnnouncement:
+		return true
+	}
+	return false
+}
+
+func IsValidStatusIncidentStatus(status string) bool {
+	switch status {
+	case StatusIncidentInvestigating, StatusIncidentIdentified, StatusIncidentMonitoring, StatusIncidentScheduled, StatusIncidentResolved:
+		return true
+	}
+	return false
+}
+
+func IsValidStatusImpact(impact string) bool {
+	switch impact {
+	case StatusImpactNone, StatusImpactMinor, StatusImpactMajor, StatusImpactCritical:
+		return true
+	}
+	return false
+}
+
+// GetModelList 返回受影响的模型列表
+func (i *StatusIncident) GetModelList() []string {
+	var models []string
+	for _, name := range strings.Split(i.Models, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			models = append(models, name)
+		}
+	}
+	return models
+}
+
+// AffectsModel 判断故障是否影响指定模型
+func (i *StatusIncident) AffectsModel(modelName string) bool {
+	models := i.GetModelList()
+	if len(models) == 0 {
+		return true
+	}
+	for _, name := range models {
+		if name == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive 判断故障当前是否生效：未解决且处于计划时间范围内
+func (i *StatusIncident) IsActive(now int64) bool {
+	if i.Status == StatusIncidentResolved {
+		return false
+	}
+	if i.StartsAt > 0 && now < i.StartsAt {
+		return false
+	}
+	return i.EndsAt == 0 || now < i.EndsAt
+}
+
+// setResolvedAt 状态变为已解决时记录解决时间，重新打开时清空
+func (i *StatusIncident) setResolvedAt(now int64) {
+	if i.Status == StatusIncidentResolved {
+		if i.ResolvedAt == 0 {
+			i.ResolvedAt = now
+		}
+	} else {
+		i.ResolvedAt = 0
+	}
+}
+
+// InsertStatusIncident 创建故障，content 不为空时作为第一条进展
+func InsertStatusIncident(incident *StatusIncident, content string) error {
+	now := common.GetTimestamp()
+	incident.CreatedAt = now
+	incident.UpdatedAt = now
+	incident.setResolvedAt(now)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(incident).Error; err != nil {
+			return err
+		}
+		return addStatusIncidentUpdate(tx, incident, content, now)
+	})
+}
+
+// UpdateStatusIncident 更新故障信息，content 不为空时追加一条进展
+func UpdateStatusIncident(incident *StatusIncident, content string) error {
+	now := common.GetTimestamp()
+	incident.UpdatedAt = now
+	incident.setResolvedAt(now)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(incident).Select("type", "title", "status", "impact", "models", "starts_at", "ends_at", "updated_at", "resolved_at").
+			Updates(incident).Error
+		if err != nil {
+			return err
+		}
+		return addStatusIncidentUpdate(tx, incident, content, now)
+	})
+}
+
+func addStatusIncidentUpdate(tx *gorm.DB, incident *StatusIncident, content string, now int64) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	return tx.Create(&StatusIncidentUpdate{
+		IncidentId: incident.Id,
+		Status:     incident.Status,
+		Content:    content,
+		CreatedAt:  now,
+	}).Error
+}
+
+func DeleteStatusIncidentById(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("incident_id = ?", id).Delete(&StatusIncidentUpdate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&StatusIncident{}, id).Error
+	})
+}
+
+// fillStatusIncidentUpdates 按时间倒序加载故障的处理进展
+func fillStatusIncidentUpdates(incidents []*StatusIncident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(incidents))
+	incidentMap := make(map[int]*StatusIncident, len(incidents))
+	for _, incident := range incidents {
+		ids = append(ids, incident.Id)
+		incidentMap[incident.Id] = incident
+		incident.Updates = make([]*StatusIncidentUpdate, 0)
+	}
+	var updates []*StatusIncidentUpdate
+	if err := DB.Where("incident_id IN ?", ids).Order("created_at desc, id desc").Find(&updates).Error; err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if incident, ok := incidentMap[update.IncidentId]; ok {
+			incident.Updates = append(incident.Updates, update)
+		}
+	}
+	return nil
+}
+
+func GetStatusIncidentById(id int) (*StatusIncident, error) {
+	var incident StatusIncident
+	if err := DB.First(&incident, id).Error; err != nil {
+		return nil, err
+	}
+	if err := fillStatusIncidentUpdates([]*StatusIncident{&incident}); err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// GetStatusIncidents 分页查询故障，可按类型与状态筛选
+func GetStatusIncidents(incidentType string, status string, startIdx int, num int) (incidents []*StatusIncident, total int64, err error) {
+	query := func() *gorm.DB {
+		tx := DB.Model(&StatusIncident{})
+		if incidentType != "" {
+			tx = tx.Where("type = ?", incidentType)
+		}
+		if status != "" {
+			tx = tx.Where("status = ?", status)
+		}
+		return tx
+	}
+	if err = query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = query().Order("id desc").Limit(num).Offset(startIdx).Find(&incidents).Error; err != nil {
+		return nil, 0, err
+	}
+	return incidents, total, fillStatusIncidentUpdates(incidents)
+}
+
+// GetPublicStatusIncidents 返回未解决的以及指定时间之后解决的故障，用于状态页
+func GetPublicStatusIncidents(since int64) ([]*StatusIncident, error) {
+	var incidents []*StatusIncident
+	err := DB.Where("status <> ? OR resolved_at >= ?", StatusIncidentResolved, since).
+		Order("created_at desc, id desc").Find(&incidents).Error
+	if err != nil {
+		return nil, err
+	}
+	return incidents, fillStatusIncidentUpdates(incidents)
+}
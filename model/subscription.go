@@ -0,0 +1,621 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionIntervalMonth = "month"
+	SubscriptionIntervalYear  = "year"
+)
+
+const (
+	SubscriptionStatusPending  = "pending"  // 已创建订单，等待首次支付
+	SubscriptionStatusActive   = "active"   // 生效中
+	SubscriptionStatusPastDue  = "past_due" // 续费失败，处于宽限期
+	SubscriptionStatusCanceled = "canceled" // 用户取消，周期结束后失效
+	SubscriptionStatusExpired  = "expired"  // 未续费或宽限期结束后失效
+)
+
+// SubscriptionPlan 订阅套餐：每个计费周期发放固定额度，订阅期间用户使用套餐分组与限流配置
+type SubscriptionPlan struct {
+	Id                    int     `json:"id"`
+	Name                  string  `json:"name" gorm:"type:varchar(64);index"`
+	Description           string  `json:"description" gorm:"type:text"`
+	Interval              string  `json:"interval" gorm:"type:varchar(16)"`
+	Price                 float64 `json:"price"`
+	Currency              string  `json:"currency" gorm:"type:varchar(16)"`
+	Quota                 int     `json:"quota"`          // 每个周期包含的额度
+	QuotaRollover         bool    `json:"quota_rollover"` // 未用完的周期额度是否结转到下个周期
+	Group                 string  `json:"group" gorm:"type:varchar(64)"`
+	RateLimitCount        int     `json:"rate_limit_count"`         // 限流时间窗口内的最大请求数，0 表示不限
+	RateLimitSuccessCount int     `json:"rate_limit_success_count"` // 限流时间窗口内的最大成功请求数，0 表示不限
+	StripePriceId         string  `json:"stripe_price_id" gorm:"type:varchar(255)"`
+	CreemProductId        string  `json:"creem_product_id" gorm:"type:varchar(255)"`
+	Enabled               bool    `json:"enabled"`
+	CreatedTime           int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime           int64   `json:"updated_time" gorm:"bigint"`
+}
+
+// Subscription 用户订阅。PeriodQuota 为本周期发放的额度，UsedQuotaAtPeriodStart 为周期开始时用户的已用额度，
+// 两者用于在周期结束时计算未用完的套餐额度（套餐额度视为优先消耗）。
+type Subscription struct {
+	Id                     int    `json:"id"`
+	UserId                 int    `json:"user_id" gorm:"index"`
+	PlanId                 int    `json:"plan_id" gorm:"index"`
+	Status                 string `json:"status" gorm:"type:varchar(16);index"`
+	PaymentMethod          string `json:"payment_method" gorm:"type:varchar(50)"`
+	TradeNo                string `json:"trade_no" gorm:"unique;type:varchar(255)"`
+	ExternalId             string `json:"external_id" gorm:"type:varchar(255);index"` // Stripe / Creem 订阅 ID
+	CurrentPeriodStart     int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd       int64  `json:"current_period_end" gorm:"bigint;index"`
+	CancelAtPeriodEnd      bool   `json:"cancel_at_period_end"`
+	GraceUntil             int64  `json:"grace_until" gorm:"bigint"`
+	PeriodQuota            int    `json:"period_quota"`
+	UsedQuotaAtPeriodStart int    `json:"-"`
+	PreviousGroup          string `json:"previous_group" gorm:"type:varchar(64)"`
+	PendingPlanId          int    `json:"pending_plan_id"` // 已发起、等待差价支付成功的升级套餐
+	CreatedTime            int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime            int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (plan *SubscriptionPlan) Validate() error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.Interval != SubscriptionIntervalMonth && plan.Interval != SubscriptionIntervalYear {
+		return errors.New("无效的计费周期")
+	}
+	if plan.Price < 0 || plan.Quota < 0 || plan.RateLimitCount < 0 || plan.RateLimitSuccessCount < 0 {
+		return errors.New("价格、额度与限流配置不能为负数")
+	}
+	return nil
+}
+
+// PeriodEnd 返回从 start 开始的一个计费周期的结束时间
+func (plan *SubscriptionPlan) PeriodEnd(start int64) int64 {
+	t := time.Unix(start, 0)
+	if plan.Interval == SubscriptionIntervalYear {
+		return t.AddDate(1, 0, 0).Unix()
+	}
+	return t.AddDate(0, 1, 0).Unix()
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	plan.UpdatedTime = plan.CreatedTime
+	if err := DB.Create(plan).Error; err != nil {
+		return err
+	}
+	RefreshSubscriptionPlanCache()
+	return nil
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	plan.UpdatedTime = common.GetTimestamp()
+	if err := DB.Model(plan).Select("*").Omit("id", "created_time").Updates(plan).Error; err != nil {
+		return err
+	}
+	RefreshSubscriptionPlanCache()
+	return nil
+}
+
+func DeleteSubscriptionPlanById(id int) error {
+	var count int64
+	DB.Model(&Subscription{}).Where("plan_id = ? AND status IN ?", id,
+		[]string{SubscriptionStatusActive, SubscriptionStatusPastDue, SubscriptionStatusCanceled}).Count(&count)
+	if count > 0 {
+		return errors.New("该套餐仍有生效中的订阅，请先停用套餐")
+	}
+	if err := DB.Delete(&SubscriptionPlan{}, id).Error; err != nil {
+		return err
+	}
+	RefreshSubscriptionPlanCache()
+	return nil
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	plan := &SubscriptionPlan{}
+	if err := DB.First(plan, id).Error; err != nil {
+		return nil, errors.New("套餐不存在")
+	}
+	return plan, nil
+}
+
+func GetSubscriptionPlans(enabledOnly bool) ([]*SubscriptionPlan, error) {
+	var plans []*SubscriptionPlan
+	tx := DB.Order("price asc, id asc")
+	if enabledOnly {
+		tx = tx.Where("enabled = ?", true)
+	}
+	err := tx.Find(&plans).Error
+	return plans, err
+}
+
+type subscriptionRateLimit struct {
+	total   int
+	success int
+}
+
+var (
+	subscriptionRateLimits     = make(map[string]subscriptionRateLimit)
+	subscriptionRateLimitsLock sync.RWMutex
+)
+
+// RefreshSubscriptionPlanCache 按套餐分组缓存限流配置，多个套餐使用同一分组时取较宽松的配置
+func RefreshSubscriptionPlanCache() {
+	plans, err := GetSubscriptionPlans(false)
+	if err != nil {
+		common.SysLog("failed to load subscription plans: " + err.Error())
+		return
+	}
+	limits := make(map[string]subscriptionRateLimit)
+	for _, plan := range plans {
+		if plan.Group == "" || (plan.RateLimitCount == 0 && plan.RateLimitSuccessCount == 0) {
+			continue
+		}
+		limit := limits[plan.Group]
+		limit.total = max(limit.total, plan.RateLimitCount)
+		limit.success = max(limit.success, plan.RateLimitSuccessCount)
+		limits[plan.Group] = limit
+	}
+	subscriptionRateLimitsLock.Lock()
+	subscriptionRateLimits = limits
+	subscriptionRateLimitsLock.Unlock()
+}
+
+// GetSubscriptionGroupRateLimit 返回套餐分组的限流配置
+func GetSubscriptionGroupRateLimit(group string) (totalCount, successCount int, found bool) {
+	subscriptionRateLimitsLock.RLock()
+	defer subscriptionRateLimitsLock.RUnlock()
+	limit, ok := subscriptionRateLimits[group]
+	if !ok {
+		return 0, 0, false
+	}
+	return limit.total, limit.success, true
+}
+
+func (subscription *Subscription) Insert() error {
+	subscription.CreatedTime = common.GetTimestamp()
+	subscription.UpdatedTime = subscription.CreatedTime
+	return DB.Create(subscription).Error
+}
+
+// GetUserActiveSubscription 返回用户当前仍享有权益的订阅（生效中、宽限期或已取消但未到期）
+func GetUserActiveSubscription(userId int) (*Subscription, error) {
+	subscription := &Subscription{}
+	err := DB.Where("user_id = ? AND status IN ?", userId,
+		[]string{SubscriptionStatusActive, SubscriptionStatusPastDue, SubscriptionStatusCanceled}).
+		Order("id desc").First(subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func GetSubscriptionByExternalId(externalId string) (*Subscription, error) {
+	if externalId == "" {
+		return nil, errors.New("未提供订阅 ID")
+	}
+	subscription := &Subscription{}
+	if err := DB.Where("external_id = ?", externalId).Order("id desc").First(subscription).Error; err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	return subscription, nil
+}
+
+func GetSubscriptions(userId int, status string, startIdx int, num int) (subscriptions []*Subscription, total int64, err error) {
+	tx := DB.Model(&Subscription{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
+// grantSubscriptionPeriod 开始新的计费周期：发放套餐额度并记录周期起点的已用额度
+func grantSubscriptionPeriod(tx *gorm.DB, subscription *Subscription, plan *SubscriptionPlan, user *User) error {
+	subscription.PeriodQuota = plan.Quota
+	subscription.UsedQuotaAtPeriodStart = user.UsedQuota
+	if plan.Quota == 0 {
+		return nil
+	}
+	user.Quota += plan.Quota
+	return tx.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota + ?", plan.Quota)).Error
+}
+
+// expireSubscriptionQuota 扣除本周期未用完的套餐额度，返回扣除的额度
+func expireSubscriptionQuota(tx *gorm.DB, subscription *Subscription, user *User) (int, error) {
+	used := user.UsedQuota - subscription.UsedQuotaAtPeriodStart
+	unused := subscription.PeriodQuota - used
+	if unused > user.Quota {
+		unused = user.Quota
+	}
+	if unused <= 0 {
+		return 0, nil
+	}
+	user.Quota -= unused
+	err := tx.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota - ?", unused)).Error
+	return unused, err
+}
+
+// ActivateSubscription 首次支付成功后开通订阅，重复通知时直接返回
+func ActivateSubscription(tradeNo string, externalId string, customerId string, periodStart int64, periodEnd int64) error {
+	if tradeNo == "" {
+		return errors.New("未提供订阅订单号")
+	}
+	var subscription Subscription
+	var plan *SubscriptionPlan
+	activated := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(&subscription).Error; err != nil {
+			return errors.New("订阅订单不存在")
+		}
+		if subscription.Status != SubscriptionStatusPending {
+			return nil
+		}
+		var err error
+		plan, err = GetSubscriptionPlanById(subscription.PlanId)
+		if err != nil {
+			return err
+		}
+		user := &User{}
+		if err := tx.Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+			return err
+		}
+		if periodStart == 0 {
+			periodStart = common.GetTimestamp()
+		}
+		if periodEnd <= periodStart {
+			periodEnd = plan.PeriodEnd(periodStart)
+		}
+		if err := grantSubscriptionPeriod(tx, &subscription, plan, user); err != nil {
+			return err
+		}
+		userUpdates := map[string]interface{}{}
+		if plan.Group != "" && user.Group != plan.Group {
+			subscription.PreviousGroup = user.Group
+			userUpdates["group"] = plan.Group
+		}
+		if customerId != "" && subscription.PaymentMethod == "stripe" && user.StripeCustomer == "" {
+			userUpdates["stripe_customer"] = customerId
+		}
+		if len(userUpdates) > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", user.Id).Updates(userUpdates).Error; err != nil {
+				return err
+			}
+		}
+		subscription.Status = SubscriptionStatusActive
+		subscription.ExternalId = externalId
+		subscription.CurrentPeriodStart = periodStart
+		subscription.CurrentPeriodEnd = periodEnd
+		subscription.UpdatedTime = common.GetTimestamp()
+		activated = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		return err
+	}
+	if activated {
+		_ = invalidateUserCache(subscription.UserId)
+		RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 开通成功，发放额度: %s", plan.Name, logger.FormatQuota(plan.Quota)))
+	}
+	return nil
+}
+
+// RenewSubscription 续费成功后进入新的计费周期。periodEnd 不晚于当前周期时视为重复通知。
+func RenewSubscription(externalId string, periodStart int64, periodEnd int64) error {
+	var subscription Subscription
+	var plan *SubscriptionPlan
+	var expired int
+	renewed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("external_id = ?", externalId).Order("id desc").First(&subscription).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if subscription.Status == SubscriptionStatusPending {
+			return errors.New("订阅尚未开通")
+		}
+		// 周期至少为一个月，一天的容差用于忽略首期账单及重复通知
+		if periodEnd <= subscription.CurrentPeriodEnd+86400 {
+			return nil
+		}
+		var err error
+		plan, err = GetSubscriptionPlanById(subscription.PlanId)
+		if err != nil {
+			return err
+		}
+		user := &User{}
+		if err := tx.Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+			return err
+		}
+		if !plan.QuotaRollover && subscription.Status != SubscriptionStatusExpired {
+			if expired, err = expireSubscriptionQuota(tx, &subscription, user); err != nil {
+				return err
+			}
+		}
+		if err := grantSubscriptionPeriod(tx, &subscription, plan, user); err != nil {
+			return err
+		}
+		if subscription.Status == SubscriptionStatusExpired && plan.Group != "" && user.Group != plan.Group {
+			// 宽限期结束后补缴成功，恢复套餐分组
+			subscription.PreviousGroup = user.Group
+			if err := tx.Model(&User{}).Where("id = ?", user.Id).Update("group", plan.Group).Error; err != nil {
+				return err
+			}
+		}
+		if periodStart == 0 || periodStart >= periodEnd {
+			periodStart = subscription.CurrentPeriodEnd
+		}
+		subscription.Status = SubscriptionStatusActive
+		subscription.CancelAtPeriodEnd = false
+		subscription.GraceUntil = 0
+		subscription.CurrentPeriodStart = periodStart
+		subscription.CurrentPeriodEnd = periodEnd
+		subscription.UpdatedTime = common.GetTimestamp()
+		renewed = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		return err
+	}
+	if renewed {
+		_ = invalidateUserCache(subscription.UserId)
+		content := fmt.Sprintf("订阅套餐 %s 续费成功，发放额度: %s", plan.Name, logger.FormatQuota(plan.Quota))
+		if expired > 0 {
+			content += fmt.Sprintf("，上周期未用完的套餐额度 %s 已过期", logger.FormatQuota(expired))
+		}
+		RecordLog(subscription.UserId, LogTypeTopup, content)
+	}
+	return nil
+}
+
+// MarkSubscriptionPastDue 续费失败时进入宽限期，宽限期从当前周期结束时开始计算
+func MarkSubscriptionPastDue(externalId string) error {
+	subscription, err := GetSubscriptionByExternalId(externalId)
+	if err != nil {
+		return err
+	}
+	if subscription.Status != SubscriptionStatusActive {
+		return nil
+	}
+	graceFrom := max(subscription.CurrentPeriodEnd, common.GetTimestamp())
+	graceUntil := graceFrom + int64(operation_setting.GetSubscriptionSetting().GracePeriodDays)*86400
+	err = DB.Model(&Subscription{}).Where("id = ? AND status = ?", subscription.Id, SubscriptionStatusActive).
+		Updates(map[string]interface{}{
+			"status":       SubscriptionStatusPastDue,
+			"grace_until":  graceUntil,
+			"updated_time": common.GetTimestamp(),
+		}).Error
+	if err != nil {
+		return err
+	}
+	RecordLog(subscription.UserId, LogTypeSystem, fmt.Sprintf("订阅续费失败，套餐权益将保留至 %s",
+		time.Unix(graceUntil, 0).Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// CancelSubscriptionAtPeriodEnd 取消订阅，当前周期结束后失效
+func CancelSubscriptionAtPeriodEnd(id int) error {
+	return DB.Model(&Subscription{}).Where("id = ? AND status IN ?", id,
+		[]string{SubscriptionStatusActive, SubscriptionStatusPastDue}).
+		Updates(map[string]interface{}{
+			"status":               SubscriptionStatusCanceled,
+			"cancel_at_period_end": true,
+			"updated_time":         common.GetTimestamp(),
+		}).Error
+}
+
+// ResumeSubscription 撤销取消，恢复自动续费
+func ResumeSubscription(id int) error {
+	return DB.Model(&Subscription{}).Where("id = ? AND status = ?", id, SubscriptionStatusCanceled).
+		Updates(map[string]interface{}{
+			"status":               SubscriptionStatusActive,
+			"cancel_at_period_end": false,
+			"updated_time":         common.GetTimestamp(),
+		}).Error
+}
+
+// LapseSubscription 订阅失效：扣除未用完的套餐额度，并将用户降级到免费分组
+func LapseSubscription(id int) error {
+	var subscription Subscription
+	var plan *SubscriptionPlan
+	var expired int
+	lapsed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&subscription, id).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if subscription.Status == SubscriptionStatusPending || subscription.Status == SubscriptionStatusExpired {
+			return nil
+		}
+		var err error
+		plan, err = GetSubscriptionPlanById(subscription.PlanId)
+		if err != nil {
+			return err
+		}
+		user := &User{}
+		if err := tx.Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+			return err
+		}
+		if !plan.QuotaRollover {
+			if expired, err = expireSubscriptionQuota(tx, &subscription, user); err != nil {
+				return err
+			}
+		}
+		// 管理员已手动调整分组时不再变更
+		if plan.Group != "" && user.Group == plan.Group {
+			freeGroup := operation_setting.GetSubscriptionSetting().FreeGroup
+			if freeGroup == "" {
+				freeGroup = subscription.PreviousGroup
+			}
+			if freeGroup != "" {
+				if err := tx.Model(&User{}).Where("id = ?", user.Id).Update("group", freeGroup).Error; err != nil {
+					return err
+				}
+			}
+		}
+		subscription.Status = SubscriptionStatusExpired
+		subscription.GraceUntil = 0
+		subscription.UpdatedTime = common.GetTimestamp()
+		lapsed = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		return err
+	}
+	if lapsed {
+		_ = invalidateUserCache(subscription.UserId)
+		content := fmt.Sprintf("订阅套餐 %s 已失效", plan.Name)
+		if expired > 0 {
+			content += fmt.Sprintf("，未用完的套餐额度 %s 已过期", logger.FormatQuota(expired))
+		}
+		RecordLog(subscription.UserId, LogTypeSystem, content)
+	}
+	return nil
+}
+
+// ProrateSubscriptionUpgrade 计算升级到新套餐时本周期剩余时间应补发的额度与应补缴的金额
+func ProrateSubscriptionUpgrade(subscription *Subscription, oldPlan *SubscriptionPlan, newPlan *SubscriptionPlan, now int64) (quota int, money float64) {
+	period := subscription.CurrentPeriodEnd - subscription.CurrentPeriodStart
+	remaining := subscription.CurrentPeriodEnd - now
+	if period <= 0 || remaining <= 0 {
+		return 0, 0
+	}
+	fraction := float64(remaining) / float64(period)
+	quota = int(float64(newPlan.Quota-oldPlan.Quota) * fraction)
+	money = (newPlan.Price - oldPlan.Price) * fraction
+	return max(quota, 0), max(money, 0)
+}
+
+// SetSubscriptionPendingUpgrade 记录已向支付平台发起的升级，差价支付成功后由回调完成升级
+func SetSubscriptionPendingUpgrade(id int, planId int) error {
+	return DB.Model(&Subscription{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"pending_plan_id": planId,
+			"updated_time":    common.GetTimestamp(),
+		}).Error
+}
+
+// UpgradeSubscription 差价支付成功后在当前周期内切换到新套餐，并补发按剩余时间折算的额度差
+// 仅处理与待升级套餐一致的请求，重复回调不会重复补发
+func UpgradeSubscription(id int, newPlan *SubscriptionPlan) (int, error) {
+	var subscription Subscription
+	var quota int
+	upgraded := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&subscription, id).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if subscription.PendingPlanId != newPlan.Id {
+			return nil
+		}
+		if subscription.Status != SubscriptionStatusActive {
+			return errors.New("只有生效中的订阅可以升级")
+		}
+		oldPlan, err := GetSubscriptionPlanById(subscription.PlanId)
+		if err != nil {
+			return err
+		}
+		quota, _ = ProrateSubscriptionUpgrade(&subscription, oldPlan, newPlan, common.GetTimestamp())
+		user := &User{}
+		if err := tx.Where("id = ?", subscription.UserId).First(user).Error; err != nil {
+			return err
+		}
+		userUpdates := map[string]interface{}{}
+		if quota > 0 {
+			userUpdates["quota"] = gorm.Expr("quota + ?", quota)
+		}
+		if newPlan.Group != "" && user.Group != newPlan.Group && (oldPlan.Group == "" || user.Group == oldPlan.Group) {
+			if oldPlan.Group == "" {
+				subscription.PreviousGroup = user.Group
+			}
+			userUpdates["group"] = newPlan.Group
+		}
+		if len(userUpdates) > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", user.Id).Updates(userUpdates).Error; err != nil {
+				return err
+			}
+		}
+		subscription.PlanId = newPlan.Id
+		subscription.PendingPlanId = 0
+		subscription.PeriodQuota += quota
+		subscription.UpdatedTime = common.GetTimestamp()
+		upgraded = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil || !upgraded {
+		return 0, err
+	}
+	_ = invalidateUserCache(subscription.UserId)
+	RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅升级为 %s，补发额度: %s", newPlan.Name, logger.FormatQuota(quota)))
+	return quota, nil
+}
+
+// UpgradeSubscriptionByExternalId 支付平台通知升级差价已支付后完成待升级的套餐切换
+func UpgradeSubscriptionByExternalId(externalId string) (int, error) {
+	subscription, err := GetSubscriptionByExternalId(externalId)
+	if err != nil {
+		return 0, err
+	}
+	if subscription.PendingPlanId == 0 {
+		return 0, nil
+	}
+	plan, err := GetSubscriptionPlanById(subscription.PendingPlanId)
+	if err != nil {
+		return 0, err
+	}
+	return UpgradeSubscription(subscription.Id, plan)
+}
+
+// SyncSubscriptions 定期刷新套餐缓存，主节点同时处理到期、宽限期结束与长时间未支付的订阅
+func SyncSubscriptions(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		RefreshSubscriptionPlanCache()
+		if common.IsMasterNode {
+			checkDueSubscriptions()
+		}
+	}
+}
+
+func checkDueSubscriptions() {
+	now := common.GetTimestamp()
+	grace := int64(operation_setting.GetSubscriptionSetting().GracePeriodDays) * 86400
+
+	var due []*Subscription
+	err := DB.Where("(status = ? AND current_period_end <= ?) OR (status = ? AND current_period_end <= ?) OR (status = ? AND grace_until <= ?)",
+		SubscriptionStatusCanceled, now,
+		SubscriptionStatusActive, now-grace,
+		SubscriptionStatusPastDue, now).Find(&due).Error
+	if err != nil {
+		common.SysLog("failed to load due subscriptions: " + err.Error())
+		return
+	}
+	for _, subscription := range due {
+		if err := LapseSubscription(subscription.Id); err != nil {
+			common.SysLog(fmt.Sprintf("failed to lapse subscription %d: %s", subscription.Id, err.Error()))
+		}
+	}
+
+	// 超过一天未完成支付的订单视为放弃
+	DB.Model(&Subscription{}).Where("status = ? AND created_time <= ?", SubscriptionStatusPending, now-86400).
+		Updates(map[string]interface{}{"status": SubscriptionStatusExpired, "updated_time": now})
+}
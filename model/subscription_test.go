@@ -0,0 +1,192 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+func createTestSubscription(t *testing.T, plan *SubscriptionPlan, quota int) (*Subscription, *User) {
+	t.Helper()
+	if err := plan.Insert(); err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	user := createTestUser(t, quota)
+	subscription := &Subscription{UserId: user.Id, PlanId: plan.Id, Status: SubscriptionStatusPending, PaymentMethod: "stripe", TradeNo: "sub_order"}
+	if err := subscription.Insert(); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return subscription, user
+}
+
+// consumeTestQuota 模拟请求消耗额度
+func consumeTestQuota(t *testing.T, userId int, quota int) {
+	t.Helper()
+	err := DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota - ?", quota),
+		"used_quota": gorm.Expr("used_quota + ?", quota),
+	}).Error
+	if err != nil {
+		t.Fatalf("consume quota: %v", err)
+	}
+}
+
+func TestSubscriptionPlanPeriodEnd(t *testing.T) {
+	start := time.Date(2026, 1, 15, 8, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Time
+	}{
+		{name: "month", interval: SubscriptionIntervalMonth, want: time.Date(2026, 2, 15, 8, 0, 0, 0, time.Local)},
+		{name: "year", interval: SubscriptionIntervalYear, want: time.Date(2027, 1, 15, 8, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &SubscriptionPlan{Interval: tt.interval}
+			if got := plan.PeriodEnd(start.Unix()); got != tt.want.Unix() {
+				t.Fatalf("expected period end %s, got %s", tt.want, time.Unix(got, 0))
+			}
+		})
+	}
+}
+
+func TestProrateSubscriptionUpgrade(t *testing.T) {
+	subscription := &Subscription{CurrentPeriodStart: 1000, CurrentPeriodEnd: 2000}
+	basic := &SubscriptionPlan{Quota: 1000, Price: 10}
+	pro := &SubscriptionPlan{Quota: 3000, Price: 30}
+
+	tests := []struct {
+		name      string
+		from      *SubscriptionPlan
+		to        *SubscriptionPlan
+		now       int64
+		wantQuota int
+		wantMoney float64
+	}{
+		{name: "half period left", from: basic, to: pro, now: 1500, wantQuota: 1000, wantMoney: 10},
+		{name: "whole period left", from: basic, to: pro, now: 1000, wantQuota: 2000, wantMoney: 20},
+		{name: "period ended", from: basic, to: pro, now: 2000},
+		{name: "downgrade is free", from: pro, to: basic, now: 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota, money := ProrateSubscriptionUpgrade(subscription, tt.from, tt.to, tt.now)
+			if quota != tt.wantQuota || money != tt.wantMoney {
+				t.Fatalf("expected %d quota and %v money, got %d and %v", tt.wantQuota, tt.wantMoney, quota, money)
+			}
+		})
+	}
+}
+
+func TestRenewSubscriptionRollover(t *testing.T) {
+	tests := []struct {
+		name      string
+		rollover  bool
+		wantQuota int
+	}{
+		// 初始 500 + 周期额度 1000，使用 300 后剩余 1200，未用完的 700 过期后再发放 1000
+		{name: "unused quota expires", wantQuota: 1500},
+		{name: "unused quota rolls over", rollover: true, wantQuota: 2200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupModelTestDB(t)
+			plan := &SubscriptionPlan{Name: "pro", Interval: SubscriptionIntervalMonth, Quota: 1000, QuotaRollover: tt.rollover, Group: "pro", Enabled: true}
+			subscription, user := createTestSubscription(t, plan, 500)
+
+			periodStart := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+			periodEnd := plan.PeriodEnd(periodStart)
+			if err := ActivateSubscription(subscription.TradeNo, "sub_ext", "", periodStart, periodEnd); err != nil {
+				t.Fatalf("activate subscription: %v", err)
+			}
+			if got := getTestUserQuota(t, user.Id); got != 1500 {
+				t.Fatalf("expected user quota 1500 after activation, got %d", got)
+			}
+			consumeTestQuota(t, user.Id, 300)
+
+			nextEnd := plan.PeriodEnd(periodEnd)
+			// 重复通知不会再次进入新周期
+			for i := 0; i < 2; i++ {
+				if err := RenewSubscription("sub_ext", periodEnd, nextEnd); err != nil {
+					t.Fatalf("renew subscription: %v", err)
+				}
+			}
+			if got := getTestUserQuota(t, user.Id); got != tt.wantQuota {
+				t.Fatalf("expected user quota %d after renewal, got %d", tt.wantQuota, got)
+			}
+			renewed, err := GetSubscriptionByExternalId("sub_ext")
+			if err != nil {
+				t.Fatalf("get subscription: %v", err)
+			}
+			if renewed.CurrentPeriodStart != periodEnd || renewed.CurrentPeriodEnd != nextEnd || renewed.PeriodQuota != 1000 {
+				t.Fatalf("expected period %d-%d with 1000 quota, got %d-%d with %d", periodEnd, nextEnd,
+					renewed.CurrentPeriodStart, renewed.CurrentPeriodEnd, renewed.PeriodQuota)
+			}
+			if renewed.UsedQuotaAtPeriodStart != 300 {
+				t.Fatalf("expected used quota at period start 300, got %d", renewed.UsedQuotaAtPeriodStart)
+			}
+		})
+	}
+}
+
+func TestRenewSubscriptionOverspentPeriod(t *testing.T) {
+	setupModelTestDB(t)
+	plan := &SubscriptionPlan{Name: "pro", Interval: SubscriptionIntervalMonth, Quota: 1000, Enabled: true}
+	subscription, user := createTestSubscription(t, plan, 500)
+
+	periodStart := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	periodEnd := plan.PeriodEnd(periodStart)
+	if err := ActivateSubscription(subscription.TradeNo, "sub_ext", "", periodStart, periodEnd); err != nil {
+		t.Fatalf("activate subscription: %v", err)
+	}
+	// 套餐额度视为优先消耗，用超后自行充值的额度不会被扣除
+	consumeTestQuota(t, user.Id, 1200)
+	if err := RenewSubscription("sub_ext", periodEnd, plan.PeriodEnd(periodEnd)); err != nil {
+		t.Fatalf("renew subscription: %v", err)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 1300 {
+		t.Fatalf("expected user quota 1300 after renewal, got %d", got)
+	}
+}
+
+func TestLapseSubscription(t *testing.T) {
+	setupModelTestDB(t)
+	setting := operation_setting.GetSubscriptionSetting()
+	previousFreeGroup := setting.FreeGroup
+	setting.FreeGroup = ""
+	t.Cleanup(func() {
+		setting.FreeGroup = previousFreeGroup
+	})
+
+	plan := &SubscriptionPlan{Name: "pro", Interval: SubscriptionIntervalMonth, Quota: 1000, Group: "pro", Enabled: true}
+	subscription, user := createTestSubscription(t, plan, 500)
+	periodStart := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	if err := ActivateSubscription(subscription.TradeNo, "sub_ext", "", periodStart, plan.PeriodEnd(periodStart)); err != nil {
+		t.Fatalf("activate subscription: %v", err)
+	}
+	consumeTestQuota(t, user.Id, 400)
+
+	for i := 0; i < 2; i++ {
+		if err := LapseSubscription(subscription.Id); err != nil {
+			t.Fatalf("lapse subscription: %v", err)
+		}
+	}
+	lapsed, err := GetUserById(user.Id, true)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if lapsed.Quota != 500 || lapsed.Group != "default" {
+		t.Fatalf("expected quota 500 in group default, got %d in %s", lapsed.Quota, lapsed.Group)
+	}
+	expired, err := GetSubscriptionByExternalId("sub_ext")
+	if err != nil {
+		t.Fatalf("get subscription: %v", err)
+	}
+	if expired.Status != SubscriptionStatusExpired {
+		t.Fatalf("expected expired subscription, got %s", expired.Status)
+	}
+}
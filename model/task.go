@@ -40,23 +40,24 @@ const (
 )
 
 type Task struct {
-	ID         int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
-	CreatedAt  int64                 `json:"created_at" gorm:"index"`
-	UpdatedAt  int64                 `json:"updated_at"`
-	TaskID     string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
-	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
-	UserId     int                   `json:"user_id" gorm:"index"`
-	Group      string                `json:"group" gorm:"type:varchar(50)"` // 修正计费用
-	ChannelId  int                   `json:"channel_id" gorm:"index"`
-	Quota      int                   `json:"quota"`
-	Action     string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
-	Status     TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
-	FailReason string                `json:"fail_reason"`
-	SubmitTime int64                 `json:"submit_time" gorm:"index"`
-	StartTime  int64                 `json:"start_time" gorm:"index"`
-	FinishTime int64                 `json:"finish_time" gorm:"index"`
-	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
-	Properties Properties            `json:"properties" gorm:"type:json"`
+	ID             int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	CreatedAt      int64                 `json:"created_at" gorm:"index"`
+	UpdatedAt      int64                 `json:"updated_at"`
+	TaskID         string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
+	Platform       constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
+	UserId         int                   `json:"user_id" gorm:"index"`
+	Group          string                `json:"group" gorm:"type:varchar(50)"` // 修正计费用
+	ChannelId      int                   `json:"channel_id" gorm:"index"`
+	Quota          int                   `json:"quota"`
+	OrganizationId int                   `json:"organization_id" gorm:"default:0"`     // 组织令牌提交的任务，退款时退回组织额度池
+	Action         string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
+	Status         TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
+	FailReason     string                `json:"fail_reason"`
+	SubmitTime     int64                 `json:"submit_time" gorm:"index"`
+	StartTime      int64                 `json:"start_time" gorm:"index"`
+	FinishTime     int64                 `json:"finish_time" gorm:"index"`
+	Progress       string                `json:"progress" gorm:"type:varchar(20);index"`
+	Properties     Properties            `json:"properties" gorm:"type:json"`
 	// 禁止返回给用户，内部可能包含key等隐私信息
 	PrivateData TaskPrivateData `json:"-" gorm:"column:private_data;type:json"`
 	Data        json.RawMessage `json:"data" gorm:"type:json"`
@@ -130,7 +131,8 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 	properties := Properties{}
 	privateData := TaskPrivateData{}
 	if relayInfo != nil && relayInfo.ChannelMeta != nil {
-		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini {
+		// 多 Key 渠道需要记录提交时使用的 Key，取消任务时使用同一个 Key
+		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini || relayInfo.ChannelMeta.ChannelIsMultiKey {
 			privateData.Key = relayInfo.ChannelMeta.ApiKey
 		}
 		if relayInfo.UpstreamModelName != "" {
@@ -142,15 +144,16 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 	}
 
 	t := &Task{
-		UserId:      relayInfo.UserId,
-		Group:       relayInfo.UsingGroup,
-		SubmitTime:  time.Now().Unix(),
-		Status:      TaskStatusNotStart,
-		Progress:    "0%",
-		ChannelId:   relayInfo.ChannelId,
-		Platform:    platform,
-		Properties:  properties,
-		PrivateData: privateData,
+		UserId:         relayInfo.UserId,
+		OrganizationId: relayInfo.OrganizationId,
+		Group:          relayInfo.UsingGroup,
+		SubmitTime:     time.Now().Unix(),
+		Status:         TaskStatusNotStart,
+		Progress:       "0%",
+		ChannelId:      relayInfo.ChannelId,
+		Platform:       platform,
+		Properties:     properties,
+		PrivateData:    privateData,
 	}
 	return t
 }
@@ -290,6 +293,25 @@ func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	return task, nil
 }
 
+// TaskMarkFailureIfUnfinished 将未结束的任务标记为失败，返回是否实际更新，用于防止重复退款
+func TaskMarkFailureIfUnfinished(id int64, reason string) (bool, error) {
+	now := time.Now().Unix()
+	result := DB.Model(&Task{}).
+		Where("id = ?", id).
+		Where("status != ? AND status != ?", TaskStatusFailure, TaskStatusSuccess).
+		Updates(map[string]any{
+			"status":      TaskStatusFailure,
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": now,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
 func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
@@ -306,6 +328,20 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateWithStatus 仅当数据库中的任务状态仍为 status 时保存，避免轮询结果覆盖已被取消或退款的任务
+func (task *Task) UpdateWithStatus(status TaskStatus) (bool, error) {
+	result := DB.Model(&Task{}).Where("id = ? AND status = ?", task.ID, status).
+		Select("*").Omit("id").Updates(task)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func TaskUpdateQuota(id int64, quota int) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Update("quota", quota).Error
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -27,6 +27,7 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	OrganizationId     int            `json:"organization_id" gorm:"index;default:0"` // 非 0 时为组织令牌，从组织额度池计费
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -59,7 +60,7 @@ func (token *Token) GetIpLimitsMap() map[string]any {
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	err = DB.Where("user_id = ? AND organization_id = 0", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
 	return tokens, err
 }
 
@@ -67,7 +68,7 @@ func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token
 	if token != "" {
 		token = strings.Trim(token, "sk-")
 	}
-	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where(commonKeyCol+" LIKE ?", "%"+token+"%").Find(&tokens).Error
+	err = DB.Where("user_id = ? AND organization_id = 0", userId).Where("name LIKE ?", "%"+keyword+"%").Where(commonKeyCol+" LIKE ?", "%"+token+"%").Find(&tokens).Error
 	return tokens, err
 }
 
@@ -121,7 +122,7 @@ func GetTokenByIds(id int, userId int) (*Token, error) {
 	}
 	token := Token{Id: id, UserId: userId}
 	var err error = nil
-	err = DB.First(&token, "id = ? and user_id = ?", id, userId).Error
+	err = DB.First(&token, "id = ? and user_id = ? and organization_id = 0", id, userId).Error
 	return &token, err
 }
 
@@ -255,7 +256,7 @@ func DeleteTokenById(id int, userId int) (err error) {
 		return errors.New("id 或 userId 为空！")
 	}
 	token := Token{Id: id, UserId: userId}
-	err = DB.Where(token).First(&token).Error
+	err = DB.Where(token).Where("organization_id = 0").First(&token).Error
 	if err != nil {
 		return err
 	}
@@ -325,7 +326,7 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 // CountUserTokens returns total number of tokens for the given user, used for pagination
 func CountUserTokens(userId int) (int64, error) {
 	var total int64
-	err := DB.Model(&Token{}).Where("user_id = ?", userId).Count(&total).Error
+	err := DB.Model(&Token{}).Where("user_id = ? AND organization_id = 0", userId).Count(&total).Error
 	return total, err
 }
 
@@ -338,12 +339,12 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 	tx := DB.Begin()
 
 	var tokens []Token
-	if err := tx.Where("user_id = ? AND id IN (?)", userId, ids).Find(&tokens).Error; err != nil {
+	if err := tx.Where("user_id = ? AND organization_id = 0 AND id IN (?)", userId, ids).Find(&tokens).Error; err != nil {
 		tx.Rollback()
 		return 0, err
 	}
 
-	if err := tx.Where("user_id = ? AND id IN (?)", userId, ids).Delete(&Token{}).Error; err != nil {
+	if err := tx.Where("user_id = ? AND organization_id = 0 AND id IN (?)", userId, ids).Delete(&Token{}).Error; err != nil {
 		tx.Rollback()
 		return 0, err
 	}
@@ -362,3 +363,24 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+func GetOrganizationTokens(orgId int, startIdx int, num int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("organization_id = ?", orgId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, err
+}
+
+func CountOrganizationTokens(orgId int) (int64, error) {
+	var total int64
+	err := DB.Model(&Token{}).Where("organization_id = ?", orgId).Count(&total).Error
+	return total, err
+}
+
+func GetOrganizationTokenById(id int, orgId int) (*Token, error) {
+	if id == 0 || orgId == 0 {
+		return nil, errors.New("id 或 organizationId 为空！")
+	}
+	var token Token
+	err := DB.First(&token, "id = ? and organization_id = ?", id, orgId).Error
+	return &token, err
+}
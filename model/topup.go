@@ -21,6 +21,13 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	// 支付平台侧的交易标识（Stripe PaymentIntent / Creem 订单 ID），用于匹配退款与拒付回调
+	ExternalId    string  `json:"external_id" gorm:"type:varchar(255);index"`
+	RefundedMoney float64 `json:"refunded_money"`
+	DisputedMoney float64 `json:"disputed_money"`
+	DisputedQuota int     `json:"disputed_quota"` // 拒付时实际扣回的额度，胜诉时按此返还
+	RefundTime    int64   `json:"refund_time"`
+	LastRefundId  string  `json:"last_refund_id" gorm:"type:varchar(255)"` // 最近处理的支付平台退款 ID，用于回调去重
 }
 
 func (topUp *TopUp) Insert() error {
@@ -99,6 +106,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	IssueTopUpInvoice(referenceId)
 
 	return nil
 }
@@ -303,6 +311,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	IssueTopUpInvoice(tradeNo)
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -371,6 +380,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	IssueTopUpInvoice(referenceId)
 
 	return nil
 }
@@ -0,0 +1,329 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func SetTopUpExternalId(tradeNo string, externalId string) error {
+	if tradeNo == "" || externalId == "" {
+		return nil
+	}
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("external_id", externalId).Error
+}
+
+func GetTopUpByExternalId(externalId string) *TopUp {
+	if externalId == "" {
+		return nil
+	}
+	topUp := &TopUp{}
+	if err := DB.Where("external_id = ?", externalId).First(topUp).Error; err != nil {
+		return nil
+	}
+	return topUp
+}
+
+// creditedQuota 返回订单充值时实际增加的额度，与 Recharge / RechargeCreem / 易支付回调保持一致
+func (topUp *TopUp) creditedQuota() decimal.Decimal {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit)
+	case "creem":
+		return decimal.NewFromInt(topUp.Amount)
+	default:
+		return decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit)
+	}
+}
+
+// RefundableMoney 返回订单剩余可退的支付金额
+func (topUp *TopUp) RefundableMoney() float64 {
+	remaining, _ := decimal.NewFromFloat(topUp.Money).
+		Sub(decimal.NewFromFloat(topUp.RefundedMoney)).
+		Sub(decimal.NewFromFloat(topUp.DisputedMoney)).Float64()
+	return remaining
+}
+
+func (topUp *TopUp) refreshRefundStatus() {
+	switch {
+	case topUp.DisputedMoney > 0:
+		topUp.Status = common.TopUpStatusDisputed
+	case topUp.RefundableMoney() <= 0:
+		topUp.Status = common.TopUpStatusRefunded
+	case topUp.RefundedMoney > 0:
+		topUp.Status = common.TopUpStatusPartiallyRefunded
+	default:
+		topUp.Status = common.TopUpStatusSuccess
+	}
+}
+
+func isRefundableTopUpStatus(status string) bool {
+	return status == common.TopUpStatusSuccess || status == common.TopUpStatusPartiallyRefunded || status == common.TopUpStatusDisputed
+}
+
+// quotaForMoney 按支付金额比例计算对应的额度
+func (topUp *TopUp) quotaForMoney(money float64) int {
+	if topUp.Money <= 0 {
+		return 0
+	}
+	return int(topUp.creditedQuota().Mul(decimal.NewFromFloat(money)).Div(decimal.NewFromFloat(topUp.Money)).IntPart())
+}
+
+// capDebitQuota 不允许负余额时最多扣到 0
+func capDebitQuota(quota int, userQuota int, allowNegative bool) int {
+	if quota <= 0 || allowNegative {
+		return quota
+	}
+	return min(quota, max(userQuota, 0))
+}
+
+// adjustTopUpQuota 按支付金额比例扣回用户额度，不允许负余额时最多扣到 0，返回实际扣回的额度
+func adjustTopUpQuota(tx *gorm.DB, topUp *TopUp, money float64) (int, error) {
+	quota := topUp.quotaForMoney(money)
+	if quota > 0 && !operation_setting.GetRefundSetting().AllowNegativeBalance {
+		user := &User{}
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id", "quota").Where("id = ?", topUp.UserId).First(user).Error; err != nil {
+			return 0, err
+		}
+		quota = capDebitQuota(quota, user.Quota, false)
+	}
+	if quota == 0 {
+		return 0, nil
+	}
+	err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", quota)).Error
+	return quota, err
+}
+
+// suspendUser 按退款策略禁用用户，已禁用的用户不做处理
+func suspendUser(userId int, reason string) {
+	result := DB.Model(&User{}).Where("id = ? AND status = ?", userId, common.UserStatusEnabled).Update("status", common.UserStatusDisabled)
+	if result.Error != nil {
+		common.SysLog(fmt.Sprintf("failed to suspend user %d: %s", userId, result.Error.Error()))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	_ = updateUserStatusCache(userId, false)
+	RecordLog(userId, LogTypeRefund, fmt.Sprintf("账户已被停用：%s", reason))
+}
+
+// afterTopUpDebit 处理扣回额度后的缓存、日志与停用策略
+func afterTopUpDebit(topUp *TopUp, quota int, content string, chargeback bool) {
+	_ = invalidateUserCache(topUp.UserId)
+	RecordLog(topUp.UserId, LogTypeRefund, content)
+
+	setting := operation_setting.GetRefundSetting()
+	if chargeback && setting.SuspendOnChargeback {
+		suspendUser(topUp.UserId, fmt.Sprintf("订单 %s 发生拒付", topUp.TradeNo))
+		return
+	}
+	if quota > 0 && setting.SuspendOnNegativeBalance {
+		if userQuota, err := GetUserQuota(topUp.UserId, true); err == nil && userQuota < 0 {
+			suspendUser(topUp.UserId, fmt.Sprintf("订单 %s 退款后余额为负", topUp.TradeNo))
+		}
+	}
+}
+
+// issueRefundCreditNote 为退款开具红字发票，未开具过发票的订单直接跳过
+func issueRefundCreditNote(topUp *TopUp, money float64, reason string) {
+	invoice, err := GetInvoiceByTopUpId(topUp.Id)
+	if err != nil || topUp.Money <= 0 {
+		return
+	}
+	amount, _ := decimal.NewFromFloat(invoice.Total).Mul(decimal.NewFromFloat(money)).
+		Div(decimal.NewFromFloat(topUp.Money)).Round(2).Float64()
+	if amount <= 0 {
+		return
+	}
+	if _, err := CreateCreditNote(invoice.Id, amount, reason); err != nil {
+		common.SysLog(fmt.Sprintf("failed to create credit note for %s: %s", topUp.TradeNo, err.Error()))
+	}
+}
+
+// RefundTopUp 退款并扣回对应额度，money 为本次退款的支付金额，<=0 表示退还剩余全部
+func RefundTopUp(tradeNo string, money float64, reason string) (*TopUp, int, error) {
+	return refundTopUp(tradeNo, "", money, reason)
+}
+
+// ApplyProviderRefund 处理支付平台逐笔通知的退款，同一退款 ID 重复回调时直接忽略
+func ApplyProviderRefund(tradeNo string, refundId string, money float64, reason string) error {
+	_, _, err := refundTopUp(tradeNo, refundId, money, reason)
+	if errors.Is(err, errDuplicateRefund) {
+		return nil
+	}
+	return err
+}
+
+var errDuplicateRefund = errors.New("duplicate refund")
+
+func refundTopUp(tradeNo string, refundId string, money float64, reason string) (*TopUp, int, error) {
+	if tradeNo == "" {
+		return nil, 0, errors.New("未提供订单号")
+	}
+	topUp := &TopUp{}
+	var quota int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if refundId != "" && topUp.LastRefundId == refundId {
+			return errDuplicateRefund
+		}
+		if !isRefundableTopUpStatus(topUp.Status) {
+			return fmt.Errorf("订单状态为 %s，无法退款", topUp.Status)
+		}
+		refundable := topUp.RefundableMoney()
+		if money <= 0 {
+			money = refundable
+		}
+		if money <= 0 {
+			return errors.New("订单已无可退金额")
+		}
+		if decimal.NewFromFloat(money).GreaterThan(decimal.NewFromFloat(refundable)) {
+			return fmt.Errorf("退款金额超过订单剩余可退金额 %.2f", refundable)
+		}
+		var err error
+		quota, err = adjustTopUpQuota(tx, topUp, money)
+		if err != nil {
+			return err
+		}
+		topUp.RefundedMoney, _ = decimal.NewFromFloat(topUp.RefundedMoney).Add(decimal.NewFromFloat(money)).Float64()
+		topUp.RefundTime = common.GetTimestamp()
+		if refundId != "" {
+			topUp.LastRefundId = refundId
+		}
+		topUp.refreshRefundStatus()
+		return tx.Save(topUp).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	content := fmt.Sprintf("订单 %s 退款，退款金额：%.2f，扣回额度：%s", tradeNo, money, logger.FormatQuota(quota))
+	if reason != "" {
+		content += "，原因：" + reason
+	}
+	afterTopUpDebit(topUp, quota, content, false)
+	issueRefundCreditNote(topUp, money, reason)
+	return topUp, quota, nil
+}
+
+// SyncTopUpRefund 按支付平台回调中的累计退款比例同步退款，重复回调不会重复扣减
+func SyncTopUpRefund(tradeNo string, refundedRatio float64, reason string) error {
+	topUp := GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return errors.New("充值订单不存在")
+	}
+	target := decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromFloat(min(refundedRatio, 1)))
+	delta, _ := target.Sub(decimal.NewFromFloat(topUp.RefundedMoney)).Round(2).Float64()
+	// 管理员已在本地发起同等金额的退款时，回调无需再次处理
+	if delta <= 0 {
+		return nil
+	}
+	delta = min(delta, topUp.RefundableMoney())
+	if delta <= 0 {
+		return nil
+	}
+	_, _, err := RefundTopUp(tradeNo, delta, reason)
+	return err
+}
+
+// DisputeTopUp 处理拒付：按争议比例扣回额度，订单标记为 disputed，并按策略停用用户
+func DisputeTopUp(tradeNo string, disputedRatio float64, reason string) error {
+	if tradeNo == "" {
+		return errors.New("未提供订单号")
+	}
+	topUp := &TopUp{}
+	var money float64
+	var quota int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		// 重复回调幂等处理
+		if topUp.DisputedMoney > 0 {
+			return nil
+		}
+		if !isRefundableTopUpStatus(topUp.Status) {
+			return fmt.Errorf("订单状态为 %s，无法处理拒付", topUp.Status)
+		}
+		refundable := topUp.RefundableMoney()
+		money, _ = decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromFloat(min(disputedRatio, 1))).Round(6).Float64()
+		money = min(money, refundable)
+		if money <= 0 {
+			return nil
+		}
+		var err error
+		quota, err = adjustTopUpQuota(tx, topUp, money)
+		if err != nil {
+			return err
+		}
+		topUp.DisputedMoney = money
+		topUp.DisputedQuota = quota
+		topUp.RefundTime = common.GetTimestamp()
+		topUp.refreshRefundStatus()
+		return tx.Save(topUp).Error
+	})
+	if err != nil || money <= 0 {
+		return err
+	}
+
+	content := fmt.Sprintf("订单 %s 发生拒付，争议金额：%.2f，扣回额度：%s", tradeNo, money, logger.FormatQuota(quota))
+	if reason != "" {
+		content += "，原因：" + reason
+	}
+	afterTopUpDebit(topUp, quota, content, true)
+	return nil
+}
+
+// ResolveTopUpDispute 处理拒付结果：胜诉时返还扣回的额度，败诉时争议金额计入已退款并开具红字发票
+// 用户停用状态不会自动恢复，需要管理员确认后手动启用
+func ResolveTopUpDispute(tradeNo string, won bool) error {
+	topUp := &TopUp{}
+	var money float64
+	var quota int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.DisputedMoney <= 0 {
+			return nil
+		}
+		money = topUp.DisputedMoney
+		quota = topUp.DisputedQuota
+		topUp.DisputedMoney = 0
+		topUp.DisputedQuota = 0
+		if won {
+			// 只返还拒付时实际扣回的额度
+			if quota > 0 {
+				if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			topUp.RefundedMoney, _ = decimal.NewFromFloat(topUp.RefundedMoney).Add(decimal.NewFromFloat(money)).Float64()
+		}
+		topUp.refreshRefundStatus()
+		return tx.Save(topUp).Error
+	})
+	if err != nil || money <= 0 {
+		return err
+	}
+
+	_ = invalidateUserCache(topUp.UserId)
+	if won {
+		RecordLog(topUp.UserId, LogTypeRefund, fmt.Sprintf("订单 %s 拒付争议胜诉，返还额度：%s", tradeNo, logger.FormatQuota(quota)))
+	} else {
+		RecordLog(topUp.UserId, LogTypeRefund, fmt.Sprintf("订单 %s 拒付争议败诉，争议金额：%.2f 计入退款", tradeNo, money))
+		issueRefundCreditNote(topUp, money, "chargeback")
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func setTestRefundSetting(t *testing.T, setting operation_setting.RefundSetting) {
+	t.Helper()
+	current := operation_setting.GetRefundSetting()
+	previous := *current
+	t.Cleanup(func() {
+		*current = previous
+	})
+	*current = setting
+}
+
+func createRefundTestTopUp(t *testing.T, quota int, topUp *TopUp) *User {
+	t.Helper()
+	user := createTestUser(t, quota)
+	topUp.UserId = user.Id
+	topUp.Status = common.TopUpStatusSuccess
+	if err := DB.Create(topUp).Error; err != nil {
+		t.Fatalf("create topup: %v", err)
+	}
+	return user
+}
+
+func TestTopUpQuotaForMoney(t *testing.T) {
+	previous := common.QuotaPerUnit
+	common.QuotaPerUnit = 500000
+	t.Cleanup(func() {
+		common.QuotaPerUnit = previous
+	})
+
+	tests := []struct {
+		name  string
+		topUp TopUp
+		money float64
+		want  int
+	}{
+		{name: "stripe uses paid money", topUp: TopUp{PaymentMethod: "stripe", Amount: 20, Money: 10}, money: 5, want: 2500000},
+		{name: "creem amount is quota", topUp: TopUp{PaymentMethod: "creem", Amount: 300000, Money: 3}, money: 1, want: 100000},
+		{name: "epay uses amount", topUp: TopUp{PaymentMethod: "alipay", Amount: 10, Money: 72}, money: 36, want: 2500000},
+		{name: "full refund", topUp: TopUp{PaymentMethod: "alipay", Amount: 10, Money: 72}, money: 72, want: 5000000},
+		{name: "rounds down", topUp: TopUp{PaymentMethod: "creem", Amount: 100, Money: 3}, money: 1, want: 33},
+		{name: "zero money order", topUp: TopUp{PaymentMethod: "stripe", Amount: 10}, money: 1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.topUp.quotaForMoney(tt.money); got != tt.want {
+				t.Fatalf("expected quota %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCapDebitQuota(t *testing.T) {
+	tests := []struct {
+		name          string
+		quota         int
+		userQuota     int
+		allowNegative bool
+		want          int
+	}{
+		{name: "enough balance", quota: 100, userQuota: 500, want: 100},
+		{name: "capped to balance", quota: 100, userQuota: 40, want: 40},
+		{name: "negative balance debits nothing", quota: 100, userQuota: -10, want: 0},
+		{name: "negative allowed", quota: 100, userQuota: 40, allowNegative: true, want: 100},
+		{name: "zero quota", quota: 0, userQuota: 40, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := capDebitQuota(tt.quota, tt.userQuota, tt.allowNegative); got != tt.want {
+				t.Fatalf("expected debit %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRefundTopUp(t *testing.T) {
+	setupModelTestDB(t)
+	setTestRefundSetting(t, operation_setting.RefundSetting{})
+
+	topUp := &TopUp{TradeNo: "refund_order", PaymentMethod: "creem", Amount: 1000, Money: 10}
+	user := createRefundTestTopUp(t, 1500, topUp)
+
+	refunded, quota, err := RefundTopUp(topUp.TradeNo, 4, "partial")
+	if err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	if quota != 400 || refunded.Status != common.TopUpStatusPartiallyRefunded {
+		t.Fatalf("expected 400 quota and partially refunded, got %d and %s", quota, refunded.Status)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 1100 {
+		t.Fatalf("expected user quota 1100, got %d", got)
+	}
+
+	if _, _, err := RefundTopUp(topUp.TradeNo, 7, "too much"); err == nil {
+		t.Fatal("expected refund above the refundable money to fail")
+	}
+
+	// 余额不足且不允许负余额时，只扣到 0
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", 100).Error; err != nil {
+		t.Fatalf("update user quota: %v", err)
+	}
+	refunded, quota, err = RefundTopUp(topUp.TradeNo, 0, "rest")
+	if err != nil {
+		t.Fatalf("refund rest: %v", err)
+	}
+	if quota != 100 || refunded.Status != common.TopUpStatusRefunded || refunded.RefundedMoney != 10 {
+		t.Fatalf("expected 100 quota, refunded status and 10 money, got %d, %s and %v", quota, refunded.Status, refunded.RefundedMoney)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 0 {
+		t.Fatalf("expected user quota 0, got %d", got)
+	}
+
+	if _, _, err := RefundTopUp(topUp.TradeNo, 0, "again"); err == nil {
+		t.Fatal("expected refund of a fully refunded order to fail")
+	}
+}
+
+func TestApplyProviderRefundIgnoresDuplicate(t *testing.T) {
+	setupModelTestDB(t)
+	setTestRefundSetting(t, operation_setting.RefundSetting{AllowNegativeBalance: true})
+
+	topUp := &TopUp{TradeNo: "provider_order", PaymentMethod: "creem", Amount: 1000, Money: 10}
+	user := createRefundTestTopUp(t, 1000, topUp)
+
+	for i := 0; i < 2; i++ {
+		if err := ApplyProviderRefund(topUp.TradeNo, "re_1", 2, ""); err != nil {
+			t.Fatalf("apply provider refund: %v", err)
+		}
+	}
+	if got := getTestUserQuota(t, user.Id); got != 800 {
+		t.Fatalf("expected user quota 800, got %d", got)
+	}
+}
+
+func TestDisputeTopUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		won        bool
+		wantQuota  int
+		wantStatus string
+		wantMoney  float64
+	}{
+		{name: "won restores debited quota", won: true, wantQuota: 300, wantStatus: common.TopUpStatusSuccess},
+		{name: "lost counts as refunded", won: false, wantQuota: 0, wantStatus: common.TopUpStatusRefunded, wantMoney: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupModelTestDB(t)
+			setTestRefundSetting(t, operation_setting.RefundSetting{})
+
+			topUp := &TopUp{TradeNo: "dispute_order", PaymentMethod: "creem", Amount: 1000, Money: 10}
+			// 余额不足以扣回全部额度，胜诉时只返还实际扣回的部分
+			user := createRefundTestTopUp(t, 300, topUp)
+
+			for i := 0; i < 2; i++ {
+				if err := DisputeTopUp(topUp.TradeNo, 1, "fraudulent"); err != nil {
+					t.Fatalf("dispute topup: %v", err)
+				}
+			}
+			disputed := GetTopUpByTradeNo(topUp.TradeNo)
+			if disputed.Status != common.TopUpStatusDisputed || disputed.DisputedMoney != 10 || disputed.DisputedQuota != 300 {
+				t.Fatalf("expected disputed 10 money and 300 quota, got %s, %v and %d", disputed.Status, disputed.DisputedMoney, disputed.DisputedQuota)
+			}
+			if got := getTestUserQuota(t, user.Id); got != 0 {
+				t.Fatalf("expected user quota 0 after dispute, got %d", got)
+			}
+
+			if err := ResolveTopUpDispute(topUp.TradeNo, tt.won); err != nil {
+				t.Fatalf("resolve dispute: %v", err)
+			}
+			resolved := GetTopUpByTradeNo(topUp.TradeNo)
+			if resolved.Status != tt.wantStatus || resolved.RefundedMoney != tt.wantMoney || resolved.DisputedQuota != 0 {
+				t.Fatalf("expected %s with %v refunded, got %s with %v refunded", tt.wantStatus, tt.wantMoney, resolved.Status, resolved.RefundedMoney)
+			}
+			if got := getTestUserQuota(t, user.Id); got != tt.wantQuota {
+				t.Fatalf("expected user quota %d, got %d", tt.wantQuota, got)
+			}
+		})
+	}
+}
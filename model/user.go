@@ -31,6 +31,8 @@ type User struct {
 	OidcId           string         `json:"oidc_id" gorm:"column:oidc_id;index"`
 	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
 	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
+	LdapId           string         `json:"ldap_id" gorm:"column:ldap_id;type:varchar(255);index"`
+	SamlId           string         `json:"saml_id" gorm:"column:saml_id;type:varchar(255);index"`
 	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
 	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
 	Quota            int            `json:"quota" gorm:"type:int;default:0"`
@@ -81,10 +83,12 @@ func (user *User) GetSetting() dto.UserSetting {
 			common.SysLog("failed to unmarshal setting: " + err.Error())
 		}
 	}
+	setting.WebhookSecret = decryptUserSettingSecret(setting.WebhookSecret)
 	return setting
 }
 
 func (user *User) SetSetting(setting dto.UserSetting) {
+	setting.WebhookSecret = encryptUserSettingSecret(setting.WebhookSecret)
 	settingBytes, err := json.Marshal(setting)
 	if err != nil {
 		common.SysLog("failed to marshal setting: " + err.Error())
@@ -477,6 +481,17 @@ func (user *User) Edit(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
+// UpdateUserColumns 只更新指定的列，避免整结构保存时写回过期的额度等字段
+func UpdateUserColumns(id int, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := DB.Model(&User{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(id)
+}
+
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
@@ -532,6 +547,14 @@ func (user *User) FillUserByEmail() error {
 	return nil
 }
 
+func (user *User) FillUserByUsername() error {
+	if user.Username == "" {
+		return errors.New("username 为空！")
+	}
+	DB.Where(User{Username: user.Username}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByGitHubId() error {
 	if user.GitHubId == "" {
 		return errors.New("GitHub id 为空！")
@@ -921,6 +944,28 @@ func (user *User) FillUserByLinuxDOId() error {
 	return err
 }
 
+func IsLdapIdAlreadyTaken(ldapId string) bool {
+	return DB.Unscoped().Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected == 1
+}
+
+func (user *User) FillUserByLdapId() error {
+	if user.LdapId == "" {
+		return errors.New("ldap id 为空！")
+	}
+	return DB.Where("ldap_id = ?", user.LdapId).First(user).Error
+}
+
+func IsSamlIdAlreadyTaken(samlId string) bool {
+	return DB.Unscoped().Where("saml_id = ?", samlId).Find(&User{}).RowsAffected == 1
+}
+
+func (user *User) FillUserBySamlId() error {
+	if user.SamlId == "" {
+		return errors.New("saml id 为空！")
+	}
+	return DB.Where("saml_id = ?", user.SamlId).First(user).Error
+}
+
 func RootUserExists() bool {
 	var user User
 	err := DB.Where("role = ?", common.RoleRootUser).First(&user).Error
@@ -41,6 +41,8 @@ func (user *UserBase) GetSetting() dto.UserSetting {
 			common.SysLog("failed to unmarshal setting: " + err.Error())
 		}
 	}
+	// 缓存中保存的是加密后的设置，使用时再解密
+	setting.WebhookSecret = decryptUserSettingSecret(setting.WebhookSecret)
 	return setting
 }
 
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// UserOAuthBinding 记录用户与具名 OIDC 提供方账户（provider + sub）的绑定关系
+type UserOAuthBinding struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index;not null"`
+	Provider  string `json:"provider" gorm:"type:varchar(64);uniqueIndex:idx_oauth_provider_subject;not null"`
+	Subject   string `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_oauth_provider_subject;not null"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+// GetUserIdByOAuthBinding 返回绑定的用户 id，未绑定时返回 0
+func GetUserIdByOAuthBinding(provider string, subject string) (int, error) {
+	var binding UserOAuthBinding
+	err := DB.Where("provider = ? AND subject = ?", provider, subject).First(&binding).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binding.UserId, nil
+}
+
+func CreateOAuthBinding(userId int, provider string, subject string) error {
+	return DB.Create(&UserOAuthBinding{
+		UserId:    userId,
+		Provider:  provider,
+		Subject:   subject,
+		CreatedAt: common.GetTimestamp(),
+	}).Error
+}
+
+func GetUserOAuthBindings(userId int) ([]*UserOAuthBinding, error) {
+	var bindings []*UserOAuthBinding
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&bindings).Error
+	return bindings, err
+}
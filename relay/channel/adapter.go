@@ -52,6 +52,11 @@ type TaskAdaptor interface {
 	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
 }
 
+// TaskCancelAdaptor 支持调用上游接口取消任务的适配器
+type TaskCancelAdaptor interface {
+	CancelTask(baseUrl, key string, body map[string]any, proxy string) (*http.Response, error)
+}
+
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
@@ -292,6 +292,7 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	reportUpstreamRateLimit(info, resp)
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
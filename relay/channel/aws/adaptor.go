@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
@@ -30,7 +31,7 @@ type Adaptor struct {
 	AwsClient  *bedrockruntime.Client
 	AwsModelId string
 	AwsReq     any
-	IsNova     bool
+	IsConverse bool
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -39,6 +40,9 @@ func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dt
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if awsModelId := resolveAwsModelId(info, ""); !isAwsClaudeModel(awsModelId) && !strings.HasPrefix(awsModelId, "arn:") {
+		return nil, fmt.Errorf("model %s does not support claude messages format on bedrock, use chat completions instead", info.UpstreamModelName)
+	}
 	for i, message := range request.Messages {
 		updated := false
 		if !message.IsStringContent() {
@@ -113,11 +117,11 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	// 非 Claude 模型（以及配置为 Converse 模式的渠道）统一使用 Converse API
+	awsModelId := resolveAwsModelId(info, "")
+	if info.ChannelOtherSettings.AwsApiMode == dto.AwsApiModeConverse || !isAwsClaudeModel(awsModelId) {
+		a.IsConverse = true
+		return requestOpenAI2Converse(c, awsModelId, request)
 	}
 
 	// 原有的Claude模型处理逻辑
@@ -130,12 +134,11 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return nil, nil
+	return convertAwsRerankRequest(request)
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	return convertAwsEmbeddingRequest(request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -144,7 +147,8 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
-	if a.ClientMode == ClientModeApiKey {
+	// Embedding 与 Rerank 需按模型分批调用 InvokeModel，API Key 模式同样通过 SDK 发起
+	if a.ClientMode == ClientModeApiKey && !isAwsEmbeddingRelayMode(info) {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
 		return doAwsClientRequest(c, info, a, requestBody)
@@ -152,12 +156,24 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if isAwsEmbeddingRelayMode(info) {
+		if info.RelayMode == relayconstant.RelayModeRerank {
+			err, usage = awsRerankHandler(c, info, a)
+		} else {
+			err, usage = awsEmbeddingHandler(c, info, a)
+		}
+		return
+	}
 	if a.ClientMode == ClientModeApiKey {
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
 	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+		if a.IsConverse {
+			if info.IsStream {
+				err, usage = converseStreamHandler(c, info, a)
+			} else {
+				err, usage = converseHandler(c, info, a)
+			}
 		} else {
 			if info.IsStream {
 				err, usage = awsStreamHandler(c, info, a)
@@ -0,0 +1,780 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/openrouter"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ConverseRequest Bedrock Converse API 的 JSON 请求格式，发送前转换为 SDK 类型
+type ConverseRequest struct {
+	Messages                     []ConverseMessage        `json:"messages"`
+	System                       []ConverseSystemBlock    `json:"system,omitempty"`
+	InferenceConfig              *ConverseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig                   *ConverseToolConfig      `json:"toolConfig,omitempty"`
+	AdditionalModelRequestFields map[string]any           `json:"additionalModelRequestFields,omitempty"`
+}
+
+type ConverseMessage struct {
+	Role    string                 `json:"role"`
+	Content []ConverseContentBlock `json:"content"`
+}
+
+type ConverseSystemBlock struct {
+	Text string `json:"text"`
+}
+
+type ConverseContentBlock struct {
+	Text             *string                  `json:"text,omitempty"`
+	Image            *ConverseImageBlock      `json:"image,omitempty"`
+	Document         *ConverseDocumentBlock   `json:"document,omitempty"`
+	ToolUse          *ConverseToolUseBlock    `json:"toolUse,omitempty"`
+	ToolResult       *ConverseToolResultBlock `json:"toolResult,omitempty"`
+	ReasoningContent *ConverseReasoningBlock  `json:"reasoningContent,omitempty"`
+}
+
+type ConverseBytesSource struct {
+	Bytes []byte `json:"bytes"`
+}
+
+type ConverseImageBlock struct {
+	Format string              `json:"format"`
+	Source ConverseBytesSource `json:"source"`
+}
+
+type ConverseDocumentBlock struct {
+	Format string              `json:"format"`
+	Name   string              `json:"name"`
+	Source ConverseBytesSource `json:"source"`
+}
+
+type ConverseToolUseBlock struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
+
+type ConverseToolResultBlock struct {
+	ToolUseId string                      `json:"toolUseId"`
+	Content   []ConverseToolResultContent `json:"content"`
+	Status    string                      `json:"status,omitempty"`
+}
+
+type ConverseToolResultContent struct {
+	Text  *string             `json:"text,omitempty"`
+	Image *ConverseImageBlock `json:"image,omitempty"`
+}
+
+type ConverseReasoningBlock struct {
+	ReasoningText   *ConverseReasoningText `json:"reasoningText,omitempty"`
+	RedactedContent []byte                 `json:"redactedContent,omitempty"`
+}
+
+type ConverseReasoningText struct {
+	Text      string `json:"text"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type ConverseInferenceConfig struct {
+	MaxTokens     *int32   `json:"maxTokens,omitempty"`
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ConverseToolConfig struct {
+	Tools      []ConverseTool      `json:"tools"`
+	ToolChoice *ConverseToolChoice `json:"toolChoice,omitempty"`
+}
+
+type ConverseTool struct {
+	ToolSpec ConverseToolSpec `json:"toolSpec"`
+}
+
+type ConverseToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema struct {
+		Json any `json:"json"`
+	} `json:"inputSchema"`
+}
+
+type ConverseToolChoice struct {
+	Auto *struct{} `json:"auto,omitempty"`
+	Any  *struct{} `json:"any,omitempty"`
+	Tool *struct {
+		Name string `json:"name"`
+	} `json:"tool,omitempty"`
+}
+
+// Bedrock 文档名只允许字母数字、空白、连字符、圆括号和方括号
+var converseDocumentNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9\s\-()\[\]]+|\s{2,}`)
+
+var converseDocumentFormats = map[string]string{
+	"application/pdf":    "pdf",
+	"text/csv":           "csv",
+	"application/msword": "doc",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+	"application/vnd.ms-excel": "xls",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+	"text/html":     "html",
+	"text/plain":    "txt",
+	"text/markdown": "md",
+}
+
+// requestOpenAI2Converse 将 OpenAI Chat Completions 请求转换为 Converse 请求
+func requestOpenAI2Converse(c *gin.Context, awsModelId string, request *dto.GeneralOpenAIRequest) (*ConverseRequest, error) {
+	converseReq := &ConverseRequest{}
+	isClaude := isAwsClaudeModel(awsModelId)
+
+	documentCount := 0
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				converseReq.System = append(converseReq.System, ConverseSystemBlock{Text: text})
+			}
+			continue
+		}
+
+		var role string
+		var blocks []ConverseContentBlock
+		switch message.Role {
+		case "tool":
+			role = "user"
+			resultText := message.StringContent()
+			blocks = append(blocks, ConverseContentBlock{
+				ToolResult: &ConverseToolResultBlock{
+					ToolUseId: message.ToolCallId,
+					Content:   []ConverseToolResultContent{{Text: &resultText}},
+				},
+			})
+		case "assistant":
+			role = "assistant"
+			if message.IsStringContent() {
+				if text := message.StringContent(); text != "" {
+					blocks = append(blocks, ConverseContentBlock{Text: &text})
+				}
+			} else {
+				for _, content := range message.ParseContent() {
+					if content.Type == dto.ContentTypeText && content.Text != "" {
+						text := content.Text
+						blocks = append(blocks, ConverseContentBlock{Text: &text})
+					}
+				}
+			}
+			for _, toolCall := range message.ParseToolCalls() {
+				input := make(map[string]any)
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+						common.SysLog("tool call function arguments is not a map[string]any: " + toolCall.Function.Arguments)
+					}
+				}
+				blocks = append(blocks, ConverseContentBlock{
+					ToolUse: &ConverseToolUseBlock{
+						ToolUseId: toolCall.ID,
+						Name:      toolCall.Function.Name,
+						Input:     input,
+					},
+				})
+			}
+		default:
+			role = "user"
+			if message.IsStringContent() {
+				if text := message.StringContent(); text != "" {
+					blocks = append(blocks, ConverseContentBlock{Text: &text})
+				}
+				break
+			}
+			for _, content := range message.ParseContent() {
+				switch content.Type {
+				case dto.ContentTypeText:
+					if content.Text != "" {
+						text := content.Text
+						blocks = append(blocks, ConverseContentBlock{Text: &text})
+					}
+				case dto.ContentTypeImageURL:
+					image, err := converseImageBlock(c, content.GetImageMedia().Url)
+					if err != nil {
+						return nil, err
+					}
+					blocks = append(blocks, ConverseContentBlock{Image: image})
+				case dto.ContentTypeFile:
+					documentCount++
+					block, err := converseFileBlock(c, content.GetFile(), documentCount)
+					if err != nil {
+						return nil, err
+					}
+					blocks = append(blocks, block)
+				}
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// Converse 要求 user 与 assistant 交替出现，连续的同角色消息合并为一条
+		if last := len(converseReq.Messages) - 1; last >= 0 && converseReq.Messages[last].Role == role {
+			converseReq.Messages[last].Content = append(converseReq.Messages[last].Content, blocks...)
+			continue
+		}
+		if len(converseReq.Messages) == 0 && role != "user" {
+			// fix: first message is assistant, add user message
+			placeholder := "..."
+			converseReq.Messages = append(converseReq.Messages, ConverseMessage{
+				Role:    "user",
+				Content: []ConverseContentBlock{{Text: &placeholder}},
+			})
+		}
+		converseReq.Messages = append(converseReq.Messages, ConverseMessage{Role: role, Content: blocks})
+	}
+
+	inferenceConfig := &ConverseInferenceConfig{}
+	maxTokens := request.GetMaxTokens()
+	if maxTokens == 0 && isClaude {
+		maxTokens = uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(request.Model))
+	}
+	if maxTokens > 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		inferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != 0 {
+		inferenceConfig.TopP = aws.Float32(float32(request.TopP))
+	}
+	inferenceConfig.StopSequences = parseStopSequences(request.Stop)
+	converseReq.InferenceConfig = inferenceConfig
+
+	additionalFields := make(map[string]any)
+	if isClaude {
+		if request.TopK != 0 {
+			additionalFields["top_k"] = request.TopK
+		}
+		budgetTokens, err := converseThinkingBudget(request)
+		if err != nil {
+			return nil, err
+		}
+		if budgetTokens > 0 {
+			// additionalModelRequestFields 按 smithy document 编码，不识别 json tag，需使用 map
+			additionalFields["thinking"] = map[string]any{"type": "enabled", "budget_tokens": budgetTokens}
+			// 开启 thinking 时不支持调整 temperature、top_p 与 top_k
+			inferenceConfig.Temperature = nil
+			inferenceConfig.TopP = nil
+			delete(additionalFields, "top_k")
+			if inferenceConfig.MaxTokens == nil || int(*inferenceConfig.MaxTokens) <= budgetTokens {
+				inferenceConfig.MaxTokens = aws.Int32(int32(budgetTokens + 1024))
+			}
+		}
+	} else if request.ReasoningEffort != "" && strings.Contains(awsModelId, "openai.") {
+		additionalFields["reasoning_effort"] = request.ReasoningEffort
+	}
+	if len(additionalFields) > 0 {
+		converseReq.AdditionalModelRequestFields = additionalFields
+	}
+
+	if len(request.Tools) > 0 {
+		toolConfig := &ConverseToolConfig{}
+		for _, tool := range request.Tools {
+			spec := ConverseToolSpec{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+			}
+			spec.InputSchema.Json = tool.Function.Parameters
+			if spec.InputSchema.Json == nil {
+				spec.InputSchema.Json = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			toolConfig.Tools = append(toolConfig.Tools, ConverseTool{ToolSpec: spec})
+		}
+		toolConfig.ToolChoice = converseToolChoice(request.ToolChoice)
+		converseReq.ToolConfig = toolConfig
+	}
+	return converseReq, nil
+}
+
+func converseThinkingBudget(request *dto.GeneralOpenAIRequest) (int, error) {
+	// 指定了 reasoning 参数,覆盖 reasoning_effort
+	if request.Reasoning != nil {
+		var reasoning openrouter.RequestReasoning
+		if err := common.Unmarshal(request.Reasoning, &reasoning); err != nil {
+			return 0, err
+		}
+		if reasoning.MaxTokens > 0 {
+			return reasoning.MaxTokens, nil
+		}
+	}
+	switch request.ReasoningEffort {
+	case "low":
+		return 1280, nil
+	case "medium":
+		return 2048, nil
+	case "high":
+		return 4096, nil
+	}
+	return 0, nil
+}
+
+// converseToolChoice Converse 不支持 none，此时保留工具定义由模型自行决定，
+// 历史消息中存在工具调用时必须携带 toolConfig
+func converseToolChoice(toolChoice any) *ConverseToolChoice {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			return &ConverseToolChoice{Auto: &struct{}{}}
+		case "required":
+			return &ConverseToolChoice{Any: &struct{}{}}
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				choice := &ConverseToolChoice{Tool: &struct {
+					Name string `json:"name"`
+				}{Name: name}}
+				return choice
+			}
+		}
+	}
+	return nil
+}
+
+func converseImageBlock(c *gin.Context, url string) (*ConverseImageBlock, error) {
+	var mimeType, data string
+	if strings.HasPrefix(url, "http") {
+		fileData, err := service.GetFileBase64FromUrl(c, url, "formatting image for Bedrock Converse")
+		if err != nil {
+			return nil, fmt.Errorf("get file base64 from url failed: %s", err.Error())
+		}
+		mimeType, data = fileData.MimeType, fileData.Base64Data
+	} else {
+		_, format, base64String, err := service.DecodeBase64ImageData(url)
+		if err != nil {
+			return nil, err
+		}
+		mimeType, data = "image/"+format, base64String
+	}
+	imageBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode image data failed")
+	}
+	format := strings.TrimPrefix(mimeType, "image/")
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	return &ConverseImageBlock{Format: format, Source: ConverseBytesSource{Bytes: imageBytes}}, nil
+}
+
+func converseFileBlock(c *gin.Context, file *dto.MessageFile, index int) (ConverseContentBlock, error) {
+	if file == nil || file.FileData == "" {
+		return ConverseContentBlock{}, errors.New("bedrock converse only supports inline file_data")
+	}
+	mimeType, data, err := service.DecodeBase64FileData(file.FileData)
+	if err != nil {
+		return ConverseContentBlock{}, err
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		image, err := converseImageBlock(c, "data:"+mimeType+";base64,"+data)
+		if err != nil {
+			return ConverseContentBlock{}, err
+		}
+		return ConverseContentBlock{Image: image}, nil
+	}
+	format, ok := converseDocumentFormats[mimeType]
+	if !ok {
+		return ConverseContentBlock{}, fmt.Errorf("unsupported document type for bedrock converse: %s", mimeType)
+	}
+	fileBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return ConverseContentBlock{}, errors.Wrap(err, "decode file data failed")
+	}
+	name := strings.TrimSuffix(file.FileName, "."+format)
+	name = strings.TrimSpace(converseDocumentNameReplacer.ReplaceAllString(name, " "))
+	if name == "" {
+		name = fmt.Sprintf("document-%d", index)
+	}
+	return ConverseContentBlock{
+		Document: &ConverseDocumentBlock{Format: format, Name: name, Source: ConverseBytesSource{Bytes: fileBytes}},
+	}, nil
+}
+
+func (r *ConverseRequest) sdkMessages() []bedrockruntimeTypes.Message {
+	messages := make([]bedrockruntimeTypes.Message, 0, len(r.Messages))
+	for _, message := range r.Messages {
+		content := make([]bedrockruntimeTypes.ContentBlock, 0, len(message.Content))
+		for _, block := range message.Content {
+			if sdkBlock := block.sdkContentBlock(); sdkBlock != nil {
+				content = append(content, sdkBlock)
+			}
+		}
+		messages = append(messages, bedrockruntimeTypes.Message{
+			Role:    bedrockruntimeTypes.ConversationRole(message.Role),
+			Content: content,
+		})
+	}
+	return messages
+}
+
+func (b ConverseContentBlock) sdkContentBlock() bedrockruntimeTypes.ContentBlock {
+	switch {
+	case b.Text != nil:
+		return &bedrockruntimeTypes.ContentBlockMemberText{Value: *b.Text}
+	case b.Image != nil:
+		return &bedrockruntimeTypes.ContentBlockMemberImage{Value: b.Image.sdkImageBlock()}
+	case b.Document != nil:
+		return &bedrockruntimeTypes.ContentBlockMemberDocument{Value: bedrockruntimeTypes.DocumentBlock{
+			Format: bedrockruntimeTypes.DocumentFormat(b.Document.Format),
+			Name:   aws.String(b.Document.Name),
+			Source: &bedrockruntimeTypes.DocumentSourceMemberBytes{Value: b.Document.Source.Bytes},
+		}}
+	case b.ToolUse != nil:
+		input := b.ToolUse.Input
+		if input == nil {
+			input = map[string]any{}
+		}
+		return &bedrockruntimeTypes.ContentBlockMemberToolUse{Value: bedrockruntimeTypes.ToolUseBlock{
+			ToolUseId: aws.String(b.ToolUse.ToolUseId),
+			Name:      aws.String(b.ToolUse.Name),
+			Input:     document.NewLazyDocument(input),
+		}}
+	case b.ToolResult != nil:
+		content := make([]bedrockruntimeTypes.ToolResultContentBlock, 0, len(b.ToolResult.Content))
+		for _, item := range b.ToolResult.Content {
+			if item.Text != nil {
+				content = append(content, &bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: *item.Text})
+			} else if item.Image != nil {
+				content = append(content, &bedrockruntimeTypes.ToolResultContentBlockMemberImage{Value: item.Image.sdkImageBlock()})
+			}
+		}
+		result := bedrockruntimeTypes.ToolResultBlock{
+			ToolUseId: aws.String(b.ToolResult.ToolUseId),
+			Content:   content,
+		}
+		if b.ToolResult.Status != "" {
+			result.Status = bedrockruntimeTypes.ToolResultStatus(b.ToolResult.Status)
+		}
+		return &bedrockruntimeTypes.ContentBlockMemberToolResult{Value: result}
+	case b.ReasoningContent != nil:
+		if b.ReasoningContent.ReasoningText != nil {
+			return &bedrockruntimeTypes.ContentBlockMemberReasoningContent{Value: &bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText{
+				Value: bedrockruntimeTypes.ReasoningTextBlock{
+					Text:      aws.String(b.ReasoningContent.ReasoningText.Text),
+					Signature: aws.String(b.ReasoningContent.ReasoningText.Signature),
+				},
+			}}
+		}
+		if len(b.ReasoningContent.RedactedContent) > 0 {
+			return &bedrockruntimeTypes.ContentBlockMemberReasoningContent{Value: &bedrockruntimeTypes.ReasoningContentBlockMemberRedactedContent{
+				Value: b.ReasoningContent.RedactedContent,
+			}}
+		}
+	}
+	return nil
+}
+
+func (i *ConverseImageBlock) sdkImageBlock() bedrockruntimeTypes.ImageBlock {
+	return bedrockruntimeTypes.ImageBlock{
+		Format: bedrockruntimeTypes.ImageFormat(i.Format),
+		Source: &bedrockruntimeTypes.ImageSourceMemberBytes{Value: i.Source.Bytes},
+	}
+}
+
+func (r *ConverseRequest) sdkSystem() []bedrockruntimeTypes.SystemContentBlock {
+	if len(r.System) == 0 {
+		return nil
+	}
+	system := make([]bedrockruntimeTypes.SystemContentBlock, 0, len(r.System))
+	for _, block := range r.System {
+		system = append(system, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: block.Text})
+	}
+	return system
+}
+
+func (r *ConverseRequest) sdkInferenceConfig() *bedrockruntimeTypes.InferenceConfiguration {
+	if r.InferenceConfig == nil {
+		return nil
+	}
+	return &bedrockruntimeTypes.InferenceConfiguration{
+		MaxTokens:     r.InferenceConfig.MaxTokens,
+		Temperature:   r.InferenceConfig.Temperature,
+		TopP:          r.InferenceConfig.TopP,
+		StopSequences: r.InferenceConfig.StopSequences,
+	}
+}
+
+func (r *ConverseRequest) sdkToolConfig() *bedrockruntimeTypes.ToolConfiguration {
+	if r.ToolConfig == nil || len(r.ToolConfig.Tools) == 0 {
+		return nil
+	}
+	toolConfig := &bedrockruntimeTypes.ToolConfiguration{}
+	for _, tool := range r.ToolConfig.Tools {
+		spec := bedrockruntimeTypes.ToolSpecification{
+			Name:        aws.String(tool.ToolSpec.Name),
+			InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(tool.ToolSpec.InputSchema.Json)},
+		}
+		if tool.ToolSpec.Description != "" {
+			spec.Description = aws.String(tool.ToolSpec.Description)
+		}
+		toolConfig.Tools = append(toolConfig.Tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+	}
+	if choice := r.ToolConfig.ToolChoice; choice != nil {
+		switch {
+		case choice.Any != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAny{}
+		case choice.Tool != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberTool{Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(choice.Tool.Name)}}
+		case choice.Auto != nil:
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAuto{}
+		}
+	}
+	return toolConfig
+}
+
+func (r *ConverseRequest) sdkAdditionalFields() document.Interface {
+	if len(r.AdditionalModelRequestFields) == 0 {
+		return nil
+	}
+	return document.NewLazyDocument(r.AdditionalModelRequestFields)
+}
+
+func (r *ConverseRequest) toConverseInput(awsModelId string) *bedrockruntime.ConverseInput {
+	return &bedrockruntime.ConverseInput{
+		ModelId:                      aws.String(awsModelId),
+		Messages:                     r.sdkMessages(),
+		System:                       r.sdkSystem(),
+		InferenceConfig:              r.sdkInferenceConfig(),
+		ToolConfig:                   r.sdkToolConfig(),
+		AdditionalModelRequestFields: r.sdkAdditionalFields(),
+	}
+}
+
+func (r *ConverseRequest) toConverseStreamInput(awsModelId string) *bedrockruntime.ConverseStreamInput {
+	return &bedrockruntime.ConverseStreamInput{
+		ModelId:                      aws.String(awsModelId),
+		Messages:                     r.sdkMessages(),
+		System:                       r.sdkSystem(),
+		InferenceConfig:              r.sdkInferenceConfig(),
+		ToolConfig:                   r.sdkToolConfig(),
+		AdditionalModelRequestFields: r.sdkAdditionalFields(),
+	}
+}
+
+func converseStopReason2OpenAI(reason bedrockruntimeTypes.StopReason) string {
+	switch reason {
+	case bedrockruntimeTypes.StopReasonMaxTokens:
+		return constant.FinishReasonLength
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return constant.FinishReasonToolCalls
+	case bedrockruntimeTypes.StopReasonContentFiltered, bedrockruntimeTypes.StopReasonGuardrailIntervened:
+		return constant.FinishReasonContentFilter
+	default:
+		return constant.FinishReasonStop
+	}
+}
+
+// converseUsage Converse 的 inputTokens 不含缓存读写，按 OpenAI 语义合并到 PromptTokens
+func converseUsage(tokenUsage *bedrockruntimeTypes.TokenUsage) *dto.Usage {
+	usage := &dto.Usage{}
+	if tokenUsage == nil {
+		return usage
+	}
+	cacheRead := int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	cacheWrite := int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens)) + cacheRead + cacheWrite
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.PromptTokensDetails.CachedTokens = cacheRead
+	usage.PromptTokensDetails.CachedCreationTokens = cacheWrite
+	return usage
+}
+
+func converseToolCallArguments(input document.Interface) string {
+	if input == nil {
+		return "{}"
+	}
+	arguments, err := input.MarshalSmithyDocument()
+	if err != nil {
+		return "{}"
+	}
+	return string(arguments)
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.Converse(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "Converse"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+
+	message := dto.Message{Role: "assistant"}
+	var text, reasoning strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				text.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberReasoningContent:
+				if reasoningText, ok := v.Value.(*bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText); ok {
+					reasoning.WriteString(aws.ToString(reasoningText.Value.Text))
+				}
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: converseToolCallArguments(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+	message.SetStringContent(text.String())
+	message.ReasoningContent = reasoning.String()
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	usage := converseUsage(awsResp.Usage)
+	response := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReason2OpenAI(awsResp.StopReason),
+		}},
+		Usage: *usage,
+	}
+	c.JSON(http.StatusOK, response)
+	return nil, usage
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.ConverseStream(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		statusCode := getAwsErrorStatusCode(err)
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, statusCode), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	responseId := helper.GetResponseID(c)
+	createdAt := common.GetTimestamp()
+	newChunk := func() *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createdAt,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: 0}},
+		}
+	}
+	sendChunk := func(chunk *dto.ChatCompletionsStreamResponse) {
+		if err := helper.ObjectData(c, chunk); err != nil {
+			logger.LogError(c, "error_rendering_stream_response: "+err.Error())
+		}
+	}
+
+	var usage *dto.Usage
+	var responseText strings.Builder
+	// contentBlockIndex -> OpenAI tool_calls index
+	toolIndexes := make(map[int32]int)
+	for event := range stream.Events() {
+		info.SetFirstResponseTime()
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStart:
+			chunk := newChunk()
+			chunk.Choices[0].Delta.Role = "assistant"
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			index := len(toolIndexes)
+			toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+			toolCall := dto.ToolCallResponse{
+				ID:   aws.ToString(toolUse.Value.ToolUseId),
+				Type: "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(toolUse.Value.Name),
+				},
+			}
+			toolCall.SetIndex(index)
+			chunk := newChunk()
+			chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			chunk := newChunk()
+			switch delta := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				responseText.WriteString(delta.Value)
+				chunk.Choices[0].Delta.SetContentString(delta.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				reasoningText, ok := delta.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText)
+				if !ok {
+					continue
+				}
+				responseText.WriteString(reasoningText.Value)
+				chunk.Choices[0].Delta.ReasoningContent = &reasoningText.Value
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				toolCall := dto.ToolCallResponse{
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Arguments: aws.ToString(delta.Value.Input),
+					},
+				}
+				toolCall.SetIndex(toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)])
+				responseText.WriteString(toolCall.Function.Arguments)
+				chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+			default:
+				continue
+			}
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			chunk := newChunk()
+			finishReason := converseStopReason2OpenAI(v.Value.StopReason)
+			chunk.Choices[0].FinishReason = &finishReason
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			usage = converseUsage(v.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		logger.LogError(c, "error_reading_converse_stream: "+err.Error())
+	}
+
+	if usage == nil || usage.CompletionTokens == 0 {
+		usage = service.ResponseText2Usage(c, responseText.String(), info.UpstreamModelName, info.GetEstimatePromptTokens())
+	}
+	if info.ShouldIncludeUsage {
+		response := helper.GenerateFinalUsageResponse(responseId, createdAt, info.UpstreamModelName, *usage)
+		sendChunk(response)
+	}
+	helper.Done(c)
+	return nil, usage
+}
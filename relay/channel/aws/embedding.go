@@ -0,0 +1,313 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Cohere Embed 单次调用最多 96 条文本
+	awsCohereEmbedBatchSize = 96
+	// Bedrock Rerank 单次调用最多 1000 个文档
+	awsRerankBatchSize = 1000
+)
+
+// AwsEmbeddingRequest 与具体模型无关的中间格式，在 DoResponse 中按模型分批调用
+type AwsEmbeddingRequest struct {
+	Texts      []string `json:"texts"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type AwsRerankRequest struct {
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents,omitempty"`
+}
+
+type awsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type awsCohereEmbeddingResponse struct {
+	// embedding_types 为空时返回二维数组，否则返回 {"float": [...]}
+	Embeddings any `json:"embeddings"`
+}
+
+type awsRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func isAwsEmbeddingRelayMode(info *relaycommon.RelayInfo) bool {
+	return info.RelayMode == relayconstant.RelayModeEmbeddings || info.RelayMode == relayconstant.RelayModeRerank
+}
+
+func rerankDocumentText(document any) string {
+	switch v := document.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			return text
+		}
+	}
+	data, _ := common.Marshal(document)
+	return string(data)
+}
+
+func convertAwsEmbeddingRequest(request dto.EmbeddingRequest) (*AwsEmbeddingRequest, error) {
+	texts := request.ParseInput()
+	if len(texts) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	return &AwsEmbeddingRequest{
+		Texts:      texts,
+		Dimensions: request.Dimensions,
+	}, nil
+}
+
+func convertAwsRerankRequest(request dto.RerankRequest) (*AwsRerankRequest, error) {
+	if len(request.Documents) == 0 {
+		return nil, errors.New("documents is empty")
+	}
+	documents := make([]string, 0, len(request.Documents))
+	for _, document := range request.Documents {
+		documents = append(documents, rerankDocumentText(document))
+	}
+	return &AwsRerankRequest{
+		Query:           request.Query,
+		Documents:       documents,
+		TopN:            request.TopN,
+		ReturnDocuments: request.GetReturnDocuments(),
+	}, nil
+}
+
+// invokeAwsJson 调用 InvokeModel 并解析 JSON 响应，返回 Bedrock 统计的输入 token 数（未返回时为 0）
+func invokeAwsJson(c *gin.Context, a *Adaptor, awsModelId string, body any, v any) (int, *types.NewAPIError) {
+	data, err := common.Marshal(body)
+	if err != nil {
+		return 0, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
+	}
+	out, err := a.AwsClient.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        data,
+	})
+	if err != nil {
+		return 0, types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, getAwsErrorStatusCode(err))
+	}
+	if err = common.Unmarshal(out.Body, v); err != nil {
+		return 0, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	tokens := 0
+	if raw, ok := awsmiddleware.GetRawResponse(out.ResultMetadata).(*smithyhttp.Response); ok && raw != nil {
+		tokens, _ = strconv.Atoi(raw.Header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	}
+	return tokens, nil
+}
+
+func parseCohereEmbeddings(embeddings any) ([][]float64, error) {
+	if byType, ok := embeddings.(map[string]any); ok {
+		embeddings = byType["float"]
+	}
+	data, err := common.Marshal(embeddings)
+	if err != nil {
+		return nil, err
+	}
+	var vectors [][]float64
+	if err = common.Unmarshal(data, &vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	req, ok := a.AwsReq.(*AwsEmbeddingRequest)
+	if !ok {
+		return types.NewError(errors.New("invalid aws embedding request"), types.ErrorCodeInvalidRequest), nil
+	}
+	awsModelId := a.AwsModelId
+	embeddingResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(req.Texts)),
+		Model:  info.UpstreamModelName,
+	}
+	promptTokens := 0
+	switch {
+	case strings.Contains(awsModelId, "amazon.titan-embed"):
+		// Titan Embeddings 每次只接受一条文本
+		isV2 := strings.Contains(awsModelId, "titan-embed-text-v2")
+		for i, text := range req.Texts {
+			body := map[string]any{"inputText": text}
+			if isV2 {
+				body["normalize"] = true
+				if req.Dimensions > 0 {
+					body["dimensions"] = req.Dimensions
+				}
+			}
+			var titanResp awsTitanEmbeddingResponse
+			if _, apiErr := invokeAwsJson(c, a, awsModelId, body, &titanResp); apiErr != nil {
+				return apiErr, nil
+			}
+			promptTokens += titanResp.InputTextTokenCount
+			embeddingResponse.Data = append(embeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     i,
+				Embedding: titanResp.Embedding,
+			})
+		}
+	case strings.Contains(awsModelId, "cohere.embed"):
+		for start := 0; start < len(req.Texts); start += awsCohereEmbedBatchSize {
+			end := min(start+awsCohereEmbedBatchSize, len(req.Texts))
+			body := map[string]any{
+				"texts":           req.Texts[start:end],
+				"input_type":      "search_document",
+				"truncate":        "END",
+				"embedding_types": []string{"float"},
+			}
+			if req.Dimensions > 0 && strings.Contains(awsModelId, "cohere.embed-v4") {
+				body["output_dimension"] = req.Dimensions
+			}
+			var cohereResp awsCohereEmbeddingResponse
+			tokens, apiErr := invokeAwsJson(c, a, awsModelId, body, &cohereResp)
+			if apiErr != nil {
+				return apiErr, nil
+			}
+			vectors, err := parseCohereEmbeddings(cohereResp.Embeddings)
+			if err != nil {
+				return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+			}
+			if len(vectors) != end-start {
+				return types.NewOpenAIError(fmt.Errorf("expected %d embeddings, got %d", end-start, len(vectors)), types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+			}
+			promptTokens += tokens
+			for i, vector := range vectors {
+				embeddingResponse.Data = append(embeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
+					Object:    "embedding",
+					Index:     start + i,
+					Embedding: vector,
+				})
+			}
+		}
+	default:
+		return types.NewErrorWithStatusCode(fmt.Errorf("model %s does not support embeddings on bedrock", info.UpstreamModelName), types.ErrorCodeInvalidRequest, http.StatusBadRequest), nil
+	}
+
+	if promptTokens == 0 {
+		promptTokens = info.GetEstimatePromptTokens()
+	}
+	embeddingResponse.Usage = dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	c.JSON(http.StatusOK, embeddingResponse)
+	return nil, &embeddingResponse.Usage
+}
+
+func awsRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	req, ok := a.AwsReq.(*AwsRerankRequest)
+	if !ok {
+		return types.NewError(errors.New("invalid aws rerank request"), types.ErrorCodeInvalidRequest), nil
+	}
+	awsModelId := a.AwsModelId
+	isCohere := strings.Contains(awsModelId, "cohere.rerank")
+	if !isCohere && !strings.Contains(awsModelId, "amazon.rerank") {
+		return types.NewErrorWithStatusCode(fmt.Errorf("model %s does not support rerank on bedrock", info.UpstreamModelName), types.ErrorCodeInvalidRequest, http.StatusBadRequest), nil
+	}
+
+	results := make([]dto.RerankResponseResult, 0, len(req.Documents))
+	promptTokens := 0
+	batches := (len(req.Documents) + awsRerankBatchSize - 1) / awsRerankBatchSize
+	for start := 0; start < len(req.Documents); start += awsRerankBatchSize {
+		end := min(start+awsRerankBatchSize, len(req.Documents))
+		body := map[string]any{
+			"query":     req.Query,
+			"documents": req.Documents[start:end],
+		}
+		// 分批时需要每批的全部得分才能合并排序
+		if req.TopN > 0 && batches == 1 {
+			body["top_n"] = min(req.TopN, end-start)
+		} else {
+			body["top_n"] = end - start
+		}
+		if isCohere {
+			body["api_version"] = 2
+		}
+		var rerankResp awsRerankResponse
+		tokens, apiErr := invokeAwsJson(c, a, awsModelId, body, &rerankResp)
+		if apiErr != nil {
+			return apiErr, nil
+		}
+		promptTokens += tokens
+		for _, result := range rerankResp.Results {
+			results = append(results, dto.RerankResponseResult{
+				Index:          start + result.Index,
+				RelevanceScore: result.RelevanceScore,
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RelevanceScore > results[j].RelevanceScore
+	})
+	if req.TopN > 0 && len(results) > req.TopN {
+		results = results[:req.TopN]
+	}
+	if req.ReturnDocuments {
+		for i := range results {
+			if results[i].Index >= 0 && results[i].Index < len(req.Documents) {
+				results[i].Document = dto.RerankDocument{Text: req.Documents[results[i].Index]}
+			}
+		}
+	}
+
+	if promptTokens == 0 {
+		promptTokens = info.GetEstimatePromptTokens()
+	}
+	rerankResponse := dto.RerankResponse{
+		Results: results,
+		Usage: dto.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	}
+	c.JSON(http.StatusOK, rerankResponse)
+	return nil, &rerankResponse.Usage
+}
+
+func decodeAwsEmbeddingRequest(info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode == relayconstant.RelayModeRerank {
+		var req AwsRerankRequest
+		if err := common.DecodeJson(requestBody, &req); err != nil {
+			return nil, err
+		}
+		return &req, nil
+	}
+	var req AwsEmbeddingRequest
+	if err := common.DecodeJson(requestBody, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
@@ -1,7 +1,6 @@
 package aws
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -85,69 +84,64 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 	a.AwsClient = awsCli
 
 	// 获取对应的AWS模型ID
-	awsModelId := getAwsModelID(info.UpstreamModelName)
+	awsModelId := resolveAwsModelId(info, awsCli.Options().Region)
 
-	awsRegionPrefix := getAwsRegionPrefix(awsCli.Options().Region)
-	canCrossRegion := awsModelCanCrossRegion(awsModelId, awsRegionPrefix)
-	if canCrossRegion {
-		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
+	if isAwsEmbeddingRelayMode(info) {
+		a.AwsModelId = awsModelId
+		a.AwsReq, err = decodeAwsEmbeddingRequest(info, requestBody)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode aws request fail"), types.ErrorCodeBadRequestBody)
+		}
+		return nil, nil
+	}
+
+	if a.IsConverse {
+		var converseReq ConverseRequest
+		err = common.DecodeJson(requestBody, &converseReq)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode converse request fail"), types.ErrorCodeBadRequestBody)
+		}
+		if info.IsStream {
+			a.AwsReq = converseReq.toConverseStreamInput(awsModelId)
+		} else {
+			a.AwsReq = converseReq.toConverseInput(awsModelId)
+		}
+		return nil, nil
 	}
 
 	// init empty request.header
 	requestHeader := http.Header{}
 	a.SetupRequestHeader(c, &requestHeader, info)
 
-	if isNovaModel(awsModelId) {
-		var novaReq *NovaRequest
-		err = common.DecodeJson(requestBody, &novaReq)
-		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "decode nova request fail"), types.ErrorCodeBadRequestBody)
-		}
+	awsClaudeReq, err := formatRequest(requestBody, requestHeader)
+	if err != nil {
+		return nil, types.NewError(errors.Wrap(err, "format aws request fail"), types.ErrorCodeBadRequestBody)
+	}
 
-		// 使用InvokeModel API，但使用Nova格式的请求体
-		awsReq := &bedrockruntime.InvokeModelInput{
+	if info.IsStream {
+		awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
 			ModelId:     aws.String(awsModelId),
 			Accept:      aws.String("application/json"),
 			ContentType: aws.String("application/json"),
 		}
-
-		reqBody, err := common.Marshal(novaReq)
+		awsReq.Body, err = common.Marshal(awsClaudeReq)
 		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "marshal nova request"), types.ErrorCodeBadResponseBody)
+			return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
 		}
-		awsReq.Body = reqBody
+		a.AwsReq = awsReq
 		return nil, nil
 	} else {
-		awsClaudeReq, err := formatRequest(requestBody, requestHeader)
-		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "format aws request fail"), types.ErrorCodeBadRequestBody)
+		awsReq := &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
 		}
-
-		if info.IsStream {
-			awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
-				ModelId:     aws.String(awsModelId),
-				Accept:      aws.String("application/json"),
-				ContentType: aws.String("application/json"),
-			}
-			awsReq.Body, err = common.Marshal(awsClaudeReq)
-			if err != nil {
-				return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
-			}
-			a.AwsReq = awsReq
-			return nil, nil
-		} else {
-			awsReq := &bedrockruntime.InvokeModelInput{
-				ModelId:     aws.String(awsModelId),
-				Accept:      aws.String("application/json"),
-				ContentType: aws.String("application/json"),
-			}
-			awsReq.Body, err = common.Marshal(awsClaudeReq)
-			if err != nil {
-				return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
-			}
-			a.AwsReq = awsReq
-			return nil, nil
+		awsReq.Body, err = common.Marshal(awsClaudeReq)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
 		}
+		a.AwsReq = awsReq
+		return nil, nil
 	}
 }
 
@@ -177,9 +171,55 @@ func getAwsModelID(requestModel string) string {
 	if awsModelIDName, ok := awsModelIDMap[requestModel]; ok {
 		return awsModelIDName
 	}
+	// 未内置的 Claude 新模型按 Bedrock 命名规则推导，无需逐个添加映射
+	if strings.HasPrefix(requestModel, "claude-") {
+		return "anthropic." + requestModel + "-v1:0"
+	}
 	return requestModel
 }
 
+// resolveAwsModelId 解析 Bedrock 模型 ID，渠道配置的映射优先于内置映射；
+// ARN 与已带跨区域前缀的模型 ID 原样使用
+func resolveAwsModelId(info *relaycommon.RelayInfo, region string) string {
+	settings := info.ChannelOtherSettings
+	awsModelId, ok := settings.AwsModelIdMap[info.UpstreamModelName]
+	if !ok {
+		awsModelId = getAwsModelID(info.UpstreamModelName)
+	}
+	if strings.HasPrefix(awsModelId, "arn:") || hasAwsCrossRegionPrefix(awsModelId) || region == "" {
+		return awsModelId
+	}
+	switch settings.AwsCrossRegion {
+	case dto.AwsCrossRegionNone:
+		return awsModelId
+	case "":
+		awsRegionPrefix := getAwsRegionPrefix(region)
+		if awsModelCanCrossRegion(awsModelId, awsRegionPrefix) {
+			return awsModelCrossRegion(awsModelId, awsRegionPrefix)
+		}
+		return awsModelId
+	default:
+		return settings.AwsCrossRegion + "." + awsModelId
+	}
+}
+
+func hasAwsCrossRegionPrefix(awsModelId string) bool {
+	prefix, _, found := strings.Cut(awsModelId, ".")
+	if !found {
+		return false
+	}
+	switch prefix {
+	case "us", "eu", "apac", "global", "us-gov", "jp", "au", "ca":
+		return true
+	}
+	return false
+}
+
+// isAwsClaudeModel Claude 模型（包括其推理配置文件）可使用 Anthropic 原生请求格式
+func isAwsClaudeModel(awsModelId string) bool {
+	return strings.Contains(awsModelId, "anthropic.")
+}
+
 func awsHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
 
 	awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), a.AwsReq.(*bedrockruntime.InvokeModelInput))
@@ -245,57 +285,3 @@ func awsStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (
 	claude.HandleStreamFinalResponse(c, info, claudeInfo, claude.RequestModeMessage)
 	return nil, claudeInfo.Usage
 }
-
-// Nova模型处理函数
-func handleNovaRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
-
-	awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), a.AwsReq.(*bedrockruntime.InvokeModelInput))
-	if err != nil {
-		statusCode := getAwsErrorStatusCode(err)
-		return types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, statusCode), nil
-	}
-
-	// 解析Nova响应
-	var novaResp struct {
-		Output struct {
-			Message struct {
-				Content []struct {
-					Text string `json:"text"`
-				} `json:"content"`
-			} `json:"message"`
-		} `json:"output"`
-		Usage struct {
-			InputTokens  int `json:"inputTokens"`
-			OutputTokens int `json:"outputTokens"`
-			TotalTokens  int `json:"totalTokens"`
-		} `json:"usage"`
-	}
-
-	if err := json.Unmarshal(awsResp.Body, &novaResp); err != nil {
-		return types.NewError(errors.Wrap(err, "unmarshal nova response"), types.ErrorCodeBadResponseBody), nil
-	}
-
-	// 构造OpenAI格式响应
-	response := dto.OpenAITextResponse{
-		Id:      helper.GetResponseID(c),
-		Object:  "chat.completion",
-		Created: common.GetTimestamp(),
-		Model:   info.UpstreamModelName,
-		Choices: []dto.OpenAITextResponseChoice{{
-			Index: 0,
-			Message: dto.Message{
-				Role:    "assistant",
-				Content: novaResp.Output.Message.Content[0].Text,
-			},
-			FinishReason: "stop",
-		}},
-		Usage: dto.Usage{
-			PromptTokens:     novaResp.Usage.InputTokens,
-			CompletionTokens: novaResp.Usage.OutputTokens,
-			TotalTokens:      novaResp.Usage.TotalTokens,
-		},
-	}
-
-	c.JSON(http.StatusOK, response)
-	return nil, &response.Usage
-}
@@ -0,0 +1,535 @@
+package gemini
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Gemini Live API (BidiGenerateContent) 消息结构
+// https://ai.google.dev/api/live
+
+type geminiLiveSetupMessage struct {
+	Setup geminiLiveSetup `json:"setup"`
+}
+
+type geminiLiveSetup struct {
+	Model                    string                      `json:"model"`
+	GenerationConfig         *geminiLiveGenerationConfig `json:"generationConfig,omitempty"`
+	SystemInstruction        *dto.GeminiChatContent      `json:"systemInstruction,omitempty"`
+	Tools                    []dto.GeminiChatTool        `json:"tools,omitempty"`
+	InputAudioTranscription  *struct{}                   `json:"inputAudioTranscription,omitempty"`
+	OutputAudioTranscription *struct{}                   `json:"outputAudioTranscription,omitempty"`
+}
+
+type geminiLiveGenerationConfig struct {
+	ResponseModalities []string                `json:"responseModalities,omitempty"`
+	Temperature        *float64                `json:"temperature,omitempty"`
+	SpeechConfig       *geminiLiveSpeechConfig `json:"speechConfig,omitempty"`
+}
+
+type geminiLiveSpeechConfig struct {
+	VoiceConfig struct {
+		PrebuiltVoiceConfig struct {
+			VoiceName string `json:"voiceName"`
+		} `json:"prebuiltVoiceConfig"`
+	} `json:"voiceConfig"`
+}
+
+type geminiLiveClientMessage struct {
+	ClientContent *geminiLiveClientContent `json:"clientContent,omitempty"`
+	RealtimeInput *geminiLiveRealtimeInput `json:"realtimeInput,omitempty"`
+	ToolResponse  *geminiLiveToolResponse  `json:"toolResponse,omitempty"`
+}
+
+type geminiLiveClientContent struct {
+	Turns        []dto.GeminiChatContent `json:"turns,omitempty"`
+	TurnComplete bool                    `json:"turnComplete"`
+}
+
+type geminiLiveRealtimeInput struct {
+	Audio          *dto.GeminiInlineData `json:"audio,omitempty"`
+	AudioStreamEnd bool                  `json:"audioStreamEnd,omitempty"`
+}
+
+type geminiLiveToolResponse struct {
+	FunctionResponses []geminiLiveFunctionResponse `json:"functionResponses"`
+}
+
+type geminiLiveFunctionResponse struct {
+	Id       string         `json:"id,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiLiveServerMessage struct {
+	SetupComplete *struct{}                `json:"setupComplete,omitempty"`
+	ServerContent *geminiLiveServerContent `json:"serverContent,omitempty"`
+	ToolCall      *geminiLiveToolCall      `json:"toolCall,omitempty"`
+	UsageMetadata *geminiLiveUsageMetadata `json:"usageMetadata,omitempty"`
+	GoAway        *struct {
+		TimeLeft string `json:"timeLeft"`
+	} `json:"goAway,omitempty"`
+}
+
+type geminiLiveServerContent struct {
+	ModelTurn           *dto.GeminiChatContent   `json:"modelTurn,omitempty"`
+	TurnComplete        bool                     `json:"turnComplete,omitempty"`
+	Interrupted         bool                     `json:"interrupted,omitempty"`
+	InputTranscription  *geminiLiveTranscription `json:"inputTranscription,omitempty"`
+	OutputTranscription *geminiLiveTranscription `json:"outputTranscription,omitempty"`
+}
+
+type geminiLiveTranscription struct {
+	Text string `json:"text"`
+}
+
+type geminiLiveToolCall struct {
+	FunctionCalls []struct {
+		Id   string         `json:"id"`
+		Name string         `json:"name"`
+		Args map[string]any `json:"args"`
+	} `json:"functionCalls"`
+}
+
+type geminiLiveUsageMetadata struct {
+	PromptTokenCount      int                             `json:"promptTokenCount"`
+	ResponseTokenCount    int                             `json:"responseTokenCount"`
+	ThoughtsTokenCount    int                             `json:"thoughtsTokenCount"`
+	TotalTokenCount       int                             `json:"totalTokenCount"`
+	PromptTokensDetails   []dto.GeminiPromptTokensDetails `json:"promptTokensDetails"`
+	ResponseTokensDetails []dto.GeminiPromptTokensDetails `json:"responseTokensDetails"`
+}
+
+// geminiLiveInputMimeType OpenAI realtime 的 pcm16 为 24kHz 单声道
+const geminiLiveInputMimeType = "audio/pcm;rate=24000"
+
+func getGeminiLiveURL(info *relaycommon.RelayInfo, version string) string {
+	baseUrl := info.ChannelBaseUrl
+	if strings.HasPrefix(baseUrl, "https://") {
+		baseUrl = "wss://" + strings.TrimPrefix(baseUrl, "https://")
+	} else if strings.HasPrefix(baseUrl, "http://") {
+		baseUrl = "ws://" + strings.TrimPrefix(baseUrl, "http://")
+	}
+	return fmt.Sprintf("%s/ws/google.ai.generativelanguage.%s.GenerativeService.BidiGenerateContent", baseUrl, version)
+}
+
+func buildGeminiLiveSetup(info *relaycommon.RelayInfo, session *dto.RealtimeSession) *geminiLiveSetupMessage {
+	setup := geminiLiveSetup{
+		Model: "models/" + info.UpstreamModelName,
+		GenerationConfig: &geminiLiveGenerationConfig{
+			ResponseModalities: []string{"AUDIO"},
+		},
+		InputAudioTranscription:  &struct{}{},
+		OutputAudioTranscription: &struct{}{},
+	}
+	if session != nil {
+		// Gemini Live 单次会话只支持一种输出模态
+		if len(session.Modalities) > 0 && !common.StringsContains(session.Modalities, "audio") {
+			setup.GenerationConfig.ResponseModalities = []string{"TEXT"}
+			setup.OutputAudioTranscription = nil
+		}
+		if session.Temperature > 0 {
+			setup.GenerationConfig.Temperature = common.GetPointer(session.Temperature)
+		}
+		if session.Voice != "" {
+			speechConfig := &geminiLiveSpeechConfig{}
+			speechConfig.VoiceConfig.PrebuiltVoiceConfig.VoiceName = session.Voice
+			setup.GenerationConfig.SpeechConfig = speechConfig
+		}
+		if session.Instructions != "" {
+			setup.SystemInstruction = &dto.GeminiChatContent{
+				Parts: []dto.GeminiPart{{Text: session.Instructions}},
+			}
+		}
+		if len(session.Tools) > 0 {
+			declarations := make([]map[string]any, 0, len(session.Tools))
+			for _, tool := range session.Tools {
+				declaration := map[string]any{
+					"name":        tool.Name,
+					"description": tool.Description,
+				}
+				if tool.Parameters != nil {
+					declaration["parameters"] = cleanFunctionParameters(tool.Parameters)
+				}
+				declarations = append(declarations, declaration)
+			}
+			setup.Tools = []dto.GeminiChatTool{{FunctionDeclarations: declarations}}
+		}
+	}
+	return &geminiLiveSetupMessage{Setup: setup}
+}
+
+func convertRealtimeItemToGeminiLive(item *dto.RealtimeItem) *geminiLiveClientMessage {
+	switch item.Type {
+	case "function_call_output":
+		response := map[string]any{}
+		if err := common.UnmarshalJsonStr(item.Output, &response); err != nil || len(response) == 0 {
+			response = map[string]any{"output": item.Output}
+		}
+		return &geminiLiveClientMessage{
+			ToolResponse: &geminiLiveToolResponse{
+				FunctionResponses: []geminiLiveFunctionResponse{{
+					Id:       item.CallId,
+					Response: response,
+				}},
+			},
+		}
+	case "message":
+		role := "user"
+		if item.Role == "assistant" {
+			role = "model"
+		}
+		parts := make([]dto.GeminiPart, 0, len(item.Content))
+		for _, content := range item.Content {
+			switch content.Type {
+			case "input_text", "text":
+				parts = append(parts, dto.GeminiPart{Text: content.Text})
+			case "input_audio":
+				if content.Audio != "" {
+					parts = append(parts, dto.GeminiPart{InlineData: &dto.GeminiInlineData{
+						MimeType: geminiLiveInputMimeType,
+						Data:     content.Audio,
+					}})
+				} else if content.Transcript != "" {
+					parts = append(parts, dto.GeminiPart{Text: content.Transcript})
+				}
+			}
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		return &geminiLiveClientMessage{
+			ClientContent: &geminiLiveClientContent{
+				Turns: []dto.GeminiChatContent{{Role: role, Parts: parts}},
+			},
+		}
+	}
+	return nil
+}
+
+func geminiLiveUsageToRealtime(usageMetadata *geminiLiveUsageMetadata) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		InputTokens:  usageMetadata.PromptTokenCount,
+		OutputTokens: usageMetadata.ResponseTokenCount + usageMetadata.ThoughtsTokenCount,
+	}
+	for _, detail := range usageMetadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.InputTokenDetails.AudioTokens += detail.TokenCount
+		} else {
+			usage.InputTokenDetails.TextTokens += detail.TokenCount
+		}
+	}
+	for _, detail := range usageMetadata.ResponseTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.OutputTokenDetails.AudioTokens += detail.TokenCount
+		} else {
+			usage.OutputTokenDetails.TextTokens += detail.TokenCount
+		}
+	}
+	usage.OutputTokenDetails.TextTokens += usageMetadata.ThoughtsTokenCount
+	// 没有模态明细时全部按文本计
+	if usage.InputTokenDetails.AudioTokens+usage.InputTokenDetails.TextTokens == 0 {
+		usage.InputTokenDetails.TextTokens = usage.InputTokens
+	}
+	if usage.OutputTokenDetails.AudioTokens+usage.OutputTokenDetails.TextTokens == 0 {
+		usage.OutputTokenDetails.TextTokens = usage.OutputTokens
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	return usage
+}
+
+// GeminiLiveRealtimeHandler 以 OpenAI Realtime 协议对接客户端，并驱动 Gemini Live 双向流
+func GeminiLiveRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+	info.IsStream = true
+	client := helper.NewRealtimeClient(c, info.ClientWs)
+	targetConn := info.TargetWs
+
+	session := &dto.RealtimeSession{
+		Modalities:        []string{"text", "audio"},
+		InputAudioFormat:  info.InputAudioFormat,
+		OutputAudioFormat: info.OutputAudioFormat,
+	}
+	if err := client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: session}); err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	// 上游未返回 usageMetadata 时使用本地估算。
+	// 用量与 session 会被客户端与上游两个读取协程同时访问，统一由 usageMutex 保护
+	var (
+		upstreamUsage *dto.RealtimeUsage
+		localUsage    = &dto.RealtimeUsage{}
+		sumUsage      = &dto.RealtimeUsage{}
+		usageMutex    sync.Mutex
+	)
+	lockUsage := usageMutex.Lock
+	unlockUsage := usageMutex.Unlock
+	getSession := func() *dto.RealtimeSession {
+		lockUsage()
+		defer unlockUsage()
+		return session
+	}
+
+	// takeUsage 取出待结算的用量并清零，保证同一份用量只会被结算一次
+	takeUsage := func() *dto.RealtimeUsage {
+		lockUsage()
+		defer unlockUsage()
+		usage := localUsage
+		if upstreamUsage != nil {
+			usage = upstreamUsage
+		}
+		upstreamUsage = nil
+		localUsage = &dto.RealtimeUsage{}
+		if usage.TotalTokens != 0 {
+			sumUsage.Add(usage)
+		}
+		return usage
+	}
+
+	setupSent := false
+	sendSetup := func(s *dto.RealtimeSession) error {
+		setupSent = true
+		return helper.WssObject(c, targetConn, buildGeminiLiveSetup(info, s))
+	}
+
+	settle := func() error {
+		usage := takeUsage()
+		_, err := client.FinishResponse(usage)
+		if usage.TotalTokens != 0 {
+			if consumeErr := service.PreWssConsumeQuota(c, info, usage); consumeErr != nil {
+				return consumeErr
+			}
+		}
+		return err
+	}
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.ClientWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from client: %v", err)
+				}
+				close(clientClosed)
+				return
+			}
+			realtimeEvent := &dto.RealtimeEvent{}
+			if err = common.Unmarshal(message, realtimeEvent); err != nil {
+				errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+				return
+			}
+
+			if realtimeEvent.Type == dto.RealtimeEventTypeSessionUpdate {
+				if realtimeEvent.Session != nil {
+					if realtimeEvent.Session.Tools != nil {
+						info.RealtimeTools = realtimeEvent.Session.Tools
+					}
+					if setupSent {
+						logger.LogWarn(c, "gemini live does not support updating session after setup, ignored")
+						_ = client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: getSession()})
+						continue
+					}
+					lockUsage()
+					session = realtimeEvent.Session
+					unlockUsage()
+					info.InputAudioFormat = common.GetStringIfEmpty(realtimeEvent.Session.InputAudioFormat, info.InputAudioFormat)
+					info.OutputAudioFormat = common.GetStringIfEmpty(realtimeEvent.Session.OutputAudioFormat, info.OutputAudioFormat)
+				}
+				if err = sendSetup(getSession()); err != nil {
+					errChan <- fmt.Errorf("error writing to target: %v", err)
+					return
+				}
+				continue
+			}
+			if !setupSent {
+				if err = sendSetup(getSession()); err != nil {
+					errChan <- fmt.Errorf("error writing to target: %v", err)
+					return
+				}
+			}
+
+			textToken, audioToken, err := service.CountTokenRealtime(info, *realtimeEvent, info.UpstreamModelName)
+			if err != nil {
+				errChan <- fmt.Errorf("error counting text token: %v", err)
+				return
+			}
+			lockUsage()
+			localUsage.TotalTokens += textToken + audioToken
+			localUsage.InputTokens += textToken + audioToken
+			localUsage.InputTokenDetails.TextTokens += textToken
+			localUsage.InputTokenDetails.AudioTokens += audioToken
+			unlockUsage()
+
+			var upstreamMessage *geminiLiveClientMessage
+			switch realtimeEvent.Type {
+			case dto.RealtimeEventInputAudioBufferAppend:
+				if info.InputAudioFormat != "pcm16" {
+					_ = client.SendError("unsupported_audio_format", "gemini live only supports pcm16 input audio")
+					continue
+				}
+				upstreamMessage = &geminiLiveClientMessage{
+					RealtimeInput: &geminiLiveRealtimeInput{
+						Audio: &dto.GeminiInlineData{MimeType: geminiLiveInputMimeType, Data: realtimeEvent.Audio},
+					},
+				}
+			case dto.RealtimeEventInputAudioBufferCommit:
+				upstreamMessage = &geminiLiveClientMessage{
+					RealtimeInput: &geminiLiveRealtimeInput{AudioStreamEnd: true},
+				}
+				_ = client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted})
+			case dto.RealtimeEventTypeConversationCreate:
+				if realtimeEvent.Item != nil {
+					upstreamMessage = convertRealtimeItemToGeminiLive(realtimeEvent.Item)
+					_ = client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, Item: realtimeEvent.Item})
+				}
+			case dto.RealtimeEventTypeResponseCreate:
+				upstreamMessage = &geminiLiveClientMessage{
+					ClientContent: &geminiLiveClientContent{TurnComplete: true},
+				}
+			default:
+				logger.LogDebug(c, fmt.Sprintf("gemini live ignores realtime event: %s", realtimeEvent.Type))
+			}
+			if upstreamMessage == nil {
+				continue
+			}
+			if err = helper.WssObject(c, targetConn, upstreamMessage); err != nil {
+				errChan <- fmt.Errorf("error writing to target: %v", err)
+				return
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := targetConn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from target: %v", err)
+				}
+				close(targetClosed)
+				return
+			}
+			info.SetFirstResponseTime()
+			serverMessage := &geminiLiveServerMessage{}
+			if err = common.Unmarshal(message, serverMessage); err != nil {
+				errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+				return
+			}
+
+			if serverMessage.SetupComplete != nil {
+				err = client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: getSession()})
+			}
+			if serverMessage.UsageMetadata != nil {
+				lockUsage()
+				upstreamUsage = geminiLiveUsageToRealtime(serverMessage.UsageMetadata)
+				unlockUsage()
+			}
+			if content := serverMessage.ServerContent; content != nil && err == nil {
+				if content.Interrupted {
+					err = client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferSpeechStarted})
+				}
+				if content.InputTranscription != nil && content.InputTranscription.Text != "" && err == nil {
+					err = client.Send(&dto.RealtimeEvent{
+						Type:  dto.RealtimeEventInputAudioTranscriptionDelta,
+						Delta: content.InputTranscription.Text,
+					})
+				}
+				if content.ModelTurn != nil {
+					for _, part := range content.ModelTurn.Parts {
+						if err != nil {
+							break
+						}
+						if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+							_, audioToken, _ := service.CountTokenRealtime(info, dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioDelta, Delta: part.InlineData.Data}, info.UpstreamModelName)
+							lockUsage()
+							localUsage.TotalTokens += audioToken
+							localUsage.OutputTokens += audioToken
+							localUsage.OutputTokenDetails.AudioTokens += audioToken
+							unlockUsage()
+							err = client.SendDelta(dto.RealtimeEventResponseAudioDelta, part.InlineData.Data)
+						} else if part.Text != "" && !part.Thought {
+							textToken := service.CountTextToken(part.Text, info.UpstreamModelName)
+							lockUsage()
+							localUsage.TotalTokens += textToken
+							localUsage.OutputTokens += textToken
+							localUsage.OutputTokenDetails.TextTokens += textToken
+							unlockUsage()
+							err = client.SendDelta(dto.RealtimeEventResponseTextDelta, part.Text)
+						}
+					}
+				}
+				if content.OutputTranscription != nil && content.OutputTranscription.Text != "" && err == nil {
+					err = client.SendDelta(dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text)
+				}
+				if content.TurnComplete && err == nil {
+					err = settle()
+				}
+			}
+			if serverMessage.ToolCall != nil && err == nil {
+				for _, call := range serverMessage.ToolCall.FunctionCalls {
+					arguments, _ := common.Marshal(call.Args)
+					if err = client.SendFunctionCall(call.Id, call.Name, string(arguments)); err != nil {
+						break
+					}
+				}
+				// 函数调用结束本轮 response，等待客户端返回 function_call_output
+				if err == nil {
+					err = settle()
+				}
+			}
+			if serverMessage.GoAway != nil {
+				logger.LogWarn(c, fmt.Sprintf("gemini live connection will be closed by upstream in %s", serverMessage.GoAway.TimeLeft))
+			}
+			if err != nil {
+				errChan <- fmt.Errorf("error handling upstream message: %v", err)
+				return
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		logger.LogError(c, "gemini live realtime error: "+err.Error())
+	case <-c.Done():
+	}
+
+	// 结算最后一轮未完成的用量，takeUsage 清零后上游协程不会再次结算同一份用量
+	if pending := takeUsage(); pending.TotalTokens != 0 {
+		_ = service.PreWssConsumeQuota(c, info, pending)
+	}
+	lockUsage()
+	defer unlockUsage()
+	total := *sumUsage
+	return nil, &total
+}
@@ -0,0 +1,88 @@
+package channel
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/common"
+)
+
+// ParseUpstreamRateLimit 解析上游限流响应头：
+// OpenAI 兼容的 x-ratelimit-{limit,remaining,reset}-{requests,tokens}、
+// Anthropic 的 anthropic-ratelimit-{requests,tokens,input-tokens}-{limit,remaining,reset}
+// 以及 retry-after / retry-after-ms
+func ParseUpstreamRateLimit(header http.Header, now time.Time) *model.UpstreamRateLimit {
+	state := model.NewUpstreamRateLimit()
+	state.UpdatedAt = now.UnixMilli()
+
+	state.LimitRequests = parseRateLimitCount(header, "x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit")
+	state.RemainingRequests = parseRateLimitCount(header, "x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining")
+	state.RequestsResetAt = parseRateLimitReset(header, now, "x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset")
+	state.LimitTokens = parseRateLimitCount(header, "x-ratelimit-limit-tokens", "anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-input-tokens-limit")
+	state.RemainingTokens = parseRateLimitCount(header, "x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-input-tokens-remaining")
+	state.TokensResetAt = parseRateLimitReset(header, now, "x-ratelimit-reset-tokens", "anthropic-ratelimit-tokens-reset", "anthropic-ratelimit-input-tokens-reset")
+
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			state.RetryAfterUntil = now.UnixMilli() + int64(ms)
+		}
+	} else if v := header.Get("retry-after"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			if seconds > 0 {
+				state.RetryAfterUntil = now.UnixMilli() + int64(seconds*1000)
+			}
+		} else if t, err := http.ParseTime(v); err == nil && t.After(now) {
+			state.RetryAfterUntil = t.UnixMilli()
+		}
+	}
+	return state
+}
+
+func parseRateLimitCount(header http.Header, names ...string) int64 {
+	for _, name := range names {
+		if v := header.Get(name); v != "" {
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// parseRateLimitReset 支持 Go 风格时长（OpenAI 的 "6m0s"、"20ms"）、秒数、Unix 时间戳与 RFC3339 时间
+func parseRateLimitReset(header http.Header, now time.Time, names ...string) int64 {
+	for _, name := range names {
+		v := strings.TrimSpace(header.Get(name))
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return now.Add(d).UnixMilli()
+		}
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			if seconds > 1e9 {
+				return int64(seconds * 1000)
+			}
+			return now.UnixMilli() + int64(seconds*1000)
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UnixMilli()
+		}
+	}
+	return 0
+}
+
+// reportUpstreamRateLimit 将上游响应中的限流状态上报到共享限流器
+func reportUpstreamRateLimit(info *common.RelayInfo, resp *http.Response) {
+	if info == nil || resp == nil || info.ChannelId == 0 {
+		return
+	}
+	keyIndex := 0
+	if info.ChannelIsMultiKey {
+		keyIndex = info.ChannelMultiKeyIndex
+	}
+	model.ReportUpstreamRateLimit(info.ChannelId, keyIndex, ParseUpstreamRateLimit(resp.Header, time.Now()))
+}
@@ -27,6 +27,9 @@ const (
 	RequestModeClaude = 1
 	RequestModeGemini = 2
 	RequestModeLlama  = 3
+	// Embedding 与 Rerank 分别使用 predict 接口和 Discovery Engine Ranking API
+	RequestModeEmbedding = 4
+	RequestModeRerank    = 5
 )
 
 var claudeModelMap = map[string]string{
@@ -76,7 +79,11 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
-	if strings.HasPrefix(info.UpstreamModelName, "claude") {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		a.RequestMode = RequestModeEmbedding
+	} else if info.RelayMode == constant.RelayModeRerank {
+		a.RequestMode = RequestModeRerank
+	} else if strings.HasPrefix(info.UpstreamModelName, "claude") {
 		a.RequestMode = RequestModeClaude
 	} else if strings.Contains(info.UpstreamModelName, "llama") ||
 		// open source models
@@ -96,7 +103,7 @@ func (a *Adaptor) getRequestUrl(info *relaycommon.RelayInfo, modelName, suffix s
 		}
 		a.AccountCredentials = *adc
 
-		if a.RequestMode == RequestModeGemini {
+		if a.RequestMode == RequestModeGemini || a.RequestMode == RequestModeEmbedding {
 			if region == "global" {
 				return fmt.Sprintf(
 					"https://aiplatform.googleapis.com/v1/projects/%s/locations/global/publishers/google/models/%s:%s",
@@ -139,8 +146,16 @@ func (a *Adaptor) getRequestUrl(info *relaycommon.RelayInfo, modelName, suffix s
 				adc.ProjectID,
 				region,
 			), nil
+		} else if a.RequestMode == RequestModeRerank {
+			return fmt.Sprintf(
+				"https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/default_ranking_config:rank",
+				adc.ProjectID,
+			), nil
 		}
 	} else {
+		if a.RequestMode == RequestModeRerank {
+			return "", errors.New("vertex ranking api requires service account credentials")
+		}
 		var keyPrefix string
 		if strings.HasSuffix(suffix, "?alt=sse") {
 			keyPrefix = "&"
@@ -210,6 +225,10 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		return a.getRequestUrl(info, model, suffix)
 	} else if a.RequestMode == RequestModeLlama {
 		return a.getRequestUrl(info, "", "")
+	} else if a.RequestMode == RequestModeEmbedding {
+		return a.getRequestUrl(info, info.UpstreamModelName, "predict")
+	} else if a.RequestMode == RequestModeRerank {
+		return a.getRequestUrl(info, "", "")
 	}
 	return "", errors.New("unsupported request mode")
 }
@@ -313,12 +332,11 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return nil, nil
+	return convertRerankRequest(request)
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	return convertEmbeddingRequest(request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -327,10 +345,22 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	switch a.RequestMode {
+	case RequestModeEmbedding:
+		return a.doEmbeddingRequest(c, info, requestBody)
+	case RequestModeRerank:
+		return a.doRerankRequest(c, info, requestBody)
+	}
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	switch a.RequestMode {
+	case RequestModeEmbedding:
+		return vertexEmbeddingHandler(c, info, resp)
+	case RequestModeRerank:
+		return vertexRerankHandler(c, info, resp)
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
@@ -0,0 +1,343 @@
+package vertex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// text-embedding 系列单次请求最多 250 条，gemini-embedding 仅支持 1 条
+	vertexEmbeddingBatchSize       = 250
+	vertexGeminiEmbeddingBatchSize = 1
+	// Ranking API 单次请求最多 200 条记录
+	vertexRankBatchSize = 200
+
+	vertexDefaultRankModel = "semantic-ranker-default@latest"
+)
+
+type VertexEmbeddingInstance struct {
+	Content  string `json:"content"`
+	TaskType string `json:"task_type,omitempty"`
+}
+
+type VertexEmbeddingParameters struct {
+	OutputDimensionality int  `json:"outputDimensionality,omitempty"`
+	AutoTruncate         bool `json:"autoTruncate"`
+}
+
+type VertexEmbeddingRequest struct {
+	Instances  []VertexEmbeddingInstance  `json:"instances"`
+	Parameters *VertexEmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type VertexEmbeddingPrediction struct {
+	Embeddings struct {
+		Values     []float64 `json:"values"`
+		Statistics struct {
+			TokenCount float64 `json:"token_count"`
+			Truncated  bool    `json:"truncated"`
+		} `json:"statistics"`
+	} `json:"embeddings"`
+}
+
+type VertexEmbeddingResponse struct {
+	Predictions []VertexEmbeddingPrediction `json:"predictions"`
+}
+
+type VertexRankRecord struct {
+	Id      string  `json:"id"`
+	Title   string  `json:"title,omitempty"`
+	Content string  `json:"content,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+type VertexRankRequest struct {
+	Model                         string             `json:"model"`
+	Query                         string             `json:"query"`
+	Records                       []VertexRankRecord `json:"records"`
+	TopN                          int                `json:"topN,omitempty"`
+	IgnoreRecordDetailsInResponse bool               `json:"ignoreRecordDetailsInResponse,omitempty"`
+}
+
+type VertexRankResponse struct {
+	Records []VertexRankRecord `json:"records"`
+}
+
+func vertexEmbeddingBatchLimit(modelName string) int {
+	if strings.HasPrefix(modelName, "gemini-embedding") {
+		return vertexGeminiEmbeddingBatchSize
+	}
+	return vertexEmbeddingBatchSize
+}
+
+func rerankDocumentText(document any) string {
+	switch v := document.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			return text
+		}
+	}
+	data, _ := common.Marshal(document)
+	return string(data)
+}
+
+func convertEmbeddingRequest(request dto.EmbeddingRequest) (*VertexEmbeddingRequest, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	vertexReq := &VertexEmbeddingRequest{
+		Instances: make([]VertexEmbeddingInstance, 0, len(inputs)),
+		Parameters: &VertexEmbeddingParameters{
+			OutputDimensionality: request.Dimensions,
+			AutoTruncate:         true,
+		},
+	}
+	for _, input := range inputs {
+		vertexReq.Instances = append(vertexReq.Instances, VertexEmbeddingInstance{Content: input})
+	}
+	return vertexReq, nil
+}
+
+func convertRerankRequest(request dto.RerankRequest) (*VertexRankRequest, error) {
+	if len(request.Documents) == 0 {
+		return nil, errors.New("documents is empty")
+	}
+	model := request.Model
+	if !strings.HasPrefix(model, "semantic-ranker") {
+		model = vertexDefaultRankModel
+	}
+	vertexReq := &VertexRankRequest{
+		Model:                         model,
+		Query:                         request.Query,
+		Records:                       make([]VertexRankRecord, 0, len(request.Documents)),
+		TopN:                          request.TopN,
+		IgnoreRecordDetailsInResponse: !request.GetReturnDocuments(),
+	}
+	for i, document := range request.Documents {
+		vertexReq.Records = append(vertexReq.Records, VertexRankRecord{
+			Id:      strconv.Itoa(i),
+			Content: rerankDocumentText(document),
+		})
+	}
+	return vertexReq, nil
+}
+
+// doBatchRequest 依次发送各批次请求，任一批次失败时直接返回上游响应交由统一错误处理
+func (a *Adaptor) doBatchRequest(c *gin.Context, info *relaycommon.RelayInfo, batches []any, merge func(body []byte) error) (*http.Response, error) {
+	for _, batch := range batches {
+		data, err := common.Marshal(batch)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := channel.DoApiRequest(a, c, info, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		service.CloseResponseBodyGracefully(resp)
+		if err != nil {
+			return nil, err
+		}
+		if err = merge(body); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func newMergedResponse(v any) (*http.Response, error) {
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func (a *Adaptor) doEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	var embeddingReq VertexEmbeddingRequest
+	if err := common.DecodeJson(requestBody, &embeddingReq); err != nil {
+		return nil, err
+	}
+	limit := vertexEmbeddingBatchLimit(info.UpstreamModelName)
+	batches := make([]any, 0, (len(embeddingReq.Instances)+limit-1)/limit)
+	for start := 0; start < len(embeddingReq.Instances); start += limit {
+		end := min(start+limit, len(embeddingReq.Instances))
+		batches = append(batches, VertexEmbeddingRequest{
+			Instances:  embeddingReq.Instances[start:end],
+			Parameters: embeddingReq.Parameters,
+		})
+	}
+	merged := VertexEmbeddingResponse{}
+	resp, err := a.doBatchRequest(c, info, batches, func(body []byte) error {
+		var batchResp VertexEmbeddingResponse
+		if err := common.Unmarshal(body, &batchResp); err != nil {
+			return err
+		}
+		merged.Predictions = append(merged.Predictions, batchResp.Predictions...)
+		return nil
+	})
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	return newMergedResponse(merged)
+}
+
+func (a *Adaptor) doRerankRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	var rankReq VertexRankRequest
+	if err := common.DecodeJson(requestBody, &rankReq); err != nil {
+		return nil, err
+	}
+	if len(rankReq.Records) <= vertexRankBatchSize {
+		data, err := common.Marshal(rankReq)
+		if err != nil {
+			return nil, err
+		}
+		return channel.DoApiRequest(a, c, info, bytes.NewReader(data))
+	}
+	// 分批请求每批的全部得分，合并后再统一排序截取
+	batches := make([]any, 0, (len(rankReq.Records)+vertexRankBatchSize-1)/vertexRankBatchSize)
+	for start := 0; start < len(rankReq.Records); start += vertexRankBatchSize {
+		end := min(start+vertexRankBatchSize, len(rankReq.Records))
+		batch := rankReq
+		batch.Records = rankReq.Records[start:end]
+		batch.TopN = 0
+		batches = append(batches, batch)
+	}
+	merged := VertexRankResponse{}
+	resp, err := a.doBatchRequest(c, info, batches, func(body []byte) error {
+		var batchResp VertexRankResponse
+		if err := common.Unmarshal(body, &batchResp); err != nil {
+			return err
+		}
+		merged.Records = append(merged.Records, batchResp.Records...)
+		return nil
+	})
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	sort.SliceStable(merged.Records, func(i, j int) bool {
+		return merged.Records[i].Score > merged.Records[j].Score
+	})
+	if rankReq.TopN > 0 && len(merged.Records) > rankReq.TopN {
+		merged.Records = merged.Records[:rankReq.TopN]
+	}
+	return newMergedResponse(merged)
+}
+
+func vertexEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var vertexResponse VertexEmbeddingResponse
+	if err = common.Unmarshal(responseBody, &vertexResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	openAIResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(vertexResponse.Predictions)),
+		Model:  info.UpstreamModelName,
+	}
+	promptTokens := 0
+	for i, prediction := range vertexResponse.Predictions {
+		promptTokens += int(prediction.Embeddings.Statistics.TokenCount)
+		openAIResponse.Data = append(openAIResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: prediction.Embeddings.Values,
+		})
+	}
+	if promptTokens == 0 {
+		promptTokens = info.GetEstimatePromptTokens()
+	}
+	openAIResponse.Usage = dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+
+	jsonResponse, err := common.Marshal(openAIResponse)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return &openAIResponse.Usage, nil
+}
+
+func vertexRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var vertexResponse VertexRankResponse
+	if err = common.Unmarshal(responseBody, &vertexResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	results := make([]dto.RerankResponseResult, 0, len(vertexResponse.Records))
+	for _, record := range vertexResponse.Records {
+		index, err := strconv.Atoi(record.Id)
+		if err != nil {
+			return nil, types.NewOpenAIError(fmt.Errorf("unexpected record id %q", record.Id), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		result := dto.RerankResponseResult{
+			Index:          index,
+			RelevanceScore: record.Score,
+		}
+		if record.Content != "" {
+			result.Document = dto.RerankDocument{Text: record.Content}
+		}
+		results = append(results, result)
+	}
+	// Ranking API 按查询计费，不返回 token 用量，使用预估值
+	promptTokens := info.GetEstimatePromptTokens()
+	rerankResponse := dto.RerankResponse{
+		Results: results,
+		Usage: dto.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	}
+
+	jsonResponse, err := common.Marshal(rerankResponse)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return &rerankResponse.Usage, nil
+}
@@ -85,6 +85,7 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	OrganizationId    int // 组织令牌所属组织，非 0 时从组织额度池计费
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -400,6 +401,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		OrganizationId: common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -216,6 +216,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 
 	modelName := relayInfo.OriginModelName
 
+	service.ApplyPricingTier(relayInfo, promptTokens)
+
 	tokenName := ctx.GetString("token_name")
 	completionRatio := relayInfo.PriceData.CompletionRatio
 	cacheRatio := relayInfo.PriceData.CacheRatio
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -49,6 +50,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
 
 	groupRatioInfo := HandleGroupRatio(c, info)
+	pricingWindow, hasPricingWindow := ratio_setting.GetActivePricingWindow(info.OriginModelName, info.UsingGroup, time.Now())
 
 	var preConsumedQuota int
 	var modelRatio float64
@@ -87,9 +89,15 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
+		if hasPricingWindow {
+			modelRatio = pricingWindow.ApplyRatio(modelRatio)
+		}
 		ratio := modelRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
+		if hasPricingWindow {
+			modelPrice = pricingWindow.ApplyPrice(modelPrice)
+		}
 		if meta.ImagePriceRatio != 0 {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
@@ -131,6 +139,11 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
 	}
+	if hasPricingWindow {
+		priceData.PricingWindow = pricingWindow.Name
+		priceData.PricingWindowModelRatio = pricingWindow.ModelRatio
+		priceData.PricingWindowMultiplier = pricingWindow.Multiplier
+	}
 
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
@@ -153,6 +166,9 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
+	if pricingWindow, ok := ratio_setting.GetActivePricingWindow(info.OriginModelName, info.UsingGroup, time.Now()); ok {
+		modelPrice = pricingWindow.ApplyPrice(modelPrice)
+	}
 	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
 		ModelPrice:     modelPrice,
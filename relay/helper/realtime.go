@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RealtimeClient 以 OpenAI Realtime 事件协议向客户端写消息，供非 OpenAI 后端的 realtime 桥接使用。
+// websocket 连接不支持并发写，所有写操作都经过同一把锁。
+type RealtimeClient struct {
+	c          *gin.Context
+	conn       *websocket.Conn
+	mutex      sync.Mutex
+	responseId string
+	itemId     string
+}
+
+func NewRealtimeClient(c *gin.Context, conn *websocket.Conn) *RealtimeClient {
+	return &RealtimeClient{
+		c:    c,
+		conn: conn,
+	}
+}
+
+func newRealtimeID(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, common.GetRandomString(20))
+}
+
+func (r *RealtimeClient) Send(event *dto.RealtimeEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if event.EventId == "" {
+		event.EventId = newRealtimeID("evt")
+	}
+	return WssObject(r.c, r.conn, event)
+}
+
+func (r *RealtimeClient) SendError(code string, message string) error {
+	return r.Send(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeError,
+		Error: &types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// StartResponse 开始一次新的 response，已有进行中的 response 时直接返回
+func (r *RealtimeClient) StartResponse() error {
+	r.mutex.Lock()
+	if r.responseId != "" {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.responseId = newRealtimeID("resp")
+	r.itemId = newRealtimeID("item")
+	responseId := r.responseId
+	r.mutex.Unlock()
+	return r.Send(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventResponseCreated,
+		Response: &dto.RealtimeResponse{
+			Id:     responseId,
+			Status: "in_progress",
+		},
+	})
+}
+
+// SendDelta 在当前 response 下发送增量事件，必要时先开始 response
+func (r *RealtimeClient) SendDelta(eventType string, delta string) error {
+	if err := r.StartResponse(); err != nil {
+		return err
+	}
+	responseId, itemId := r.current()
+	return r.Send(&dto.RealtimeEvent{
+		Type:       eventType,
+		ResponseId: responseId,
+		ItemId:     itemId,
+		Delta:      delta,
+	})
+}
+
+// SendFunctionCall 在当前 response 下发送一次完整的函数调用
+func (r *RealtimeClient) SendFunctionCall(callId string, name string, arguments string) error {
+	if err := r.StartResponse(); err != nil {
+		return err
+	}
+	responseId, itemId := r.current()
+	return r.Send(&dto.RealtimeEvent{
+		Type:       dto.RealtimeEventResponseFunctionCallArgumentsDone,
+		ResponseId: responseId,
+		ItemId:     itemId,
+		CallId:     callId,
+		Name:       name,
+		Arguments:  arguments,
+	})
+}
+
+// FinishResponse 结束当前 response 并附带本次用量，没有进行中的 response 时返回 false
+func (r *RealtimeClient) FinishResponse(usage *dto.RealtimeUsage) (bool, error) {
+	r.mutex.Lock()
+	responseId := r.responseId
+	r.responseId = ""
+	r.itemId = ""
+	r.mutex.Unlock()
+	if responseId == "" {
+		return false, nil
+	}
+	return true, r.Send(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeResponseDone,
+		Response: &dto.RealtimeResponse{
+			Id:     responseId,
+			Status: "completed",
+			Usage:  usage,
+		},
+	})
+}
+
+func (r *RealtimeClient) current() (string, string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.responseId, r.itemId
+}
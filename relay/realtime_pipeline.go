@@ -0,0 +1,528 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// OpenAI realtime 的 pcm16 音频为 24kHz、16bit、单声道
+	realtimePcmSampleRate = 24000
+	// 每个 response.audio.delta 约 0.5 秒音频
+	realtimePcmChunkSize = realtimePcmSampleRate * 2 / 2
+)
+
+type realtimePipelineSession struct {
+	c            *gin.Context
+	info         *relaycommon.RelayInfo
+	pipeline     model_setting.RealtimePipeline
+	client       *helper.RealtimeClient
+	session      *dto.RealtimeSession
+	audioBuffer  bytes.Buffer
+	history      []dto.Message
+	pendingUsage *dto.RealtimeUsage
+	sumUsage     *dto.RealtimeUsage
+	// 缓冲区与最近一次提交的音频 token，用于将语音识别的用量计入对应渠道
+	bufferedAudioTokens  int
+	committedAudioTokens int
+	// 额度不足时结束会话
+	quotaExceeded bool
+}
+
+// RealtimePipelineHelper 使用已有渠道串联 语音识别 -> 对话 -> 语音合成，对客户端提供 OpenAI Realtime 协议。
+// 管道不做服务端 VAD，客户端需通过 input_audio_buffer.commit 与 response.create 控制轮次。
+// 各环节按模型在当前分组中选择渠道，经渠道适配器调用，找不到渠道时返回错误。
+func RealtimePipelineHelper(c *gin.Context, info *relaycommon.RelayInfo, pipeline model_setting.RealtimePipeline) (*types.NewAPIError, *dto.RealtimeUsage) {
+	info.IsStream = true
+	s := &realtimePipelineSession{
+		c:        c,
+		info:     info,
+		pipeline: pipeline,
+		client:   helper.NewRealtimeClient(c, info.ClientWs),
+		session: &dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			Voice:             pipeline.Voice,
+			InputAudioFormat:  info.InputAudioFormat,
+			OutputAudioFormat: info.OutputAudioFormat,
+		},
+		pendingUsage: &dto.RealtimeUsage{},
+		sumUsage:     &dto.RealtimeUsage{},
+	}
+	if err := s.client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: s.session}); err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	for {
+		_, message, err := info.ClientWs.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.LogError(c, "error reading from client: "+err.Error())
+			}
+			break
+		}
+		realtimeEvent := &dto.RealtimeEvent{}
+		if err = common.Unmarshal(message, realtimeEvent); err != nil {
+			logger.LogError(c, "error unmarshalling message: "+err.Error())
+			break
+		}
+		if err = s.handleEvent(realtimeEvent); err != nil {
+			logger.LogError(c, "realtime pipeline error: "+err.Error())
+			_ = s.client.SendError("pipeline_error", err.Error())
+			_, _ = s.client.FinishResponse(nil)
+			if s.quotaExceeded {
+				break
+			}
+		}
+	}
+
+	if s.pendingUsage.TotalTokens != 0 {
+		s.sumUsage.Add(s.pendingUsage)
+		_ = service.PreWssConsumeQuota(c, info, s.pendingUsage)
+	}
+	return nil, s.sumUsage
+}
+
+func (s *realtimePipelineSession) handleEvent(event *dto.RealtimeEvent) error {
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session != nil {
+			if len(event.Session.Modalities) > 0 {
+				s.session.Modalities = event.Session.Modalities
+			}
+			if event.Session.Instructions != "" {
+				s.session.Instructions = event.Session.Instructions
+			}
+			if event.Session.Voice != "" {
+				s.session.Voice = event.Session.Voice
+			}
+			if event.Session.InputAudioFormat != "" && event.Session.InputAudioFormat != "pcm16" {
+				return fmt.Errorf("realtime pipeline only supports pcm16 input audio")
+			}
+		}
+		return s.client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: s.session})
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return fmt.Errorf("invalid audio data: %w", err)
+		}
+		s.audioBuffer.Write(audio)
+		audioToken, err := service.CountAudioTokenInput(event.Audio, s.info.InputAudioFormat)
+		if err == nil {
+			s.pendingUsage.TotalTokens += audioToken
+			s.pendingUsage.InputTokens += audioToken
+			s.pendingUsage.InputTokenDetails.AudioTokens += audioToken
+			s.bufferedAudioTokens += audioToken
+		}
+		return nil
+	case dto.RealtimeEventInputAudioBufferClear:
+		s.audioBuffer.Reset()
+		s.bufferedAudioTokens = 0
+		return nil
+	case dto.RealtimeEventInputAudioBufferCommit:
+		return s.commitAudio()
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item == nil || event.Item.Type != "message" {
+			return nil
+		}
+		var text strings.Builder
+		for _, content := range event.Item.Content {
+			text.WriteString(content.Text)
+			text.WriteString(content.Transcript)
+		}
+		role := event.Item.Role
+		if role == "" {
+			role = "user"
+		}
+		s.history = append(s.history, dto.Message{Role: role, Content: text.String()})
+		return s.client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, Item: event.Item})
+	case dto.RealtimeEventTypeResponseCreate:
+		if s.audioBuffer.Len() > 0 {
+			if err := s.commitAudio(); err != nil {
+				return err
+			}
+		}
+		return s.respond()
+	default:
+		logger.LogDebug(s.c, fmt.Sprintf("realtime pipeline ignores event: %s", event.Type))
+	}
+	return nil
+}
+
+func (s *realtimePipelineSession) commitAudio() error {
+	if s.audioBuffer.Len() == 0 {
+		return nil
+	}
+	wav := pcm16ToWav(s.audioBuffer.Bytes(), realtimePcmSampleRate)
+	s.audioBuffer.Reset()
+	s.committedAudioTokens = s.bufferedAudioTokens
+	s.bufferedAudioTokens = 0
+	if err := s.client.Send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted}); err != nil {
+		return err
+	}
+	transcript, err := s.transcribe(wav)
+	if err != nil {
+		return err
+	}
+	s.history = append(s.history, dto.Message{Role: "user", Content: transcript})
+	return s.client.Send(&dto.RealtimeEvent{
+		Type:       dto.RealtimeEventInputAudioTranscriptionCompleted,
+		Transcript: transcript,
+	})
+}
+
+func (s *realtimePipelineSession) respond() error {
+	if err := s.client.StartResponse(); err != nil {
+		return err
+	}
+	text, err := s.chat()
+	if err != nil {
+		return err
+	}
+	s.history = append(s.history, dto.Message{Role: "assistant", Content: text})
+
+	if common.StringsContains(s.session.Modalities, "audio") && s.pipeline.SpeechModel != "" {
+		if err = s.client.SendDelta(dto.RealtimeEventResponseAudioTranscriptionDelta, text); err != nil {
+			return err
+		}
+		audio, channelId, err := s.speak(text)
+		if err != nil {
+			return err
+		}
+		audioToken, err := service.CountAudioTokenOutput(base64.StdEncoding.EncodeToString(audio), s.info.OutputAudioFormat)
+		if err == nil {
+			legUsage := &dto.RealtimeUsage{TotalTokens: audioToken, OutputTokens: audioToken}
+			legUsage.OutputTokenDetails.AudioTokens = audioToken
+			s.pendingUsage.Add(legUsage)
+			s.updateLegChannelQuota(channelId, legUsage)
+		}
+		for start := 0; start < len(audio); start += realtimePcmChunkSize {
+			end := min(start+realtimePcmChunkSize, len(audio))
+			if err = s.client.SendDelta(dto.RealtimeEventResponseAudioDelta, base64.StdEncoding.EncodeToString(audio[start:end])); err != nil {
+				return err
+			}
+		}
+	} else if err = s.client.SendDelta(dto.RealtimeEventResponseTextDelta, text); err != nil {
+		return err
+	}
+
+	usage := s.pendingUsage
+	s.pendingUsage = &dto.RealtimeUsage{}
+	if _, err = s.client.FinishResponse(usage); err != nil {
+		return err
+	}
+	s.sumUsage.Add(usage)
+	if err = service.PreWssConsumeQuota(s.c, s.info, usage); err != nil {
+		s.quotaExceeded = true
+		return err
+	}
+	return nil
+}
+
+func (s *realtimePipelineSession) transcribe(wav []byte) (string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("model", s.pipeline.TranscriptionModel)
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(wav); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	request := &dto.AudioRequest{Model: s.pipeline.TranscriptionModel}
+	result, err := s.callLeg(s.pipeline.TranscriptionModel, "/v1/audio/transcriptions", types.RelayFormatOpenAIAudio, request, body.Bytes(), writer.FormDataContentType())
+	if err != nil {
+		return "", fmt.Errorf("transcription failed: %w", err)
+	}
+	var response struct {
+		Text string `json:"text"`
+	}
+	if err = common.Unmarshal(result.body, &response); err != nil {
+		return "", fmt.Errorf("transcription failed: %w", err)
+	}
+	legUsage := &dto.RealtimeUsage{TotalTokens: s.committedAudioTokens, InputTokens: s.committedAudioTokens}
+	legUsage.InputTokenDetails.AudioTokens = s.committedAudioTokens
+	s.updateLegChannelQuota(result.channelId, legUsage)
+	return response.Text, nil
+}
+
+func (s *realtimePipelineSession) chat() (string, error) {
+	messages := make([]dto.Message, 0, len(s.history)+1)
+	if s.session.Instructions != "" {
+		messages = append(messages, dto.Message{Role: "system", Content: s.session.Instructions})
+	}
+	messages = append(messages, s.history...)
+	request := &dto.GeneralOpenAIRequest{
+		Model:    s.pipeline.ChatModel,
+		Messages: messages,
+	}
+	if s.session.Temperature > 0 {
+		request.Temperature = common.GetPointer(s.session.Temperature)
+	}
+	requestBody, err := common.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	result, err := s.callLeg(s.pipeline.ChatModel, "/v1/chat/completions", types.RelayFormatOpenAI, request, requestBody, "application/json")
+	if err != nil {
+		return "", fmt.Errorf("chat completion failed: %w", err)
+	}
+	var response dto.OpenAITextResponse
+	if err = common.Unmarshal(result.body, &response); err != nil {
+		return "", fmt.Errorf("chat completion failed: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("chat completion returned no choices")
+	}
+	text := response.Choices[0].Message.StringContent()
+	var promptTokens, completionTokens int
+	if result.usage != nil {
+		promptTokens = result.usage.PromptTokens
+		completionTokens = result.usage.CompletionTokens
+	}
+	if promptTokens == 0 && completionTokens == 0 {
+		for _, message := range messages {
+			promptTokens += service.CountTextToken(message.StringContent(), s.pipeline.ChatModel)
+		}
+		completionTokens = service.CountTextToken(text, s.pipeline.ChatModel)
+	}
+	legUsage := &dto.RealtimeUsage{
+		TotalTokens:  promptTokens + completionTokens,
+		InputTokens:  promptTokens,
+		OutputTokens: completionTokens,
+	}
+	legUsage.InputTokenDetails.TextTokens = promptTokens
+	legUsage.OutputTokenDetails.TextTokens = completionTokens
+	s.pendingUsage.Add(legUsage)
+	s.updateLegChannelQuota(result.channelId, legUsage)
+	return text, nil
+}
+
+func (s *realtimePipelineSession) speak(text string) ([]byte, int, error) {
+	request := &dto.AudioRequest{
+		Model:          s.pipeline.SpeechModel,
+		Input:          text,
+		Voice:          common.GetStringIfEmpty(s.session.Voice, "alloy"),
+		ResponseFormat: "pcm",
+	}
+	requestBody, err := common.Marshal(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := s.callLeg(s.pipeline.SpeechModel, "/v1/audio/speech", types.RelayFormatOpenAIAudio, request, requestBody, "application/json")
+	if err != nil {
+		return nil, 0, fmt.Errorf("speech synthesis failed: %w", err)
+	}
+	return result.body, result.channelId, nil
+}
+
+type realtimeLegResult struct {
+	channelId int
+	body      []byte
+	usage     *dto.Usage
+}
+
+// callLeg 在当前分组中选择支持该模型的渠道，经渠道适配器发起请求，失败时按重试次数切换渠道
+func (s *realtimePipelineSession) callLeg(modelName string, path string, relayFormat types.RelayFormat, request dto.Request, body []byte, contentType string) (*realtimeLegResult, error) {
+	var newAPIError *types.NewAPIError
+	for retry := 0; retry <= common.RetryTimes; retry++ {
+		channel, err := model.GetRandomSatisfiedChannel(s.info.UsingGroup, modelName, retry)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("no available channel for model %s in group %s", modelName, s.info.UsingGroup)
+		}
+		var result *realtimeLegResult
+		result, newAPIError = s.doLeg(channel, modelName, path, relayFormat, request, body, contentType)
+		if newAPIError == nil {
+			return result, nil
+		}
+		if !shouldRetryRealtimeLeg(newAPIError) {
+			break
+		}
+	}
+	return nil, newAPIError
+}
+
+// doLeg 以独立的子请求上下文调用渠道，与普通请求一样应用模型映射、参数覆盖、并发槽位与限流上报
+func (s *realtimePipelineSession) doLeg(channel *model.Channel, modelName string, path string, relayFormat types.RelayFormat, request dto.Request, body []byte, contentType string) (*realtimeLegResult, *types.NewAPIError) {
+	req, err := http.NewRequestWithContext(s.c.Request.Context(), http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	c := middleware.NewSubRequestContext(s.c, w, req, body)
+	defer middleware.ReleaseChannelSlot(c)
+
+	if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, modelName); newAPIError != nil {
+		return nil, newAPIError
+	}
+	usage, newAPIError := relayRealtimeLeg(c, relayFormat, request)
+	if newAPIError != nil {
+		s.processLegError(c, channel, newAPIError)
+		return nil, newAPIError
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		model.RecordChannelKeySuccess(channel.Id, common.GetContextKeyString(c, constant.ContextKeyChannelKey))
+	}
+	return &realtimeLegResult{channelId: channel.Id, body: w.Body.Bytes(), usage: usage}, nil
+}
+
+func relayRealtimeLeg(c *gin.Context, relayFormat types.RelayFormat, request dto.Request) (*dto.Usage, *types.NewAPIError) {
+	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeGenRelayInfoFailed, types.ErrOptionWithSkipRetry())
+	}
+	info.InitChannelMeta(c)
+	if err = helper.ModelMappedHelper(c, info, request); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return nil, types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+
+	var requestBody io.Reader
+	switch r := request.(type) {
+	case *dto.AudioRequest:
+		requestBody, err = adaptor.ConvertAudioRequest(c, info, *r)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+	case *dto.GeneralOpenAIRequest:
+		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, r)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+		jsonData, err := common.Marshal(convertedRequest)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+		jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+		if len(info.ParamOverride) > 0 {
+			jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
+			if err != nil {
+				return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid, types.ErrOptionWithSkipRetry())
+			}
+		}
+		requestBody = bytes.NewReader(jsonData)
+	default:
+		return nil, types.NewError(fmt.Errorf("unsupported realtime pipeline request %T", request), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+			return nil, newAPIError
+		}
+	}
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, newAPIError
+	}
+	if usage, ok := usage.(*dto.Usage); ok {
+		return usage, nil
+	}
+	return nil, nil
+}
+
+// processLegError 记录 Key 错误并按渠道配置自动禁用，与普通请求的渠道错误处理一致
+func (s *realtimePipelineSession) processLegError(c *gin.Context, channel *model.Channel, newAPIError *types.NewAPIError) {
+	logger.LogError(s.c, fmt.Sprintf("realtime pipeline channel error (channel #%d, status code: %d): %s", channel.Id, newAPIError.StatusCode, newAPIError.Error()))
+	channelError := types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan())
+	if channelError.IsMultiKey {
+		model.RecordChannelKeyError(channelError.ChannelId, channelError.UsingKey, newAPIError.Error())
+	}
+	if service.ShouldDisableChannel(channelError.ChannelType, newAPIError) && channelError.AutoBan {
+		gopool.Go(func() {
+			service.DisableChannel(*channelError, newAPIError.Error())
+		})
+	}
+}
+
+// shouldRetryRealtimeLeg 渠道不可用、限流或上游 5xx 时切换渠道重试，超时与请求本身的错误不重试
+func shouldRetryRealtimeLeg(newAPIError *types.NewAPIError) bool {
+	if types.IsChannelError(newAPIError) {
+		return true
+	}
+	if types.IsSkipRetryError(newAPIError) {
+		return false
+	}
+	switch {
+	case newAPIError.StatusCode == http.StatusTooManyRequests:
+		return true
+	case newAPIError.StatusCode == http.StatusGatewayTimeout || newAPIError.StatusCode == 524:
+		return false
+	case newAPIError.StatusCode/100 == 5:
+		return true
+	}
+	return false
+}
+
+// updateLegChannelQuota 按会话价格将环节的用量计入实际调用的渠道
+func (s *realtimePipelineSession) updateLegChannelQuota(channelId int, usage *dto.RealtimeUsage) {
+	if channelId == 0 || usage.TotalTokens == 0 {
+		return
+	}
+	model.UpdateChannelUsedQuota(channelId, service.GetRealtimeUsageQuota(s.info, usage))
+}
+
+// pcm16ToWav 为 16bit 单声道 PCM 数据添加 WAV 头
+func pcm16ToWav(pcm []byte, sampleRate int) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(pcm)+44))
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1)) // mono
+	_ = binary.Write(buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(sampleRate*2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -62,6 +63,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			modelPrice = defaultPrice
 		}
 	}
+	pricingWindow, hasPricingWindow := ratio_setting.GetActivePricingWindow(modelName, info.UsingGroup, time.Now())
+	if hasPricingWindow {
+		modelPrice = pricingWindow.ApplyPrice(modelPrice)
+	}
 
 	// 预扣
 	groupRatio := ratio_setting.GetGroupRatio(info.UsingGroup)
@@ -83,7 +88,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		}
 	}
 	println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
-	userQuota, err := model.GetUserQuota(info.UserId, false)
+	userQuota, err := service.GetBillingQuota(info)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -181,6 +186,9 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
 				}
+				if hasPricingWindow {
+					other["pricing_window"] = pricingWindow.Name
+				}
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
 					ChannelId: info.ChannelId,
 					ModelName: modelName,
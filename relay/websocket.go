@@ -6,6 +6,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,15 @@ func WssHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
+
+	if pipeline, ok := model_setting.GetRealtimePipeline(info.OriginModelName); ok {
+		newAPIError, usage := RealtimePipelineHelper(c, info, pipeline)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		service.PostWssConsumeQuota(c, info, info.OriginModelName, usage, "")
+		return nil
+	}
 	//var requestBody io.Reader
 	//firstWssRequest, _ := c.Get("first_wss_request")
 	//requestBody = bytes.NewBuffer(firstWssRequest.([]byte))
@@ -17,6 +17,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
+		apiRouter.GET("/status_page", controller.GetStatusPage)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
 		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
@@ -32,6 +33,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), controller.GitHubOAuth)
 		apiRouter.GET("/oauth/discord", middleware.CriticalRateLimit(), controller.DiscordOAuth)
 		apiRouter.GET("/oauth/oidc", middleware.CriticalRateLimit(), controller.OidcAuth)
+		apiRouter.GET("/oauth/oidc/:provider", middleware.CriticalRateLimit(), controller.OidcProviderAuth)
+		apiRouter.GET("/oauth/oidc/:provider/login", middleware.CriticalRateLimit(), controller.OidcProviderLogin)
 		apiRouter.GET("/oauth/linuxdo", middleware.CriticalRateLimit(), controller.LinuxdoOAuth)
 		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), controller.GenerateOAuthCode)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), controller.WeChatAuth)
@@ -39,6 +42,10 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), controller.EmailBind)
 		apiRouter.GET("/oauth/telegram/login", middleware.CriticalRateLimit(), controller.TelegramLogin)
 		apiRouter.GET("/oauth/telegram/bind", middleware.CriticalRateLimit(), controller.TelegramBind)
+		apiRouter.GET("/oauth/saml", middleware.CriticalRateLimit(), controller.SamlAuth)
+		apiRouter.GET("/saml/metadata", controller.SamlMetadata)
+		apiRouter.GET("/saml/login", middleware.CriticalRateLimit(), controller.SamlLogin)
+		apiRouter.POST("/saml/acs", middleware.CriticalRateLimit(), controller.SamlACS)
 		apiRouter.GET("/ratio_config", middleware.CriticalRateLimit(), controller.GetRatioConfig)
 
 		apiRouter.POST("/stripe/webhook", controller.StripeWebhook)
@@ -52,6 +59,7 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/ldap", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.LdapLogin)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Verify2FALogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
@@ -84,6 +92,15 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
 				selfRoute.POST("/stripe/amount", controller.RequestStripeAmount)
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
+				selfRoute.GET("/billing_profile", controller.GetSelfBillingProfile)
+				selfRoute.PUT("/billing_profile", controller.UpdateSelfBillingProfile)
+				selfRoute.GET("/invoice", controller.GetSelfInvoices)
+				selfRoute.GET("/invoice/:id/html", controller.GetSelfInvoiceHTML)
+				selfRoute.GET("/subscription/plans", controller.GetSubscriptionPlans)
+				selfRoute.GET("/subscription/self", controller.GetSelfSubscription)
+				selfRoute.POST("/subscription/pay", middleware.CriticalRateLimit(), controller.RequestSubscriptionPay)
+				selfRoute.POST("/subscription/upgrade", middleware.CriticalRateLimit(), controller.UpgradeSelfSubscription)
+				selfRoute.POST("/subscription/cancel", middleware.CriticalRateLimit(), controller.CancelSelfSubscription)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 
@@ -101,6 +118,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", controller.AdminRefundTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
@@ -120,6 +138,11 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
+			optionRoute.POST("/rotate_secrets", middleware.CriticalRateLimit(), controller.RotateSecrets)
+			optionRoute.GET("/revision", controller.GetOptionRevisions)
+			optionRoute.GET("/revision/:id/diff", controller.GetOptionRevisionDiff)
+			optionRoute.POST("/revision/:id/rollback", controller.RollbackOptionRevision)
+			optionRoute.DELETE("/revision/:id", controller.CancelOptionRevision)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
@@ -135,7 +158,15 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/queue", controller.GetChannelQueue)
+			channelRoute.GET("/probe/results", controller.GetChannelProbeResults)
+			channelRoute.GET("/probe/stats", controller.GetChannelProbeStats)
+			channelRoute.GET("/probe/slo", controller.GetChannelProbeSlo)
+			channelRoute.POST("/probe/run", controller.RunChannelProbe)
 			channelRoute.GET("/:id", controller.GetChannel)
+			channelRoute.GET("/:id/usage", controller.GetChannelUsageLimit)
+			channelRoute.POST("/:id/usage/reset", controller.ResetChannelUsageLimit)
+			channelRoute.GET("/:id/rate_limit", controller.GetChannelUpstreamRateLimit)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -156,7 +187,39 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/tag/models", controller.GetTagModels)
 			channelRoute.POST("/copy/:id", controller.CopyChannel)
 			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
+			channelRoute.POST("/multi_key/export", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.ExportMultiKeys)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			orgAdminRoute := organizationRoute.Group("/admin")
+			orgAdminRoute.Use(middleware.AdminAuth())
+			{
+				orgAdminRoute.GET("/", controller.GetAllOrganizations)
+				orgAdminRoute.PUT("/", controller.AdminUpdateOrganization)
+				orgAdminRoute.DELETE("/:id", controller.AdminDeleteOrganization)
+			}
+
+			orgSelfRoute := organizationRoute.Group("/")
+			orgSelfRoute.Use(middleware.UserAuth())
+			{
+				orgSelfRoute.GET("/", controller.GetSelfOrganizations)
+				orgSelfRoute.POST("/", controller.CreateOrganization)
+				orgSelfRoute.GET("/:id", controller.GetOrganization)
+				orgSelfRoute.PUT("/:id", controller.UpdateOrganization)
+				orgSelfRoute.DELETE("/:id", controller.DeleteOrganization)
+				orgSelfRoute.GET("/:id/member", controller.GetOrganizationMembers)
+				orgSelfRoute.POST("/:id/member", controller.AddOrganizationMember)
+				orgSelfRoute.PUT("/:id/member", controller.UpdateOrganizationMember)
+				orgSelfRoute.DELETE("/:id/member/:user_id", controller.RemoveOrganizationMember)
+				orgSelfRoute.GET("/:id/token", controller.GetOrganizationTokens)
+				orgSelfRoute.POST("/:id/token", controller.AddOrganizationToken)
+				orgSelfRoute.PUT("/:id/token", controller.UpdateOrganizationToken)
+				orgSelfRoute.DELETE("/:id/token/:token_id", controller.DeleteOrganizationToken)
+				orgSelfRoute.POST("/:id/transfer", middleware.CriticalRateLimit(), controller.TransferOrganizationQuota)
+				orgSelfRoute.GET("/:id/log", controller.GetOrganizationLogs)
+			}
+		}
+
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
 		{
@@ -193,12 +256,27 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
+		logRoute.GET("/margin", middleware.RootAuth(), controller.GetMarginReport)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.RootAuth())
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+		}
+
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth())
+		{
+			configRoute.GET("/export", controller.ExportConfig)
+			configRoute.POST("/import", middleware.CriticalRateLimit(), controller.ImportConfig)
+		}
+
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
@@ -213,6 +291,26 @@ func SetApiRouter(router *gin.Engine) {
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
+		subscriptionRoute := apiRouter.Group("/subscription")
+		subscriptionRoute.Use(middleware.AdminAuth())
+		{
+			subscriptionRoute.GET("/", controller.GetAllSubscriptions)
+			subscriptionRoute.GET("/plan", controller.GetAllSubscriptionPlans)
+			subscriptionRoute.POST("/plan", controller.CreateSubscriptionPlan)
+			subscriptionRoute.PUT("/plan", controller.UpdateSubscriptionPlan)
+			subscriptionRoute.DELETE("/plan/:id", controller.DeleteSubscriptionPlan)
+		}
+
+		invoiceRoute := apiRouter.Group("/invoice")
+		invoiceRoute.Use(middleware.AdminAuth())
+		{
+			invoiceRoute.GET("/", controller.GetAllInvoices)
+			invoiceRoute.GET("/export", controller.ExportInvoices)
+			invoiceRoute.POST("/issue", controller.IssueInvoice)
+			invoiceRoute.GET("/:id/html", controller.GetInvoiceHTML)
+			invoiceRoute.POST("/:id/credit_note", controller.CreateCreditNote)
+		}
+
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
 		prefillGroupRoute.Use(middleware.AdminAuth())
 		{
@@ -222,6 +320,16 @@ func SetApiRouter(router *gin.Engine) {
 			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
 		}
 
+		statusIncidentRoute := apiRouter.Group("/status_page/incident")
+		statusIncidentRoute.Use(middleware.AdminAuth())
+		{
+			statusIncidentRoute.GET("/", controller.GetStatusIncidents)
+			statusIncidentRoute.GET("/:id", controller.GetStatusIncident)
+			statusIncidentRoute.POST("/", controller.CreateStatusIncident)
+			statusIncidentRoute.PUT("/", controller.UpdateStatusIncident)
+			statusIncidentRoute.DELETE("/:id", controller.DeleteStatusIncident)
+		}
+
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
 		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
@@ -229,6 +337,7 @@ func SetApiRouter(router *gin.Engine) {
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
+			taskRoute.POST("/self/:task_id/cancel", middleware.UserAuth(), controller.CancelUserTask)
 			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
 		}
 
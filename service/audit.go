@@ -0,0 +1,198 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditMaskedValue = "******"
+
+// AuditChange 是审计日志中的单个字段变更，Field 为 a.b.c 形式的路径
+type AuditChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// RecordAudit 记录一次管理操作。before / after 为变更前后的对象，创建时 before 传 nil，删除时 after 传 nil。
+// 敏感字段（密钥、密码、令牌等）在快照与差异中都会被脱敏，写入失败只记录系统日志，不影响业务操作。
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	beforeValue := normalizeAuditValue(before)
+	afterValue := normalizeAuditValue(after)
+	// 创建与删除时按空对象对比，差异中同样列出每个字段
+	diffBefore, diffAfter := beforeValue, afterValue
+	if _, ok := afterValue.(map[string]any); ok && diffBefore == nil {
+		diffBefore = map[string]any{}
+	}
+	if _, ok := beforeValue.(map[string]any); ok && diffAfter == nil {
+		diffAfter = map[string]any{}
+	}
+	changes := diffAuditValues("", diffBefore, diffAfter, nil)
+	if action == model.AuditActionUpdate && len(changes) == 0 {
+		return
+	}
+
+	entry := &model.AuditLog{
+		CreatedAt:  common.GetTimestamp(),
+		UserId:     c.GetInt("id"),
+		Username:   c.GetString("username"),
+		Ip:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+	}
+	if c.GetBool("use_access_token") {
+		entry.AuthMethod = "access_token"
+		// access token 本身不落库，只记录不可逆的指纹以便关联
+		accessToken := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		entry.CredentialId = common.GenerateHMAC(accessToken)[:16]
+	} else {
+		entry.AuthMethod = "session"
+		entry.CredentialId = c.GetString("session_id")
+	}
+	if before != nil {
+		entry.Before = auditJson(maskAuditValue("", beforeValue))
+	}
+	if after != nil {
+		entry.After = auditJson(maskAuditValue("", afterValue))
+	}
+	entry.Diff = auditJson(changes)
+
+	if err := model.InsertAuditLog(entry); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record audit log: %s %s %s: %s", action, targetType, entry.TargetId, err.Error()))
+	}
+}
+
+// normalizeAuditValue 将对象转换为通用的 JSON 结构，内容为 JSON 的字符串字段（如倍率配置）会被展开以便逐项对比
+func normalizeAuditValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := common.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var result any
+	if err := common.Unmarshal(data, &result); err != nil {
+		return string(data)
+	}
+	return expandAuditJsonStrings(result)
+}
+
+func expandAuditJsonStrings(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, item := range value {
+			value[k] = expandAuditJsonStrings(item)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = expandAuditJsonStrings(item)
+		}
+		return value
+	case string:
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var parsed any
+			if err := common.UnmarshalJsonStr(trimmed, &parsed); err == nil {
+				return expandAuditJsonStrings(parsed)
+			}
+		}
+		return value
+	}
+	return v
+}
+
+func isSensitiveAuditField(field string) bool {
+	name := strings.ToLower(field)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, keyword := range []string{"password", "secret", "private", "credential", "authorization"} {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, "key") || strings.HasSuffix(name, "token") || strings.HasSuffix(name, "keys")
+}
+
+func maskAuditValue(path string, v any) any {
+	if path != "" && isSensitiveAuditField(path) {
+		if v == nil || v == "" {
+			return v
+		}
+		return auditMaskedValue
+	}
+	switch value := v.(type) {
+	case map[string]any:
+		masked := make(map[string]any, len(value))
+		for k, item := range value {
+			masked[k] = maskAuditValue(joinAuditPath(path, k), item)
+		}
+		return masked
+	case []any:
+		masked := make([]any, len(value))
+		for i, item := range value {
+			masked[i] = maskAuditValue(path, item)
+		}
+		return masked
+	}
+	return v
+}
+
+// diffAuditValues 逐字段对比，敏感字段只记录发生了变化而不记录具体值
+func diffAuditValues(path string, before any, after any, changes []AuditChange) []AuditChange {
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if beforeIsMap && afterIsMap && !(path != "" && isSensitiveAuditField(path)) {
+		keys := make([]string, 0, len(beforeMap)+len(afterMap))
+		for k := range beforeMap {
+			keys = append(keys, k)
+		}
+		for k := range afterMap {
+			if _, ok := beforeMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			changes = diffAuditValues(joinAuditPath(path, k), beforeMap[k], afterMap[k], changes)
+		}
+		return changes
+	}
+	if auditJson(before) == auditJson(after) {
+		return changes
+	}
+	return append(changes, AuditChange{
+		Field:  path,
+		Before: maskAuditValue(path, before),
+		After:  maskAuditValue(path, after),
+	})
+}
+
+// DiffOptionValues 对比配置项的两个值，JSON 内容（如倍率）逐项对比，敏感配置项只标记发生了变化
+func DiffOptionValues(key string, before string, after string) []AuditChange {
+	return diffAuditValues(key, normalizeAuditValue(before), normalizeAuditValue(after), nil)
+}
+
+func joinAuditPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func auditJson(v any) string {
+	data, err := common.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteRequirements 虚拟模型解析时请求需要满足的能力
+type RouteRequirements struct {
+	Modalities   []string // 除文本外的输入模态，如 image、audio
+	Tools        bool
+	JsonSchema   bool
+	Reasoning    bool
+	PromptTokens int
+	MaxTokens    int
+}
+
+// NewRouteRequirements 从请求的 token 统计信息中提取模态与 token 需求
+func NewRouteRequirements(meta *types.TokenCountMeta, promptTokens int) RouteRequirements {
+	req := RouteRequirements{
+		PromptTokens: promptTokens,
+	}
+	if meta == nil {
+		return req
+	}
+	req.MaxTokens = meta.MaxTokens
+	req.Tools = meta.ToolsCount > 0
+	for _, file := range meta.Files {
+		if file == nil {
+			continue
+		}
+		if modality := string(file.FileType); !slices.Contains(req.Modalities, modality) {
+			req.Modalities = append(req.Modalities, modality)
+		}
+	}
+	return req
+}
+
+// satisfies 判断模型能力是否满足请求；未配置能力元数据的模型只能处理纯文本且无特殊需求的请求
+func (r RouteRequirements) satisfies(capabilities *dto.ModelCapabilities) bool {
+	if capabilities == nil {
+		return len(r.Modalities) == 0 && !r.Tools && !r.JsonSchema && !r.Reasoning
+	}
+	for _, modality := range r.Modalities {
+		if capabilities.InputModalities == "" || !capabilities.SupportsInputModality(modality) {
+			return false
+		}
+	}
+	// 结构化输出与工具调用依赖同一类能力，按 supports_tools 判断
+	if (r.Tools || r.JsonSchema) && !capabilities.SupportsTools {
+		return false
+	}
+	if r.Reasoning && !capabilities.SupportsReasoning {
+		return false
+	}
+	if capabilities.ContextWindow > 0 && r.PromptTokens+r.MaxTokens > capabilities.ContextWindow {
+		return false
+	}
+	return true
+}
+
+// estimateRouteCost 按模型倍率或固定价格与分组倍率估算请求费用，仅用于候选模型之间比较
+func estimateRouteCost(modelName string, userGroup string, group string, req RouteRequirements) float64 {
+	groupRatio, ok := ratio_setting.GetGroupGroupRatio(userGroup, group)
+	if !ok {
+		groupRatio = ratio_setting.GetGroupRatio(group)
+	}
+	if price, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+		return price * common.QuotaPerUnit * groupRatio
+	}
+	completionTokens := req.MaxTokens
+	if completionTokens <= 0 {
+		completionTokens = model_setting.GetAutoRoutingSettings().DefaultCompletionTokens
+	}
+	modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+	completionRatio := ratio_setting.GetCompletionRatio(modelName)
+	return (float64(req.PromptTokens) + float64(completionTokens)*completionRatio) * modelRatio * groupRatio
+}
+
+// ResolveVirtualModel 在用户可用分组中为虚拟模型选择满足请求能力且费用最低的模型与分组。
+// allowed 用于令牌模型限制，为 nil 时不限制。
+func ResolveVirtualModel(c *gin.Context, virtualModelName string, group string, req RouteRequirements, allowed func(string) bool) (string, string, error) {
+	virtualModel, ok := model_setting.GetVirtualModel(virtualModelName)
+	if !ok {
+		return "", "", fmt.Errorf("virtual model %s not found", virtualModelName)
+	}
+	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	groups := []string{group}
+	if group == "auto" {
+		groups = GetContextUserAutoGroup(c)
+	}
+
+	bestModel, bestGroup := "", ""
+	bestCost := math.MaxFloat64
+	for _, g := range groups {
+		for _, modelName := range model.CacheGetGroupEnabledModels(g) {
+			if len(virtualModel.Candidates) > 0 && !slices.Contains(virtualModel.Candidates, modelName) {
+				continue
+			}
+			if _, isVirtual := model_setting.GetVirtualModel(modelName); isVirtual {
+				continue
+			}
+			if allowed != nil && !allowed(modelName) {
+				continue
+			}
+			if !req.satisfies(model.GetModelCapabilities(modelName)) {
+				continue
+			}
+			cost := estimateRouteCost(modelName, userGroup, g, req)
+			// 费用相同时按模型名排序，保证结果稳定
+			if cost < bestCost || (cost == bestCost && modelName < bestModel) {
+				bestModel, bestGroup, bestCost = modelName, g, cost
+			}
+		}
+	}
+	if bestModel == "" {
+		return "", "", errors.New("no model satisfies the request requirements")
+	}
+	return bestModel, bestGroup, nil
+}
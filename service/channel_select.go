@@ -3,8 +3,6 @@ package service
 import (
 	"errors"
 
-	"github.com/QuantumNous/new-api/common"
-	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
@@ -15,15 +13,18 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 	var channel *model.Channel
 	var err error
 	selectGroup := group
-	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
 	if group == "auto" {
 		if len(setting.GetAutoGroups()) == 0 {
 			return nil, selectGroup, errors.New("auto groups is not enabled")
 		}
-		for _, autoGroup := range GetUserAutoGroup(userGroup) {
+		busy := false
+		for _, autoGroup := range GetContextUserAutoGroup(c) {
 			logger.LogDebug(c, "Auto selecting group:", autoGroup)
-			channel, _ = model.GetRandomSatisfiedChannel(autoGroup, modelName, retry)
+			channel, err = model.GetRandomSatisfiedChannel(autoGroup, modelName, retry)
 			if channel == nil {
+				if errors.Is(err, model.ErrAllChannelsBusy) {
+					busy = true
+				}
 				continue
 			} else {
 				c.Set("auto_group", autoGroup)
@@ -32,6 +33,10 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 				break
 			}
 		}
+		// 所有分组均无空闲渠道且存在繁忙渠道时，交由调用方排队等待
+		if channel == nil && busy {
+			return nil, selectGroup, model.ErrAllChannelsBusy
+		}
 	} else {
 		channel, err = model.GetRandomSatisfiedChannel(group, modelName, retry)
 		if err != nil {
@@ -40,3 +45,15 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 	}
 	return channel, selectGroup, nil
 }
+
+// GetCandidateChannelIds 返回分组下可提供该模型的渠道，auto 分组合并用户可用的全部自动分组
+func GetCandidateChannelIds(c *gin.Context, group string, modelName string) []int {
+	if group != "auto" {
+		return model.GetGroupModelChannelIds(group, modelName)
+	}
+	var ids []int
+	for _, autoGroup := range GetContextUserAutoGroup(c) {
+		ids = append(ids, model.GetGroupModelChannelIds(autoGroup, modelName)...)
+	}
+	return ids
+}
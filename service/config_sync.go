@@ -0,0 +1,214 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatJSON = "json"
+)
+
+// ConfigChange 是导入预览中的一项变更，Changes 中的敏感字段已脱敏
+type ConfigChange struct {
+	Section string        `json:"section"` // channel / option / vendor / model / prefill_group
+	Name    string        `json:"name"`
+	Action  string        `json:"action"` // create / update / delete
+	Changes []AuditChange `json:"changes,omitempty"`
+}
+
+// EncodeConfigDocument 将配置文档编码为 YAML 或 JSON，两种格式的字段名与顺序一致
+func EncodeConfigDocument(doc *model.ConfigDocument, format string) ([]byte, error) {
+	data, err := common.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case ConfigFormatJSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case ConfigFormatYAML, "":
+		// JSON 是 YAML 的子集，解析为节点后改为块格式输出，保留结构体的字段顺序
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		resetYamlStyle(&node)
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config format: %s", format)
+}
+
+func resetYamlStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYamlStyle(child)
+	}
+}
+
+// DecodeConfigDocument 解析 YAML 或 JSON 格式的配置文档
+func DecodeConfigDocument(data []byte) (*model.ConfigDocument, error) {
+	doc := &model.ConfigDocument{}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if err := common.Unmarshal(trimmed, doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	jsonData, err := common.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := common.Unmarshal(jsonData, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// PlanConfigImport 对比待导入文档与当前配置，返回导入将产生的变更，不修改任何数据。
+// 文档需先经过 model.PrepareConfigDocument 处理。
+func PlanConfigImport(doc *model.ConfigDocument, prune bool) ([]ConfigChange, error) {
+	current, err := model.ExportConfigDocument(model.ConfigKeyModePlain)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]ConfigChange, 0)
+
+	currentChannels := make(map[string]any, len(current.Channels))
+	currentKeys := make(map[string]string, len(current.Channels))
+	for _, channel := range current.Channels {
+		currentChannels[channel.Name] = channel
+		currentKeys[channel.Name] = channel.Key
+	}
+	incomingChannels := make(map[string]any, len(doc.Channels))
+	for _, channel := range doc.Channels {
+		if key, ok := currentKeys[channel.Name]; ok && channel.Key == "" {
+			// 未提供密钥时保留现有密钥，不算作变更
+			channel.Key = key
+		}
+		incomingChannels[channel.Name] = channel
+	}
+	plan = planConfigSection(plan, "channel", currentChannels, incomingChannels, prune)
+
+	currentVendors := make(map[string]any, len(current.Vendors))
+	for _, vendor := range current.Vendors {
+		currentVendors[vendor.Name] = vendor
+	}
+	incomingVendors := make(map[string]any, len(doc.Vendors))
+	for _, vendor := range doc.Vendors {
+		incomingVendors[vendor.Name] = vendor
+	}
+	plan = planConfigSection(plan, "vendor", currentVendors, incomingVendors, prune)
+
+	currentModels := make(map[string]any, len(current.Models))
+	for _, m := range current.Models {
+		currentModels[m.ModelName] = m
+	}
+	incomingModels := make(map[string]any, len(doc.Models))
+	for _, m := range doc.Models {
+		incomingModels[m.ModelName] = m
+	}
+	plan = planConfigSection(plan, "model", currentModels, incomingModels, prune)
+
+	currentGroups := make(map[string]any, len(current.PrefillGroups))
+	for _, group := range current.PrefillGroups {
+		currentGroups[group.Name] = group
+	}
+	incomingGroups := make(map[string]any, len(doc.PrefillGroups))
+	for _, group := range doc.PrefillGroups {
+		incomingGroups[group.Name] = group
+	}
+	plan = planConfigSection(plan, "prefill_group", currentGroups, incomingGroups, prune)
+
+	// 配置项只会新增或修改，不参与 prune
+	keys := make([]string, 0, len(doc.Options))
+	for key := range doc.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		before, exists := current.Options[key]
+		if exists && before == doc.Options[key] {
+			continue
+		}
+		changes := DiffOptionValues(key, before, doc.Options[key])
+		action := model.AuditActionUpdate
+		if !exists {
+			action = model.AuditActionCreate
+		}
+		plan = append(plan, ConfigChange{Section: "option", Name: key, Action: action, Changes: changes})
+	}
+	return plan, nil
+}
+
+func planConfigSection(plan []ConfigChange, section string, current map[string]any, incoming map[string]any, prune bool) []ConfigChange {
+	names := make([]string, 0, len(current)+len(incoming))
+	for name := range incoming {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := incoming[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		before, inCurrent := current[name]
+		after, inIncoming := incoming[name]
+		switch {
+		case inCurrent && inIncoming:
+			changes := diffAuditValues("", normalizeAuditValue(before), normalizeAuditValue(after), nil)
+			if len(changes) > 0 {
+				plan = append(plan, ConfigChange{Section: section, Name: name, Action: model.AuditActionUpdate, Changes: changes})
+			}
+		case inIncoming:
+			changes := diffAuditValues("", map[string]any{}, normalizeAuditValue(after), nil)
+			plan = append(plan, ConfigChange{Section: section, Name: name, Action: model.AuditActionCreate, Changes: changes})
+		case prune:
+			plan = append(plan, ConfigChange{Section: section, Name: name, Action: model.AuditActionDelete})
+		}
+	}
+	return plan
+}
+
+// FormatConfigPlan 将导入预览格式化为便于在终端或代码评审中阅读的文本
+func FormatConfigPlan(plan []ConfigChange) string {
+	if len(plan) == 0 {
+		return "no changes\n"
+	}
+	var sb strings.Builder
+	for _, change := range plan {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", change.Action, change.Section, change.Name))
+		for _, field := range change.Changes {
+			sb.WriteString(fmt.Sprintf("    %s: %s -> %s\n", field.Field, auditJson(field.Before), auditJson(field.After)))
+		}
+	}
+	return sb.String()
+}
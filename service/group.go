@@ -1,10 +1,16 @@
 package service
 
 import (
+	"slices"
 	"strings"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
 )
 
 func GetUserUsableGroups(userGroup string) map[string]string {
@@ -36,6 +42,25 @@ func GetUserUsableGroups(userGroup string) map[string]string {
 	return groupsCopy
 }
 
+// FilterAllowedTokenGroups 按用户设置中的令牌分组限制过滤可用分组，未设置限制时原样返回
+func FilterAllowedTokenGroups(groups map[string]string, userSetting dto.UserSetting) map[string]string {
+	if len(userSetting.AllowedTokenGroups) == 0 {
+		return groups
+	}
+	filtered := make(map[string]string, len(userSetting.AllowedTokenGroups))
+	for _, group := range userSetting.AllowedTokenGroups {
+		if desc, ok := groups[group]; ok {
+			filtered[group] = desc
+		}
+	}
+	return filtered
+}
+
+// IsTokenGroupAllowed 判断分组是否在用户设置的令牌分组限制内，未设置限制时返回 true
+func IsTokenGroupAllowed(group string, userSetting dto.UserSetting) bool {
+	return len(userSetting.AllowedTokenGroups) == 0 || slices.Contains(userSetting.AllowedTokenGroups, group)
+}
+
 func GroupInUserUsableGroups(userGroup, groupName string) bool {
 	_, ok := GetUserUsableGroups(userGroup)[groupName]
 	return ok
@@ -53,6 +78,22 @@ func GetUserAutoGroup(userGroup string) []string {
 	return autoGroups
 }
 
+// GetContextUserAutoGroup 获取当前请求用户的自动分组，并按令牌分组限制过滤
+func GetContextUserAutoGroup(c *gin.Context) []string {
+	autoGroups := GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	userSetting, _ := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
+	if len(userSetting.AllowedTokenGroups) == 0 {
+		return autoGroups
+	}
+	filtered := make([]string, 0, len(autoGroups))
+	for _, group := range autoGroups {
+		if IsTokenGroupAllowed(group, userSetting) {
+			filtered = append(filtered, group)
+		}
+	}
+	return filtered
+}
+
 // GetUserGroupRatio 获取用户使用某个分组的倍率
 // userGroup 用户分组
 // group 需要获取倍率的分组
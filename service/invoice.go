@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	},
+	"percent": func(v float64) string {
+		return strconv.FormatFloat(v*100, 'f', -1, 64) + "%"
+	},
+	"date": func(ts int64) string {
+		return time.Unix(ts, 0).Format("2006-01-02")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Invoice.InvoiceNo}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 800px; margin: 40px auto; padding: 0 24px; }
+h1 { font-size: 28px; margin-bottom: 4px; }
+table { width: 100%; border-collapse: collapse; margin-top: 24px; }
+th, td { text-align: left; padding: 8px; border-bottom: 1px solid #ddd; }
+td.num, th.num { text-align: right; }
+.parties { display: flex; justify-content: space-between; margin-top: 32px; }
+.parties div { width: 48%; white-space: pre-line; }
+.muted { color: #777; }
+.totals td { border: none; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="muted">No. {{.Invoice.InvoiceNo}} · {{date .Invoice.CreatedTime}}{{if .Related}} · Original invoice {{.Related.InvoiceNo}}{{end}}</div>
+<div class="parties">
+<div><strong>From</strong>
+{{.Seller.SellerName}}{{if .Seller.SellerTaxId}}
+Tax ID: {{.Seller.SellerTaxId}}{{end}}
+{{.Seller.SellerAddress}}</div>
+<div><strong>Bill to</strong>
+{{if .Invoice.CompanyName}}{{.Invoice.CompanyName}}{{else}}{{.Username}}{{end}}{{if .Invoice.TaxId}}
+Tax ID: {{.Invoice.TaxId}}{{end}}
+{{.Invoice.Address}}{{if .Invoice.Country}}
+{{.Invoice.Country}}{{end}}{{if .Invoice.Email}}
+{{.Invoice.Email}}{{end}}</div>
+</div>
+<table>
+<tr><th>Description</th><th class="num">Amount ({{.Invoice.Currency}})</th></tr>
+<tr><td>{{.Invoice.Description}}<div class="muted">Order {{.Invoice.TradeNo}} · {{.Invoice.PaymentMethod}}</div></td><td class="num">{{money .Invoice.Subtotal}}</td></tr>
+</table>
+<table class="totals">
+<tr><td class="num">Subtotal</td><td class="num">{{money .Invoice.Subtotal}}</td></tr>
+<tr><td class="num">Tax ({{percent .Invoice.TaxRate}})</td><td class="num">{{money .Invoice.TaxAmount}}</td></tr>
+<tr><td class="num"><strong>Total</strong></td><td class="num"><strong>{{.Invoice.Currency}} {{money .Invoice.Total}}</strong></td></tr>
+</table>
+<p class="muted">{{.SystemName}}</p>
+</body>
+</html>
+`))
+
+// RenderInvoiceHTML 生成可打印的 HTML 发票，浏览器中可直接打印或另存为 PDF
+func RenderInvoiceHTML(invoice *model.Invoice) ([]byte, error) {
+	title := "Invoice"
+	var related *model.Invoice
+	if invoice.Type == model.InvoiceTypeCreditNote {
+		title = "Credit Note"
+		related, _ = model.GetInvoiceById(invoice.RelatedInvoiceId)
+	}
+	username, _ := model.GetUsernameById(invoice.UserId, false)
+	var buf bytes.Buffer
+	err := invoiceTemplate.Execute(&buf, map[string]any{
+		"Title":      title,
+		"Invoice":    invoice,
+		"Related":    related,
+		"Seller":     operation_setting.GetInvoiceSetting(),
+		"Username":   username,
+		"SystemName": common.SystemName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -45,10 +45,19 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	if relayInfo.ReasoningEffort != "" {
 		other["reasoning_effort"] = relayInfo.ReasoningEffort
 	}
+	if relayInfo.PriceData.PricingTier != "" {
+		other["pricing_tier"] = relayInfo.PriceData.PricingTier
+	}
+	if relayInfo.PriceData.PricingWindow != "" {
+		other["pricing_window"] = relayInfo.PriceData.PricingWindow
+	}
 	if relayInfo.IsModelMapped {
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if virtualModel := common.GetContextKeyString(ctx, constant.ContextKeyVirtualModel); virtualModel != "" {
+		other["virtual_model"] = virtualModel
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
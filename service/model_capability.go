@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// CheckModelCapabilities 按模型能力元数据校验请求：估算输入 token 加 max_tokens 不得超过上下文长度，
+// 且请求中的图片、音频等文件必须是模型支持的输入模态。未配置能力元数据的模型不做校验。
+func CheckModelCapabilities(modelName string, promptTokens int, meta *types.TokenCountMeta) error {
+	if !model_setting.GetGlobalSettings().CapabilityCheckEnabled || meta == nil {
+		return nil
+	}
+	capabilities := model.GetModelCapabilities(modelName)
+	if capabilities == nil {
+		return nil
+	}
+	if capabilities.ContextWindow > 0 && promptTokens+meta.MaxTokens > capabilities.ContextWindow {
+		return fmt.Errorf("this model's maximum context length is %d tokens, but the request uses about %d tokens (%d in the prompt, %d for max_tokens)",
+			capabilities.ContextWindow, promptTokens+meta.MaxTokens, promptTokens, meta.MaxTokens)
+	}
+	for _, file := range meta.Files {
+		if file == nil {
+			continue
+		}
+		if modality := string(file.FileType); !capabilities.SupportsInputModality(modality) {
+			return fmt.Errorf("model %s does not support %s input", modelName, modality)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// GetBillingQuota 返回本次请求计费主体的剩余额度，组织令牌使用组织额度池（受成员限额约束），否则使用用户额度
+func GetBillingQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	if relayInfo.OrganizationId != 0 {
+		return model.GetOrganizationBillingQuota(relayInfo.OrganizationId, relayInfo.UserId)
+	}
+	return model.GetUserQuota(relayInfo.UserId, false)
+}
+
+func billingSubject(relayInfo *relaycommon.RelayInfo) string {
+	if relayInfo.OrganizationId != 0 {
+		return "组织"
+	}
+	return "用户"
+}
@@ -47,6 +47,53 @@ func hasCustomModelRatio(modelName string, currentRatio float64) bool {
 	return currentRatio != defaultRatio
 }
 
+// ApplyPricingTier 在结算时按实际输入 tokens 选择分段计费规则，用命中规则中的倍率覆盖 PriceData，
+// 需要在读取 PriceData 中的倍率前调用。按次计费的模型不参与分段计费。
+func ApplyPricingTier(relayInfo *relaycommon.RelayInfo, promptTokens int) {
+	if relayInfo.PriceData.UsePrice {
+		return
+	}
+	tier, ok := ratio_setting.GetPricingTier(relayInfo.OriginModelName, promptTokens, getRequestServiceTier(relayInfo), relayInfo.ReasoningEffort)
+	if !ok {
+		return
+	}
+	priceData := &relayInfo.PriceData
+	if tier.ModelRatio != nil {
+		priceData.ModelRatio = *tier.ModelRatio
+		// 定时计费规则在分段倍率的基础上继续生效
+		priceData.ModelRatio = priceData.ApplyPricingWindowRatio(priceData.ModelRatio)
+	}
+	if tier.CompletionRatio != nil {
+		priceData.CompletionRatio = *tier.CompletionRatio
+	}
+	if tier.CacheRatio != nil {
+		priceData.CacheRatio = *tier.CacheRatio
+	}
+	if tier.CacheCreationRatio != nil {
+		// 1h 缓存写入价格与 5m 保持原有比例
+		if priceData.CacheCreation5mRatio != 0 {
+			priceData.CacheCreation1hRatio = priceData.CacheCreation1hRatio / priceData.CacheCreation5mRatio * *tier.CacheCreationRatio
+		}
+		priceData.CacheCreationRatio = *tier.CacheCreationRatio
+		priceData.CacheCreation5mRatio = *tier.CacheCreationRatio
+	}
+	priceData.PricingTier = tier.Name
+}
+
+// getRequestServiceTier 返回实际发往上游的 service_tier，渠道未允许透传时视为默认层级
+func getRequestServiceTier(relayInfo *relaycommon.RelayInfo) string {
+	if relayInfo.ChannelMeta == nil || !relayInfo.ChannelOtherSettings.AllowServiceTier {
+		return ""
+	}
+	switch request := relayInfo.Request.(type) {
+	case *dto.OpenAIResponsesRequest:
+		return request.ServiceTier
+	case *dto.ClaudeRequest:
+		return request.ServiceTier
+	}
+	return ""
+}
+
 func calculateAudioQuota(info QuotaInfo) int {
 	if info.UsePrice {
 		modelPrice := decimal.NewFromFloat(info.ModelPrice)
@@ -86,11 +133,31 @@ func calculateAudioQuota(info QuotaInfo) int {
 	return int(quota.Round(0).IntPart())
 }
 
+// GetRealtimeUsageQuota 按会话的模型倍率计算 realtime 用量对应的额度，按次计费的会话返回 0
+func GetRealtimeUsageQuota(relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) int {
+	if relayInfo.PriceData.UsePrice {
+		return 0
+	}
+	return calculateAudioQuota(QuotaInfo{
+		InputDetails: TokenDetails{
+			TextTokens:  usage.InputTokenDetails.TextTokens,
+			AudioTokens: usage.InputTokenDetails.AudioTokens,
+		},
+		OutputDetails: TokenDetails{
+			TextTokens:  usage.OutputTokenDetails.TextTokens,
+			AudioTokens: usage.OutputTokenDetails.AudioTokens,
+		},
+		ModelName:  relayInfo.OriginModelName,
+		ModelRatio: relayInfo.PriceData.ModelRatio,
+		GroupRatio: relayInfo.PriceData.GroupRatioInfo.GroupRatio,
+	})
+}
+
 func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) error {
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := GetBillingQuota(relayInfo)
 	if err != nil {
 		return err
 	}
@@ -237,6 +304,13 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
 
+	// 分段计费按完整输入计算，Claude 的 input_tokens 不含缓存读写部分（OpenRouter 除外）
+	tierPromptTokens := usage.PromptTokens
+	if relayInfo.ChannelType != constant.ChannelTypeOpenRouter {
+		tierPromptTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	ApplyPricingTier(relayInfo, tierPromptTokens)
+
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
@@ -503,11 +577,7 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
-	if quota > 0 {
-		err = model.DecreaseUserQuota(relayInfo.UserId, quota)
-	} else {
-		err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
-	}
+	err = model.ConsumeBillingQuota(relayInfo.UserId, relayInfo.OrganizationId, quota)
 	if err != nil {
 		return err
 	}
@@ -523,7 +593,8 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if sendEmail {
+	// 组织令牌消费的是组织额度池，不触发个人额度预警
+	if sendEmail && relayInfo.OrganizationId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+const (
+	ModelStatusOperational = "operational"
+	ModelStatusDegraded    = "degraded"
+	ModelStatusOutage      = "outage"
+	ModelStatusUnknown     = "unknown" // 近期没有请求与探测数据
+)
+
+const (
+	statusPageCacheDuration = time.Minute
+	statusPageRecentWindow  = 3600 // 当前状态按上一整点小时至今的数据判断
+	statusPageHistoryDays   = model.ModelStatusRetentionDays
+	statusDegradedUptime    = 99.0 // 低于该可用率视为性能下降
+	statusOutageUptime      = 90.0 // 低于该可用率视为故障
+	statusPageOtherVendor   = "Other"
+)
+
+var statusLevels = map[string]int{
+	ModelStatusUnknown:     0,
+	ModelStatusOperational: 1,
+	ModelStatusDegraded:    2,
+	ModelStatusOutage:      3,
+}
+
+// StatusPageDay 某模型一天的可用率，没有数据时 Uptime 为 nil
+type StatusPageDay struct {
+	Date   string   `json:"date"`
+	Uptime *float64 `json:"uptime"`
+}
+
+type StatusPageModel struct {
+	ModelName string           `json:"model_name"`
+	Status    string           `json:"status"`
+	Uptime24h *float64         `json:"uptime_24h"`
+	Uptime90d *float64         `json:"uptime_90d"`
+	LatencyMs int64            `json:"latency_ms"` // 最近 24 小时成功请求的平均首字延迟
+	Days      []*StatusPageDay `json:"days"`
+}
+
+type StatusPageVendor struct {
+	Name   string             `json:"name"`
+	Icon   string             `json:"icon,omitempty"`
+	Status string             `json:"status"`
+	Models []*StatusPageModel `json:"models"`
+}
+
+// StatusPage 公开状态页数据，只按模型与供应商汇总，不包含任何渠道信息
+type StatusPage struct {
+	Status            string                  `json:"status"`
+	UpdatedAt         int64                   `json:"updated_at"`
+	Vendors           []*StatusPageVendor     `json:"vendors"`
+	ActiveIncidents   []*model.StatusIncident `json:"active_incidents"`
+	UpcomingIncidents []*model.StatusIncident `json:"upcoming_incidents"` // 尚未开始的计划维护与公告
+	Incidents         []*model.StatusIncident `json:"incidents"`          // 最近 90 天已结束的故障与公告
+}
+
+var (
+	statusPageCache     *StatusPage
+	statusPageCacheTime time.Time
+	statusPageCacheLock sync.Mutex
+)
+
+func worseStatus(a string, b string) string {
+	if statusLevels[b] > statusLevels[a] {
+		return b
+	}
+	return a
+}
+
+// impactStatus 将故障影响程度映射为模型状态
+func impactStatus(impact string) string {
+	switch impact {
+	case model.StatusImpactCritical:
+		return ModelStatusOutage
+	case model.StatusImpactMinor, model.StatusImpactMajor:
+		return ModelStatusDegraded
+	}
+	return ModelStatusUnknown
+}
+
+// aggregateUptime 合并真实请求与健康探测计算可用率，没有数据时返回 nil
+func aggregateUptime(stat *model.ModelStatusAggregate) *float64 {
+	if stat == nil {
+		return nil
+	}
+	success := stat.SuccessCount + stat.ProbeSuccessCount
+	total := success + stat.FailureCount + stat.ProbeFailureCount
+	if total == 0 {
+		return nil
+	}
+	uptime := float64(success) / float64(total) * 100
+	return &uptime
+}
+
+func uptimeStatus(uptime *float64) string {
+	switch {
+	case uptime == nil:
+		return ModelStatusUnknown
+	case *uptime < statusOutageUptime:
+		return ModelStatusOutage
+	case *uptime < statusDegradedUptime:
+		return ModelStatusDegraded
+	}
+	return ModelStatusOperational
+}
+
+func groupModelStatus(rows []*model.ModelStatusAggregate) map[string]*model.ModelStatusAggregate {
+	result := make(map[string]*model.ModelStatusAggregate, len(rows))
+	for _, row := range rows {
+		result[row.ModelName] = row
+	}
+	return result
+}
+
+// isPricingUsable 判断模型是否在可用分组中启用
+func isPricingUsable(pricing model.Pricing, usableGroup map[string]string) bool {
+	for _, group := range pricing.EnableGroup {
+		if _, ok := usableGroup[group]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStatusPage 返回状态页数据，结果缓存一分钟
+func GetStatusPage() (*StatusPage, error) {
+	statusPageCacheLock.Lock()
+	defer statusPageCacheLock.Unlock()
+	if statusPageCache != nil && time.Since(statusPageCacheTime) < statusPageCacheDuration {
+		return statusPageCache, nil
+	}
+	page, err := buildStatusPage(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	statusPageCache = page
+	statusPageCacheTime = time.Now()
+	return page, nil
+}
+
+func buildStatusPage(now time.Time) (*StatusPage, error) {
+	nowUnix := now.Unix()
+	today := nowUnix - nowUnix%86400
+	historyStart := today - int64(statusPageHistoryDays-1)*86400
+
+	recentRows, err := model.GetModelStatusSince(nowUnix - nowUnix%3600 - statusPageRecentWindow)
+	if err != nil {
+		return nil, err
+	}
+	dayRows, err := model.GetModelStatusSince(nowUnix - nowUnix%3600 - 23*3600)
+	if err != nil {
+		return nil, err
+	}
+	dailyRows, err := model.GetModelStatusDaily(historyStart)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := model.GetPublicStatusIncidents(historyStart)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := groupModelStatus(recentRows)
+	lastDay := groupModelStatus(dayRows)
+	daily := make(map[string]map[int64]*model.ModelStatusAggregate)
+	history := make(map[string]*model.ModelStatusAggregate)
+	for _, row := range dailyRows {
+		if daily[row.ModelName] == nil {
+			daily[row.ModelName] = make(map[int64]*model.ModelStatusAggregate)
+		}
+		daily[row.ModelName][row.Bucket] = row
+		total, ok := history[row.ModelName]
+		if !ok {
+			total = &model.ModelStatusAggregate{ModelName: row.ModelName}
+			history[row.ModelName] = total
+		}
+		total.SuccessCount += row.SuccessCount
+		total.FailureCount += row.FailureCount
+		total.ProbeSuccessCount += row.ProbeSuccessCount
+		total.ProbeFailureCount += row.ProbeFailureCount
+	}
+
+	page := &StatusPage{
+		Status:            ModelStatusUnknown,
+		UpdatedAt:         nowUnix,
+		Vendors:           make([]*StatusPageVendor, 0),
+		ActiveIncidents:   make([]*model.StatusIncident, 0),
+		UpcomingIncidents: make([]*model.StatusIncident, 0),
+		Incidents:         make([]*model.StatusIncident, 0),
+	}
+	for _, incident := range incidents {
+		if incident.IsActive(nowUnix) {
+			page.ActiveIncidents = append(page.ActiveIncidents, incident)
+			if incident.Type != model.StatusIncidentTypeAnnouncement {
+				page.Status = worseStatus(page.Status, impactStatus(incident.Impact))
+			}
+		} else if incident.Status != model.StatusIncidentResolved && incident.StartsAt > nowUnix {
+			page.UpcomingIncidents = append(page.UpcomingIncidents, incident)
+		} else {
+			page.Incidents = append(page.Incidents, incident)
+		}
+	}
+
+	vendorNames := make(map[int]model.PricingVendor)
+	for _, vendor := range model.GetVendors() {
+		vendorNames[vendor.ID] = vendor
+	}
+	vendors := make(map[string]*StatusPageVendor)
+	// 状态页无需登录，只展示未登录用户可用分组中的模型，与模型广场一致
+	usableGroup := GetUserUsableGroups("")
+	for _, pricing := range model.GetPricing() {
+		if !isPricingUsable(pricing, usableGroup) {
+			continue
+		}
+		item := &StatusPageModel{
+			ModelName: pricing.ModelName,
+			Uptime24h: aggregateUptime(lastDay[pricing.ModelName]),
+			Uptime90d: aggregateUptime(history[pricing.ModelName]),
+			Days:      make([]*StatusPageDay, 0, statusPageHistoryDays),
+		}
+		if stat := lastDay[pricing.ModelName]; stat != nil && stat.SuccessCount > 0 {
+			item.LatencyMs = stat.LatencyMsSum / stat.SuccessCount
+		}
+		item.Status = uptimeStatus(aggregateUptime(recent[pricing.ModelName]))
+		for _, incident := range page.ActiveIncidents {
+			if incident.Type != model.StatusIncidentTypeAnnouncement && incident.AffectsModel(pricing.ModelName) {
+				item.Status = worseStatus(item.Status, impactStatus(incident.Impact))
+			}
+		}
+		for day := historyStart; day <= today; day += 86400 {
+			item.Days = append(item.Days, &StatusPageDay{
+				Date:   time.Unix(day, 0).UTC().Format("2006-01-02"),
+				Uptime: aggregateUptime(daily[pricing.ModelName][day]),
+			})
+		}
+
+		vendorName, vendorIcon := statusPageOtherVendor, ""
+		if vendor, ok := vendorNames[pricing.VendorID]; ok {
+			vendorName, vendorIcon = vendor.Name, vendor.Icon
+		}
+		vendor, ok := vendors[vendorName]
+		if !ok {
+			vendor = &StatusPageVendor{Name: vendorName, Icon: vendorIcon, Status: ModelStatusUnknown}
+			vendors[vendorName] = vendor
+			page.Vendors = append(page.Vendors, vendor)
+		}
+		vendor.Models = append(vendor.Models, item)
+		vendor.Status = worseStatus(vendor.Status, item.Status)
+		page.Status = worseStatus(page.Status, item.Status)
+	}
+
+	sort.Slice(page.Vendors, func(i, j int) bool {
+		// 未归类的模型排在最后
+		if (page.Vendors[i].Name == statusPageOtherVendor) != (page.Vendors[j].Name == statusPageOtherVendor) {
+			return page.Vendors[j].Name == statusPageOtherVendor
+		}
+		return page.Vendors[i].Name < page.Vendors[j].Name
+	})
+	for _, vendor := range page.Vendors {
+		sort.Slice(vendor.Models, func(i, j int) bool {
+			return vendor.Models[i].ModelName < vendor.Models[j].ModelName
+		})
+	}
+	return page, nil
+}
+
+// InvalidateStatusPageCache 故障信息变更后清除缓存，使状态页立即更新
+func InvalidateStatusPageCache() {
+	statusPageCacheLock.Lock()
+	defer statusPageCacheLock.Unlock()
+	statusPageCache = nil
+}
@@ -0,0 +1,44 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// VirtualModel 管理员定义的虚拟模型，请求时按能力需求解析为实际模型
+type VirtualModel struct {
+	Description string `json:"description,omitempty"`
+	// 候选模型，为空时从用户分组下全部启用的模型中选择
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+type AutoRoutingSettings struct {
+	Enabled       bool                    `json:"enabled"`
+	VirtualModels map[string]VirtualModel `json:"virtual_models"`
+	// 请求未指定 max_tokens 时，估算费用使用的输出 token 数
+	DefaultCompletionTokens int `json:"default_completion_tokens"`
+}
+
+// 默认配置
+var autoRoutingSettings = AutoRoutingSettings{
+	Enabled:                 true,
+	VirtualModels:           map[string]VirtualModel{},
+	DefaultCompletionTokens: 1000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("auto_routing", &autoRoutingSettings)
+}
+
+func GetAutoRoutingSettings() *AutoRoutingSettings {
+	return &autoRoutingSettings
+}
+
+// GetVirtualModel 返回名称对应的虚拟模型配置
+func GetVirtualModel(name string) (VirtualModel, bool) {
+	if !autoRoutingSettings.Enabled || name == "" {
+		return VirtualModel{}, false
+	}
+	virtualModel, ok := autoRoutingSettings.VirtualModels[name]
+	return virtualModel, ok
+}
@@ -9,6 +9,8 @@ import (
 type GlobalSettings struct {
 	PassThroughRequestEnabled bool     `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist    []string `json:"thinking_model_blacklist"`
+	// 按模型能力元数据在预扣费前拦截超出上下文长度或包含不支持模态的请求
+	CapabilityCheckEnabled bool `json:"capability_check_enabled"`
 }
 
 // 默认配置
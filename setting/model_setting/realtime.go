@@ -0,0 +1,45 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RealtimePipeline 使用已有渠道串联 语音识别 -> 对话 -> 语音合成 组成的 realtime 模型
+type RealtimePipeline struct {
+	TranscriptionModel string `json:"transcription_model"`
+	ChatModel          string `json:"chat_model"`
+	SpeechModel        string `json:"speech_model"`
+	Voice              string `json:"voice"`
+}
+
+// RealtimeSettings 定义 realtime 相关配置
+type RealtimeSettings struct {
+	// key 为客户端请求的 realtime 模型名
+	Pipelines map[string]RealtimePipeline `json:"pipelines"`
+}
+
+// 默认配置
+var defaultRealtimeSettings = RealtimeSettings{
+	Pipelines: map[string]RealtimePipeline{},
+}
+
+// 全局实例
+var realtimeSettings = defaultRealtimeSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime", &realtimeSettings)
+}
+
+func GetRealtimeSettings() *RealtimeSettings {
+	return &realtimeSettings
+}
+
+// GetRealtimePipeline 获取模型对应的 realtime 管道配置
+func GetRealtimePipeline(modelName string) (RealtimePipeline, bool) {
+	pipeline, ok := realtimeSettings.Pipelines[modelName]
+	if !ok || pipeline.ChatModel == "" {
+		return RealtimePipeline{}, false
+	}
+	return pipeline, true
+}
@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelQueueSetting 渠道并发达到上限时的排队设置
+type ChannelQueueSetting struct {
+	Enabled         bool `json:"enabled"`
+	MaxQueueSize    int  `json:"max_queue_size"`     // 队列最大长度，超出后直接拒绝
+	MaxQueuePerUser int  `json:"max_queue_per_user"` // 单个用户最多同时排队的请求数，0 表示不限
+	TimeoutSeconds  int  `json:"timeout_seconds"`    // 排队超时时间
+}
+
+// 默认配置
+var channelQueueSetting = ChannelQueueSetting{
+	Enabled:         true,
+	MaxQueueSize:    1000,
+	MaxQueuePerUser: 20,
+	TimeoutSeconds:  60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_queue_setting", &channelQueueSetting)
+}
+
+func GetChannelQueueSetting() *ChannelQueueSetting {
+	return &channelQueueSetting
+}
@@ -0,0 +1,86 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// HealthProbeAssertion 对探测输出的断言，未设置的条件不检查
+type HealthProbeAssertion struct {
+	Contains     string `json:"contains,omitempty"`       // 输出需包含的文本（不区分大小写）
+	Regex        string `json:"regex,omitempty"`          // 输出需匹配的正则表达式
+	MinLength    int    `json:"min_length,omitempty"`     // 输出最少字符数
+	MaxLatencyMs int64  `json:"max_latency_ms,omitempty"` // 单次探测耗时上限，超出视为失败
+}
+
+// HealthProbe 一个合成探测用例，按模型与端点类型定时探测渠道
+type HealthProbe struct {
+	Name            string               `json:"name"`
+	Model           string               `json:"model"`
+	EndpointType    string               `json:"endpoint_type,omitempty"` // 为空时按模型自动判断
+	Stream          bool                 `json:"stream"`
+	Prompt          string               `json:"prompt,omitempty"`
+	MaxTokens       int                  `json:"max_tokens,omitempty"`
+	ChannelIds      []int                `json:"channel_ids,omitempty"` // 为空时探测所有启用且支持该模型的渠道
+	IntervalMinutes int                  `json:"interval_minutes"`
+	Assertion       HealthProbeAssertion `json:"assertion"`
+	// SLO 目标，为 0 时使用全局默认值
+	UptimeTarget       float64 `json:"uptime_target,omitempty"`
+	LatencyP95TargetMs int64   `json:"latency_p95_target_ms,omitempty"`
+}
+
+// HealthProbeSetting 渠道合成健康探测设置
+type HealthProbeSetting struct {
+	Enabled                   bool          `json:"enabled"`
+	Probes                    []HealthProbe `json:"probes"`
+	RetentionDays             int           `json:"retention_days"`                // 探测结果保留天数
+	SloWindowHours            int           `json:"slo_window_hours"`              // SLO 统计窗口
+	MinSloSamples             int           `json:"min_slo_samples"`               // 窗口内样本数少于该值时不判定 SLO
+	DefaultUptimeTarget       float64       `json:"default_uptime_target"`         // 可用率目标（百分比）
+	DefaultLatencyP95TargetMs int64         `json:"default_latency_p95_target_ms"` // P95 延迟目标，0 表示不检查
+	NotifyOnBreach            bool          `json:"notify_on_breach"`              // SLO 违约与恢复时通知管理员
+}
+
+// 默认配置
+var healthProbeSetting = HealthProbeSetting{
+	Enabled:                   false,
+	Probes:                    []HealthProbe{},
+	RetentionDays:             30,
+	SloWindowHours:            24,
+	MinSloSamples:             5,
+	DefaultUptimeTarget:       99,
+	DefaultLatencyP95TargetMs: 0,
+	NotifyOnBreach:            true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("health_probe_setting", &healthProbeSetting)
+}
+
+func GetHealthProbeSetting() *HealthProbeSetting {
+	return &healthProbeSetting
+}
+
+// GetHealthProbe 按名称查找探测用例
+func GetHealthProbe(name string) (HealthProbe, bool) {
+	for _, probe := range healthProbeSetting.Probes {
+		if probe.Name == name {
+			return probe, true
+		}
+	}
+	return HealthProbe{}, false
+}
+
+// GetUptimeTarget 返回探测用例的可用率目标
+func (p HealthProbe) GetUptimeTarget() float64 {
+	if p.UptimeTarget > 0 {
+		return p.UptimeTarget
+	}
+	return healthProbeSetting.DefaultUptimeTarget
+}
+
+// GetLatencyP95TargetMs 返回探测用例的 P95 延迟目标
+func (p HealthProbe) GetLatencyP95TargetMs() int64 {
+	if p.LatencyP95TargetMs > 0 {
+		return p.LatencyP95TargetMs
+	}
+	return healthProbeSetting.DefaultLatencyP95TargetMs
+}
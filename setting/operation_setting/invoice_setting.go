@@ -0,0 +1,51 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type InvoiceSetting struct {
+	Enabled          bool               `json:"enabled"`            // 充值成功后是否自动开具发票
+	InvoicePrefix    string             `json:"invoice_prefix"`     // 发票编号前缀
+	CreditNotePrefix string             `json:"credit_note_prefix"` // 红字发票（退款凭证）编号前缀
+	Currency         string             `json:"currency"`
+	PaymentCurrency  map[string]string  `json:"payment_currency"` // 按支付方式指定币种，例如 {"alipay": "CNY"}
+	TaxRate          float64            `json:"tax_rate"`         // 默认税率，例如 0.2 表示 20%
+	CountryTaxRate   map[string]float64 `json:"country_tax_rate"` // 按账单国家指定税率
+	SellerName       string             `json:"seller_name"`
+	SellerTaxId      string             `json:"seller_tax_id"`
+	SellerAddress    string             `json:"seller_address"`
+}
+
+// 默认配置
+var invoiceSetting = InvoiceSetting{
+	Enabled:          false,
+	InvoicePrefix:    "INV",
+	CreditNotePrefix: "CN",
+	Currency:         "USD",
+	PaymentCurrency:  map[string]string{},
+	CountryTaxRate:   map[string]float64{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("invoice_setting", &invoiceSetting)
+}
+
+func GetInvoiceSetting() *InvoiceSetting {
+	return &invoiceSetting
+}
+
+// GetPaymentCurrency 返回支付方式对应的发票币种
+func (s *InvoiceSetting) GetPaymentCurrency(paymentMethod string) string {
+	if currency, ok := s.PaymentCurrency[paymentMethod]; ok && currency != "" {
+		return currency
+	}
+	return s.Currency
+}
+
+// GetTaxRate 返回账单国家适用的税率
+func (s *InvoiceSetting) GetTaxRate(country string) float64 {
+	if rate, ok := s.CountryTaxRate[country]; ok {
+		return rate
+	}
+	return s.TaxRate
+}
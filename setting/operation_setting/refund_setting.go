@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type RefundSetting struct {
+	AllowNegativeBalance     bool `json:"allow_negative_balance"`      // 退款扣回额度时是否允许余额为负
+	SuspendOnChargeback      bool `json:"suspend_on_chargeback"`       // 收到拒付（争议）时是否禁用用户
+	SuspendOnNegativeBalance bool `json:"suspend_on_negative_balance"` // 退款后余额为负时是否禁用用户
+}
+
+// 默认配置
+var refundSetting = RefundSetting{
+	AllowNegativeBalance:     true,
+	SuspendOnChargeback:      true,
+	SuspendOnNegativeBalance: false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("refund_setting", &refundSetting)
+}
+
+func GetRefundSetting() *RefundSetting {
+	return &refundSetting
+}
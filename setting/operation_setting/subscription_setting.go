@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type SubscriptionSetting struct {
+	Enabled         bool   `json:"enabled"`           // 是否开放订阅套餐
+	GracePeriodDays int    `json:"grace_period_days"` // 续费失败后保留套餐权益的天数
+	FreeGroup       string `json:"free_group"`        // 套餐失效后用户降级到的分组
+}
+
+// 默认配置
+var subscriptionSetting = SubscriptionSetting{
+	Enabled:         false,
+	GracePeriodDays: 3,
+	FreeGroup:       "default",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("subscription_setting", &subscriptionSetting)
+}
+
+func GetSubscriptionSetting() *SubscriptionSetting {
+	return &subscriptionSetting
+}
@@ -0,0 +1,54 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type TaskSetting struct {
+	TimeoutEnabled         bool           `json:"timeout_enabled"`          // 是否启用异步任务超时
+	DefaultTimeoutMinutes  int            `json:"default_timeout_minutes"`  // 默认最长执行时间（分钟）
+	PlatformTimeoutMinutes map[string]int `json:"platform_timeout_minutes"` // 按平台覆盖，key 为 platform（渠道类型或 suno）
+	SubmitRetryTimes       int            `json:"submit_retry_times"`       // 提交失败时的重试次数，小于 0 时沿用全局重试次数
+	UserCancelEnabled      bool           `json:"user_cancel_enabled"`      // 是否允许用户取消任务
+}
+
+// 默认配置
+var taskSetting = TaskSetting{
+	TimeoutEnabled:         false,
+	DefaultTimeoutMinutes:  120,
+	PlatformTimeoutMinutes: map[string]int{},
+	SubmitRetryTimes:       -1,
+	UserCancelEnabled:      true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_setting", &taskSetting)
+}
+
+func GetTaskSetting() *TaskSetting {
+	return &taskSetting
+}
+
+// GetTimeoutSeconds 返回指定平台任务的最长执行时间，0 表示不限制
+func (s *TaskSetting) GetTimeoutSeconds(platform string) int64 {
+	if !s.TimeoutEnabled {
+		return 0
+	}
+	minutes := s.DefaultTimeoutMinutes
+	if m, ok := s.PlatformTimeoutMinutes[platform]; ok {
+		minutes = m
+	}
+	if minutes <= 0 {
+		return 0
+	}
+	return int64(minutes) * 60
+}
+
+func (s *TaskSetting) GetSubmitRetryTimes() int {
+	if s.SubmitRetryTimes < 0 {
+		return common.RetryTimes
+	}
+	return s.SubmitRetryTimes
+}
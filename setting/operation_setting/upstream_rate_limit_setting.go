@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UpstreamRateLimitSetting 根据上游返回的限流响应头，在渠道选择与多 Key 轮询时主动避开即将耗尽的 Key
+type UpstreamRateLimitSetting struct {
+	Enabled              bool    `json:"enabled"`
+	MinRemainingRequests int64   `json:"min_remaining_requests"` // 剩余请求数不高于该值时跳过
+	MinRemainingTokens   int64   `json:"min_remaining_tokens"`   // 剩余 token 数不高于该值时跳过
+	MinRemainingRatio    float64 `json:"min_remaining_ratio"`    // 剩余比例不高于该值时跳过，0 表示不按比例判断
+	MaxStateSeconds      int     `json:"max_state_seconds"`      // 上游未返回重置时间时，限流状态的最长保留时间
+}
+
+// 默认配置
+var upstreamRateLimitSetting = UpstreamRateLimitSetting{
+	Enabled:              true,
+	MinRemainingRequests: 0,
+	MinRemainingTokens:   0,
+	MinRemainingRatio:    0.01,
+	MaxStateSeconds:      60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("upstream_rate_limit_setting", &upstreamRateLimitSetting)
+}
+
+func GetUpstreamRateLimitSetting() *UpstreamRateLimitSetting {
+	return &upstreamRateLimitSetting
+}
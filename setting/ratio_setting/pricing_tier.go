@@ -0,0 +1,150 @@
+package ratio_setting
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// PricingTier 分段计费规则：按输入 tokens 区间，以及可选的 service_tier、推理强度选择不同倍率。
+// 未设置的倍率沿用模型的基础倍率；同一模型的多条规则按顺序匹配，命中第一条即停止。
+type PricingTier struct {
+	Name               string   `json:"name"`
+	MinPromptTokens    int      `json:"min_prompt_tokens,omitempty"` // 输入 tokens 下限（含）
+	MaxPromptTokens    int      `json:"max_prompt_tokens,omitempty"` // 输入 tokens 上限（含），0 表示不限
+	ServiceTier        string   `json:"service_tier,omitempty"`      // 为空时匹配任意 service_tier
+	ReasoningEffort    string   `json:"reasoning_effort,omitempty"`  // 为空时匹配任意推理强度
+	ModelRatio         *float64 `json:"model_ratio,omitempty"`
+	CompletionRatio    *float64 `json:"completion_ratio,omitempty"`
+	CacheRatio         *float64 `json:"cache_ratio,omitempty"`
+	CacheCreationRatio *float64 `json:"cache_creation_ratio,omitempty"`
+}
+
+func pricingTierRatio(v float64) *float64 {
+	return &v
+}
+
+// 默认规则参考官方价格：超过 200k 输入 tokens 后按长上下文价格计费
+var defaultPricingTiers = map[string][]PricingTier{
+	"gemini-2.5-pro": {
+		{Name: ">200k", MinPromptTokens: 200001, ModelRatio: pricingTierRatio(1.25), CompletionRatio: pricingTierRatio(6)},
+	},
+	"claude-sonnet-4-20250514": {
+		{Name: ">200k", MinPromptTokens: 200001, ModelRatio: pricingTierRatio(3), CompletionRatio: pricingTierRatio(3.75)},
+	},
+	"claude-sonnet-4-5-20250929": {
+		{Name: ">200k", MinPromptTokens: 200001, ModelRatio: pricingTierRatio(3), CompletionRatio: pricingTierRatio(3.75)},
+	},
+}
+
+var pricingTierMap = defaultPricingTiers
+var pricingTierMapMutex sync.RWMutex
+
+func (t *PricingTier) matches(promptTokens int, serviceTier string, reasoningEffort string) bool {
+	if promptTokens < t.MinPromptTokens {
+		return false
+	}
+	if t.MaxPromptTokens > 0 && promptTokens > t.MaxPromptTokens {
+		return false
+	}
+	if t.ServiceTier != "" && t.ServiceTier != serviceTier {
+		return false
+	}
+	if t.ReasoningEffort != "" && t.ReasoningEffort != reasoningEffort {
+		return false
+	}
+	return true
+}
+
+func PricingTiers2JSONString() string {
+	pricingTierMapMutex.RLock()
+	defer pricingTierMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(pricingTierMap)
+	if err != nil {
+		common.SysError("error marshalling pricing tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// CheckPricingTiersJSONString 校验分段计费规则配置，供保存配置前调用
+func CheckPricingTiersJSONString(jsonStr string) error {
+	_, err := parsePricingTiers(jsonStr)
+	return err
+}
+
+func parsePricingTiers(jsonStr string) (map[string][]PricingTier, error) {
+	tiers := make(map[string][]PricingTier)
+	if err := common.UnmarshalJsonStr(jsonStr, &tiers); err != nil {
+		return nil, err
+	}
+	if err := validatePricingTiers(tiers); err != nil {
+		return nil, err
+	}
+	return tiers, nil
+}
+
+func UpdatePricingTiersByJSONString(jsonStr string) error {
+	tiers, err := parsePricingTiers(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingTierMapMutex.Lock()
+	pricingTierMap = tiers
+	pricingTierMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+func validatePricingTiers(tiers map[string][]PricingTier) error {
+	for model, rules := range tiers {
+		for i, rule := range rules {
+			if rule.Name == "" {
+				return fmt.Errorf("模型 %s 的第 %d 条分段计费规则缺少名称", model, i+1)
+			}
+			if rule.MinPromptTokens < 0 || rule.MaxPromptTokens < 0 {
+				return fmt.Errorf("模型 %s 的分段计费规则 %s 的 tokens 区间不能为负数", model, rule.Name)
+			}
+			if rule.MaxPromptTokens > 0 && rule.MaxPromptTokens < rule.MinPromptTokens {
+				return fmt.Errorf("模型 %s 的分段计费规则 %s 的 tokens 上限小于下限", model, rule.Name)
+			}
+			for _, ratio := range []*float64{rule.ModelRatio, rule.CompletionRatio, rule.CacheRatio, rule.CacheCreationRatio} {
+				if ratio != nil && *ratio < 0 {
+					return errors.New("分段计费规则 " + rule.Name + " 的倍率不能为负数")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetPricingTier 返回模型在给定输入 tokens、service_tier 与推理强度下命中的分段计费规则
+func GetPricingTier(name string, promptTokens int, serviceTier string, reasoningEffort string) (*PricingTier, bool) {
+	pricingTierMapMutex.RLock()
+	defer pricingTierMapMutex.RUnlock()
+	rules, ok := pricingTierMap[name]
+	if !ok {
+		rules, ok = pricingTierMap[FormatMatchingModelName(name)]
+		if !ok {
+			return nil, false
+		}
+	}
+	for i := range rules {
+		if rules[i].matches(promptTokens, serviceTier, reasoningEffort) {
+			tier := rules[i]
+			return &tier, true
+		}
+	}
+	return nil, false
+}
+
+func GetPricingTiersCopy() map[string][]PricingTier {
+	pricingTierMapMutex.RLock()
+	defer pricingTierMapMutex.RUnlock()
+	copyMap := make(map[string][]PricingTier, len(pricingTierMap))
+	for k, v := range pricingTierMap {
+		copyMap[k] = append([]PricingTier(nil), v...)
+	}
+	return copyMap
+}
@@ -0,0 +1,98 @@
+package ratio_setting
+
+import "testing"
+
+func setTestPricingTiers(t *testing.T, jsonStr string) {
+	t.Helper()
+	pricingTierMapMutex.RLock()
+	previous := pricingTierMap
+	pricingTierMapMutex.RUnlock()
+	t.Cleanup(func() {
+		pricingTierMapMutex.Lock()
+		pricingTierMap = previous
+		pricingTierMapMutex.Unlock()
+	})
+	if err := UpdatePricingTiersByJSONString(jsonStr); err != nil {
+		t.Fatalf("update pricing tiers: %v", err)
+	}
+}
+
+func TestGetPricingTier(t *testing.T) {
+	setTestPricingTiers(t, `{
+		"test-model": [
+			{"name": "flex", "service_tier": "flex", "model_ratio": 0.5},
+			{"name": "high", "reasoning_effort": "high", "min_prompt_tokens": 1000, "model_ratio": 3},
+			{"name": "short", "max_prompt_tokens": 1000, "model_ratio": 1},
+			{"name": "long", "min_prompt_tokens": 1001, "model_ratio": 2}
+		]
+	}`)
+
+	tests := []struct {
+		name            string
+		model           string
+		promptTokens    int
+		serviceTier     string
+		reasoningEffort string
+		want            string
+	}{
+		{name: "service tier matches first", model: "test-model", promptTokens: 5000, serviceTier: "flex", want: "flex"},
+		{name: "reasoning effort with enough tokens", model: "test-model", promptTokens: 1000, reasoningEffort: "high", want: "high"},
+		{name: "reasoning effort below min tokens", model: "test-model", promptTokens: 999, reasoningEffort: "high", want: "short"},
+		{name: "max tokens is inclusive", model: "test-model", promptTokens: 1000, want: "short"},
+		{name: "above max tokens", model: "test-model", promptTokens: 1001, want: "long"},
+		{name: "unknown model", model: "other-model", promptTokens: 1001, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier, ok := GetPricingTier(tt.model, tt.promptTokens, tt.serviceTier, tt.reasoningEffort)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("expected no tier, got %s", tier.Name)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected tier %s, got none", tt.want)
+			}
+			if tier.Name != tt.want {
+				t.Fatalf("expected tier %s, got %s", tt.want, tier.Name)
+			}
+		})
+	}
+}
+
+func TestGetPricingTierReturnsCopy(t *testing.T) {
+	setTestPricingTiers(t, `{"test-model": [{"name": "all", "model_ratio": 2}]}`)
+
+	tier, ok := GetPricingTier("test-model", 0, "", "")
+	if !ok {
+		t.Fatal("expected tier to match")
+	}
+	tier.Name = "changed"
+	if tier, _ = GetPricingTier("test-model", 0, "", ""); tier.Name != "all" {
+		t.Fatalf("expected stored tier to stay unchanged, got %s", tier.Name)
+	}
+}
+
+func TestCheckPricingTiersJSONString(t *testing.T) {
+	tests := []struct {
+		name    string
+		jsonStr string
+		wantErr bool
+	}{
+		{name: "valid", jsonStr: `{"m": [{"name": "a", "min_prompt_tokens": 10, "max_prompt_tokens": 20}]}`},
+		{name: "missing name", jsonStr: `{"m": [{"model_ratio": 1}]}`, wantErr: true},
+		{name: "negative tokens", jsonStr: `{"m": [{"name": "a", "min_prompt_tokens": -1}]}`, wantErr: true},
+		{name: "max below min", jsonStr: `{"m": [{"name": "a", "min_prompt_tokens": 20, "max_prompt_tokens": 10}]}`, wantErr: true},
+		{name: "negative ratio", jsonStr: `{"m": [{"name": "a", "completion_ratio": -1}]}`, wantErr: true},
+		{name: "invalid json", jsonStr: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPricingTiersJSONString(tt.jsonStr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package ratio_setting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	PricingWindowRecurrenceOnce   = ""       // 仅在 start_time ~ end_time 内生效
+	PricingWindowRecurrenceDaily  = "daily"  // 每天的 start_clock ~ end_clock
+	PricingWindowRecurrenceWeekly = "weekly" // 每周 weekdays 中的 start_clock ~ end_clock
+)
+
+// PricingWindow 定时计费规则，用于错峰优惠、限时促销等场景。
+// 命中规则时，按倍率计费的模型使用 model_ratio 覆盖或乘以 multiplier，按次计费的模型使用 model_price 覆盖或乘以 multiplier。
+// 多条规则按顺序匹配，命中第一条即停止。
+type PricingWindow struct {
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	Models     []string `json:"models,omitempty"` // 为空时匹配所有模型
+	Groups     []string `json:"groups,omitempty"` // 为空时匹配所有分组
+	Timezone   string   `json:"timezone,omitempty"`
+	StartTime  int64    `json:"start_time,omitempty"` // 生效起始时间戳，0 表示不限
+	EndTime    int64    `json:"end_time,omitempty"`   // 生效结束时间戳，0 表示不限
+	Recurrence string   `json:"recurrence,omitempty"`
+	Weekdays   []int    `json:"weekdays,omitempty"`    // 0 表示周日
+	StartClock string   `json:"start_clock,omitempty"` // HH:MM，晚于 end_clock 时表示跨天
+	EndClock   string   `json:"end_clock,omitempty"`
+	Multiplier *float64 `json:"multiplier,omitempty"`
+	ModelRatio *float64 `json:"model_ratio,omitempty"`
+	ModelPrice *float64 `json:"model_price,omitempty"`
+}
+
+var pricingWindows []PricingWindow
+var pricingWindowsMutex sync.RWMutex
+
+func PricingWindows2JSONString() string {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	windows := pricingWindows
+	if windows == nil {
+		windows = []PricingWindow{}
+	}
+	jsonBytes, err := common.Marshal(windows)
+	if err != nil {
+		common.SysError("error marshalling pricing windows: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// CheckPricingWindowsJSONString 校验定时计费规则配置，供保存配置前调用
+func CheckPricingWindowsJSONString(jsonStr string) error {
+	_, err := parsePricingWindows(jsonStr)
+	return err
+}
+
+func UpdatePricingWindowsByJSONString(jsonStr string) error {
+	windows, err := parsePricingWindows(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingWindowsMutex.Lock()
+	pricingWindows = windows
+	pricingWindowsMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+func parsePricingWindows(jsonStr string) ([]PricingWindow, error) {
+	windows := make([]PricingWindow, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return windows, nil
+	}
+	if err := common.UnmarshalJsonStr(jsonStr, &windows); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(windows))
+	for i := range windows {
+		if err := windows[i].validate(); err != nil {
+			return nil, err
+		}
+		if names[windows[i].Name] {
+			return nil, fmt.Errorf("定时计费规则名称重复: %s", windows[i].Name)
+		}
+		names[windows[i].Name] = true
+	}
+	return windows, nil
+}
+
+func (w *PricingWindow) validate() error {
+	if w.Name == "" {
+		return errors.New("定时计费规则缺少名称")
+	}
+	if _, err := w.location(); err != nil {
+		return fmt.Errorf("定时计费规则 %s 的时区无效: %s", w.Name, w.Timezone)
+	}
+	if w.EndTime != 0 && w.EndTime <= w.StartTime {
+		return fmt.Errorf("定时计费规则 %s 的结束时间必须晚于开始时间", w.Name)
+	}
+	switch w.Recurrence {
+	case PricingWindowRecurrenceOnce:
+		if w.StartTime == 0 && w.EndTime == 0 {
+			return fmt.Errorf("定时计费规则 %s 未设置生效时间", w.Name)
+		}
+	case PricingWindowRecurrenceDaily, PricingWindowRecurrenceWeekly:
+		start, err := ParseClock(w.StartClock)
+		if err != nil {
+			return fmt.Errorf("定时计费规则 %s 的开始时刻无效: %s", w.Name, w.StartClock)
+		}
+		end, err := ParseClock(w.EndClock)
+		if err != nil {
+			return fmt.Errorf("定时计费规则 %s 的结束时刻无效: %s", w.Name, w.EndClock)
+		}
+		if start == end {
+			return fmt.Errorf("定时计费规则 %s 的开始时刻与结束时刻相同", w.Name)
+		}
+		if w.Recurrence == PricingWindowRecurrenceWeekly {
+			if len(w.Weekdays) == 0 {
+				return fmt.Errorf("定时计费规则 %s 未设置星期", w.Name)
+			}
+			for _, day := range w.Weekdays {
+				if day < 0 || day > 6 {
+					return fmt.Errorf("定时计费规则 %s 的星期无效: %d", w.Name, day)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("定时计费规则 %s 的重复方式无效: %s", w.Name, w.Recurrence)
+	}
+	if w.Multiplier == nil && w.ModelRatio == nil && w.ModelPrice == nil {
+		return fmt.Errorf("定时计费规则 %s 未设置倍数或价格", w.Name)
+	}
+	for _, v := range []*float64{w.Multiplier, w.ModelRatio, w.ModelPrice} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("定时计费规则 %s 的倍数或价格不能为负数", w.Name)
+		}
+	}
+	return nil
+}
+
+func (w *PricingWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(w.Timezone)
+}
+
+// ParseClock 将 HH:MM 解析为当天的分钟数
+func ParseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, errors.New("invalid clock")
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, errors.New("invalid clock")
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, errors.New("invalid clock")
+	}
+	return hour*60 + minute, nil
+}
+
+func (w *PricingWindow) matchesTarget(model string, group string) bool {
+	if len(w.Models) > 0 && !common.StringsContains(w.Models, model) && !common.StringsContains(w.Models, FormatMatchingModelName(model)) {
+		return false
+	}
+	if len(w.Groups) > 0 && !common.StringsContains(w.Groups, group) {
+		return false
+	}
+	return true
+}
+
+// ActiveUntil 返回规则在 now 时刻所处的生效时段的结束时间，未生效时返回 false
+func (w *PricingWindow) ActiveUntil(now time.Time) (time.Time, bool) {
+	if !w.Enabled {
+		return time.Time{}, false
+	}
+	if w.StartTime != 0 && now.Unix() < w.StartTime {
+		return time.Time{}, false
+	}
+	if w.EndTime != 0 && now.Unix() >= w.EndTime {
+		return time.Time{}, false
+	}
+	var until time.Time
+	if w.Recurrence == PricingWindowRecurrenceOnce {
+		if w.EndTime != 0 {
+			until = time.Unix(w.EndTime, 0)
+		}
+		return until, true
+	}
+
+	loc, err := w.location()
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(loc)
+	start, _ := ParseClock(w.StartClock)
+	end, _ := ParseClock(w.EndClock)
+	minute := local.Hour()*60 + local.Minute()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	// 时段所属的日期：跨天时段在次日凌晨的部分属于前一天
+	var day time.Time
+	switch {
+	case start < end && minute >= start && minute < end:
+		day = midnight
+	case start > end && minute >= start:
+		day = midnight
+	case start > end && minute < end:
+		day = midnight.AddDate(0, 0, -1)
+	default:
+		return time.Time{}, false
+	}
+	if w.Recurrence == PricingWindowRecurrenceWeekly && !containsWeekday(w.Weekdays, int(day.Weekday())) {
+		return time.Time{}, false
+	}
+	until = day.Add(time.Duration(end) * time.Minute)
+	if start > end {
+		until = day.AddDate(0, 0, 1).Add(time.Duration(end) * time.Minute)
+	}
+	if w.EndTime != 0 && until.Unix() > w.EndTime {
+		until = time.Unix(w.EndTime, 0)
+	}
+	return until, true
+}
+
+func containsWeekday(weekdays []int, day int) bool {
+	for _, d := range weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyRatio 返回规则生效时的模型倍率
+func (w *PricingWindow) ApplyRatio(ratio float64) float64 {
+	if w.ModelRatio != nil {
+		return *w.ModelRatio
+	}
+	if w.Multiplier != nil {
+		return ratio * *w.Multiplier
+	}
+	return ratio
+}
+
+// ApplyPrice 返回规则生效时的按次价格
+func (w *PricingWindow) ApplyPrice(price float64) float64 {
+	if w.ModelPrice != nil {
+		return *w.ModelPrice
+	}
+	if w.Multiplier != nil {
+		return price * *w.Multiplier
+	}
+	return price
+}
+
+// GetActivePricingWindow 返回模型与分组在 now 时刻命中的定时计费规则
+func GetActivePricingWindow(model string, group string, now time.Time) (*PricingWindow, bool) {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	for i := range pricingWindows {
+		if !pricingWindows[i].matchesTarget(model, group) {
+			continue
+		}
+		if _, ok := pricingWindows[i].ActiveUntil(now); ok {
+			window := pricingWindows[i]
+			return &window, true
+		}
+	}
+	return nil, false
+}
+
+// GetActivePricingWindows 返回 now 时刻处于生效时段的所有规则
+func GetActivePricingWindows(now time.Time) []PricingWindow {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	active := make([]PricingWindow, 0)
+	for _, window := range pricingWindows {
+		if _, ok := window.ActiveUntil(now); ok {
+			active = append(active, window)
+		}
+	}
+	return active
+}
@@ -0,0 +1,200 @@
+package ratio_setting
+
+import (
+	"testing"
+	"time"
+)
+
+func setTestPricingWindows(t *testing.T, jsonStr string) {
+	t.Helper()
+	pricingWindowsMutex.RLock()
+	previous := pricingWindows
+	pricingWindowsMutex.RUnlock()
+	t.Cleanup(func() {
+		pricingWindowsMutex.Lock()
+		pricingWindows = previous
+		pricingWindowsMutex.Unlock()
+	})
+	if err := UpdatePricingWindowsByJSONString(jsonStr); err != nil {
+		t.Fatalf("update pricing windows: %v", err)
+	}
+}
+
+func TestPricingWindowActiveUntil(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	// 2026-10-19 为周一
+	tests := []struct {
+		name      string
+		window    PricingWindow
+		now       time.Time
+		wantOK    bool
+		wantUntil time.Time
+	}{
+		{
+			name:      "daily inside window",
+			window:    PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "09:00", EndClock: "18:00"},
+			now:       utc(2026, 10, 19, 12, 0),
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 19, 18, 0),
+		},
+		{
+			name:   "daily end clock is exclusive",
+			window: PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "09:00", EndClock: "18:00"},
+			now:    utc(2026, 10, 19, 18, 0),
+		},
+		{
+			name:      "overnight before midnight",
+			window:    PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "22:00", EndClock: "06:00"},
+			now:       utc(2026, 10, 19, 23, 30),
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 20, 6, 0),
+		},
+		{
+			name:      "overnight after midnight",
+			window:    PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "22:00", EndClock: "06:00"},
+			now:       utc(2026, 10, 20, 2, 0),
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 20, 6, 0),
+		},
+		{
+			name:   "overnight outside",
+			window: PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "22:00", EndClock: "06:00"},
+			now:    utc(2026, 10, 19, 12, 0),
+		},
+		{
+			name:      "weekly overnight belongs to the start day",
+			window:    PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "weekly", Weekdays: []int{5}, StartClock: "22:00", EndClock: "02:00"},
+			now:       utc(2026, 10, 24, 1, 0), // 周六凌晨，属于周五的时段
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 24, 2, 0),
+		},
+		{
+			name:   "weekly on other day",
+			window: PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "weekly", Weekdays: []int{5}, StartClock: "22:00", EndClock: "02:00"},
+			now:    utc(2026, 10, 19, 23, 0),
+		},
+		{
+			name:      "timezone is applied",
+			window:    PricingWindow{Enabled: true, Timezone: "Asia/Shanghai", Recurrence: "daily", StartClock: "00:00", EndClock: "08:00"},
+			now:       utc(2026, 10, 19, 20, 0), // 北京时间次日 04:00
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 20, 0, 0),
+		},
+		{
+			name:      "end time caps the daily window",
+			window:    PricingWindow{Enabled: true, Timezone: "UTC", Recurrence: "daily", StartClock: "09:00", EndClock: "18:00", EndTime: utc(2026, 10, 19, 15, 0).Unix()},
+			now:       utc(2026, 10, 19, 12, 0),
+			wantOK:    true,
+			wantUntil: utc(2026, 10, 19, 15, 0),
+		},
+		{
+			name:      "one-off window",
+			window:    PricingWindow{Enabled: true, StartTime: utc(2026, 10, 1, 0, 0).Unix(), EndTime: utc(2026, 11, 1, 0, 0).Unix()},
+			now:       utc(2026, 10, 19, 12, 0),
+			wantOK:    true,
+			wantUntil: utc(2026, 11, 1, 0, 0),
+		},
+		{
+			name:   "one-off window not started",
+			window: PricingWindow{Enabled: true, StartTime: utc(2026, 11, 1, 0, 0).Unix()},
+			now:    utc(2026, 10, 19, 12, 0),
+		},
+		{
+			name:   "disabled",
+			window: PricingWindow{Timezone: "UTC", Recurrence: "daily", StartClock: "00:00", EndClock: "24:00"},
+			now:    utc(2026, 10, 19, 12, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, ok := tt.window.ActiveUntil(tt.now)
+			if ok != tt.wantOK {
+				t.Fatalf("expected active %v, got %v", tt.wantOK, ok)
+			}
+			if ok && !until.Equal(tt.wantUntil) {
+				t.Fatalf("expected active until %s, got %s", tt.wantUntil, until)
+			}
+		})
+	}
+}
+
+func TestGetActivePricingWindow(t *testing.T) {
+	setTestPricingWindows(t, `[
+		{"name": "vip-promo", "enabled": true, "groups": ["vip"], "timezone": "UTC", "recurrence": "daily", "start_clock": "00:00", "end_clock": "24:00", "multiplier": 0.5},
+		{"name": "off-peak", "enabled": true, "models": ["gpt-4o"], "timezone": "UTC", "recurrence": "daily", "start_clock": "00:00", "end_clock": "08:00", "model_ratio": 1},
+		{"name": "disabled", "enabled": false, "timezone": "UTC", "recurrence": "daily", "start_clock": "00:00", "end_clock": "24:00", "multiplier": 0}
+	]`)
+	night := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		model string
+		group string
+		now   time.Time
+		want  string
+	}{
+		{name: "first matching rule wins", model: "gpt-4o", group: "vip", now: night, want: "vip-promo"},
+		{name: "model rule in window", model: "gpt-4o", group: "default", now: night, want: "off-peak"},
+		{name: "model rule outside window", model: "gpt-4o", group: "default", now: day, want: ""},
+		{name: "other model", model: "gpt-4o-mini", group: "default", now: night, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, ok := GetActivePricingWindow(tt.model, tt.group, tt.now)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("expected no window, got %s", window.Name)
+				}
+				return
+			}
+			if !ok || window.Name != tt.want {
+				t.Fatalf("expected window %s, got %v", tt.want, window)
+			}
+		})
+	}
+}
+
+func TestPricingWindowApply(t *testing.T) {
+	half, ratio, price := 0.5, 3.0, 0.02
+	if got := (&PricingWindow{Multiplier: &half}).ApplyRatio(2); got != 1 {
+		t.Fatalf("expected multiplied ratio 1, got %v", got)
+	}
+	if got := (&PricingWindow{Multiplier: &half, ModelRatio: &ratio}).ApplyRatio(2); got != 3 {
+		t.Fatalf("expected model_ratio to override multiplier, got %v", got)
+	}
+	if got := (&PricingWindow{Multiplier: &half}).ApplyPrice(0.1); got != 0.05 {
+		t.Fatalf("expected multiplied price 0.05, got %v", got)
+	}
+	if got := (&PricingWindow{Multiplier: &half, ModelPrice: &price}).ApplyPrice(0.1); got != 0.02 {
+		t.Fatalf("expected model_price to override multiplier, got %v", got)
+	}
+}
+
+func TestCheckPricingWindowsJSONString(t *testing.T) {
+	tests := []struct {
+		name    string
+		jsonStr string
+		wantErr bool
+	}{
+		{name: "empty", jsonStr: ""},
+		{name: "valid weekly", jsonStr: `[{"name": "a", "recurrence": "weekly", "weekdays": [1], "start_clock": "09:00", "end_clock": "18:00", "multiplier": 0.8}]`},
+		{name: "duplicate name", jsonStr: `[{"name": "a", "start_time": 1, "multiplier": 1}, {"name": "a", "start_time": 1, "multiplier": 1}]`, wantErr: true},
+		{name: "one-off without time", jsonStr: `[{"name": "a", "multiplier": 1}]`, wantErr: true},
+		{name: "invalid clock", jsonStr: `[{"name": "a", "recurrence": "daily", "start_clock": "25:00", "end_clock": "08:00", "multiplier": 1}]`, wantErr: true},
+		{name: "same clocks", jsonStr: `[{"name": "a", "recurrence": "daily", "start_clock": "08:00", "end_clock": "08:00", "multiplier": 1}]`, wantErr: true},
+		{name: "weekly without days", jsonStr: `[{"name": "a", "recurrence": "weekly", "start_clock": "08:00", "end_clock": "09:00", "multiplier": 1}]`, wantErr: true},
+		{name: "invalid timezone", jsonStr: `[{"name": "a", "timezone": "Mars/Base", "start_time": 1, "multiplier": 1}]`, wantErr: true},
+		{name: "no price", jsonStr: `[{"name": "a", "start_time": 1}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPricingWindowsJSONString(tt.jsonStr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package system_setting
+
+import "strings"
+
+// DirectoryGroupRule 将外部目录（LDAP / SAML）中的组映射为本系统的用户分组
+type DirectoryGroupRule struct {
+	External string `json:"external"` // 外部组名，可填 CN 或完整 DN，大小写不敏感
+	Group    string `json:"group"`    // 对应的用户分组
+}
+
+// ResolveDirectoryGroup 根据外部组计算用户分组与是否为管理员。
+// 分组按规则顺序取第一条命中的规则，未命中时使用 defaultGroup（为空表示保持不变）。
+func ResolveDirectoryGroup(rules []DirectoryGroupRule, adminGroups []string, defaultGroup string, groups []string) (group string, isAdmin bool) {
+	for _, rule := range rules {
+		if rule.Group != "" && directoryGroupMatch(rule.External, groups) {
+			group = rule.Group
+			break
+		}
+	}
+	if group == "" {
+		group = defaultGroup
+	}
+	for _, adminGroup := range adminGroups {
+		if directoryGroupMatch(adminGroup, groups) {
+			isAdmin = true
+			break
+		}
+	}
+	return group, isAdmin
+}
+
+func directoryGroupMatch(name string, groups []string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return false
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g, name) || strings.EqualFold(directoryGroupCN(g), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// directoryGroupCN 从 "CN=AI-Admins,OU=Groups,DC=corp,DC=local" 形式的 DN 中取出 CN
+func directoryGroupCN(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	key, value, ok := strings.Cut(first, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "cn") {
+		return dn
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,42 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type LDAPSettings struct {
+	Enabled              bool                 `json:"enabled"`
+	URL                  string               `json:"url"`                  // 如 ldaps://dc.corp.local:636 或 ldap://dc.corp.local:389
+	StartTLS             bool                 `json:"start_tls"`            // 使用 ldap:// 时是否升级为 TLS
+	InsecureSkipVerify   bool                 `json:"insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
+	BindDN               string               `json:"bind_dn"`              // 用于查找用户的服务账号，留空则匿名查找
+	BindPassword         string               `json:"bind_password"`
+	BaseDN               string               `json:"base_dn"`
+	UserFilter           string               `json:"user_filter"`        // %s 会被替换为转义后的登录用户名
+	IdAttribute          string               `json:"id_attribute"`       // 唯一标识属性，留空使用 DN，AD 可填 objectGUID
+	UsernameAttribute    string               `json:"username_attribute"` // JIT 创建用户时使用的用户名属性
+	DisplayNameAttribute string               `json:"display_name_attribute"`
+	EmailAttribute       string               `json:"email_attribute"`
+	GroupAttribute       string               `json:"group_attribute"` // 用户所属组属性，AD 为 memberOf
+	GroupRules           []DirectoryGroupRule `json:"group_rules"`     // 外部组到用户分组的映射，按顺序匹配
+	AdminGroups          []string             `json:"admin_groups"`    // 属于这些组的用户为管理员，为空则不同步角色
+	DefaultGroup         string               `json:"default_group"`   // 未命中任何映射时的分组，为空则保持不变
+}
+
+// 默认配置
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(sAMAccountName=%s)",
+	UsernameAttribute:    "sAMAccountName",
+	DisplayNameAttribute: "displayName",
+	EmailAttribute:       "mail",
+	GroupAttribute:       "memberOf",
+	GroupRules:           []DirectoryGroupRule{},
+	AdminGroups:          []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
@@ -0,0 +1,253 @@
+package system_setting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// OIDCClaimRule 根据 ID Token / UserInfo 中的声明决定用户的分组、角色、初始额度与可用令牌分组
+type OIDCClaimRule struct {
+	Claim              string   `json:"claim"`                          // 声明路径，支持 a.b 形式的嵌套，如 groups、realm_access.roles、hd
+	Match              string   `json:"match"`                          // equals（默认）/ contains / prefix / suffix / regex / exists
+	Value              string   `json:"value"`                          // 匹配值，数组声明中任一元素命中即可
+	Group              string   `json:"group,omitempty"`                // 命中后设置的用户分组
+	Role               int      `json:"role,omitempty"`                 // 命中后设置的角色，1 普通用户 / 10 管理员，0 表示不设置
+	Quota              int      `json:"quota,omitempty"`                // 首次登录创建用户时额外赠送的额度
+	AllowedTokenGroups []string `json:"allowed_token_groups,omitempty"` // 命中后限制令牌可选的分组
+}
+
+type OIDCProvider struct {
+	Name             string          `json:"name"` // 唯一标识，回调地址为 {ServerAddress}/oauth/oidc/{name}
+	DisplayName      string          `json:"display_name"`
+	Enabled          bool            `json:"enabled"`
+	Issuer           string          `json:"issuer"` // 通过 {issuer}/.well-known/openid-configuration 自动发现端点
+	ClientId         string          `json:"client_id"`
+	ClientSecret     string          `json:"client_secret"`
+	Scopes           string          `json:"scopes"` // 空格分隔，留空为 "openid profile email"
+	UsernameClaim    string          `json:"username_claim"`
+	DisplayNameClaim string          `json:"display_name_claim"`
+	EmailClaim       string          `json:"email_claim"`
+	DefaultGroup     string          `json:"default_group"` // 没有规则设置分组时使用的分组，留空则保持不变
+	Rules            []OIDCClaimRule `json:"rules"`         // 按顺序匹配，每一项取第一条命中并设置了该项的规则
+}
+
+// OIDCClaimResult 是规则匹配后的结果，Set 为 false 的项在登录时不做修改
+type OIDCClaimResult struct {
+	Group                 string
+	RoleSet               bool
+	Role                  int
+	Quota                 int
+	AllowedTokenGroupsSet bool
+	AllowedTokenGroups    []string
+}
+
+type OIDCProvidersSettings struct {
+	Providers []OIDCProvider `json:"providers"`
+}
+
+// 默认配置
+var defaultOIDCProvidersSettings = OIDCProvidersSettings{
+	Providers: []OIDCProvider{},
+}
+
+var oidcProviderNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("oidc_providers", &defaultOIDCProvidersSettings)
+}
+
+func GetOIDCProvidersSettings() *OIDCProvidersSettings {
+	return &defaultOIDCProvidersSettings
+}
+
+// GetOIDCProvider 按名称查找已启用的 OIDC 提供方
+func GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	for i := range defaultOIDCProvidersSettings.Providers {
+		p := &defaultOIDCProvidersSettings.Providers[i]
+		if p.Name == name && p.Enabled {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// CheckOIDCProviders 校验提供方配置，保存前调用
+func CheckOIDCProviders(providers []OIDCProvider) error {
+	names := make(map[string]bool)
+	for _, p := range providers {
+		if !oidcProviderNameRegex.MatchString(p.Name) {
+			return fmt.Errorf("OIDC 提供方名称 %q 无效，只能包含字母、数字、下划线与连字符", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("OIDC 提供方名称 %s 重复", p.Name)
+		}
+		names[p.Name] = true
+		if p.Enabled && (p.Issuer == "" || p.ClientId == "") {
+			return fmt.Errorf("OIDC 提供方 %s 缺少 Issuer 或 Client Id", p.Name)
+		}
+		for _, rule := range p.Rules {
+			if rule.Claim == "" {
+				return fmt.Errorf("OIDC 提供方 %s 存在未填写声明的规则", p.Name)
+			}
+			if rule.Role != 0 && rule.Role != common.RoleCommonUser && rule.Role != common.RoleAdminUser {
+				return fmt.Errorf("OIDC 提供方 %s 的规则只能设置普通用户或管理员角色", p.Name)
+			}
+			if rule.Match == "regex" {
+				if _, err := regexp.Compile(rule.Value); err != nil {
+					return fmt.Errorf("OIDC 提供方 %s 的正则 %q 无效: %v", p.Name, rule.Value, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *OIDCProvider) GetScopes() string {
+	if strings.TrimSpace(p.Scopes) == "" {
+		return "openid profile email"
+	}
+	return p.Scopes
+}
+
+// EvaluateClaims 对声明执行映射规则
+func (p *OIDCProvider) EvaluateClaims(claims map[string]any) OIDCClaimResult {
+	result := OIDCClaimResult{}
+	hasRoleRule := false
+	hasTokenGroupRule := false
+	emailClaim := p.EmailClaim
+	if emailClaim == "" {
+		emailClaim = "email"
+	}
+	emailVerified := isClaimTrue(claims["email_verified"])
+	for _, rule := range p.Rules {
+		if rule.Role != 0 {
+			hasRoleRule = true
+		}
+		if len(rule.AllowedTokenGroups) > 0 {
+			hasTokenGroupRule = true
+		}
+		// 邮箱未经提供方验证时不可信，不参与邮箱规则匹配
+		if (rule.Claim == emailClaim || rule.Claim == "email") && !emailVerified {
+			continue
+		}
+		if !rule.matches(claims) {
+			continue
+		}
+		if result.Group == "" && rule.Group != "" {
+			result.Group = rule.Group
+		}
+		if !result.RoleSet && rule.Role != 0 {
+			result.RoleSet = true
+			result.Role = rule.Role
+		}
+		if result.Quota == 0 && rule.Quota > 0 {
+			result.Quota = rule.Quota
+		}
+		if !result.AllowedTokenGroupsSet && len(rule.AllowedTokenGroups) > 0 {
+			result.AllowedTokenGroupsSet = true
+			result.AllowedTokenGroups = rule.AllowedTokenGroups
+		}
+	}
+	if result.Group == "" {
+		result.Group = p.DefaultGroup
+	}
+	// 配置了角色或令牌分组规则但都未命中时回落到默认值，保证权限随声明变化被收回
+	if hasRoleRule && !result.RoleSet {
+		result.RoleSet = true
+		result.Role = common.RoleCommonUser
+	}
+	if hasTokenGroupRule && !result.AllowedTokenGroupsSet {
+		result.AllowedTokenGroupsSet = true
+		result.AllowedTokenGroups = nil
+	}
+	return result
+}
+
+func (r *OIDCClaimRule) matches(claims map[string]any) bool {
+	value, ok := lookupClaim(claims, r.Claim)
+	if !ok {
+		return false
+	}
+	if r.Match == "exists" {
+		return true
+	}
+	for _, v := range claimStrings(value) {
+		switch r.Match {
+		case "contains":
+			if strings.Contains(strings.ToLower(v), strings.ToLower(r.Value)) {
+				return true
+			}
+		case "prefix":
+			if strings.HasPrefix(strings.ToLower(v), strings.ToLower(r.Value)) {
+				return true
+			}
+		case "suffix":
+			if strings.HasSuffix(strings.ToLower(v), strings.ToLower(r.Value)) {
+				return true
+			}
+		case "regex":
+			if matched, _ := regexp.MatchString(r.Value, v); matched {
+				return true
+			}
+		default:
+			if strings.EqualFold(v, r.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isClaimTrue 兼容布尔值与字符串形式的 "true"
+func isClaimTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+func lookupClaim(claims map[string]any, path string) (any, bool) {
+	// 完整名称优先，兼容 "https://example.com/groups" 这类包含点号的自定义声明
+	if v, ok := claims[path]; ok {
+		return v, true
+	}
+	var current any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			result = append(result, claimStrings(item)...)
+		}
+		return result
+	case []string:
+		return v
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,39 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type SAMLSettings struct {
+	Enabled              bool                 `json:"enabled"`
+	EntityId             string               `json:"entity_id"`           // SP Entity ID，留空使用 {ServerAddress}/api/saml/metadata
+	IdPMetadataURL       string               `json:"idp_metadata_url"`    // 与 IdPMetadataXML 二选一
+	IdPMetadataXML       string               `json:"idp_metadata_xml"`    // 直接粘贴 IdP 元数据
+	SPCertificate        string               `json:"sp_certificate"`      // PEM，配置后 AuthnRequest 签名并支持加密断言
+	SPPrivateKey         string               `json:"sp_private_key"`      // PEM
+	NameIdFormat         string               `json:"name_id_format"`      // 留空由 IdP 决定
+	AllowIdPInitiated    bool                 `json:"allow_idp_initiated"` // IdP 发起的登录转为由本站重新发起 SP 登录
+	UsernameAttribute    string               `json:"username_attribute"`  // 为空时使用 NameID
+	DisplayNameAttribute string               `json:"display_name_attribute"`
+	EmailAttribute       string               `json:"email_attribute"`
+	GroupAttribute       string               `json:"group_attribute"`
+	GroupRules           []DirectoryGroupRule `json:"group_rules"`   // 外部组到用户分组的映射，按顺序匹配
+	AdminGroups          []string             `json:"admin_groups"`  // 属于这些组的用户为管理员，为空则不同步角色
+	DefaultGroup         string               `json:"default_group"` // 未命中任何映射时的分组，为空则保持不变
+}
+
+// 默认配置
+var defaultSAMLSettings = SAMLSettings{
+	DisplayNameAttribute: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	EmailAttribute:       "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	GroupAttribute:       "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+	GroupRules:           []DirectoryGroupRule{},
+	AdminGroups:          []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("saml", &defaultSAMLSettings)
+}
+
+func GetSAMLSettings() *SAMLSettings {
+	return &defaultSAMLSettings
+}
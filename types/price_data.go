@@ -24,6 +24,22 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	PricingTier          string // 结算时命中的分段计费规则名称
+	PricingWindow        string // 请求时命中的定时计费规则名称
+	// 请求时命中的定时计费规则的倍率与倍数，结算时直接使用，不受请求期间修改规则的影响
+	PricingWindowModelRatio *float64
+	PricingWindowMultiplier *float64
+}
+
+// ApplyPricingWindowRatio 按请求时命中的定时计费规则调整倍率，未命中时原样返回
+func (p *PriceData) ApplyPricingWindowRatio(ratio float64) float64 {
+	if p.PricingWindowModelRatio != nil {
+		return *p.PricingWindowModelRatio
+	}
+	if p.PricingWindowMultiplier != nil {
+		return ratio * *p.PricingWindowMultiplier
+	}
+	return ratio
 }
 
 type PerCallPriceData struct {
@@ -208,6 +208,22 @@ function App() {
             </Suspense>
           }
         />
+        <Route
+          path='/oauth/oidc/:provider'
+          element={
+            <Suspense fallback={<Loading></Loading>} key={location.pathname}>
+              <OAuth2Callback type='oidc'></OAuth2Callback>
+            </Suspense>
+          }
+        />
+        <Route
+          path='/oauth/saml'
+          element={
+            <Suspense fallback={<Loading></Loading>} key={location.pathname}>
+              <OAuth2Callback type='saml'></OAuth2Callback>
+            </Suspense>
+          }
+        />
         <Route
           path='/oauth/linuxdo'
           element={
@@ -18,10 +18,11 @@ For commercial licensing, please contact support@quantumnous.com
 */
 
 import React, { useContext, useEffect } from 'react';
-import { useNavigate, useSearchParams } from 'react-router-dom';
+import { useNavigate, useParams, useSearchParams } from 'react-router-dom';
 import { useTranslation } from 'react-i18next';
 import {
   API,
+  getOAuthState,
   showError,
   showSuccess,
   updateAPI,
@@ -33,6 +34,9 @@ import Loading from '../common/ui/Loading';
 const OAuth2Callback = (props) => {
   const { t } = useTranslation();
   const [searchParams] = useSearchParams();
+  const { provider } = useParams();
+  // 具名 OIDC 提供方的回调地址为 /oauth/oidc/:provider
+  const type = provider ? `${props.type}/${provider}` : props.type;
   const [, userDispatch] = useContext(UserContext);
   const navigate = useNavigate();
 
@@ -42,7 +46,7 @@ const OAuth2Callback = (props) => {
   const sendCode = async (code, state, retry = 0) => {
     try {
       const { data: resData } = await API.get(
-        `/api/oauth/${props.type}?code=${code}&state=${state}`,
+        `/api/oauth/${type}?code=${code}&state=${state}`,
       );
 
       const { success, message, data } = resData;
@@ -76,6 +80,18 @@ const OAuth2Callback = (props) => {
   };
 
   useEffect(() => {
+    // IdP 发起的 SAML 登录没有绑定会话，重新发起 SP 登录
+    if (props.type === 'saml' && searchParams.get('restart')) {
+      getOAuthState().then((state) => {
+        if (state) {
+          window.location.href = `/api/saml/login?state=${state}`;
+        } else {
+          navigate('/login');
+        }
+      });
+      return;
+    }
+
     const code = searchParams.get('code');
     const state = searchParams.get('state');
 